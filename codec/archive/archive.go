@@ -0,0 +1,58 @@
+// Package archive implements a framed container format for binary encoded
+// events, for backups and bulk transfer of events between relays.
+//
+// A file starts with a header containing a magic string, a version and a flags
+// byte. Each record follows as a 4 byte little endian length prefix, the
+// event.T BinaryV2 encoding, and a CRC32C checksum of the encoding. A zero
+// length prefix marks the end of the records.
+//
+// If the index flag is set, the records are followed by an index of every
+// event ID with its record offset and created_at timestamp, sorted by
+// created_at, and a fixed size footer at the very end of the file that gives
+// the offset of the index and its checksum, so a reader can seek straight to
+// any event by its ID or to a range of timestamps.
+package archive
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	. "nostr.mleku.dev"
+
+	"github.com/minio/sha256-simd"
+)
+
+const (
+	// Version is the current version of the container format.
+	Version byte = 1
+	// MagicLen is the length of the header and footer magic strings.
+	MagicLen = 8
+	// HeaderLen is the length of the magic, version and flags.
+	HeaderLen = MagicLen + 2
+	// FooterLen is the length of the index offset, index checksum and footer
+	// magic at the end of an indexed file.
+	FooterLen = 8 + 4 + MagicLen
+	// EntryLen is the size of an index entry: event ID, record offset and
+	// created_at timestamp.
+	EntryLen = sha256.Size + 8 + 8
+	// MaxRecordLen is the largest record that will be accepted, anything
+	// bigger is treated as corruption.
+	MaxRecordLen = 1 << 26
+)
+
+const (
+	// FlagIndex indicates the file has an index and footer after the records.
+	FlagIndex byte = 1 << iota
+)
+
+var (
+	Magic       = B("NOSTRARC")
+	FooterMagic = B("NARCINDX")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksum returns the CRC32C of the provided bytes.
+func Checksum(b B) uint32 { return crc32.Checksum(b, castagnoli) }
+
+var le = binary.LittleEndian
@@ -0,0 +1,238 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/event/examples"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+)
+
+// cache returns every example event and the events as JSONL.
+func cache(t testing.TB) (evs []*event.T, jsonl B) {
+	scanner := bufio.NewScanner(bytes.NewBuffer(examples.Cache))
+	buf := make(B, 1_000_000)
+	scanner.Buffer(buf, len(buf))
+	for scanner.Scan() {
+		b := append(B{}, scanner.Bytes()...)
+		ev := event.New()
+		if _, err := ev.UnmarshalJSON(b); Chk.E(err) {
+			t.Fatal(err)
+		}
+		evs = append(evs, ev)
+		jsonl = append(jsonl, scanner.Bytes()...)
+		jsonl = append(jsonl, '\n')
+	}
+	return
+}
+
+func TestJSONLRoundTrip(t *testing.T) {
+	_, jsonl := cache(t)
+	for _, index := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		n, err := FromJSONL(buf, bytes.NewReader(jsonl), index)
+		if Chk.E(err) {
+			t.Fatal(err)
+		}
+		ar, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if Chk.E(err) {
+			t.Fatal(err)
+		}
+		if index && ar.Index.Len() != n {
+			t.Fatalf("index has %d entries, expected %d", ar.Index.Len(), n)
+		}
+		out := new(bytes.Buffer)
+		var m int
+		if m, err = ToJSONL(out, ar); Chk.E(err) {
+			t.Fatal(err)
+		}
+		if m != n {
+			t.Fatalf("wrote %d events, read back %d", n, m)
+		}
+		if !Equals(out.Bytes(), jsonl) {
+			t.Fatal("events read back from archive differ from original")
+		}
+	}
+}
+
+func TestGetAndRange(t *testing.T) {
+	buf := new(bytes.Buffer)
+	aw, err := NewWriter(buf, true)
+	if Chk.E(err) {
+		t.Fatal(err)
+	}
+	evs, _ := cache(t)
+	for _, ev := range evs {
+		if _, err = aw.Write(ev); Chk.E(err) {
+			t.Fatal(err)
+		}
+	}
+	if err = aw.Close(); Chk.E(err) {
+		t.Fatal(err)
+	}
+	ar, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if Chk.E(err) {
+		t.Fatal(err)
+	}
+	for _, ev := range evs {
+		var got *event.T
+		if got, err = ar.Get(ev.ID); Chk.E(err) {
+			t.Fatal(err)
+		}
+		if !Equals(got.Serialize(), ev.Serialize()) {
+			t.Fatalf("got\n%s\nexpected\n%s", got.Serialize(), ev.Serialize())
+		}
+	}
+	since, until := ar.Index.Since(), ar.Index.Until()
+	mid := timestamp.T((since + until) / 2)
+	var count int
+	for _, ev := range evs {
+		if *ev.CreatedAt >= mid {
+			count++
+		}
+	}
+	var rng []*event.T
+	if rng, err = ar.Range(&mid, nil); Chk.E(err) {
+		t.Fatal(err)
+	}
+	if len(rng) != count {
+		t.Fatalf("got %d events in range, expected %d", len(rng), count)
+	}
+	for i := range rng {
+		if *rng[i].CreatedAt < mid ||
+			(i > 0 && *rng[i].CreatedAt < *rng[i-1].CreatedAt) {
+			t.Fatalf("event %d out of order or range", i)
+		}
+	}
+}
+
+func TestMalformedTags(t *testing.T) {
+	evs, _ := cache(t)
+	ev := *evs[0]
+	upper := bytes.ToUpper(B(ev.PubKeyString()))
+	ev.Tags = tags.New(tag.New("e", "not hex"), tag.New(B("p"), upper),
+		tag.New("a", "30023:"+S(upper)+":x"), tag.New("a", "bogus"))
+	buf := new(bytes.Buffer)
+	aw, err := NewWriter(buf, true)
+	if Chk.E(err) {
+		t.Fatal(err)
+	}
+	if _, err = aw.Write(&ev); Chk.E(err) {
+		t.Fatal(err)
+	}
+	if err = aw.Close(); Chk.E(err) {
+		t.Fatal(err)
+	}
+	ar, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if Chk.E(err) {
+		t.Fatal(err)
+	}
+	var got *event.T
+	if got, err = ar.Get(ev.ID); Chk.E(err) {
+		t.Fatal(err)
+	}
+	if !Equals(got.Serialize(), ev.Serialize()) {
+		t.Fatalf("got\n%s\nexpected\n%s", got.Serialize(), ev.Serialize())
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	evs, _ := cache(t)
+	buf := new(bytes.Buffer)
+	aw, err := NewWriter(buf, false)
+	if Chk.E(err) {
+		t.Fatal(err)
+	}
+	if _, err = aw.Write(evs[0]); Chk.E(err) {
+		t.Fatal(err)
+	}
+	noTime := *evs[1]
+	noTime.CreatedAt = nil
+	if _, err = aw.Write(&noTime); err == nil {
+		t.Fatal("wrote an event with no created_at")
+	}
+	if err = aw.Close(); Chk.E(err) {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	// flip a bit in the middle of the first record
+	b[HeaderLen+40] ^= 1
+	var ar *Reader
+	ar, err = NewReader(bytes.NewReader(b), int64(len(b)))
+	if Chk.E(err) {
+		t.Fatal(err)
+	}
+	if _, _, err = ar.ReadAt(ar.First()); err == nil {
+		t.Fatal("expected checksum error")
+	}
+	// truncated record
+	b = buf.Bytes()[:HeaderLen+50]
+	if ar, err = NewReader(bytes.NewReader(b), int64(len(b))); Chk.E(err) {
+		t.Fatal(err)
+	}
+	if _, _, err = ar.ReadAt(ar.First()); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected unexpected EOF, got %v", err)
+	}
+}
+
+func FuzzReader(f *testing.F) {
+	evs, _ := cache(f)
+	for _, index := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		aw, _ := NewWriter(buf, index)
+		for _, ev := range evs[:5] {
+			_, _ = aw.Write(ev)
+		}
+		_ = aw.Close()
+		f.Add(buf.Bytes())
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ar, err := NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return
+		}
+		_ = ar.Scan(func(offset int64, ev *event.T) (stop bool) {
+			_, _ = ev.MarshalBinary(nil)
+			return
+		})
+		if ar.Index != nil {
+			for _, e := range ar.Index.Entries {
+				_, _ = ar.Get(e.ID)
+			}
+			_, _ = ar.Range(nil, nil)
+		}
+	})
+}
+
+func FuzzIndex(f *testing.F) {
+	idx := NewIndex()
+	for i := range 3 {
+		id := make(B, 32)
+		id[0] = byte(i)
+		idx.Add(id, int64(HeaderLen+i*100), timestamp.T(1700000000-i))
+	}
+	b, _ := idx.MarshalBinary(nil)
+	f.Add(b)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		idx := NewIndex()
+		if _, err := idx.UnmarshalBinary(b); err != nil {
+			return
+		}
+		m1, _ := idx.MarshalBinary(nil)
+		idx2 := NewIndex()
+		if _, err := idx2.UnmarshalBinary(m1); err != nil {
+			t.Fatalf("failed to decode own encoding: %v", err)
+		}
+		m2, _ := idx2.MarshalBinary(nil)
+		if !Equals(m1, m2) {
+			t.Fatalf("encoding not stable\nfirst %x\nsecond %x", m1, m2)
+		}
+	})
+}
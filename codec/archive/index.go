@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"sort"
+
+	. "nostr.mleku.dev"
+
+	"github.com/minio/sha256-simd"
+	"nostr.mleku.dev/codec/timestamp"
+)
+
+// Entry is the location and timestamp of a single event in an archive.
+type Entry struct {
+	ID        B
+	Offset    int64
+	CreatedAt timestamp.T
+}
+
+// Index is the footer index of an archive, sorted by created_at.
+type Index struct {
+	Entries []*Entry
+	ids     map[S]int
+}
+
+func NewIndex() (idx *Index) { return &Index{ids: make(map[S]int)} }
+
+// Add appends an entry to the index. Call Sort once all entries are added.
+func (idx *Index) Add(id B, offset int64, createdAt timestamp.T) {
+	idx.Entries = append(idx.Entries,
+		&Entry{ID: id, Offset: offset, CreatedAt: createdAt})
+}
+
+// Sort orders the entries by created_at, and then by offset, and rebuilds the
+// ID lookup table.
+func (idx *Index) Sort() {
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		if idx.Entries[i].CreatedAt == idx.Entries[j].CreatedAt {
+			return idx.Entries[i].Offset < idx.Entries[j].Offset
+		}
+		return idx.Entries[i].CreatedAt < idx.Entries[j].CreatedAt
+	})
+	idx.ids = make(map[S]int, len(idx.Entries))
+	for i := range idx.Entries {
+		idx.ids[S(idx.Entries[i].ID)] = i
+	}
+}
+
+func (idx *Index) Len() int { return len(idx.Entries) }
+
+// Find returns the record offset of the event with the given ID.
+func (idx *Index) Find(id B) (offset int64, found bool) {
+	var i int
+	if i, found = idx.ids[S(id)]; found {
+		offset = idx.Entries[i].Offset
+	}
+	return
+}
+
+// Since returns the oldest created_at in the index.
+func (idx *Index) Since() (t timestamp.T) {
+	if len(idx.Entries) > 0 {
+		t = idx.Entries[0].CreatedAt
+	}
+	return
+}
+
+// Until returns the newest created_at in the index.
+func (idx *Index) Until() (t timestamp.T) {
+	if len(idx.Entries) > 0 {
+		t = idx.Entries[len(idx.Entries)-1].CreatedAt
+	}
+	return
+}
+
+// Range returns the entries with created_at between since and until,
+// inclusive. A nil since or until leaves that end of the range open.
+func (idx *Index) Range(since, until *timestamp.T) (entries []*Entry) {
+	start, end := 0, len(idx.Entries)
+	if since != nil {
+		start = sort.Search(len(idx.Entries), func(i int) bool {
+			return idx.Entries[i].CreatedAt >= *since
+		})
+	}
+	if until != nil {
+		end = sort.Search(len(idx.Entries), func(i int) bool {
+			return idx.Entries[i].CreatedAt > *until
+		})
+	}
+	if start >= end {
+		return
+	}
+	return idx.Entries[start:end]
+}
+
+// MarshalBinary appends the entry count and each entry to dst.
+func (idx *Index) MarshalBinary(dst B) (b B, err E) {
+	b = le.AppendUint64(dst, uint64(len(idx.Entries)))
+	for _, e := range idx.Entries {
+		b = append(b, e.ID...)
+		b = le.AppendUint64(b, uint64(e.Offset))
+		b = le.AppendUint64(b, uint64(e.CreatedAt))
+	}
+	return
+}
+
+// UnmarshalBinary decodes an index, the IDs reference the provided buffer.
+func (idx *Index) UnmarshalBinary(b B) (r B, err E) {
+	if len(b) < 8 {
+		err = Errorf.E("index too short: %d", len(b))
+		return
+	}
+	n := le.Uint64(b)
+	r = b[8:]
+	if n > uint64(len(r)/EntryLen) {
+		err = Errorf.E("index count %d exceeds data length %d", n, len(r))
+		return
+	}
+	idx.Entries = make([]*Entry, n)
+	for i := range idx.Entries {
+		idx.Entries[i] = &Entry{
+			ID:        r[:sha256.Size],
+			Offset:    int64(le.Uint64(r[sha256.Size:])),
+			CreatedAt: timestamp.T(le.Uint64(r[sha256.Size+8:])),
+		}
+		r = r[EntryLen:]
+	}
+	idx.Sort()
+	return
+}
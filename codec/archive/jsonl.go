@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+)
+
+// FromJSONL reads line structured JSON events from src and writes them to an
+// archive in dst. Blank lines are skipped.
+func FromJSONL(dst io.Writer, src io.Reader, index bool) (n int, err E) {
+	var aw *Writer
+	if aw, err = NewWriter(dst, index); Chk.E(err) {
+		return
+	}
+	br := bufio.NewReader(src)
+	var line B
+	for {
+		// ReadBytes allocates a new slice each time, which is needed because
+		// the decoded event references the buffer it was decoded from.
+		if line, err = br.ReadBytes('\n'); err != nil && err != io.EOF {
+			return
+		}
+		eof := err == io.EOF
+		err = nil
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			ev := event.New()
+			if _, err = ev.UnmarshalJSON(line); Chk.E(err) {
+				err = Errorf.E("line %d: %s", n+1, err)
+				return
+			}
+			if _, err = aw.Write(ev); Chk.E(err) {
+				return
+			}
+			n++
+		}
+		if eof {
+			break
+		}
+	}
+	err = aw.Close()
+	return
+}
+
+// ToJSONL writes every event in the archive to dst as line structured JSON in
+// the order they were written.
+func ToJSONL(dst io.Writer, ar *Reader) (n int, err E) {
+	var b B
+	var werr E
+	if err = ar.Scan(func(_ int64, ev *event.T) bool {
+		if b, werr = ev.MarshalJSON(b[:0]); Chk.E(werr) {
+			return true
+		}
+		b = append(b, '\n')
+		if _, werr = dst.Write(b); Chk.E(werr) {
+			return true
+		}
+		n++
+		return false
+	}); Chk.E(err) {
+		return
+	}
+	err = werr
+	return
+}
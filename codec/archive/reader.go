@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"io"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/timestamp"
+)
+
+// Reader provides sequential and random access to the events in an archive.
+type Reader struct {
+	r       io.ReaderAt
+	size    int64
+	Version byte
+	Flags   byte
+	// Index is nil if the archive was written without one.
+	Index *Index
+}
+
+// NewReader checks the header of the archive and loads the index if there is
+// one.
+func NewReader(r io.ReaderAt, size int64) (ar *Reader, err E) {
+	ar = &Reader{r: r, size: size}
+	hdr := make(B, HeaderLen)
+	if err = ar.readAt(hdr, 0); Chk.E(err) {
+		return
+	}
+	if !Equals(hdr[:MagicLen], Magic) {
+		err = Errorf.E("not an event archive, magic is '%s'", hdr[:MagicLen])
+		return
+	}
+	ar.Version, ar.Flags = hdr[MagicLen], hdr[MagicLen+1]
+	if ar.Version != Version {
+		err = Errorf.E("unsupported archive version %d", ar.Version)
+		return
+	}
+	if ar.Flags&FlagIndex != 0 {
+		if err = ar.loadIndex(); Chk.E(err) {
+			return
+		}
+	}
+	return
+}
+
+func (ar *Reader) loadIndex() (err E) {
+	if ar.size < int64(HeaderLen+4+FooterLen) {
+		err = Errorf.E("archive too short for index: %d", ar.size)
+		return
+	}
+	footer := make(B, FooterLen)
+	if err = ar.readAt(footer, ar.size-int64(FooterLen)); Chk.E(err) {
+		return
+	}
+	if !Equals(footer[12:], FooterMagic) {
+		err = Errorf.E("archive index footer missing, truncated file?")
+		return
+	}
+	start := int64(le.Uint64(footer))
+	end := ar.size - int64(FooterLen)
+	if start < int64(HeaderLen) || start > end {
+		err = Errorf.E("archive index offset %d out of range", start)
+		return
+	}
+	idx := make(B, end-start)
+	if err = ar.readAt(idx, start); Chk.E(err) {
+		return
+	}
+	if sum := Checksum(idx); sum != le.Uint32(footer[8:]) {
+		err = Errorf.E("archive index checksum mismatch, got %08x expected %08x",
+			sum, le.Uint32(footer[8:]))
+		return
+	}
+	ar.Index = NewIndex()
+	if _, err = ar.Index.UnmarshalBinary(idx); Chk.E(err) {
+		return
+	}
+	return
+}
+
+// readAt fills b from offset, a short read is an io.ErrUnexpectedEOF.
+func (ar *Reader) readAt(b B, offset int64) (err E) {
+	var n int
+	if n, err = ar.r.ReadAt(b, offset); n == len(b) {
+		err = nil
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// First returns the offset of the first record.
+func (ar *Reader) First() int64 { return int64(HeaderLen) }
+
+// ReadAt decodes the record at offset and returns the offset of the following
+// record. At the end of the records ev is nil and err is io.EOF.
+func (ar *Reader) ReadAt(offset int64) (ev *event.T, next int64, err E) {
+	pre := make(B, 4)
+	if err = ar.readAt(pre, offset); err != nil {
+		return
+	}
+	l := le.Uint32(pre)
+	if l == 0 {
+		err = io.EOF
+		return
+	}
+	if l > MaxRecordLen {
+		err = Errorf.E("record at %d has invalid length %d", offset, l)
+		return
+	}
+	rec := make(B, l+4)
+	if err = ar.readAt(rec, offset+4); err != nil {
+		return
+	}
+	if sum := Checksum(rec[:l]); sum != le.Uint32(rec[l:]) {
+		err = Errorf.E("record at %d checksum mismatch, got %08x expected %08x",
+			offset, sum, le.Uint32(rec[l:]))
+		return
+	}
+	ev = event.New()
+	var rem B
+	if rem, err = ev.UnmarshalBinary(rec[:l]); Chk.E(err) {
+		ev = nil
+		return
+	}
+	if len(rem) > 0 {
+		err = Errorf.E("record at %d has %d bytes after the event", offset,
+			len(rem))
+		ev = nil
+		return
+	}
+	next = offset + 4 + int64(l) + 4
+	return
+}
+
+// Scan calls fn with each event in the archive in the order they were written,
+// until fn returns true or the end of the records.
+func (ar *Reader) Scan(fn func(offset int64, ev *event.T) (stop bool)) (err E) {
+	var ev *event.T
+	for offset, next := ar.First(), int64(0); ; offset = next {
+		if ev, next, err = ar.ReadAt(offset); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if fn(offset, ev) {
+			return
+		}
+	}
+}
+
+// Get returns the event with the given ID using the index. If the archive has
+// no index it falls back to scanning.
+func (ar *Reader) Get(id B) (ev *event.T, err E) {
+	if ar.Index == nil {
+		if err = ar.Scan(func(_ int64, e *event.T) bool {
+			if Equals(e.ID, id) {
+				ev = e
+				return true
+			}
+			return false
+		}); Chk.E(err) {
+			return
+		}
+	} else if offset, found := ar.Index.Find(id); found {
+		if ev, _, err = ar.ReadAt(offset); Chk.E(err) {
+			return
+		}
+	}
+	if ev == nil {
+		err = Errorf.E("event %0x not found in archive", id)
+	}
+	return
+}
+
+// Range returns the events with created_at between since and until inclusive,
+// in ascending created_at order. A nil since or until leaves that end of the
+// range open. This requires an index.
+func (ar *Reader) Range(since, until *timestamp.T) (evs []*event.T, err E) {
+	if ar.Index == nil {
+		err = Errorf.E("archive has no index")
+		return
+	}
+	for _, e := range ar.Index.Range(since, until) {
+		var ev *event.T
+		if ev, _, err = ar.ReadAt(e.Offset); Chk.E(err) {
+			return
+		}
+		evs = append(evs, ev)
+	}
+	return
+}
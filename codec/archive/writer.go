@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"io"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+)
+
+// Writer appends framed events to an archive.
+type Writer struct {
+	w     io.Writer
+	pos   int64
+	flags byte
+	index *Index
+	buf   B
+}
+
+// NewWriter writes the archive header to w and returns a Writer, if index is
+// true an index and footer is written when the Writer is closed.
+func NewWriter(w io.Writer, index bool) (aw *Writer, err E) {
+	aw = &Writer{w: w}
+	if index {
+		aw.flags |= FlagIndex
+		aw.index = NewIndex()
+	}
+	hdr := make(B, 0, HeaderLen)
+	hdr = append(hdr, Magic...)
+	hdr = append(hdr, Version, aw.flags)
+	if err = aw.write(hdr); Chk.E(err) {
+		return
+	}
+	return
+}
+
+func (aw *Writer) write(b B) (err E) {
+	var n int
+	n, err = aw.w.Write(b)
+	aw.pos += int64(n)
+	return
+}
+
+// Write appends an event record to the archive and returns the offset it was
+// written at.
+func (aw *Writer) Write(ev *event.T) (offset int64, err E) {
+	offset = aw.pos
+	if ev.CreatedAt == nil {
+		err = Errorf.E("event %0x has no created_at", ev.ID)
+		return
+	}
+	// leave space for the length prefix. BinaryV2 stores fields it can't
+	// compress as literals, so it encodes any event that has a created_at.
+	aw.buf = append(aw.buf[:0], 0, 0, 0, 0)
+	if aw.buf, err = ev.MarshalBinaryVersion(aw.buf, event.BinaryV2); Chk.E(err) {
+		return
+	}
+	l := len(aw.buf) - 4
+	if l > MaxRecordLen {
+		err = Errorf.E("event too large for archive record: %d > %d", l,
+			MaxRecordLen)
+		return
+	}
+	le.PutUint32(aw.buf, uint32(l))
+	aw.buf = le.AppendUint32(aw.buf, Checksum(aw.buf[4:]))
+	if err = aw.write(aw.buf); Chk.E(err) {
+		return
+	}
+	if aw.index != nil {
+		id := make(B, len(ev.ID))
+		copy(id, ev.ID)
+		aw.index.Add(id, offset, *ev.CreatedAt)
+	}
+	return
+}
+
+// Close writes the end of records marker, and the index and footer if the
+// archive is indexed. It does not close the underlying io.Writer.
+func (aw *Writer) Close() (err E) {
+	if err = aw.write(B{0, 0, 0, 0}); Chk.E(err) {
+		return
+	}
+	if aw.index == nil {
+		return
+	}
+	start := aw.pos
+	aw.index.Sort()
+	var idx B
+	if idx, err = aw.index.MarshalBinary(aw.buf[:0]); Chk.E(err) {
+		return
+	}
+	footer := le.AppendUint64(nil, uint64(start))
+	footer = le.AppendUint32(footer, Checksum(idx))
+	footer = append(footer, FooterMagic...)
+	if err = aw.write(append(idx, footer...)); Chk.E(err) {
+		return
+	}
+	return
+}
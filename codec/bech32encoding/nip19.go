@@ -22,6 +22,8 @@ var (
 	NprofileHRP = B("nprofile")
 	NeventHRP   = B("nevent")
 	NentityHRP  = B("naddr")
+	// NcryptsecHRP is the prefix of a NIP-49 password encrypted secret key.
+	NcryptsecHRP = B("ncryptsec")
 )
 
 func DecodeToString(bech32String B) (prefix, value B, err E) {
@@ -57,6 +59,8 @@ func Decode(bech32string B) (prefix B, value any, err E) {
 		b := make(B, schnorr.PubKeyBytesLen*2)
 		hex.EncBytes(b, data[:32])
 		return prefix, b, nil
+	case Equals(prefix, NcryptsecHRP):
+		return prefix, data, nil
 	case Equals(prefix, NprofileHRP):
 		var result pointers.Profile
 		curr := 0
@@ -110,6 +114,9 @@ func Decode(bech32string B) (prefix B, value any, err E) {
 				result.Author = make(B, schnorr.PubKeyBytesLen*2)
 				hex.EncBytes(result.Author, v)
 			case TLVKind:
+				if len(v) != 4 {
+					return prefix, nil, Errorf.E("kind is not 4 bytes (%d)", len(v))
+				}
 				result.Kind = kind.New(binary.BigEndian.Uint32(v))
 			default:
 				// ignore
@@ -123,7 +130,7 @@ func Decode(bech32string B) (prefix B, value any, err E) {
 			t, v := readTLVEntry(data[curr:])
 			if v == nil {
 				// end here
-				if result.Kind.ToU16() == 0 ||
+				if result.Kind == nil || result.Kind.ToU16() == 0 ||
 					len(result.Identifier) < 1 ||
 					len(result.PublicKey) < 1 {
 
@@ -143,6 +150,9 @@ func Decode(bech32string B) (prefix B, value any, err E) {
 				result.PublicKey = make(B, schnorr.PubKeyBytesLen*2)
 				hex.EncBytes(result.PublicKey, v)
 			case TLVKind:
+				if len(v) != 4 {
+					return prefix, nil, Errorf.E("kind is not 4 bytes (%d)", len(v))
+				}
 				result.Kind = kind.New(binary.BigEndian.Uint32(v))
 			default:
 				Log.D.Ln("got a bogus TLV type code", t)
@@ -232,3 +242,28 @@ func EncodeEntity(pk B, k *kind.T, id B, relays []B) (s B, err E) {
 	}
 	return bech32.Encode(NentityHRP, bits5)
 }
+
+// EncodeNcryptsec encodes a NIP-49 encrypted secret key payload, see
+// encryption.EncryptSecretKey.
+func EncodeNcryptsec(payload B) (s B, err E) {
+	var bits5 []byte
+	if bits5, err = bech32.ConvertBits(payload, 8, 5, true); Chk.D(err) {
+		return nil, Errorf.E("failed to convert bits: %w", err)
+	}
+	return bech32.Encode(NcryptsecHRP, bits5)
+}
+
+// DecodeNcryptsec returns the NIP-49 encrypted secret key payload of an
+// ncryptsec string.
+func DecodeNcryptsec(ncryptsec B) (payload B, err E) {
+	var prefix B
+	var value any
+	if prefix, value, err = Decode(ncryptsec); Chk.D(err) {
+		return
+	}
+	if !Equals(prefix, NcryptsecHRP) {
+		return nil, Errorf.E("expected %s prefix, got %s", NcryptsecHRP, prefix)
+	}
+	payload = value.(B)
+	return
+}
@@ -17,6 +17,9 @@ func readTLVEntry(data []byte) (typ uint8, value []byte) {
 	}
 	typ = data[0]
 	length := int(data[1])
+	if len(data) < 2+length {
+		return
+	}
 	value = data[2 : 2+length]
 	return
 }
@@ -0,0 +1,377 @@
+// Package bolt11 decodes and encodes BOLT11 lightning invoices, as far as zaps
+// need them: the amount, payment hash, description or its hash, expiry and the
+// payee that signed it.
+package bolt11
+
+import (
+	"crypto/rand"
+	"math"
+	"strconv"
+	"strings"
+
+	"ec.mleku.dev/v2/bech32"
+	"ec.mleku.dev/v2/secp256k1"
+	"github.com/minio/sha256-simd"
+	. "nostr.mleku.dev"
+)
+
+// The types of the tagged fields.
+const (
+	PaymentHash     = 1
+	Routing         = 3
+	Features        = 5
+	Expiry          = 6
+	Fallback        = 9
+	Description     = 13
+	PaymentSecret   = 16
+	Payee           = 19
+	DescriptionHash = 23
+	MinFinalCLTV    = 24
+	Metadata        = 27
+)
+
+const (
+	// DefaultExpiry is the expiry in seconds of an invoice without an expiry field.
+	DefaultExpiry = 3600
+	// DefaultMinFinalCLTV is the min_final_cltv_expiry of an invoice without one.
+	DefaultMinFinalCLTV = 18
+	// sigLen is the length of the signature in 5 bit groups.
+	sigLen = 104
+)
+
+// T is a decoded invoice.
+type T struct {
+	// Network is the currency prefix, such as bc for bitcoin mainnet.
+	Network S
+	// MSat is the amount in millisatoshis, or zero if the invoice has none.
+	MSat int64
+	// Timestamp is the UNIX time the invoice was created.
+	Timestamp int64
+	// PaymentHash is the 32 byte hash of the preimage.
+	PaymentHash B
+	// PaymentSecret is the 32 byte payment secret, if there is one.
+	PaymentSecret B
+	// Description is the purpose of the payment, if there is one.
+	Description S
+	// DescriptionHash is the 32 byte SHA256 hash of a longer description, if
+	// there is one.
+	DescriptionHash B
+	// Payee is the 33 byte compressed public key of the node that signed it.
+	Payee B
+	// Expiry is how many seconds after Timestamp the invoice expires.
+	Expiry int64
+	// MinFinalCLTV is the min_final_cltv_expiry of the last hop.
+	MinFinalCLTV int64
+	// Signature is the 64 byte compact signature and the recovery id.
+	Signature B
+}
+
+// multipliers are the divisors of bitcoin of the amount suffixes, in msat.
+var multipliers = map[byte]int64{'m': 100_000_000, 'u': 100_000, 'n': 100, 'p': 0}
+
+// parseHRP reads the network and amount from the human readable part.
+func parseHRP(hrp S) (network S, msat int64, err E) {
+	if !strings.HasPrefix(hrp, "ln") {
+		err = Errorf.E("invoice prefix '%s' does not start with ln", hrp)
+		return
+	}
+	hrp = hrp[2:]
+	i := strings.IndexAny(hrp, "0123456789")
+	if i < 0 {
+		return hrp, 0, nil
+	}
+	network, hrp = hrp[:i], hrp[i:]
+	if network == "" {
+		err = Errorf.E("invoice has no network")
+		return
+	}
+	var mult int64 = -1
+	if m, ok := multipliers[hrp[len(hrp)-1]]; ok {
+		mult, hrp = m, hrp[:len(hrp)-1]
+	}
+	var n uint64
+	if n, err = strconv.ParseUint(hrp, 10, 63); err != nil || (len(hrp) > 1 && hrp[0] == '0') {
+		err = Errorf.E("invalid invoice amount '%s'", hrp)
+		return
+	}
+	switch mult {
+	case -1:
+		if n > math.MaxInt64/100_000_000_000 {
+			err = Errorf.E("invoice amount is too large")
+			return
+		}
+		msat = int64(n) * 100_000_000_000
+	case 0:
+		// picobitcoin are tenths of msat.
+		if n%10 != 0 {
+			err = Errorf.E("amount of %dp is not a whole number of msat", n)
+			return
+		}
+		msat = int64(n / 10)
+	default:
+		if n > uint64(math.MaxInt64/mult) {
+			err = Errorf.E("invoice amount is too large")
+			return
+		}
+		msat = int64(n) * mult
+	}
+	return
+}
+
+// encodeAmount returns the shortest amount of the human readable part.
+func encodeAmount(msat int64) S {
+	if msat%100_000_000_000 == 0 {
+		return strconv.FormatInt(msat/100_000_000_000, 10)
+	}
+	for _, m := range []byte("mun") {
+		if msat%multipliers[m] == 0 {
+			return strconv.FormatInt(msat/multipliers[m], 10) + string(m)
+		}
+	}
+	return strconv.FormatInt(msat*10, 10) + "p"
+}
+
+// readUint reads 5 bit groups as a big endian number.
+func readUint(groups B) (n int64) {
+	for _, g := range groups {
+		n = n<<5 | int64(g)
+	}
+	return
+}
+
+// putUint appends a number as 5 bit groups, at least min of them.
+func putUint(dst B, n int64, min N) B {
+	var groups B
+	for n > 0 || len(groups) < min {
+		groups = append(B{byte(n & 31)}, groups...)
+		n >>= 5
+	}
+	return append(dst, groups...)
+}
+
+// Decode decodes an invoice and recovers the payee from the signature, or checks
+// the signature against the payee field if there is one.
+func Decode(invoice S) (inv *T, err E) {
+	invoice = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(invoice, "lightning:"),
+		"LIGHTNING:"))
+	var hrp, data B
+	if hrp, data, err = bech32.DecodeNoLimit(B(invoice)); err != nil {
+		err = Errorf.E("invalid invoice: %w", err)
+		return
+	}
+	if len(data) < 7+sigLen {
+		err = Errorf.E("invoice is too short")
+		return
+	}
+	inv = &T{Expiry: DefaultExpiry, MinFinalCLTV: DefaultMinFinalCLTV}
+	if inv.Network, inv.MSat, err = parseHRP(S(hrp)); err != nil {
+		return nil, err
+	}
+	fields := data[:len(data)-sigLen]
+	if inv.Signature, err = bech32.ConvertBits(data[len(data)-sigLen:], 5, 8,
+		false); err != nil || len(inv.Signature) != 65 {
+		return nil, Errorf.E("invalid invoice signature")
+	}
+	inv.Timestamp = readUint(fields[:7])
+	for rest := fields[7:]; len(rest) > 0; {
+		if len(rest) < 3 {
+			return nil, Errorf.E("truncated invoice field")
+		}
+		typ, l := rest[0], N(readUint(rest[1:3]))
+		if len(rest) < 3+l {
+			return nil, Errorf.E("invoice field %d is truncated", typ)
+		}
+		v := rest[3 : 3+l]
+		rest = rest[3+l:]
+		// fields of the wrong length are skipped as BOLT11 requires.
+		switch typ {
+		case PaymentHash, PaymentSecret, DescriptionHash:
+			if l != 52 {
+				continue
+			}
+			var b B
+			if b, err = bech32.ConvertBits(v, 5, 8, false); err != nil {
+				return nil, Errorf.E("invalid invoice field %d: %w", typ, err)
+			}
+			switch typ {
+			case PaymentHash:
+				inv.PaymentHash = b
+			case PaymentSecret:
+				inv.PaymentSecret = b
+			default:
+				inv.DescriptionHash = b
+			}
+		case Payee:
+			if l != 53 {
+				continue
+			}
+			if inv.Payee, err = bech32.ConvertBits(v, 5, 8, false); err != nil {
+				return nil, Errorf.E("invalid invoice payee: %w", err)
+			}
+		case Description:
+			var b B
+			if b, err = bech32.ConvertBits(v, 5, 8, false); err != nil {
+				return nil, Errorf.E("invalid invoice description: %w", err)
+			}
+			inv.Description = S(b)
+		case Expiry:
+			inv.Expiry = readUint(v)
+		case MinFinalCLTV:
+			inv.MinFinalCLTV = readUint(v)
+		}
+	}
+	if inv.PaymentHash == nil {
+		return nil, Errorf.E("invoice has no payment hash")
+	}
+	var pub B
+	if pub, err = recoverPubKey(sigHash(hrp, fields), inv.Signature); err != nil {
+		return nil, err
+	}
+	if inv.Payee != nil && !Equals(pub, inv.Payee) {
+		return nil, Errorf.E("invoice is not signed by its payee")
+	}
+	inv.Payee = pub
+	return
+}
+
+// sigHash is the hash an invoice signs: the human readable part and the fields
+// as bytes.
+func sigHash(hrp, fields B) (h B) {
+	b, _ := bech32.ConvertBits(fields, 5, 8, true)
+	s := sha256.Sum256(append(append(B{}, hrp...), b...))
+	return s[:]
+}
+
+// Encode signs the invoice with a 32 byte secret key and encodes it. The payee is
+// set to the public key of the secret key.
+func (inv *T) Encode(sec B) (invoice S, err E) {
+	if len(inv.PaymentHash) != 32 {
+		err = Errorf.E("payment hash must be 32 bytes")
+		return
+	}
+	hrp := "ln" + inv.Network
+	if inv.MSat > 0 {
+		hrp += encodeAmount(inv.MSat)
+	}
+	fields := putUint(nil, inv.Timestamp, 7)
+	addBytes := func(typ byte, b B) {
+		g, _ := bech32.ConvertBits(b, 8, 5, true)
+		fields = putUint(append(fields, typ), int64(len(g)), 2)
+		fields = append(fields, g...)
+	}
+	addUint := func(typ byte, n int64) {
+		g := putUint(nil, n, 1)
+		fields = putUint(append(fields, typ), int64(len(g)), 2)
+		fields = append(fields, g...)
+	}
+	addBytes(PaymentHash, inv.PaymentHash)
+	if inv.PaymentSecret != nil {
+		addBytes(PaymentSecret, inv.PaymentSecret)
+	}
+	if inv.DescriptionHash != nil {
+		addBytes(DescriptionHash, inv.DescriptionHash)
+	} else {
+		addBytes(Description, B(inv.Description))
+	}
+	if inv.Expiry != DefaultExpiry {
+		addUint(Expiry, inv.Expiry)
+	}
+	if inv.MinFinalCLTV != DefaultMinFinalCLTV {
+		addUint(MinFinalCLTV, inv.MinFinalCLTV)
+	}
+	if inv.Signature, inv.Payee, err = sign(sigHash(B(hrp), fields), sec); err != nil {
+		return
+	}
+	sig, _ := bech32.ConvertBits(inv.Signature, 8, 5, true)
+	var b B
+	if b, err = bech32.Encode(B(hrp), append(fields, sig...)); err != nil {
+		return
+	}
+	return S(b), nil
+}
+
+// ExpiresAt returns the UNIX time the invoice expires.
+func (inv *T) ExpiresAt() int64 { return inv.Timestamp + inv.Expiry }
+
+// sign makes a recoverable ECDSA signature, r and s followed by the recovery id,
+// and returns the compressed public key of sec.
+func sign(hash, sec B) (sig, pub B, err E) {
+	var d, e secp256k1.ModNScalar
+	if overflow := d.SetByteSlice(sec); overflow || d.IsZero() || len(sec) != 32 {
+		return nil, nil, Errorf.E("invalid secret key")
+	}
+	e.SetByteSlice(hash)
+	var p secp256k1.JacobianPoint
+	secp256k1.ScalarBaseMultNonConst(&d, &p)
+	p.ToAffine()
+	pub = secp256k1.NewPublicKey(&p.X, &p.Y).SerializeCompressed()
+	for {
+		kb := make(B, 32)
+		if _, err = rand.Read(kb); err != nil {
+			return
+		}
+		var k, r secp256k1.ModNScalar
+		if overflow := k.SetByteSlice(kb); overflow || k.IsZero() {
+			continue
+		}
+		var rp secp256k1.JacobianPoint
+		secp256k1.ScalarBaseMultNonConst(&k, &rp)
+		rp.ToAffine()
+		x := rp.X.Bytes()
+		if overflow := r.SetByteSlice(x[:]); overflow || r.IsZero() {
+			continue
+		}
+		recid := byte(0)
+		if rp.Y.IsOdd() {
+			recid = 1
+		}
+		// s = k⁻¹(e + rd), with the low s that negates R.
+		s := new(secp256k1.ModNScalar).Mul2(&r, &d)
+		s.Add(&e).Mul(k.InverseNonConst())
+		if s.IsZero() {
+			continue
+		}
+		if s.IsOverHalfOrder() {
+			s.Negate()
+			recid ^= 1
+		}
+		rb, sb := r.Bytes(), s.Bytes()
+		sig = append(append(append(make(B, 0, 65), rb[:]...), sb[:]...), recid)
+		return
+	}
+}
+
+// recoverPubKey returns the compressed public key that made a recoverable
+// signature of hash.
+func recoverPubKey(hash, sig B) (pub B, err E) {
+	var r, s, e secp256k1.ModNScalar
+	if overflow := r.SetByteSlice(sig[:32]); overflow || r.IsZero() {
+		return nil, Errorf.E("invalid invoice signature")
+	}
+	if overflow := s.SetByteSlice(sig[32:64]); overflow || s.IsZero() {
+		return nil, Errorf.E("invalid invoice signature")
+	}
+	if sig[64] > 1 {
+		return nil, Errorf.E("unsupported recovery id %d", sig[64])
+	}
+	e.SetByteSlice(hash)
+	rb := r.Bytes()
+	var rpub *secp256k1.PublicKey
+	if rpub, err = secp256k1.ParsePubKey(append(B{2 + sig[64]}, rb[:]...)); err != nil {
+		return nil, Errorf.E("invalid invoice signature: %w", err)
+	}
+	// Q = r⁻¹(sR - eG)
+	var rp, sr, eg, q secp256k1.JacobianPoint
+	rpub.AsJacobian(&rp)
+	rinv := new(secp256k1.ModNScalar).Set(&r).InverseNonConst()
+	u1 := new(secp256k1.ModNScalar).Mul2(&e, rinv).Negate()
+	u2 := new(secp256k1.ModNScalar).Mul2(&s, rinv)
+	secp256k1.ScalarBaseMultNonConst(u1, &eg)
+	secp256k1.ScalarMultNonConst(u2, &rp, &sr)
+	secp256k1.AddNonConst(&eg, &sr, &q)
+	if q.Z.IsZero() {
+		return nil, Errorf.E("invalid invoice signature")
+	}
+	q.ToAffine()
+	return secp256k1.NewPublicKey(&q.X, &q.Y).SerializeCompressed(), nil
+}
@@ -0,0 +1,76 @@
+package bolt11
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"github.com/minio/sha256-simd"
+	"lukechampine.com/frand"
+	"util.mleku.dev/hex"
+)
+
+// coffee is the "1 cup coffee" example of BOLT11.
+const coffee = "lnbc2500u1pvjluezsp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygspp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpu9qrsgquk0rl77nj30yxdy8j9vdx85fkpmdla2087ne0xh8nhedh8w27kyke0lp53ut353s06fv3qfegext0eh0ymjpf39tuven09sam30g4vgpfna3rh"
+
+func TestDecode(t *testing.T) {
+	inv, err := Decode(coffee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Network != "bc" || inv.MSat != 250_000_000 || inv.Timestamp != 1496314658 ||
+		inv.Description != "1 cup coffee" || inv.Expiry != 60 ||
+		hex.Enc(inv.PaymentHash) != "0001020304050607080900010203040506070809000102030405060708090102" ||
+		hex.Enc(inv.Payee) != "03e7156ae33b0a208d0744199163177e909e80176e55d97a2f221ede0f934dd9ad" {
+		t.Fatalf("unexpected invoice %+v", inv)
+	}
+	// any change breaks the checksum or the signature.
+	b := B(coffee)
+	b[len(b)-10] = 'q'
+	if _, err = Decode(S(b)); err == nil {
+		t.Fatal("expected an error for a tampered invoice")
+	}
+}
+
+func TestAmounts(t *testing.T) {
+	for hrp, msat := range map[S]int64{"lnbc": 0, "lnbc1": 100_000_000_000,
+		"lnbc2500u": 250_000_000, "lnbc20m": 2_000_000_000, "lnbc10n": 1000,
+		"lnbc10p": 1, "lntb1500n": 150_000, "lnbcrt5u": 500_000} {
+		if _, got, err := parseHRP(hrp); err != nil || got != msat {
+			t.Fatalf("%s: got %d msat expected %d: %v", hrp, got, msat, err)
+		}
+		if msat > 0 && hrp != "lnbcrt5u" {
+			if got := encodeAmount(msat); "lnbc"+got != hrp && "lntb"+got != hrp {
+				t.Fatalf("%d msat encoded to %s", msat, got)
+			}
+		}
+	}
+	for _, hrp := range []S{"lnbc1x", "lnbc05u", "lnbc1p", "bc1", "ln1"} {
+		if _, _, err := parseHRP(hrp); err == nil {
+			t.Fatalf("expected an error for %s", hrp)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	sec := frand.Bytes(32)
+	h := sha256.Sum256(B(`{"kind":9734}`))
+	for _, msat := range []int64{21_000, 1, 123_456_789, 0} {
+		inv := &T{Network: "bc", MSat: msat, Timestamp: 1700000000,
+			PaymentHash: frand.Bytes(32), PaymentSecret: frand.Bytes(32),
+			DescriptionHash: h[:], Expiry: 600, MinFinalCLTV: DefaultMinFinalCLTV}
+		s, err := inv.Encode(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got *T
+		if got, err = Decode(s); err != nil {
+			t.Fatal(err)
+		}
+		if got.MSat != msat || got.Expiry != 600 || got.ExpiresAt() != 1700000600 ||
+			!Equals(got.DescriptionHash, h[:]) || !Equals(got.PaymentHash, inv.PaymentHash) ||
+			!Equals(got.PaymentSecret, inv.PaymentSecret) || !Equals(got.Payee, inv.Payee) {
+			t.Fatalf("got %+v expected %+v", got, inv)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package content
+
+import (
+	"bytes"
+	"strconv"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/bech32encoding/pointers"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+)
+
+// Tags returns the tags NIP-27 expects for the references in content that t
+// does not have yet: a p tag for each profile, an e tag for each event, an a tag
+// for each addressable event and a t tag for each hashtag. Legacy mentions
+// already refer to a tag so they don't add any.
+func Tags(content B, t *tags.T) (add []*tag.T) {
+	if t == nil {
+		t = tags.New()
+	}
+	has := func(k, v B) bool {
+		for _, ts := range [][]*tag.T{t.T, add} {
+			for _, tt := range ts {
+				if tt != nil && Equals(tt.Key(), k) && Equals(tt.Value(), v) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, s := range Parse(content, t) {
+		var tt *tag.T
+		switch s.Type {
+		case URI:
+			tt = PointerTag(s.Pointer)
+		case Hashtag:
+			tt = tag.New(B("t"), bytes.ToLower(s.Text[1:]))
+		}
+		if tt != nil && !has(tt.Key(), tt.Value()) {
+			add = append(add, tt)
+		}
+	}
+	return
+}
+
+// AddTags appends the tags for the references in the content of ev to its tags,
+// see Tags. The event must be signed again afterwards.
+func AddTags(ev *event.T) {
+	if ev.Tags == nil {
+		ev.Tags = tags.New()
+	}
+	ev.Tags.T = append(ev.Tags.T, Tags(ev.Content, ev.Tags)...)
+}
+
+// PointerTag returns the p, e or a tag for a *pointers.Profile, *pointers.Event
+// or *pointers.Entity, with the first relay as the relay hint.
+func PointerTag(p any) (t *tag.T) {
+	relay := func(relays []B) []B {
+		if len(relays) > 0 {
+			return relays[:1]
+		}
+		return nil
+	}
+	switch v := p.(type) {
+	case *pointers.Profile:
+		return tag.New(append([]B{B("p"), v.PublicKey}, relay(v.Relays)...)...)
+	case *pointers.Event:
+		return tag.New(append([]B{B("e"), v.ID.ByteString(nil)},
+			relay(v.Relays)...)...)
+	case *pointers.Entity:
+		var a B
+		if v.Kind != nil {
+			a = strconv.AppendUint(a, v.Kind.ToU64(), 10)
+		} else {
+			a = append(a, '0')
+		}
+		a = append(a, ':')
+		a = append(a, v.PublicKey...)
+		a = append(a, ':')
+		a = append(a, v.Identifier...)
+		return tag.New(append([]B{B("a"), a}, relay(v.Relays)...)...)
+	}
+	return
+}
+
+// Render appends content to dst with every span that is not Text replaced by
+// what fn appends for it. fn can append s.Text to leave a span as it is.
+func Render(dst, content B, t *tags.T, fn func(dst B, s *Span) B) B {
+	for _, s := range Parse(content, t) {
+		if s.Type == Text {
+			dst = append(dst, s.Text...)
+			continue
+		}
+		dst = fn(dst, &s)
+	}
+	return dst
+}
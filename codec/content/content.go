@@ -0,0 +1,321 @@
+// Package content finds the references inside the content of an event: NIP-21
+// nostr: URIs, URLs, hashtags, NIP-30 custom emoji and the legacy NIP-08 #[n]
+// mentions, and adds the tags NIP-27 expects for them when composing.
+package content
+
+import (
+	"bytes"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/bech32encoding"
+	"nostr.mleku.dev/codec/bech32encoding/pointers"
+	"nostr.mleku.dev/codec/eventid"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"util.mleku.dev/hex"
+)
+
+// Type is the type of a Span.
+type Type byte
+
+const (
+	// Text is plain text.
+	Text Type = iota
+	// URI is a NIP-21 nostr: URI.
+	URI
+	// URL is a http or https URL.
+	URL
+	// Hashtag is a #hashtag.
+	Hashtag
+	// Emoji is a NIP-30 :shortcode: that has a matching emoji tag.
+	Emoji
+	// Mention is a legacy #[n] mention of the tag at index n.
+	Mention
+)
+
+var typeNames = []S{"text", "uri", "url", "hashtag", "emoji", "mention"}
+
+func (t Type) String() S {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return "unknown"
+}
+
+// Span is a section of the content.
+type Span struct {
+	Type Type
+	// Start and End are the byte offsets of the span in the content.
+	Start, End int
+	// Text is the content of the span.
+	Text B
+	// Prefix is the NIP-19 prefix of a URI.
+	Prefix B
+	// Pointer is the decoded URI or mention, one of *pointers.Profile,
+	// *pointers.Event or *pointers.Entity.
+	Pointer any
+	// Tag is the tag a Mention refers to, or the emoji tag of an Emoji.
+	Tag *tag.T
+}
+
+var (
+	uriScheme   = B("nostr:")
+	httpScheme  = B("http://")
+	httpsScheme = B("https://")
+	emojiKey    = B("emoji")
+)
+
+// bech32Charset is the set of characters in the data part of bech32 strings.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Parse splits content into spans. The tags of the event are used to resolve
+// legacy mentions and custom emoji, and can be nil. Adjacent plain text is
+// merged into one Text span, and references that fail to decode are left as
+// text.
+func Parse(content B, t *tags.T) (spans []Span) {
+	var text int
+	emit := func(s Span) {
+		if text < s.Start {
+			spans = append(spans, Span{Type: Text, Start: text, End: s.Start,
+				Text: content[text:s.Start]})
+		}
+		s.Text = content[s.Start:s.End]
+		spans = append(spans, s)
+		text = s.End
+	}
+	for i := 0; i < len(content); {
+		var s Span
+		var ok bool
+		switch content[i] {
+		case 'n':
+			s, ok = parseURI(content, i)
+		case 'h':
+			s, ok = parseURL(content, i)
+		case '#':
+			if s, ok = parseMention(content, i, t); !ok {
+				s, ok = parseHashtag(content, i)
+			}
+		case ':':
+			s, ok = parseEmoji(content, i, t)
+		}
+		if ok {
+			emit(s)
+			i = s.End
+			continue
+		}
+		i++
+	}
+	if text < len(content) {
+		spans = append(spans, Span{Type: Text, Start: text, End: len(content),
+			Text: content[text:]})
+	}
+	return
+}
+
+func parseURI(content B, i int) (s Span, ok bool) {
+	if !bytes.HasPrefix(content[i:], uriScheme) || wordBefore(content, i) {
+		return
+	}
+	start := i + len(uriScheme)
+	end := start
+	sep := -1
+	for ; end < len(content); end++ {
+		c := content[end]
+		if c == '1' && sep < 0 && end > start {
+			sep = end
+		} else if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			break
+		}
+	}
+	if sep < 0 {
+		return
+	}
+	for _, c := range content[sep+1 : end] {
+		if bytes.IndexByte(B(bech32Charset), c) < 0 {
+			return
+		}
+	}
+	prefix, value, err := bech32encoding.Decode(content[start:end])
+	if err != nil {
+		return
+	}
+	var p any
+	switch v := value.(type) {
+	case B:
+		switch {
+		case Equals(prefix, bech32encoding.NpubHRP):
+			p = &pointers.Profile{PublicKey: v}
+		case Equals(prefix, bech32encoding.NoteHRP):
+			var id B
+			if id, err = hex.Dec(S(v)); err != nil {
+				return
+			}
+			p = &pointers.Event{ID: eventid.NewWith(id)}
+		default:
+			// NIP-21 doesn't allow nsec, it is left as text so it can be
+			// noticed.
+			return
+		}
+	case pointers.Profile:
+		p = &v
+	case pointers.Event:
+		p = &v
+	case pointers.Entity:
+		p = &v
+	default:
+		return
+	}
+	return Span{Type: URI, Start: i, End: end, Prefix: prefix, Pointer: p}, true
+}
+
+func parseURL(content B, i int) (s Span, ok bool) {
+	rest := content[i:]
+	if !bytes.HasPrefix(rest, httpsScheme) && !bytes.HasPrefix(rest, httpScheme) ||
+		wordBefore(content, i) {
+		return
+	}
+	end := i
+	for end < len(content) {
+		r, n := utf8.DecodeRune(content[end:])
+		if unicode.IsSpace(r) || r == '<' || r == '>' || r == '"' {
+			break
+		}
+		end += n
+	}
+	// trailing punctuation is part of the sentence, not the URL, except a
+	// closing parenthesis that has a matching open one in the URL.
+	for end > i {
+		c := content[end-1]
+		if c == ')' && bytes.Count(content[i:end], B("(")) >=
+			bytes.Count(content[i:end], B(")")) {
+			break
+		}
+		if bytes.IndexByte(B(".,;:!?'\")]"), c) < 0 {
+			break
+		}
+		end--
+	}
+	if n := bytes.Index(content[i:end], B("://")); end-i <= n+3 {
+		return
+	}
+	return Span{Type: URL, Start: i, End: end}, true
+}
+
+func parseMention(content B, i int, t *tags.T) (s Span, ok bool) {
+	if t == nil || i+3 >= len(content) || content[i+1] != '[' {
+		return
+	}
+	end := bytes.IndexByte(content[i+2:], ']')
+	if end < 1 {
+		return
+	}
+	end += i + 2
+	n, err := strconv.Atoi(S(content[i+2 : end]))
+	if err != nil || n < 0 || n >= t.Len() {
+		return
+	}
+	tt := t.T[n]
+	p := Pointer(tt)
+	if p == nil {
+		return
+	}
+	return Span{Type: Mention, Start: i, End: end + 1, Pointer: p, Tag: tt}, true
+}
+
+func parseHashtag(content B, i int) (s Span, ok bool) {
+	if wordBefore(content, i) || (i > 0 && content[i-1] == '&') {
+		return
+	}
+	end := i + 1
+	for end < len(content) && isWord(content, end) {
+		_, n := utf8.DecodeRune(content[end:])
+		end += n
+	}
+	if end == i+1 {
+		return
+	}
+	return Span{Type: Hashtag, Start: i, End: end}, true
+}
+
+func parseEmoji(content B, i int, t *tags.T) (s Span, ok bool) {
+	if t == nil {
+		return
+	}
+	end := i + 1
+	for ; end < len(content); end++ {
+		c := content[end]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '_' || c == '-') {
+			break
+		}
+	}
+	if end == i+1 || end == len(content) || content[end] != ':' {
+		return
+	}
+	code := content[i+1 : end]
+	for _, tt := range t.T {
+		if tt != nil && tt.Len() >= 3 && Equals(tt.Key(), emojiKey) &&
+			Equals(tt.Value(), code) {
+			return Span{Type: Emoji, Start: i, End: end + 1, Tag: tt}, true
+		}
+	}
+	return
+}
+
+// isWord reports whether the rune starting at content[i] is a letter, digit or
+// underscore.
+func isWord(content B, i int) bool {
+	r, _ := utf8.DecodeRune(content[i:])
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordBefore reports whether the rune before content[i] is a letter, digit or
+// underscore.
+func wordBefore(content B, i int) bool {
+	r, _ := utf8.DecodeLastRune(content[:i])
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Pointer decodes the reference in a p, e or a tag into a *pointers.Profile,
+// *pointers.Event or *pointers.Entity, or returns nil if the tag is not a valid
+// reference.
+func Pointer(t *tag.T) any {
+	if t == nil || t.Len() < 2 {
+		return nil
+	}
+	var relays []B
+	if t.Len() > 2 && len(t.Field[2]) > 0 {
+		relays = []B{t.Field[2]}
+	}
+	v := t.Value()
+	switch S(t.Key()) {
+	case "p":
+		if pk, err := hex.Dec(S(v)); err != nil || len(pk) != 32 {
+			return nil
+		}
+		return &pointers.Profile{PublicKey: v, Relays: relays}
+	case "e":
+		id, err := hex.Dec(S(v))
+		if err != nil || len(id) != 32 {
+			return nil
+		}
+		return &pointers.Event{ID: eventid.NewWith(id), Relays: relays}
+	case "a":
+		parts := bytes.SplitN(v, B(":"), 3)
+		if len(parts) != 3 || len(parts[1]) != 64 {
+			return nil
+		}
+		k, err := strconv.ParseUint(S(parts[0]), 10, 16)
+		if err != nil {
+			return nil
+		}
+		return &pointers.Entity{PublicKey: parts[1], Kind: kind.New(uint16(k)),
+			Identifier: parts[2], Relays: relays}
+	}
+	return nil
+}
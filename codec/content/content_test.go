@@ -0,0 +1,165 @@
+package content
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/bech32encoding"
+	"nostr.mleku.dev/codec/bech32encoding/pointers"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/eventid"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"util.mleku.dev/hex"
+)
+
+const (
+	pk  = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+	eid = "45326f5d6962ab1e3cd424e758c3002b8665f7b0d8dcee9fe9e288d7751ac194"
+)
+
+func references(t *testing.T) (npub, nevent, naddr, nsec B) {
+	var err error
+	if npub, err = bech32encoding.HexToNpub(B(pk)); Chk.E(err) {
+		t.Fatal(err)
+	}
+	id, _ := hex.Dec(eid)
+	if nevent, err = bech32encoding.EncodeEvent(eventid.NewWith(id),
+		[]B{B("wss://relay.example.com")}, B(pk)); Chk.E(err) {
+		t.Fatal(err)
+	}
+	if naddr, err = bech32encoding.EncodeEntity(B(pk), kind.New(30023),
+		B("slug"), nil); Chk.E(err) {
+		t.Fatal(err)
+	}
+	if nsec, err = bech32encoding.HexToNsec(B(eid)); Chk.E(err) {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestParse(t *testing.T) {
+	npub, nevent, naddr, nsec := references(t)
+	content := B("hi nostr:" + S(npub) + ", see nostr:" + S(nevent) +
+		" and (https://example.com/a_(b)). #Nostr #[1] :soapbox: nostr:" +
+		S(naddr) + " nostr:" + S(nsec) + " a#b &#39;")
+	tt := tags.New(
+		tag.New("emoji", "soapbox", "https://example.com/soapbox.png"),
+		tag.New("p", pk),
+	)
+	spans := Parse(content, tt)
+	expect := []struct {
+		typ  Type
+		text S
+	}{
+		{Text, "hi "},
+		{URI, "nostr:" + S(npub)},
+		{Text, ", see "},
+		{URI, "nostr:" + S(nevent)},
+		{Text, " and ("},
+		{URL, "https://example.com/a_(b)"},
+		{Text, "). "},
+		{Hashtag, "#Nostr"},
+		{Text, " "},
+		{Mention, "#[1]"},
+		{Text, " "},
+		{Emoji, ":soapbox:"},
+		{Text, " "},
+		{URI, "nostr:" + S(naddr)},
+		{Text, " nostr:" + S(nsec) + " a#b &#39;"},
+	}
+	if len(spans) != len(expect) {
+		for _, s := range spans {
+			t.Logf("%v %q", s.Type, s.Text)
+		}
+		t.Fatalf("got %d spans, expected %d", len(spans), len(expect))
+	}
+	var end int
+	for i, s := range spans {
+		if s.Type != expect[i].typ || S(s.Text) != expect[i].text {
+			t.Fatalf("span %d: got %v %q, expected %v %q", i, s.Type, s.Text,
+				expect[i].typ, expect[i].text)
+		}
+		if s.Start != end || !Equals(content[s.Start:s.End], s.Text) {
+			t.Fatalf("span %d has wrong offsets %d-%d", i, s.Start, s.End)
+		}
+		end = s.End
+	}
+	if p, ok := spans[1].Pointer.(*pointers.Profile); !ok || S(p.PublicKey) != pk {
+		t.Fatalf("wrong npub pointer %v", spans[1].Pointer)
+	}
+	if p, ok := spans[3].Pointer.(*pointers.Event); !ok || p.ID.String() != eid ||
+		len(p.Relays) != 1 {
+		t.Fatalf("wrong nevent pointer %v", spans[3].Pointer)
+	}
+	if p, ok := spans[9].Pointer.(*pointers.Profile); !ok || S(p.PublicKey) != pk ||
+		spans[9].Tag != tt.T[1] {
+		t.Fatalf("wrong mention %v", spans[9].Pointer)
+	}
+	if p, ok := spans[13].Pointer.(*pointers.Entity); !ok ||
+		p.Kind.ToU16() != 30023 || S(p.Identifier) != "slug" {
+		t.Fatalf("wrong naddr pointer %v", spans[13].Pointer)
+	}
+}
+
+func TestAddTags(t *testing.T) {
+	npub, nevent, naddr, _ := references(t)
+	ev := event.New()
+	ev.Content = B("nostr:" + S(npub) + " nostr:" + S(nevent) + " nostr:" +
+		S(naddr) + " #Nostr #nostr nostr:" + S(npub))
+	ev.Tags = tags.New(tag.New("t", "nostr"))
+	AddTags(ev)
+	expect := [][]S{
+		{"t", "nostr"},
+		{"p", pk},
+		{"e", eid, "wss://relay.example.com"},
+		{"a", "30023:" + pk + ":slug"},
+	}
+	got := ev.Tags.ToStringSlice()
+	if len(got) != len(expect) {
+		t.Fatalf("got %v, expected %v", got, expect)
+	}
+	for i := range expect {
+		if len(got[i]) != len(expect[i]) {
+			t.Fatalf("tag %d: got %v, expected %v", i, got[i], expect[i])
+		}
+		for j := range expect[i] {
+			if got[i][j] != expect[i][j] {
+				t.Fatalf("tag %d: got %v, expected %v", i, got[i], expect[i])
+			}
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	content := B("see https://example.com and #nostr")
+	out := Render(nil, content, nil, func(dst B, s *Span) B {
+		dst = append(dst, '<')
+		dst = append(dst, s.Type.String()...)
+		return append(dst, '>')
+	})
+	if S(out) != "see <url> and <hashtag>" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add(B("hi nostr:npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6 #[0] :x: https://a.b/(c)."))
+	tt := tags.New(tag.New("e", eid), tag.New("emoji", "x", "https://x"),
+		tag.New("a", "1:"+pk+":"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var end int
+		for _, s := range Parse(b, tt) {
+			if s.Start != end || s.End <= s.Start {
+				t.Fatalf("span %d-%d does not follow %d", s.Start, s.End, end)
+			}
+			end = s.End
+		}
+		if end != len(b) {
+			t.Fatalf("spans end at %d of %d", end, len(b))
+		}
+		_ = Tags(b, tt)
+	})
+}
@@ -0,0 +1,239 @@
+// Package delegation implements NIP-26 delegated event signing, where a
+// delegator signs a token that lets a delegatee key publish events on its behalf
+// within conditions on the kind and time of the events.
+package delegation
+
+import (
+	"bytes"
+	"strconv"
+
+	. "nostr.mleku.dev"
+
+	"github.com/minio/sha256-simd"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/crypto/p256k"
+	"util.mleku.dev/hex"
+)
+
+// Key is the key of the delegation tag.
+var Key = B("delegation")
+
+// Conditions are the restrictions a delegator puts on the events of the
+// delegatee. An event must be one of Kinds, if there are any, and created
+// strictly after Since and strictly before Until, where they are not zero.
+type Conditions struct {
+	Kinds        *kinds.T
+	Since, Until int64
+}
+
+// ParseConditions parses a query string of conditions such as
+// kind=1&created_at>1674834236&created_at<1677426236.
+func ParseConditions(s B) (c *Conditions, err E) {
+	c = &Conditions{Kinds: kinds.New()}
+	if len(s) == 0 {
+		return
+	}
+	for _, cond := range bytes.Split(s, B("&")) {
+		var v uint64
+		switch {
+		case bytes.HasPrefix(cond, B("kind=")):
+			if v, err = strconv.ParseUint(S(cond[5:]), 10, 16); err != nil {
+				err = Errorf.E("invalid kind condition '%s'", cond)
+				return
+			}
+			c.Kinds.K = append(c.Kinds.K, kind.New(uint16(v)))
+		case bytes.HasPrefix(cond, B("created_at>")):
+			if v, err = strconv.ParseUint(S(cond[11:]), 10, 63); err != nil {
+				err = Errorf.E("invalid created_at condition '%s'", cond)
+				return
+			}
+			// where there are several the narrowest applies.
+			if int64(v) > c.Since {
+				c.Since = int64(v)
+			}
+		case bytes.HasPrefix(cond, B("created_at<")):
+			if v, err = strconv.ParseUint(S(cond[11:]), 10, 63); err != nil {
+				err = Errorf.E("invalid created_at condition '%s'", cond)
+				return
+			}
+			if c.Until == 0 || int64(v) < c.Until {
+				c.Until = int64(v)
+			}
+		default:
+			err = Errorf.E("unknown condition '%s'", cond)
+			return
+		}
+	}
+	return
+}
+
+// Marshal appends the conditions as a query string, kinds first.
+func (c *Conditions) Marshal(dst B) (b B) {
+	b = dst
+	add := func(s S) {
+		if len(b) > len(dst) {
+			b = append(b, '&')
+		}
+		b = append(b, s...)
+	}
+	if c.Kinds != nil {
+		for _, k := range c.Kinds.K {
+			add("kind=" + strconv.FormatUint(uint64(k.K), 10))
+		}
+	}
+	if c.Since != 0 {
+		add("created_at>" + strconv.FormatInt(c.Since, 10))
+	}
+	if c.Until != 0 {
+		add("created_at<" + strconv.FormatInt(c.Until, 10))
+	}
+	return
+}
+
+// Check returns an error describing the first condition the event does not meet.
+func (c *Conditions) Check(ev *event.T) (err E) {
+	if c.Kinds != nil && c.Kinds.Len() > 0 {
+		if ev.Kind == nil || !c.Kinds.Contains(ev.Kind) {
+			return Errorf.E("kind is not one of the delegated kinds")
+		}
+	}
+	if c.Since != 0 || c.Until != 0 {
+		if ev.CreatedAt == nil {
+			return Errorf.E("event has no created_at")
+		}
+	}
+	if c.Since != 0 && ev.CreatedAt.I64() <= c.Since {
+		return Errorf.E("created_at is not after %d", c.Since)
+	}
+	if c.Until != 0 && ev.CreatedAt.I64() >= c.Until {
+		return Errorf.E("created_at is not before %d", c.Until)
+	}
+	return
+}
+
+// T is a NIP-26 delegation.
+type T struct {
+	// Delegator is the 32 byte public key of the delegator.
+	Delegator B
+	// Conditions is the query string of conditions as it was signed.
+	Conditions B
+	// Sig is the delegator's signature of the token.
+	Sig B
+}
+
+// Token returns the hash of the delegation string that the delegator signs,
+// nostr:delegation:<delegatee hex>:<conditions>.
+func Token(delegatee, conditions B) (h B) {
+	s := make(B, 0, 17+64+1+len(conditions))
+	s = append(s, "nostr:delegation:"...)
+	s = hex.EncAppend(s, delegatee)
+	s = append(s, ':')
+	s = append(s, conditions...)
+	hh := sha256.Sum256(s)
+	return hh[:]
+}
+
+// New signs a delegation to the 32 byte public key delegatee with the given
+// conditions.
+func New(delegator crypto.Signer, delegatee B, c *Conditions) (d *T, err E) {
+	if len(delegatee) != 32 {
+		err = Errorf.E("delegatee must be 32 bytes, got %d", len(delegatee))
+		return
+	}
+	d = &T{Delegator: delegator.Pub(), Conditions: c.Marshal(nil)}
+	if d.Sig, err = delegator.Sign(Token(delegatee, d.Conditions)); Chk.E(err) {
+		return
+	}
+	return
+}
+
+// Tag returns the delegation tag, ["delegation", <delegator>, <conditions>,
+// <sig>].
+func (d *T) Tag() *tag.T {
+	return tag.New(S(Key), hex.Enc(d.Delegator), S(d.Conditions), hex.Enc(d.Sig))
+}
+
+// Attach adds the delegation tag to the event, replacing any it already has. The
+// event must be signed by the delegatee after this.
+func (d *T) Attach(ev *event.T) {
+	t := tags.New()
+	if ev.Tags != nil {
+		for _, tt := range ev.Tags.T {
+			if !Equals(tt.Key(), Key) {
+				t.T = append(t.T, tt)
+			}
+		}
+	}
+	t.T = append(t.T, d.Tag())
+	ev.Tags = t
+}
+
+// FromEvent decodes the delegation tag of an event. It returns nil if there is
+// none.
+func FromEvent(ev *event.T) (d *T, err E) {
+	if ev.Tags == nil {
+		return
+	}
+	var t *tag.T
+	for _, tt := range ev.Tags.T {
+		if Equals(tt.Key(), Key) {
+			t = tt
+			break
+		}
+	}
+	if t == nil {
+		return
+	}
+	if t.Len() < 4 {
+		err = Errorf.E("delegation tag must have 4 fields, got %d", t.Len())
+		return
+	}
+	d = &T{Conditions: t.Field[2]}
+	if d.Delegator, err = hex.Dec(S(t.Field[1])); err != nil || len(d.Delegator) != 32 {
+		err = Errorf.E("invalid delegator '%s'", t.Field[1])
+		return nil, err
+	}
+	if d.Sig, err = hex.Dec(S(t.Field[3])); err != nil || len(d.Sig) != 64 {
+		err = Errorf.E("invalid delegation signature '%s'", t.Field[3])
+		return nil, err
+	}
+	return
+}
+
+// Verify checks that the delegation is signed by the delegator for the
+// delegatee of the event, and that the event meets the conditions. It does not
+// check the signature of the event itself.
+func (d *T) Verify(ev *event.T) (err E) {
+	var c *Conditions
+	if c, err = ParseConditions(d.Conditions); err != nil {
+		return
+	}
+	signer := &p256k.Signer{}
+	if err = signer.InitPub(d.Delegator); err != nil {
+		return
+	}
+	var valid bool
+	if valid, err = signer.Verify(Token(ev.PubKey, d.Conditions), d.Sig); err != nil ||
+		!valid {
+		return Errorf.E("invalid delegation signature")
+	}
+	return c.Check(ev)
+}
+
+// Delegator returns the delegator of an event if it has a valid delegation tag,
+// or nil if it has none.
+func Delegator(ev *event.T) (delegator B, err E) {
+	var d *T
+	if d, err = FromEvent(ev); err != nil || d == nil {
+		return
+	}
+	if err = d.Verify(ev); err != nil {
+		return
+	}
+	return d.Delegator, nil
+}
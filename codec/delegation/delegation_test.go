@@ -0,0 +1,100 @@
+package delegation
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto/p256k"
+	"util.mleku.dev/hex"
+)
+
+// TestNIP26Example checks the delegation in the example of NIP-26.
+func TestNIP26Example(t *testing.T) {
+	delegator, _ := hex.Dec("8e0d3d3eb2881ec137a11debe736a9086715a8c8beeeda615780064d68bc25dd")
+	delegatee, _ := hex.Dec("477318cfb5427b9cfc66a9fa376150c1ddbc62115ae27cef72417eb959691396")
+	sig, _ := hex.Dec("6f44d7fe4f1c09f3954640fb58bd12bae8bb8ff4120853c4693106c82e920e2b" +
+		"898f1f9ba9bd65449a987c39c0423426ab7b53910c0c6abfb41b30bc16e5f524")
+	d := &T{Delegator: delegator,
+		Conditions: B("kind=1&created_at>1674834236&created_at<1677426236"), Sig: sig}
+	ev := &event.T{PubKey: delegatee, Kind: kind.TextNote,
+		CreatedAt: timestamp.FromUnix(1677000000), Tags: tags.New()}
+	d.Attach(ev)
+	got, err := Delegator(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equals(got, delegator) {
+		t.Fatalf("got delegator %0x expected %0x", got, delegator)
+	}
+	for _, ev := range []*event.T{
+		{PubKey: delegatee, Kind: kind.Reaction, CreatedAt: ev.CreatedAt, Tags: ev.Tags},
+		{PubKey: delegatee, Kind: kind.TextNote, CreatedAt: timestamp.FromUnix(1674834236),
+			Tags: ev.Tags},
+		{PubKey: delegatee, Kind: kind.TextNote, CreatedAt: timestamp.FromUnix(1677426236),
+			Tags: ev.Tags},
+		{PubKey: delegator, Kind: kind.TextNote, CreatedAt: ev.CreatedAt, Tags: ev.Tags},
+	} {
+		if _, err = Delegator(ev); err == nil {
+			t.Fatalf("expected the delegation to be invalid for kind %d at %d by %0x",
+				ev.Kind.K, ev.CreatedAt.I64(), ev.PubKey)
+		}
+	}
+}
+
+func TestDelegate(t *testing.T) {
+	delegator, delegatee := &p256k.Signer{}, &p256k.Signer{}
+	if err := delegator.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := delegatee.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	now := timestamp.Now().I64()
+	c := &Conditions{Kinds: kinds.New(kind.TextNote, kind.Reaction), Since: now - 60,
+		Until: now + 60}
+	d, err := New(delegator, delegatee.Pub(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "kind=1&kind=7&created_at>" + timestamp.FromUnix(now-60).String() +
+		"&created_at<" + timestamp.FromUnix(now+60).String()
+	if S(d.Conditions) != expected {
+		t.Fatalf("got conditions %s expected %s", d.Conditions, expected)
+	}
+	ev := &event.T{Kind: kind.Reaction, CreatedAt: timestamp.Now(),
+		Tags: tags.New(), Content: B("+")}
+	d.Attach(ev)
+	// attaching again replaces the tag
+	d.Attach(ev)
+	if ev.Tags.Len() != 1 {
+		t.Fatalf("expected one tag, got %d", ev.Tags.Len())
+	}
+	if err = ev.Sign(delegatee); err != nil {
+		t.Fatal(err)
+	}
+	var got B
+	if got, err = Delegator(ev); err != nil {
+		t.Fatal(err)
+	}
+	if !Equals(got, delegator.Pub()) {
+		t.Fatalf("got delegator %0x expected %0x", got, delegator.Pub())
+	}
+	var parsed *Conditions
+	if parsed, err = ParseConditions(d.Conditions); err != nil {
+		t.Fatal(err)
+	}
+	if !Equals(parsed.Marshal(nil), d.Conditions) {
+		t.Fatalf("got %s expected %s", parsed.Marshal(nil), d.Conditions)
+	}
+	for _, s := range []S{"kind=x", "kind=70000", "created_at>-1", "author=abc", "kind=1&"} {
+		if _, err = ParseConditions(B(s)); err == nil {
+			t.Fatalf("expected an error for '%s'", s)
+		}
+	}
+}
@@ -48,12 +48,13 @@ func (en *Challenge) UnmarshalJSON(b B) (r B, err E) {
 	if en.Challenge, r, err = text.UnmarshalQuoted(r); Chk.E(err) {
 		return
 	}
-	for ; len(r) >= 0; r = r[1:] {
+	for ; len(r) > 0; r = r[1:] {
 		if r[0] == ']' {
 			r = r[:0]
 			return
 		}
 	}
+	err = io.EOF
 	return
 }
 
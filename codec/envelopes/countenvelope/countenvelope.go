@@ -2,8 +2,9 @@ package countenvelope
 
 import "C"
 import (
-	"bytes"
 	"io"
+	"math"
+	"strconv"
 
 	. "nostr.mleku.dev"
 
@@ -12,6 +13,7 @@ import (
 	"nostr.mleku.dev/codec/filters"
 	sid "nostr.mleku.dev/codec/subscriptionid"
 	"nostr.mleku.dev/codec/text"
+	"util.mleku.dev/hex"
 	"util.mleku.dev/ints"
 )
 
@@ -85,10 +87,13 @@ func ParseRequest(b B) (t *Request, rem B, err E) {
 	return
 }
 
+// Response is the answer to a COUNT request. HLL, if the relay sends one, is
+// the 256 registers of a NIP-45 HyperLogLog sketch of the authors counted.
 type Response struct {
 	ID          *sid.T
 	Count       int
 	Approximate bool
+	HLL         B
 }
 
 var _ enveloper.I = (*Response)(nil)
@@ -99,7 +104,7 @@ func NewResponseFrom[V S | B](id V, cnt int, approx ...bool) *Response {
 	if len(approx) > 0 {
 		a = approx[0]
 	}
-	return &Response{sid.MustNew(id), cnt, a}
+	return &Response{ID: sid.MustNew(id), Count: cnt, Approximate: a}
 }
 func (en *Response) Label() string { return L }
 func (en *Response) Write(w io.Writer) (err E) {
@@ -119,74 +124,130 @@ func (en *Response) MarshalJSON(dst B) (b B, err error) {
 			if o, err = en.ID.MarshalJSON(o); Chk.E(err) {
 				return
 			}
-			o = append(o, ',')
-			c := ints.New(en.Count)
-			o, err = c.MarshalJSON(o)
+			o = append(o, `,{"count":`...)
+			o = strconv.AppendInt(o, int64(en.Count), 10)
 			if en.Approximate {
-				o = append(dst, ',')
-				o = append(o, "true"...)
+				o = append(o, `,"approximate":true`...)
+			}
+			if len(en.HLL) > 0 {
+				o = append(o, `,"hll":"`...)
+				o = hex.EncAppend(o, en.HLL)
+				o = append(o, '"')
 			}
+			o = append(o, '}')
 			return
 		})
 	return
 }
 
+// The keys of the object of a COUNT response.
+var (
+	jCount       = B("count")
+	jApproximate = B("approximate")
+	jHLL         = B("hll")
+)
+
 func (en *Response) UnmarshalJSON(b B) (r B, err error) {
 	r = b
-	var inID, inCount bool
-	for ; len(r) > 0; r = r[1:] {
-		// first we should be finding a subscription ID
-		if !inID && r[0] == '"' {
+	en.ID = &sid.T{}
+	if r, err = en.ID.UnmarshalJSON(r); Chk.E(err) {
+		return
+	}
+	for len(r) > 0 && (r[0] == ',' || isSpace(r[0])) {
+		r = r[1:]
+	}
+	if len(r) == 0 || r[0] != '{' {
+		err = Errorf.E("count response has no object")
+		return
+	}
+	r = r[1:]
+	en.Count, en.Approximate, en.HLL = 0, false, nil
+	for len(r) > 0 {
+		switch r[0] {
+		case ' ', '\n', '\t', '\r', ',':
 			r = r[1:]
-			// so we don't do this twice
-			inID = true
-			for i := range r {
-				if r[i] == '\\' {
-					continue
-				} else if r[i] == '"' {
-					// skip escaped quotes
-					if i > 0 {
-						if r[i-1] != '\\' {
-							continue
-						}
-					}
-					if en.ID, err = sid.
-						New(text.NostrUnescape(r[:i])); Chk.E(err) {
-
-						return
-					}
-					// trim the rest
-					r = r[i:]
-				}
+		case '}':
+			if r, err = envelopes.SkipToTheEnd(r[1:]); Chk.E(err) {
+				return
 			}
-		} else {
-			// pass the comma
-			if r[0] == ',' {
-				continue
-			} else if !inCount {
-				inCount = true
+			return
+		case '"':
+			var key B
+			if key, r, err = text.UnmarshalQuoted(r); Chk.E(err) {
+				return
+			}
+			for len(r) > 0 && (r[0] == ':' || isSpace(r[0])) {
+				r = r[1:]
+			}
+			switch {
+			case Equals(key, jCount):
 				n := ints.New(0)
 				if r, err = n.UnmarshalJSON(r); Chk.E(err) {
 					return
 				}
-				en.Count = int(n.Uint64())
-			} else {
-				// can only be either the end or optional approx
-				if r[0] == ']' {
+				if n.N > math.MaxInt {
+					err = Errorf.E("count %d is too large", n.N)
+					return
+				}
+				en.Count = int(n.N)
+			case Equals(key, jApproximate):
+				if r, en.Approximate, err = text.UnmarshalBool(r); Chk.E(err) {
+					return
+				}
+			case Equals(key, jHLL):
+				if en.HLL, r, err = text.UnmarshalHex(r); Chk.E(err) {
+					return
+				}
+				if len(en.HLL) != 256 {
+					err = Errorf.E("hll must be 256 bytes, got %d", len(en.HLL))
+					return
+				}
+			default:
+				// later additions to NIP-45 are ignored.
+				if r, err = skipValue(r); Chk.E(err) {
 					return
-				} else {
-					for i := range r {
-						if r[i] == ']' {
-							if bytes.Contains(r[:i], B("true")) {
-								en.Approximate = true
-							}
-							return
-						}
-					}
 				}
 			}
+		default:
+			err = Errorf.E("invalid count response object at '%s'", r)
+			return
+		}
+	}
+	err = io.EOF
+	return
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\n' || c == '\t' || c == '\r' }
+
+// skipValue returns what follows the JSON value at the start of b.
+func skipValue(b B) (r B, err E) {
+	var depth int
+	var quoted, escaping bool
+	for r = b; len(r) > 0; r = r[1:] {
+		c := r[0]
+		switch {
+		case quoted:
+			if escaping {
+				escaping = false
+			} else if c == '\\' {
+				escaping = true
+			} else if c == '"' {
+				quoted = false
+			}
+		case c == '"':
+			quoted = true
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			if depth == 0 {
+				return
+			}
+			depth--
+		case depth == 0 && (c == ',' || isSpace(c)):
+			return
 		}
 	}
+	err = io.EOF
 	return
 }
 
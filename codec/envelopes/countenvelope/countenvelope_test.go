@@ -66,5 +66,46 @@ func TestRequest(t *testing.T) {
 }
 
 func TestResponse(t *testing.T) {
-
+	sketch := make(B, 256)
+	sketch[3] = 7
+	for _, res := range []*Response{
+		NewResponseFrom("sub", 10),
+		NewResponseFrom("sub", 93412452, true),
+		{ID: subscriptionid.MustNew("sub"), Count: 1234, Approximate: true, HLL: sketch},
+	} {
+		b, err := res.MarshalJSON(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var l string
+		var rem B
+		if l, rem, err = envelopes.Identify(b); err != nil || l != L {
+			t.Fatalf("%s: %s %v", b, l, err)
+		}
+		res2 := NewResponse()
+		if rem, err = res2.UnmarshalJSON(rem); err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		if len(rem) > 0 || res2.ID.String() != "sub" || res2.Count != res.Count ||
+			res2.Approximate != res.Approximate || !Equals(res2.HLL, res.HLL) {
+			t.Fatalf("%s: got %+v", b, res2)
+		}
+	}
+	// as NIP-45 has it.
+	res, _, err := Parse(B(`"sub", {"count": 5, "approximate": false}]`))
+	if err != nil || res.Count != 5 || res.Approximate {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+	// unknown keys are skipped, whatever their value.
+	res, _, err = Parse(B("\"sub\",\n\t{\r\n\t\"extra\": {\"a\": [1, \"}\\\"]\"]},\n" +
+		"\t\"count\": 7,\n\t\"limit\": 1\n}\n]"))
+	if err != nil || res.Count != 7 {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+	for _, s := range []string{`"sub",{"count":5,"hll":"00"}]`, `"sub",{"count":-1}]`,
+		`"sub",{"count":5,"limit":[1}]`, `"sub",{"count":5]`, `"sub",5]`} {
+		if _, _, err = Parse(B(s)); err == nil {
+			t.Fatalf("%s should not parse", s)
+		}
+	}
 }
@@ -0,0 +1,434 @@
+package event
+
+import (
+	"io"
+	"strconv"
+	"sync"
+
+	. "nostr.mleku.dev"
+
+	"github.com/minio/sha256-simd"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"util.mleku.dev/hex"
+)
+
+// Dict is a shared dictionary of common tag fields used by the BinaryV2
+// compressed encoding. The version is written in each record, so once a
+// dictionary has been used to write events its entries must never change, new
+// entries go in a new version.
+type Dict struct {
+	Version uint64
+	Entries []B
+	index   map[S]int
+}
+
+// NewDict creates a dictionary from a list of entries.
+func NewDict(version uint64, entries ...S) (d *Dict) {
+	d = &Dict{Version: version, index: make(map[S]int, len(entries))}
+	for i, e := range entries {
+		d.Entries = append(d.Entries, B(e))
+		if _, ok := d.index[e]; !ok {
+			d.index[e] = i
+		}
+	}
+	return
+}
+
+// Lookup returns the index of an entry in the dictionary.
+func (d *Dict) Lookup(b B) (i int, ok bool) {
+	i, ok = d.index[S(b)]
+	return
+}
+
+var dicts = struct {
+	sync.Mutex
+	m map[uint64]*Dict
+}{m: make(map[uint64]*Dict)}
+
+// RegisterDict makes a dictionary available for decoding. Registering a
+// different dictionary with the same version is an error.
+func RegisterDict(d *Dict) (err E) {
+	dicts.Lock()
+	defer dicts.Unlock()
+	if x, ok := dicts.m[d.Version]; ok && x != d {
+		err = Errorf.E("binary dictionary version %d already registered",
+			d.Version)
+		return
+	}
+	dicts.m[d.Version] = d
+	return
+}
+
+// GetDict returns the registered dictionary with the given version.
+func GetDict(version uint64) (d *Dict, err E) {
+	dicts.Lock()
+	defer dicts.Unlock()
+	var ok bool
+	if d, ok = dicts.m[version]; !ok {
+		err = Errorf.E("unknown binary dictionary version %d", version)
+	}
+	return
+}
+
+// DefaultDict is the dictionary used by MarshalBinaryVersion for BinaryV2. It
+// contains the common single letter and named tag keys, e tag markers and
+// popular relay URLs.
+var DefaultDict = NewDict(1,
+	// tag keys
+	"e", "p", "a", "t", "d", "r", "q", "k", "g", "i", "l", "L", "m", "x",
+	"relay", "relays", "client", "subject", "title", "summary", "image",
+	"thumb", "published_at", "alt", "imeta", "emoji", "expiration", "nonce",
+	"content-warning", "delegation", "challenge", "proxy", "bolt11",
+	"description", "preimage", "amount", "lnurl", "zap", "url", "name",
+	"server", "encryption", "status", "request", "size", "dim",
+	"blurhash", "ox", "fallback", "magnet", "web", "word", "u", "method",
+	"payload", "price", "location", "geohash", "h", "K", "P", "E", "A",
+	// e tag markers and r tag hints
+	"reply", "root", "mention", "read", "write",
+	// relays
+	"wss://relay.damus.io", "wss://nos.lol", "wss://relay.nostr.band",
+	"wss://nostr.wine", "wss://relay.snort.social", "wss://relay.primal.net",
+	"wss://purplepag.es", "wss://nostr.mom", "wss://offchain.pub",
+	"wss://relay.nostr.bg", "wss://nostr.bitcoiner.social",
+	"wss://nostr-pub.wellorder.net", "wss://relay.current.fyi",
+	"wss://eden.nostr.land", "wss://nostr.land", "wss://relay.nostr.info",
+	"wss://nostr.oxtr.dev", "wss://relay.mostr.pub", "wss://filter.nostr.wine",
+	"wss://relay.nos.social", "wss://nostr21.com", "wss://nostr.fmt.wiz.biz",
+	"wss://atlas.nostr.land", "wss://relay.orangepill.dev",
+	"wss://nostr.zebedee.cloud", "wss://relay.nostrplebs.com",
+	"wss://pyramid.fiatjaf.com", "wss://relay.nostr.net",
+	"wss://relay.damus.io/", "wss://nos.lol/", "wss://relay.nostr.band/",
+	"wss://relay.primal.net/", "wss://nostr.wine/", "wss://relay.snort.social/",
+	// common values
+	"nostr", "bitcoin", "en", "image/jpeg", "image/png", "image/webp",
+	"image/gif", "video/mp4", "ISO-639-1", "ugc", "wot",
+)
+
+func init() {
+	if err := RegisterDict(DefaultDict); Chk.E(err) {
+		panic(err)
+	}
+}
+
+// The codes that prefix each tag field in the BinaryV2 encoding.
+const (
+	// fieldLiteral is followed by a uvarint length and the bytes.
+	fieldLiteral = iota
+	// fieldHex is followed by 32 bytes that are a 64 character lower case hex
+	// string.
+	fieldHex
+	// fieldRepeat is followed by a uvarint index into the 32 byte values seen
+	// so far in the event, where the event pubkey is 0.
+	fieldRepeat
+	// fieldAddress is followed by a uvarint kind, a hex or repeat value and a
+	// literal identifier, which are the parts of an `a` tag kind:hex:ident.
+	fieldAddress
+	// fieldDict and above are dictionary entries, offset by fieldDict.
+	fieldDict
+)
+
+func isLowerHex(b B) bool {
+	for _, c := range b {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// splitAddress splits a kind:hex:ident value if it will decode back to the
+// same bytes.
+func splitAddress(b B) (k uint64, h, ident B, ok bool) {
+	i := 0
+	for i < len(b) && b[i] != ':' {
+		i++
+	}
+	if i == 0 || i > 5 || len(b) < i+2+2*sha256.Size ||
+		b[i+1+2*sha256.Size] != ':' {
+		return
+	}
+	var err E
+	if k, err = strconv.ParseUint(S(b[:i]), 10, 16); err != nil ||
+		S(b[:i]) != strconv.FormatUint(k, 10) {
+		return
+	}
+	h = b[i+1 : i+1+2*sha256.Size]
+	if !isLowerHex(h) {
+		return
+	}
+	return k, h, b[i+2+2*sha256.Size:], true
+}
+
+// refs keeps the 32 byte values already written in an event so repeats can be
+// written as a reference.
+type refs []B
+
+func (r refs) find(b B) int {
+	for i := range r {
+		if Equals(r[i], b) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (w *Writer) writeLiteral(b B) {
+	w.Buf = appendUvarint(w.Buf, uint64(len(b)))
+	w.Buf = append(w.Buf, b...)
+}
+
+// writeRef writes a 64 character hex string as a repeat or as the binary value.
+func (w *Writer) writeRef(h B, seen *refs) (err E) {
+	var a [sha256.Size]byte
+	v := a[:]
+	if _, err = hex.DecBytes(v, h); Chk.E(err) {
+		return
+	}
+	if i := seen.find(v); i >= 0 {
+		w.Buf = appendUvarint(w.Buf, fieldRepeat)
+		w.Buf = appendUvarint(w.Buf, uint64(i))
+		return
+	}
+	w.Buf = appendUvarint(w.Buf, fieldHex)
+	w.Buf = append(w.Buf, v...)
+	*seen = append(*seen, w.Buf[len(w.Buf)-sha256.Size:])
+	return
+}
+
+// WriteTagsDict encodes tags using the dictionary d, writing 64 character hex
+// values as binary and repeats of them, including the event pubkey, as
+// references.
+func (w *Writer) WriteTagsDict(t *tags.T, pub B, d *Dict) (err E) {
+	seen := refs{pub}
+	w.Buf = appendUvarint(w.Buf, uint64(len(t.T)))
+	for _, tt := range t.T {
+		w.Buf = appendUvarint(w.Buf, uint64(len(tt.Field)))
+		for _, f := range tt.Field {
+			if i, ok := d.Lookup(f); ok {
+				w.Buf = appendUvarint(w.Buf, uint64(fieldDict+i))
+				continue
+			}
+			if len(f) == 2*sha256.Size && isLowerHex(f) {
+				if err = w.writeRef(f, &seen); Chk.E(err) {
+					return
+				}
+				continue
+			}
+			if k, h, ident, ok := splitAddress(f); ok {
+				w.Buf = appendUvarint(w.Buf, fieldAddress)
+				w.Buf = appendUvarint(w.Buf, k)
+				if err = w.writeRef(h, &seen); Chk.E(err) {
+					return
+				}
+				w.writeLiteral(ident)
+				continue
+			}
+			w.Buf = appendUvarint(w.Buf, fieldLiteral)
+			w.writeLiteral(f)
+		}
+	}
+	return
+}
+
+// WriteEventDict writes an event in the BinaryV2 layout, without the version
+// header or extensions.
+func (w *Writer) WriteEventDict(ev *T, d *Dict) (err E) {
+	w.Buf = appendUvarint(w.Buf, d.Version)
+	if err = w.WriteID(ev.ID); Chk.E(err) {
+		return
+	}
+	if err = w.WritePubKey(ev.PubKey); Chk.E(err) {
+		return
+	}
+	if err = w.WriteCreatedAt(ev.CreatedAt); Chk.E(err) {
+		return
+	}
+	if err = w.WriteKind(ev.Kind); Chk.E(err) {
+		return
+	}
+	if err = w.WriteTagsDict(ev.Tags, ev.PubKey, d); Chk.E(err) {
+		return
+	}
+	if err = w.WriteContent(ev.Content); Chk.E(err) {
+		return
+	}
+	if err = w.WriteSignature(ev.Sig); Chk.E(err) {
+		return
+	}
+	return
+}
+
+func (r *Reader) readBytes(n uint64) (b B, err E) {
+	if n > uint64(len(r.Buf)-r.Pos) {
+		err = io.EOF
+		return
+	}
+	b = r.Buf[r.Pos : r.Pos+int(n)]
+	r.Pos += int(n)
+	return
+}
+
+// readRef reads the value of a hex or repeat coded field and appends it to dst
+// as hex.
+func (r *Reader) readRef(dst B, code uint64, seen *refs) (b B, err E) {
+	var i uint64
+	var v B
+	switch code {
+	case fieldHex:
+		if v, err = r.readBytes(sha256.Size); err != nil {
+			return
+		}
+		*seen = append(*seen, v)
+	case fieldRepeat:
+		if i, err = r.readUvarint(); err != nil {
+			return
+		}
+		if i >= uint64(len(*seen)) {
+			err = Errorf.E("invalid repeat reference %d of %d", i, len(*seen))
+			return
+		}
+		v = (*seen)[i]
+	default:
+		err = Errorf.E("expected hex or repeat field, got code %d", code)
+		return
+	}
+	b = hex.EncAppend(dst, v)
+	return
+}
+
+// ReadTagsDict decodes tags written by WriteTagsDict.
+func (r *Reader) ReadTagsDict(pub B, d *Dict) (t *tags.T, err E) {
+	seen := refs{pub}
+	var nTags, nFields, code, k, l uint64
+	if nTags, err = r.readUvarint(); err != nil {
+		return
+	}
+	t = &tags.T{}
+	if nTags == 0 {
+		return
+	}
+	// every tag and field takes at least one byte
+	if nTags > uint64(len(r.Buf)-r.Pos) {
+		err = io.EOF
+		return
+	}
+	t.T = make([]*tag.T, nTags)
+	for i := range t.T {
+		if nFields, err = r.readUvarint(); err != nil {
+			return
+		}
+		if nFields > uint64(len(r.Buf)-r.Pos) {
+			err = io.EOF
+			return
+		}
+		t.T[i] = tag.NewWithCap(int(nFields))
+		for range nFields {
+			if code, err = r.readUvarint(); err != nil {
+				return
+			}
+			var f B
+			switch {
+			case code >= fieldDict:
+				if code-fieldDict >= uint64(len(d.Entries)) {
+					err = Errorf.E("dictionary %d has no entry %d", d.Version,
+						code-fieldDict)
+					return
+				}
+				f = append(B{}, d.Entries[code-fieldDict]...)
+			case code == fieldLiteral:
+				if l, err = r.readUvarint(); err != nil {
+					return
+				}
+				if f, err = r.readBytes(l); err != nil {
+					return
+				}
+			case code == fieldAddress:
+				if k, err = r.readUvarint(); err != nil {
+					return
+				}
+				if k > 1<<16-1 {
+					err = Errorf.E("address kind %d out of range", k)
+					return
+				}
+				f = strconv.AppendUint(make(B, 0, 80), k, 10)
+				f = append(f, ':')
+				if code, err = r.readUvarint(); err != nil {
+					return
+				}
+				if f, err = r.readRef(f, code, &seen); err != nil {
+					return
+				}
+				f = append(f, ':')
+				var ident B
+				if l, err = r.readUvarint(); err != nil {
+					return
+				}
+				if ident, err = r.readBytes(l); err != nil {
+					return
+				}
+				f = append(f, ident...)
+			default:
+				f = make(B, 0, 2*sha256.Size)
+				if f, err = r.readRef(f, code, &seen); err != nil {
+					return
+				}
+			}
+			t.T[i].Field = append(t.T[i].Field, f)
+		}
+	}
+	return
+}
+
+// ReadEventDict reads an event written by WriteEventDict.
+func (r *Reader) ReadEventDict() (ev *T, err E) {
+	var version uint64
+	if version, err = r.readUvarint(); err != nil {
+		return
+	}
+	var d *Dict
+	if d, err = GetDict(version); err != nil {
+		return
+	}
+	ev = &T{}
+	if ev.ID, err = r.ReadID(); err != nil {
+		return
+	}
+	if ev.PubKey, err = r.ReadPubKey(); err != nil {
+		return
+	}
+	if ev.CreatedAt, err = r.ReadCreatedAt(); err != nil {
+		return
+	}
+	if ev.Kind, err = r.ReadKind(); err != nil {
+		return
+	}
+	if ev.Tags, err = r.ReadTagsDict(ev.PubKey, d); err != nil {
+		return
+	}
+	if ev.Content, err = r.ReadContent(); err != nil {
+		return
+	}
+	if ev.Sig, err = r.ReadSignature(); err != nil {
+		return
+	}
+	return
+}
+
+// MarshalBinaryDict encodes the event in the compressed BinaryV2 layout using
+// the given dictionary, which must be registered with RegisterDict for the
+// event to be decoded.
+func (ev *T) MarshalBinaryDict(dst B, d *Dict) (b B, err E) {
+	w := NewWriteBuffer(dst, BinaryHeaderLen+EstimateSize(ev)+1)
+	if err = w.WriteHeader(BinaryV2); Chk.E(err) {
+		return
+	}
+	if err = w.WriteEventDict(ev, d); Chk.E(err) {
+		return
+	}
+	if err = w.WriteExtensions(nil); Chk.E(err) {
+		return
+	}
+	b = w.Bytes()
+	return
+}
@@ -157,7 +157,12 @@ func (w *Writer) WriteTags(t *tags.T) (err E) {
 			case j == 1:
 				switch {
 				case secondIsHex:
-					w.Buf = appendUvarint(w.Buf, uint64(32))
+					if len(ts) != 2*sha256.Size {
+						err = Errorf.E("invalid length hex value in `%s` tag: %d",
+							t.T[i].Field[0], len(ts))
+						return
+					}
+					w.Buf = appendUvarint(w.Buf, uint64(sha256.Size))
 					if w.Buf, err = hex.DecAppend(w.Buf, ts); Chk.E(err) {
 						// the value MUST be hex by the spec
 						Log.W.Ln(t.T[i])
@@ -165,10 +170,14 @@ func (w *Writer) WriteTags(t *tags.T) (err E) {
 					}
 					continue scanning
 				case secondIsDecimalHex:
-					split := bytes.Split(t.T[i].Field[j], B(":"))
+					split := bytes.SplitN(t.T[i].Field[j], B(":"), 3)
+					if len(split) != 3 {
+						err = Errorf.E("invalid `a` tag, require 3 fields "+
+							"separated by ':' got %d", len(split))
+						return
+					}
 					// append the lengths accordingly
 					// first is 2 bytes size
-					var n int
 					k := kind.New(0)
 					if _, err = k.UnmarshalJSON(split[0]); Chk.E(err) {
 						return
@@ -184,7 +193,7 @@ func (w *Writer) WriteTags(t *tags.T) (err E) {
 					w.Buf = appendUvarint(w.Buf, uint64(2+32+len(split[2])))
 					// encode a 16 bit kind value
 					w.Buf = binary.LittleEndian.
-						AppendUint16(w.Buf, uint16(n))
+						AppendUint16(w.Buf, k.K)
 					// encode the 32 byte binary value
 					if w.Buf, err = hex.DecAppend(w.Buf, split[1]); Chk.E(err) {
 						return
@@ -241,11 +250,7 @@ func (w *Writer) WriteEvent(ev *T) (err error) {
 	return
 }
 
+// MarshalBinary encodes the event in the current binary version.
 func (ev *T) MarshalBinary(dst B) (b B, err E) {
-	w := NewBufForEvent(dst, ev)
-	if err = w.WriteEvent(ev); err != nil {
-		return
-	}
-	b = w.Bytes()
-	return
+	return ev.MarshalBinaryVersion(dst, BinaryVersion)
 }
@@ -91,11 +91,20 @@ func (r *Reader) ReadTags() (t *tags.T, err error) {
 		err = io.EOF
 		return
 	}
+	r.Pos += read
+	// every tag takes at least one byte, so a larger count is corrupt
+	if vi > uint64(len(r.Buf)-r.Pos) {
+		err = io.EOF
+		return
+	}
 	nTags := int(vi)
 	var end int
-	r.Pos += read
-	t = &tags.T{T: make([]*tag.T, nTags)}
-	// t = make(tags.T, nTags)
+	t = &tags.T{}
+	if nTags == 0 {
+		// a nil tags slice encodes as an empty array, the same as the original
+		return
+	}
+	t.T = make([]*tag.T, nTags)
 	// iterate through the individual tags
 	for i := 0; i < nTags; i++ {
 		vi, read = binary.Uvarint(r.Buf[r.Pos:])
@@ -103,8 +112,12 @@ func (r *Reader) ReadTags() (t *tags.T, err error) {
 			err = io.EOF
 			return
 		}
-		lenTag := int(vi)
 		r.Pos += read
+		if vi > uint64(len(r.Buf)-r.Pos) {
+			err = io.EOF
+			return
+		}
+		lenTag := int(vi)
 		t.T[i] = tag.NewWithCap(lenTag)
 		// extract the individual tag strings
 		var secondIsHex, secondIsDecimalHex bool
@@ -119,11 +132,11 @@ func (r *Reader) ReadTags() (t *tags.T, err error) {
 			}
 			r.Pos += read
 			// now read it off
-			end = r.Pos + int(vi)
-			if len(r.Buf) < end {
+			if vi > uint64(len(r.Buf)-r.Pos) {
 				err = io.EOF
 				return
 			}
+			end = r.Pos + int(vi)
 			// we know from this first tag certain conditions that allow
 			// data optimizations
 			switch {
@@ -144,6 +157,11 @@ func (r *Reader) ReadTags() (t *tags.T, err error) {
 			case j == 1:
 				switch {
 				case secondIsHex:
+					if vi != sha256.Size {
+						err = Errorf.E("hex tag value must be %d bytes, got %d",
+							sha256.Size, vi)
+						return
+					}
 					t.T[i].Field = append(t.T[i].Field, make(B, 0, sha256.Size*2))
 					t.T[i].Field[j] = hex.EncAppend(t.T[i].Field[j], r.Buf[r.Pos:end])
 					r.Pos = end
@@ -166,11 +184,12 @@ func (r *Reader) ReadTags() (t *tags.T, err error) {
 					}
 					pk = r.Buf[r.Pos:fieldEnd]
 					r.Pos = fieldEnd
-					t.T[i].Field = append(t.T[i].Field, B(fmt.Sprintf("%d:%0x:%s",
+					t.T[i].Field = append(t.T[i].Field, B(fmt.Sprintf("%d:%s:%s",
 						k,
 						hex.Enc(pk),
 						string(r.Buf[r.Pos:end]))))
 					r.Pos = end
+					continue reading
 				}
 			}
 			t.T[i].Field = append(t.T[i].Field, r.Buf[r.Pos:r.Pos+int(vi)])
@@ -188,11 +207,11 @@ func (r *Reader) ReadContent() (s B, err error) {
 		return
 	}
 	r.Pos += n
-	end := r.Pos + int(vi)
-	if end > len(r.Buf) {
-		err = Log.E.Err("expect %d got %d", end, len(r.Buf))
+	if vi > uint64(len(r.Buf)-r.Pos) {
+		err = Log.E.Err("expect %d got %d", uint64(r.Pos)+vi, len(r.Buf))
 		return
 	}
+	end := r.Pos + int(vi)
 	// extract the string
 	s = r.Buf[r.Pos : r.Pos+int(vi)]
 	r.Pos = end
@@ -236,13 +255,26 @@ func (r *Reader) ReadEvent() (ev *T, err error) {
 	return
 }
 
+// UnmarshalBinary decodes a binary event of any known version.
 func (ev *T) UnmarshalBinary(b B) (r B, err E) {
-	er := &Reader{Buf: b}
-	var re *T
-	if re, err = er.ReadEvent(); Chk.E(err) {
+	version, rem := BinaryVersionOf(b)
+	if r, err = ev.UnmarshalBinaryVersion(rem, version); version == BinaryLegacy ||
+		(err == nil && len(r) == 0) {
+		if Chk.E(err) {
+			return
+		}
+		return
+	}
+	// a legacy event ID can start with the version marker, so the record is
+	// legacy if it only decodes as one, or only uses all of b as one.
+	legacy := New()
+	if lr, lerr := legacy.UnmarshalBinaryVersion(b, BinaryLegacy); lerr == nil &&
+		(err != nil || len(lr) == 0) {
+		*ev = *legacy
+		return lr, nil
+	}
+	if Chk.E(err) {
 		return
 	}
-	*ev = *re
-	r = er.Buf[er.Pos:]
 	return
 }
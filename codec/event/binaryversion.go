@@ -0,0 +1,190 @@
+package event
+
+import (
+	"encoding/binary"
+	"io"
+
+	. "nostr.mleku.dev"
+)
+
+// Binary encoding versions.
+//
+// BinaryLegacy is the original layout written before versioning was added, it
+// has no header and starts directly with the event ID. Every later version
+// starts with BinaryMarker followed by the version byte.
+//
+// Records from version 1 onwards end with an extension block: a uvarint count
+// followed by that many uvarint type, uvarint length and value triplets.
+// Decoders skip extension types they don't know, so fields can be added in this
+// block without changing the version, and older decoders can still read newer
+// records. A new version is only needed when the layout of the fixed fields
+// changes.
+//
+// BinaryV2 is the BinaryV1 layout with a uvarint dictionary version after the
+// header and the tags compressed with that dictionary, see WriteTagsDict. The
+// content is written as in BinaryV1, most event content is too short for zstd
+// to shrink it much even with a shared dictionary. It is optional,
+// MarshalBinary writes BinaryVersion.
+const (
+	BinaryLegacy byte = iota
+	BinaryV1
+	BinaryV2
+	// BinaryVersion is the version written by MarshalBinary.
+	BinaryVersion = BinaryV1
+	// BinaryLatest is the newest version that can be decoded.
+	BinaryLatest = BinaryV2
+)
+
+// BinaryMarker prefixes versioned binary events. A legacy event whose ID
+// happens to start with the marker is still decoded correctly because decoding
+// falls back to the legacy layout unless the versioned decode uses the whole
+// record.
+var BinaryMarker = B{0xff, 0xfe}
+
+// BinaryHeaderLen is the length of the marker and version byte.
+const BinaryHeaderLen = 3
+
+// Extension is an optional field in the extension block of a versioned binary
+// event.
+type Extension struct {
+	Type  uint64
+	Value B
+}
+
+// BinaryVersionOf returns the version of a binary encoded event and the
+// remainder after the version header. A marker followed by a version that is
+// not known can only be the ID of a legacy event, which is returned whole.
+func BinaryVersionOf(b B) (version byte, rem B) {
+	if len(b) >= BinaryHeaderLen && Equals(b[:len(BinaryMarker)], BinaryMarker) {
+		if v := b[len(BinaryMarker)]; v > BinaryLegacy && v <= BinaryLatest {
+			return v, b[BinaryHeaderLen:]
+		}
+	}
+	return BinaryLegacy, b
+}
+
+// WriteHeader writes the version marker, nothing is written for BinaryLegacy.
+func (w *Writer) WriteHeader(version byte) (err E) {
+	if version == BinaryLegacy {
+		return
+	}
+	if version > BinaryLatest {
+		err = Errorf.E("unknown binary event version %d", version)
+		return
+	}
+	w.Buf = append(w.Buf, BinaryMarker...)
+	w.Buf = append(w.Buf, version)
+	return
+}
+
+// WriteExtensions writes the extension block.
+func (w *Writer) WriteExtensions(ext []Extension) (err E) {
+	w.Buf = appendUvarint(w.Buf, uint64(len(ext)))
+	for _, e := range ext {
+		w.Buf = appendUvarint(w.Buf, e.Type)
+		w.Buf = appendUvarint(w.Buf, uint64(len(e.Value)))
+		w.Buf = append(w.Buf, e.Value...)
+	}
+	return
+}
+
+// ReadExtensions reads the extension block, the values reference the buffer.
+func (r *Reader) ReadExtensions() (ext []Extension, err E) {
+	var n, t, l uint64
+	if n, err = r.readUvarint(); err != nil {
+		return
+	}
+	for range n {
+		if t, err = r.readUvarint(); err != nil {
+			return
+		}
+		if l, err = r.readUvarint(); err != nil {
+			return
+		}
+		if l > uint64(len(r.Buf)-r.Pos) {
+			err = io.EOF
+			return
+		}
+		ext = append(ext, Extension{Type: t, Value: r.Buf[r.Pos : r.Pos+int(l)]})
+		r.Pos += int(l)
+	}
+	return
+}
+
+func (r *Reader) readUvarint() (v uint64, err E) {
+	if r.Pos >= len(r.Buf) {
+		err = io.EOF
+		return
+	}
+	var n int
+	if v, n = binary.Uvarint(r.Buf[r.Pos:]); n <= 0 {
+		err = io.EOF
+		return
+	}
+	r.Pos += n
+	return
+}
+
+// MarshalBinaryVersion encodes the event in the given binary version, use this
+// to write records for readers that don't know the current version. BinaryV2
+// uses DefaultDict.
+func (ev *T) MarshalBinaryVersion(dst B, version byte) (b B, err E) {
+	if version == BinaryV2 {
+		return ev.MarshalBinaryDict(dst, DefaultDict)
+	}
+	w := NewWriteBuffer(dst, BinaryHeaderLen+EstimateSize(ev)+1)
+	if err = w.WriteHeader(version); Chk.E(err) {
+		return
+	}
+	if err = w.WriteEvent(ev); Chk.E(err) {
+		return
+	}
+	if version != BinaryLegacy {
+		if err = w.WriteExtensions(nil); Chk.E(err) {
+			return
+		}
+	}
+	b = w.Bytes()
+	return
+}
+
+// UnmarshalBinaryVersion decodes an event with the layout of the given version,
+// the version header must already have been removed.
+func (ev *T) UnmarshalBinaryVersion(b B, version byte) (r B, err E) {
+	er := &Reader{Buf: b}
+	var re *T
+	switch version {
+	case BinaryLegacy, BinaryV1:
+		re, err = er.ReadEvent()
+	case BinaryV2:
+		re, err = er.ReadEventDict()
+	default:
+		err = Errorf.E("unknown binary event version %d", version)
+	}
+	if err != nil {
+		return
+	}
+	if version != BinaryLegacy {
+		// there are no extensions defined yet, so they are all skipped.
+		if _, err = er.ReadExtensions(); err != nil {
+			return
+		}
+	}
+	*ev = *re
+	r = er.Buf[er.Pos:]
+	return
+}
+
+// MigrateBinary decodes a binary event of any known version from src and
+// appends it to dst encoded with the current version, returning the remainder
+// of src after the event.
+func MigrateBinary(dst, src B) (b, rem B, err E) {
+	ev := New()
+	if rem, err = ev.UnmarshalBinary(src); Chk.E(err) {
+		return
+	}
+	if b, err = ev.MarshalBinary(dst); Chk.E(err) {
+		return
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event/examples"
+)
+
+func exampleEvents(t testing.TB, max int) (evs []*T) {
+	scanner := bufio.NewScanner(bytes.NewBuffer(examples.Cache))
+	buf := make(B, 1_000_000)
+	scanner.Buffer(buf, len(buf))
+	for scanner.Scan() && len(evs) < max {
+		ev := New()
+		if _, err := ev.UnmarshalJSON(append(B{}, scanner.Bytes()...)); Chk.E(err) {
+			t.Fatal(err)
+		}
+		// skip the events with malformed `a` tags
+		if _, err := ev.MarshalBinary(nil); err != nil {
+			continue
+		}
+		evs = append(evs, ev)
+	}
+	return
+}
+
+func TestBinaryVersions(t *testing.T) {
+	var err error
+	for _, ev := range exampleEvents(t, 1000) {
+		for _, version := range []byte{BinaryLegacy, BinaryV1, BinaryV2} {
+			var b B
+			if b, err = ev.MarshalBinaryVersion(nil, version); Chk.E(err) {
+				t.Fatal(err)
+			}
+			if v, _ := BinaryVersionOf(b); v != version {
+				t.Fatalf("encoded version %d, got %d", version, v)
+			}
+			ev2 := New()
+			var rem B
+			if rem, err = ev2.UnmarshalBinary(b); Chk.E(err) {
+				t.Fatal(err)
+			}
+			if len(rem) > 0 {
+				t.Fatalf("version %d: %d bytes remaining", version, len(rem))
+			}
+			if !Equals(ev.Serialize(), ev2.Serialize()) {
+				t.Fatalf("version %d: got\n%s\nexpected\n%s", version,
+					ev2.Serialize(), ev.Serialize())
+			}
+		}
+	}
+}
+
+func TestMigrateBinary(t *testing.T) {
+	var err error
+	for _, ev := range exampleEvents(t, 100) {
+		var legacy, migrated, current, rem B
+		if legacy, err = ev.MarshalBinaryVersion(nil, BinaryLegacy); Chk.E(err) {
+			t.Fatal(err)
+		}
+		if migrated, rem, err = MigrateBinary(nil, legacy); Chk.E(err) {
+			t.Fatal(err)
+		}
+		if len(rem) > 0 {
+			t.Fatalf("%d bytes remaining", len(rem))
+		}
+		if current, err = ev.MarshalBinary(nil); Chk.E(err) {
+			t.Fatal(err)
+		}
+		if !Equals(migrated, current) {
+			t.Fatalf("migrated\n%0x\nexpected\n%0x", migrated, current)
+		}
+	}
+}
+
+func TestBinaryUnknownExtension(t *testing.T) {
+	ev := exampleEvents(t, 1)[0]
+	w := NewBufForEvent(nil, ev)
+	_ = w.WriteHeader(BinaryV1)
+	if err := w.WriteEvent(ev); Chk.E(err) {
+		t.Fatal(err)
+	}
+	_ = w.WriteExtensions([]Extension{{Type: 1 << 20, Value: B("from the future")}})
+	w.Buf = append(w.Buf, "trailing"...)
+	ev2 := New()
+	rem, err := ev2.UnmarshalBinary(w.Bytes())
+	if Chk.E(err) {
+		t.Fatal(err)
+	}
+	if S(rem) != "trailing" {
+		t.Fatalf("unexpected remainder '%s'", rem)
+	}
+	if !Equals(ev.Serialize(), ev2.Serialize()) {
+		t.Fatalf("got\n%s\nexpected\n%s", ev2.Serialize(), ev.Serialize())
+	}
+	// a marker with an unknown version is the start of a legacy event ID.
+	b := append(B{}, w.Bytes()...)
+	b[2] = BinaryLatest + 1
+	if v, rem := BinaryVersionOf(b); v != BinaryLegacy || len(rem) != len(b) {
+		t.Fatalf("got version %d and %d bytes", v, len(rem))
+	}
+	ev3 := New()
+	if _, err = ev3.UnmarshalBinary(b); err == nil &&
+		Equals(ev3.Serialize(), ev.Serialize()) {
+		t.Fatal("decoded an unknown version as a versioned event")
+	}
+}
+
+func TestBinaryLegacyMarkerID(t *testing.T) {
+	for _, ev := range exampleEvents(t, 50) {
+		for _, version := range []byte{BinaryLegacy, BinaryV1, BinaryV2, BinaryLatest + 1} {
+			// a legacy record whose ID starts with the version marker.
+			l := *ev
+			l.ID = append(append(append(B{}, BinaryMarker...), version), ev.ID[3:]...)
+			b, err := l.MarshalBinaryVersion(nil, BinaryLegacy)
+			if Chk.E(err) {
+				t.Fatal(err)
+			}
+			ev2 := New()
+			var rem B
+			if rem, err = ev2.UnmarshalBinary(b); Chk.E(err) {
+				t.Fatalf("version %d: %v", version, err)
+			}
+			if len(rem) > 0 {
+				t.Fatalf("version %d: %d bytes remaining", version, len(rem))
+			}
+			if !Equals(l.Serialize(), ev2.Serialize()) {
+				t.Fatalf("version %d: got\n%s\nexpected\n%s", version,
+					ev2.Serialize(), l.Serialize())
+			}
+		}
+	}
+}
+
+func FuzzUnmarshalBinary(f *testing.F) {
+	for _, ev := range exampleEvents(f, 20) {
+		for _, version := range []byte{BinaryLegacy, BinaryV1, BinaryV2} {
+			b, _ := ev.MarshalBinaryVersion(nil, version)
+			f.Add(b)
+		}
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ev := New()
+		if _, err := ev.UnmarshalBinary(b); err != nil {
+			return
+		}
+		// anything that decodes must encode and decode to the same event
+		enc, err := ev.MarshalBinary(nil)
+		if err != nil {
+			return
+		}
+		ev2 := New()
+		if _, err = ev2.UnmarshalBinary(enc); err != nil {
+			t.Fatalf("re-encoded event failed to decode: %v", err)
+		}
+		if !Equals(ev.Serialize(), ev2.Serialize()) {
+			t.Fatalf("got\n%s\nexpected\n%s", ev2.Serialize(), ev.Serialize())
+		}
+	})
+}
@@ -10,6 +10,9 @@ import (
 	. "nostr.mleku.dev"
 
 	"nostr.mleku.dev/codec/event/examples"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
 	"nostr.mleku.dev/crypto/p256k"
 )
 
@@ -88,6 +91,46 @@ func TestT_SignWithSecKey(t *testing.T) {
 	}
 }
 
+func TestT_Sign(t *testing.T) {
+	signer := new(p256k.Signer)
+	if err := signer.Generate(); Chk.E(err) {
+		t.Fatal(err)
+	}
+	// an event with no pubkey yet must be signed over the ID that includes it.
+	ev := &T{CreatedAt: timestamp.FromUnix(1), Kind: kind.TextNote, Tags: tags.New(),
+		Content: B("hi")}
+	if err := ev.Sign(signer); Chk.E(err) {
+		t.Fatal(err)
+	}
+	if !Equals(ev.PubKey, signer.Pub()) || !Equals(ev.ID, ev.GetIDBytes()) {
+		t.Fatalf("signed with the wrong ID\n%s", ev.Serialize())
+	}
+	if valid, err := ev.CheckSignature(); Chk.E(err) || !valid {
+		t.Fatalf("invalid signature\n%s", ev.Serialize())
+	}
+}
+
+func TestUnsignedJSON(t *testing.T) {
+	ev := &T{CreatedAt: timestamp.FromUnix(1), Kind: kind.TextNote, Tags: tags.New(),
+		Content: B("hi")}
+	b, err := ev.MarshalJSON(nil)
+	if Chk.E(err) {
+		t.Fatal(err)
+	}
+	if S(b) != `{"created_at":1,"kind":1,"tags":[],"content":"hi"}` {
+		t.Fatalf("got %s", b)
+	}
+	if _, err = New().UnmarshalJSON(b); Chk.E(err) {
+		t.Fatal(err)
+	}
+	for _, k := range []S{"id", "pubkey", "sig"} {
+		b = B(`{"` + k + `":"","created_at":1,"kind":1,"tags":[],"content":"hi"}`)
+		if _, err = New().UnmarshalJSON(b); err == nil {
+			t.Fatalf("accepted an empty %s", k)
+		}
+	}
+}
+
 func TestBinaryEvents(t *testing.T) {
 	var err error
 	var ev, ev2 *T
@@ -0,0 +1,56 @@
+package event
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+)
+
+func FuzzUnmarshalJSON(f *testing.F) {
+	for _, ev := range exampleEvents(f, 50) {
+		f.Add(ev.Serialize())
+	}
+	f.Add(B(`{"created_at":0,"kind":0,"tags":[],"content":""}`))
+	f.Add(B(`{"kind":1,"content":"é\\\"\n","tags":[["e"],[]]}`))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ev := New()
+		if _, err := ev.UnmarshalJSON(append(B{}, b...)); err != nil {
+			return
+		}
+		m1, err := ev.MarshalJSON(nil)
+		if err != nil {
+			return
+		}
+		ev2 := New()
+		if _, err = ev2.UnmarshalJSON(append(B{}, m1...)); err != nil {
+			t.Fatalf("failed to decode own encoding: %v\ninput %q\nencoded %q",
+				err, b, m1)
+		}
+		var m2 B
+		if m2, err = ev2.MarshalJSON(nil); err != nil {
+			t.Fatal(err)
+		}
+		if !Equals(m1, m2) {
+			t.Fatalf("encoding not stable\ninput %q\nfirst %q\nsecond %q", b,
+				m1, m2)
+		}
+		// the canonical form is used for the ID and must not panic either
+		_ = ev.GetIDBytes()
+	})
+}
+
+func FuzzUnmarshalJSONStrict(f *testing.F) {
+	for _, ev := range exampleEvents(f, 50) {
+		f.Add(ev.Serialize())
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ev := New()
+		if _, err := ev.UnmarshalJSONStrict(append(B{}, b...)); err != nil {
+			return
+		}
+		// an accepted event must be accepted again in its canonical encoding
+		if _, err := New().UnmarshalJSONStrict(ev.Serialize()); err != nil {
+			t.Fatalf("%v\ninput %q\nencoded %q", err, b, ev.Serialize())
+		}
+	})
+}
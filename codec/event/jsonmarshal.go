@@ -9,14 +9,17 @@ import (
 func (ev *T) MarshalJSON(dst B) (b B, err error) {
 	// open parentheses
 	dst = append(dst, '{')
-	// ID
-	dst = text.JSONKey(dst, jId)
-	dst = text.AppendQuote(dst, ev.ID, hex.EncAppend)
-	dst = append(dst, ',')
-	// PubKey
-	dst = text.JSONKey(dst, jPubkey)
-	dst = text.AppendQuote(dst, ev.PubKey, hex.EncAppend)
-	dst = append(dst, ',')
+	// ID and PubKey are left out of unsigned events rather than written empty.
+	if len(ev.ID) > 0 {
+		dst = text.JSONKey(dst, jId)
+		dst = text.AppendQuote(dst, ev.ID, hex.EncAppend)
+		dst = append(dst, ',')
+	}
+	if len(ev.PubKey) > 0 {
+		dst = text.JSONKey(dst, jPubkey)
+		dst = text.AppendQuote(dst, ev.PubKey, hex.EncAppend)
+		dst = append(dst, ',')
+	}
 	// CreatedAt
 	dst = text.JSONKey(dst, jCreatedAt)
 	if dst, err = ev.CreatedAt.MarshalJSON(dst); Chk.E(err) {
@@ -34,10 +37,12 @@ func (ev *T) MarshalJSON(dst B) (b B, err error) {
 	// Content
 	dst = text.JSONKey(dst, jContent)
 	dst = text.AppendQuote(dst, ev.Content, text.NostrEscape)
-	dst = append(dst, ',')
-	// jSig
-	dst = text.JSONKey(dst, jSig)
-	dst = text.AppendQuote(dst, ev.Sig, hex.EncAppend)
+	// Sig
+	if len(ev.Sig) > 0 {
+		dst = append(dst, ',')
+		dst = text.JSONKey(dst, jSig)
+		dst = text.AppendQuote(dst, ev.Sig, hex.EncAppend)
+	}
 	// close parentheses
 	dst = append(dst, '}')
 	b = dst
@@ -49,6 +49,11 @@ InKV:
 	}
 	goto eof
 InVal:
+	// keys are told apart by their first two bytes, a shorter one is not a key
+	// of an event.
+	if len(key) < 2 {
+		goto invalid
+	}
 	switch key[0] {
 	case jId[0]:
 		if !Equals(jId, key) {
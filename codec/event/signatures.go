@@ -11,11 +11,12 @@ import (
 // Sign the event using the nostr.Signer. Uses github.com/bitcoin-core/secp256k1 if available for much faster
 // signatures.
 func (ev *T) Sign(keys crypto.Signer) (err error) {
+	// the pubkey is part of the canonical form the ID is the hash of.
+	ev.PubKey = keys.Pub()
 	ev.ID = ev.GetIDBytes()
 	if ev.Sig, err = keys.Sign(ev.ID); Chk.E(err) {
 		return
 	}
-	ev.PubKey = keys.Pub()
 	return
 }
 
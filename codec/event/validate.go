@@ -0,0 +1,271 @@
+package event
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"ec.mleku.dev/v2/schnorr"
+	"github.com/minio/sha256-simd"
+	. "nostr.mleku.dev"
+)
+
+// ValidationError is the error returned by Validate and UnmarshalJSONStrict. It
+// names the field that failed, and its message starts with the NIP-01 `invalid:`
+// prefix so a relay can send it as the reason of an OK envelope as it is.
+type ValidationError struct {
+	// Field is the JSON key of the field that failed, or "event" if the JSON
+	// object itself is malformed.
+	Field S
+	// Reason describes what is wrong with the field.
+	Reason S
+}
+
+func (e *ValidationError) Error() S { return "invalid: " + e.Field + ": " + e.Reason }
+
+func invalid(field S, format S, a ...any) *ValidationError {
+	return &ValidationError{Field: field, Reason: fmt.Sprintf(format, a...)}
+}
+
+// Validate checks that the event has the fields NIP-01 requires with the right
+// lengths and that the ID is the hash of the canonical form of the event. It
+// does not verify the signature, use Verify for that.
+func (ev *T) Validate() (err E) {
+	if len(ev.ID) != sha256.Size {
+		return invalid(S(jId), "must be %d bytes, got %d", sha256.Size, len(ev.ID))
+	}
+	if len(ev.PubKey) != schnorr.PubKeyBytesLen {
+		return invalid(S(jPubkey), "must be %d bytes, got %d",
+			schnorr.PubKeyBytesLen, len(ev.PubKey))
+	}
+	if len(ev.Sig) != schnorr.SignatureSize {
+		return invalid(S(jSig), "must be %d bytes, got %d", schnorr.SignatureSize,
+			len(ev.Sig))
+	}
+	if ev.CreatedAt == nil {
+		return invalid(S(jCreatedAt), "missing")
+	}
+	// the kind is a uint16 so it can't be out of range once decoded, the strict
+	// decoder checks the JSON value.
+	if ev.Kind == nil {
+		return invalid(S(jKind), "missing")
+	}
+	if ev.Tags != nil {
+		for i, t := range ev.Tags.T {
+			if t == nil {
+				return invalid(S(jTags), "tag %d is null", i)
+			}
+		}
+	}
+	if !Equals(ev.GetIDBytes(), ev.ID) {
+		return invalid(S(jId), "does not match the hash of the event")
+	}
+	return
+}
+
+// UnmarshalJSONStrict decodes an event like UnmarshalJSON, but first rejects
+// JSON that NIP-01 does not allow and UnmarshalJSON accepts: duplicate, missing
+// or unknown keys, hex that is not lowercase or not the right length, escapes
+// other than the seven NIP-01 escapes, invalid UTF-8, kinds out of range and tags
+// that are not arrays of strings. The decoded event is then checked with
+// Validate. All errors are a *ValidationError.
+func (ev *T) UnmarshalJSONStrict(b B) (r B, err E) {
+	s := &strict{b: b}
+	if err = s.event(); err != nil {
+		return
+	}
+	if r, err = ev.UnmarshalJSON(b); err != nil {
+		return nil, invalid("event", "%s", err.Error())
+	}
+	if err = ev.Validate(); err != nil {
+		return
+	}
+	return
+}
+
+// strict is a scanner that checks the JSON of an event without decoding it.
+type strict struct {
+	b   B
+	pos int
+}
+
+func (s *strict) ws() {
+	for s.pos < len(s.b) {
+		switch s.b[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// next skips whitespace and consumes c if it is the next character.
+func (s *strict) next(c byte) bool {
+	s.ws()
+	if s.pos < len(s.b) && s.b[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+func (s *strict) event() (err E) {
+	if !s.next('{') {
+		return invalid("event", "not a JSON object")
+	}
+	seen := make(map[S]bool)
+	for !s.next('}') {
+		if len(seen) > 0 && !s.next(',') {
+			return invalid("event", "expected ',' or '}' at offset %d", s.pos)
+		}
+		var key B
+		if key, err = s.str("event"); err != nil {
+			return
+		}
+		k := S(key)
+		if seen[k] {
+			return invalid(k, "duplicate key")
+		}
+		seen[k] = true
+		if !s.next(':') {
+			return invalid(k, "expected ':' at offset %d", s.pos)
+		}
+		switch k {
+		case S(jId), S(jPubkey):
+			err = s.hex(k, 32)
+		case S(jSig):
+			err = s.hex(k, 64)
+		case S(jCreatedAt):
+			err = s.integer(k, math.MaxInt64)
+		case S(jKind):
+			err = s.integer(k, math.MaxUint16)
+		case S(jTags):
+			err = s.tags()
+		case S(jContent):
+			_, err = s.str(k)
+		default:
+			return invalid(k, "unknown key")
+		}
+		if err != nil {
+			return
+		}
+	}
+	for _, k := range []B{jId, jPubkey, jCreatedAt, jKind, jTags, jContent, jSig} {
+		if !seen[S(k)] {
+			return invalid(S(k), "missing")
+		}
+	}
+	return
+}
+
+// str reads a string and returns its raw content, without unescaping.
+func (s *strict) str(field S) (raw B, err E) {
+	if !s.next('"') {
+		return nil, invalid(field, "expected a string at offset %d", s.pos)
+	}
+	start := s.pos
+	for ; s.pos < len(s.b); s.pos++ {
+		switch c := s.b[s.pos]; {
+		case c == '"':
+			raw = s.b[start:s.pos]
+			s.pos++
+			if !utf8.Valid(raw) {
+				return nil, invalid(field, "invalid UTF-8")
+			}
+			return
+		case c == '\\':
+			s.pos++
+			if s.pos == len(s.b) {
+				return nil, invalid(field, "unterminated string")
+			}
+			// text.NostrEscape passes \u through as it is, whether or not it is
+			// a \uXXXX escape.
+			switch s.b[s.pos] {
+			case '"', '\\', 'b', 'f', 'n', 'r', 't', 'u':
+			default:
+				return nil, invalid(field, "non-canonical escape '\\%c'",
+					s.b[s.pos])
+			}
+		case c == '\b', c == '\t', c == '\n', c == '\f', c == '\r':
+			// NIP-01 escapes these, and only these, control characters.
+			return nil, invalid(field, "unescaped control character 0x%02x", c)
+		}
+	}
+	return nil, invalid(field, "unterminated string")
+}
+
+// hex reads a string that must be n bytes of lowercase hexadecimal.
+func (s *strict) hex(field S, n int) (err E) {
+	var raw B
+	if raw, err = s.str(field); err != nil {
+		return
+	}
+	if len(raw) != n*2 {
+		return invalid(field, "must be %d hex characters, got %d", n*2, len(raw))
+	}
+	for _, c := range raw {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return invalid(field, "must be lowercase hex, found '%c'", c)
+		}
+	}
+	return
+}
+
+// integer reads a non-negative integer no larger than max.
+func (s *strict) integer(field S, max uint64) (err E) {
+	s.ws()
+	start := s.pos
+	for s.pos < len(s.b) && s.b[s.pos] >= '0' && s.b[s.pos] <= '9' {
+		s.pos++
+	}
+	raw := s.b[start:s.pos]
+	if len(raw) == 0 {
+		return invalid(field, "expected a non-negative integer at offset %d",
+			start)
+	}
+	if len(raw) > 1 && raw[0] == '0' {
+		return invalid(field, "leading zero")
+	}
+	if s.pos < len(s.b) {
+		switch s.b[s.pos] {
+		case '.', 'e', 'E':
+			return invalid(field, "must be an integer")
+		}
+	}
+	var n uint64
+	if n, err = strconv.ParseUint(S(raw), 10, 64); err != nil || n > max {
+		return invalid(field, "out of range, maximum is %d", max)
+	}
+	return
+}
+
+func (s *strict) tags() (err E) {
+	if !s.next('[') {
+		return invalid(S(jTags), "must be an array")
+	}
+	for i := 0; !s.next(']'); i++ {
+		if i > 0 && !s.next(',') {
+			return invalid(S(jTags), "expected ',' or ']' at offset %d", s.pos)
+		}
+		if !s.next('[') {
+			return invalid(S(jTags), "tag %d is not an array", i)
+		}
+		for j := 0; !s.next(']'); j++ {
+			if j > 0 && !s.next(',') {
+				return invalid(S(jTags), "tag %d: expected ',' or ']' at offset %d",
+					i, s.pos)
+			}
+			s.ws()
+			if s.pos == len(s.b) || s.b[s.pos] != '"' {
+				return invalid(S(jTags), "tag %d element %d is not a string", i, j)
+			}
+			if _, err = s.str(S(jTags)); err != nil {
+				return invalid(S(jTags), "tag %d element %d: %s", i, j,
+					err.(*ValidationError).Reason)
+			}
+		}
+	}
+	return
+}
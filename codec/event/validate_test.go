@@ -0,0 +1,84 @@
+package event
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto/p256k"
+)
+
+func TestUnmarshalJSONStrict(t *testing.T) {
+	evs := exampleEvents(t, 200)
+	for _, ev := range evs {
+		b := ev.Serialize()
+		ev2 := New()
+		if _, err := ev2.UnmarshalJSONStrict(b); err != nil {
+			t.Fatalf("%v\n%s", err, ev.Serialize())
+		}
+	}
+	valid := S(evs[0].Serialize())
+	id, pk := evs[0].IDString(), evs[0].PubKeyString()
+	for _, c := range []struct{ json, field S }{
+		{`[]`, "event"},
+		{strings.Replace(valid, `"kind":`, `"kind":1,"kind":`, 1), "kind"},
+		{strings.Replace(valid, `"content":`, `"extra":1,"content":`, 1), "extra"},
+		{strings.Replace(valid, `,"sig":`, `,"Sig":`, 1), "Sig"},
+		{strings.Replace(valid, id, strings.ToUpper(id), 1), "id"},
+		{strings.Replace(valid, id, id[:62], 1), "id"},
+		{strings.Replace(valid, pk, pk+"00", 1), "pubkey"},
+		{strings.Replace(valid, `"kind":`, `"kind":70000,"x":`, 1), "kind"},
+		{strings.Replace(valid, `"created_at":`, `"created_at":-`, 1), "created_at"},
+		{strings.Replace(valid, `"tags":[`, `"tags":[1,`, 1), "tags"},
+		{strings.Replace(valid, `"tags":[`, `"tags":[[1],`, 1), "tags"},
+		{strings.Replace(valid, `"content":"`, `"content":"\/`, 1), "content"},
+		{strings.Replace(valid, `"content":"`, `"content":"`+"\t", 1), "content"},
+		{strings.Replace(valid, `"content":"`, `"content":"x`, 1), "id"},
+		{strings.Replace(valid, `,"sig":"`+evs[0].SigString()+`"`, ``, 1), "sig"},
+	} {
+		_, err := New().UnmarshalJSONStrict(B(c.json))
+		var ve *ValidationError
+		if !errors.As(err, &ve) {
+			t.Fatalf("expected validation error on field %s, got %v\n%s",
+				c.field, err, c.json)
+		}
+		if ve.Field != c.field {
+			t.Fatalf("expected error on field %s, got %v\n%s", c.field, err, c.json)
+		}
+		if !strings.HasPrefix(err.Error(), "invalid: ") {
+			t.Fatalf("error has no invalid prefix: %v", err)
+		}
+	}
+}
+
+func TestUnmarshalJSONStrictSigned(t *testing.T) {
+	signer := new(p256k.Signer)
+	if err := signer.Generate(); Chk.E(err) {
+		t.Fatal(err)
+	}
+	// a raw control character as this library writes it, and \u escapes as
+	// other clients write them.
+	for _, content := range []S{"a\x01b", `a\u0001b`, `\user`, "\x1f\t\"\\"} {
+		ev := &T{CreatedAt: timestamp.Now(), Kind: kind.TextNote, Tags: tags.New(),
+			Content: B(content)}
+		if err := ev.Sign(signer); Chk.E(err) {
+			t.Fatal(err)
+		}
+		b, err := ev.MarshalJSON(nil)
+		if Chk.E(err) {
+			t.Fatal(err)
+		}
+		ev2 := New()
+		if _, err = ev2.UnmarshalJSONStrict(b); err != nil {
+			t.Fatalf("%q: %v\n%s", content, err, b)
+		}
+		if S(ev2.Content) != content {
+			t.Fatalf("got content %q want %q", ev2.Content, content)
+		}
+	}
+}
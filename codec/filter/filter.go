@@ -2,6 +2,7 @@ package filter
 
 import (
 	"encoding/binary"
+	"io"
 	"sort"
 
 	"ec.mleku.dev/v2/schnorr"
@@ -9,9 +10,11 @@ import (
 	"github.com/minio/sha256-simd"
 	"lukechampine.com/frand"
 	. "nostr.mleku.dev"
+	"nostr.mleku.dev/codec/delegation"
 	"nostr.mleku.dev/codec/event"
 	"nostr.mleku.dev/codec/kind"
 	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/search"
 	"nostr.mleku.dev/codec/tag"
 	"nostr.mleku.dev/codec/tags"
 	"nostr.mleku.dev/codec/text"
@@ -38,6 +41,10 @@ type T struct {
 	Until   *timestamp.T `json:"until,omitempty"`
 	Search  B            `json:"search,omitempty"`
 	Limit   int          `json:"limit,omitempty"`
+	// query is Search parsed when the filter was decoded, and searched is the
+	// Search it was parsed from.
+	query    *search.Query
+	searched S
 }
 
 func New() (f *T) {
@@ -58,7 +65,7 @@ func New() (f *T) {
 // management code to act as a reference counter, and making a clone implicitly means 1
 // reference.
 func (f *T) Clone() (clone *T) {
-	return &T{
+	clone = &T{
 		IDs:     f.IDs,
 		Kinds:   f.Kinds,
 		Authors: f.Authors,
@@ -68,6 +75,8 @@ func (f *T) Clone() (clone *T) {
 		Search:  f.Search,
 		Limit:   2,
 	}
+	clone.query, clone.searched = f.query, f.searched
+	return
 }
 
 var (
@@ -236,7 +245,7 @@ func (f *T) UnmarshalJSON(b B) (r B, err error) {
 	r = b[:]
 	var key B
 	var state int
-	for ; len(r) >= 0; r = r[1:] {
+	for ; len(r) > 0; r = r[1:] {
 		// Log.I.F("%c", rem[0])
 		switch state {
 		case beforeOpen:
@@ -267,6 +276,9 @@ func (f *T) UnmarshalJSON(b B) (r B, err error) {
 			}
 			switch key[0] {
 			case '#':
+				if len(key) < 2 {
+					goto invalid
+				}
 				k := make(B, len(key))
 				copy(k, key)
 				// r = r[1:]
@@ -354,6 +366,7 @@ func (f *T) UnmarshalJSON(b B) (r B, err error) {
 						return
 					}
 					f.Search = txt
+					f.query, f.searched = search.Parse(S(txt)), S(txt)
 					// Log.I.F("\n%s\n%s", txt, rem)
 					state = betweenKV
 					// Log.I.Ln("betweenKV")
@@ -397,12 +410,32 @@ func (f *T) UnmarshalJSON(b B) (r B, err error) {
 			return
 		}
 	}
+	err = io.EOF
+	return
 invalid:
 	err = Errorf.E("invalid key,\n'%s'\n'%s'", S(b), S(r))
 	return
 }
 
-func (f *T) Matches(ev *event.T) bool {
+// Query returns the NIP-50 query of Search. It is parsed once when the filter is
+// decoded, and again on each call if Search has been changed since.
+func (f *T) Query() (q *search.Query) {
+	if f.query != nil && f.searched == S(f.Search) {
+		return f.query
+	}
+	return search.Parse(S(f.Search))
+}
+
+// Matches reports whether the event matches the filter. An event matches a
+// NIP-50 search if its text has every term of it.
+func (f *T) Matches(ev *event.T) bool { return f.matches(ev, false) }
+
+// MatchesDelegated is Matches, except that an event with a valid NIP-26
+// delegation tag also matches the authors of the filter if the delegator is one
+// of them.
+func (f *T) MatchesDelegated(ev *event.T) bool { return f.matches(ev, true) }
+
+func (f *T) matches(ev *event.T, delegated bool) bool {
 	if ev == nil {
 		// Log.T.F("nil event")
 		return false
@@ -416,8 +449,14 @@ func (f *T) Matches(ev *event.T) bool {
 		return false
 	}
 	if f.Authors != nil && len(f.Authors.Field) > 0 && !f.Authors.Contains(ev.PubKey) {
-		// Log.T.F("no matching authors in filter\nEVENT %s\nFILTER %s", ev.ToObject().String(), f.ToObject().String())
-		return false
+		if !delegated {
+			// Log.T.F("no matching authors in filter\nEVENT %s\nFILTER %s", ev.ToObject().String(), f.ToObject().String())
+			return false
+		}
+		if d, err := delegation.Delegator(ev); err != nil || d == nil ||
+			!f.Authors.Contains(d) {
+			return false
+		}
 	}
 	if f.Tags != nil && !ev.Tags.Intersects(f.Tags) {
 		return false
@@ -430,6 +469,9 @@ func (f *T) Matches(ev *event.T) bool {
 		// Log.T.F("event is newer than until\nEVENT %s\nFILTER %s", ev.ToObject().String(), f.ToObject().String())
 		return false
 	}
+	if len(f.Search) > 0 && !f.Query().Match(ev) {
+		return false
+	}
 	return true
 }
 
@@ -4,6 +4,15 @@ import (
 	"testing"
 
 	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/delegation"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto/p256k"
 )
 
 func TestT_MarshalUnmarshal(t *testing.T) {
@@ -34,3 +43,67 @@ func TestT_MarshalUnmarshal(t *testing.T) {
 		dst, dst1, dst2 = dst[:0], dst1[:0], dst2[:0]
 	}
 }
+
+func TestMatchesDelegated(t *testing.T) {
+	delegator, delegatee := &p256k.Signer{}, &p256k.Signer{}
+	if err := delegator.Generate(); Chk.E(err) {
+		t.Fatal(err)
+	}
+	if err := delegatee.Generate(); Chk.E(err) {
+		t.Fatal(err)
+	}
+	d, err := delegation.New(delegator, delegatee.Pub(),
+		&delegation.Conditions{Kinds: kinds.New(kind.TextNote)})
+	if Chk.E(err) {
+		t.Fatal(err)
+	}
+	ev := &event.T{Kind: kind.TextNote, CreatedAt: timestamp.Now(), Tags: tags.New()}
+	d.Attach(ev)
+	if err = ev.Sign(delegatee); Chk.E(err) {
+		t.Fatal(err)
+	}
+	f := New()
+	f.Authors.Append(delegator.Pub())
+	if f.Matches(ev) {
+		t.Fatal("only MatchesDelegated should count the delegator as an author")
+	}
+	if !f.MatchesDelegated(ev) {
+		t.Fatal("expected the delegator to match")
+	}
+	// the delegation only covers text notes
+	ev.Kind = kind.Reaction
+	if f.MatchesDelegated(ev) {
+		t.Fatal("expected a kind outside the conditions not to match")
+	}
+}
+
+func TestMatchesSearch(t *testing.T) {
+	ev := &event.T{Kind: kind.TextNote, CreatedAt: timestamp.Now(),
+		Tags: tags.New(tag.New("t", "Bitcoin")), Content: B("Best Nostr apps, 2024")}
+	for s, match := range map[S]bool{
+		"":                            true,
+		"nostr apps":                  true,
+		"NOSTR bitcoin":               true,
+		"nostr apps include:spam":     true,
+		"language:en":                 true,
+		"nostr clients":               false,
+		"https://nostr.com best apps": false,
+	} {
+		f := New()
+		f.Search = B(s)
+		if f.Matches(ev) != match {
+			t.Fatalf("search %q: expected match %v", s, match)
+		}
+	}
+	// a decoded filter parses its search once.
+	f := New()
+	if _, err := f.UnmarshalJSON(B(`{"search":"nostr apps"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if q := f.Query(); q != f.Query() || q != f.Clone().Query() || !f.Matches(ev) {
+		t.Fatal("search was not parsed once")
+	}
+	if f.Search = B("nostr clients"); f.Matches(ev) {
+		t.Fatal("a changed search was not parsed again")
+	}
+}
@@ -0,0 +1,139 @@
+// Package hll is the HyperLogLog sketch of NIP-45, which relays return with
+// COUNT responses so that clients can merge the counts of several relays
+// without counting the same author twice.
+//
+// A sketch has 256 registers. The register of a pubkey is its byte at an offset
+// taken from the filter, and its value is one more than the leading zero bits of
+// the bytes after it.
+package hll
+
+import (
+	"math"
+	"math/bits"
+	"strings"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/filter"
+	"util.mleku.dev/hex"
+)
+
+// M is the number of registers.
+const M = 256
+
+// T is a HyperLogLog sketch.
+type T struct {
+	Registers [M]uint8
+}
+
+// New creates an empty sketch.
+func New() *T { return &T{} }
+
+// FromBytes reads a sketch from its 256 registers.
+func FromBytes(b B) (h *T, err E) {
+	if len(b) != M {
+		return nil, Errorf.E("hll must be %d bytes, got %d", M, len(b))
+	}
+	h = New()
+	copy(h.Registers[:], b)
+	return
+}
+
+// Bytes returns the registers of the sketch.
+func (h *T) Bytes() B { return append(B{}, h.Registers[:]...) }
+
+// Add counts a pubkey, with the offset of the filter that matched its event.
+func (h *T) Add(offset N, pub B) {
+	if offset < 0 || offset >= len(pub) {
+		return
+	}
+	v := 1
+	for _, b := range pub[offset+1:] {
+		v += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	if v > math.MaxUint8 {
+		v = math.MaxUint8
+	}
+	ri := pub[offset]
+	if uint8(v) > h.Registers[ri] {
+		h.Registers[ri] = uint8(v)
+	}
+}
+
+// Merge adds the counts of another sketch made with the same offset, as from
+// another relay.
+func (h *T) Merge(o *T) {
+	for i, v := range o.Registers {
+		if v > h.Registers[i] {
+			h.Registers[i] = v
+		}
+	}
+}
+
+// Estimate returns the approximate number of distinct pubkeys counted.
+func (h *T) Estimate() N {
+	var sum float64
+	var zeros N
+	for _, v := range h.Registers {
+		sum += math.Ldexp(1, -N(v))
+		if v == 0 {
+			zeros++
+		}
+	}
+	m := float64(M)
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// small counts are better estimated by the registers still empty.
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return N(math.Round(e))
+}
+
+// Offset returns the register offset for a filter, and false if the filter is
+// not one a sketch can be made for: it must have a single tag with a single
+// value that is an event id or pubkey, or an address, whose 33rd hex digit plus
+// 8 is the offset.
+func Offset(f *filter.T) (offset N, ok bool) {
+	if f == nil || f.Tags == nil || f.Tags.Len() != 1 {
+		return
+	}
+	t := f.Tags.T[0]
+	if t.Len() != 2 {
+		return
+	}
+	v := t.Value()
+	var h S
+	switch {
+	case len(v) == 32:
+		// e and p tag values are binary in filters.
+		h = hex.Enc(v)
+	case S(t.Key()) == "#a":
+		// kind:pubkey:identifier
+		parts := strings.SplitN(S(v), ":", 3)
+		if len(parts) < 2 {
+			return
+		}
+		h = parts[1]
+	default:
+		h = S(v)
+	}
+	if len(h) != 64 {
+		return
+	}
+	if _, err := hex.Dec(h); err != nil {
+		return
+	}
+	d := h[32]
+	switch {
+	case d >= '0' && d <= '9':
+		offset = N(d - '0')
+	case d >= 'a' && d <= 'f':
+		offset = N(d-'a') + 10
+	case d >= 'A' && d <= 'F':
+		offset = N(d-'A') + 10
+	}
+	return offset + 8, true
+}
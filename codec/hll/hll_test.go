@@ -0,0 +1,103 @@
+package hll
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/minio/sha256-simd"
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"util.mleku.dev/hex"
+)
+
+// pub returns a made up pubkey that is the same for the same n.
+func pub(n N) B {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(n))
+	h := sha256.Sum256(b[:])
+	return h[:]
+}
+
+func TestOffset(t *testing.T) {
+	id := strings.Repeat("00", 16) + "c" + strings.Repeat("0", 31)
+	bin, _ := hex.Dec(id)
+	for _, c := range []struct {
+		tags   *tags.T
+		offset N
+		ok     bool
+	}{
+		{tags.New(tag.New(B("#p"), bin)), 20, true},
+		{tags.New(tag.New(B("#e"), bin)), 20, true},
+		{tags.New(tag.New("#q", id)), 20, true},
+		{tags.New(tag.New("#a", "30023:"+id+":article")), 20, true},
+		{tags.New(tag.New("#a", "30023")), 0, false},
+		{tags.New(tag.New("#t", "nostr")), 0, false},
+		{tags.New(tag.New(B("#e"), bin, bin)), 0, false},
+		{tags.New(tag.New(B("#e"), bin), tag.New(B("#p"), bin)), 0, false},
+		{tags.New(), 0, false},
+	} {
+		f := filter.New()
+		f.Kinds = kinds.New(kind.Reaction)
+		f.Tags = c.tags
+		if offset, ok := Offset(f); offset != c.offset || ok != c.ok {
+			t.Fatalf("%s: got %d, %v", f.Serialize(), offset, ok)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	h := New()
+	p := make(B, 32)
+	p[10], p[12] = 7, 0x10
+	// register 7, with the 11 zero bits after it and one.
+	h.Add(10, p)
+	if h.Registers[7] != 12 {
+		t.Fatalf("got %d", h.Registers[7])
+	}
+	// a smaller value leaves it be.
+	p[11] = 0x80
+	h.Add(10, p)
+	if h.Registers[7] != 12 {
+		t.Fatalf("got %d", h.Registers[7])
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	for _, n := range []N{0, 10, 200, 5000, 100000} {
+		h := New()
+		for i := range n {
+			h.Add(8+i%16, pub(i))
+		}
+		// the standard error with 256 registers is 6.5%.
+		if e := h.Estimate(); e < n*80/100 || e > n*120/100 {
+			t.Fatalf("%d counted as %d", n, e)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := New(), New()
+	for i := range 6000 {
+		a.Add(12, pub(i))
+	}
+	for i := 4000; i < 10000; i++ {
+		b.Add(12, pub(i))
+	}
+	c, err := FromBytes(a.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Merge(b)
+	if e := c.Estimate(); e < 8500 || e > 11500 {
+		t.Fatalf("10000 counted as %d", e)
+	}
+	if _, err = FromBytes(make(B, 255)); err == nil {
+		t.Fatal("a sketch is 256 bytes")
+	}
+}
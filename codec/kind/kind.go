@@ -50,7 +50,12 @@ func IsPrivileged(k ...*T) (is bool) {
 	return
 }
 
-func (k *T) MarshalJSON(dst B) (b B, err E) { return ints.New(k.ToU64()).MarshalJSON(dst) }
+func (k *T) MarshalJSON(dst B) (b B, err E) {
+	if k == nil {
+		return append(dst, '0'), nil
+	}
+	return ints.New(k.ToU64()).MarshalJSON(dst)
+}
 
 func (k *T) UnmarshalJSON(b B) (r B, err E) {
 	n := ints.New(0)
@@ -115,6 +120,8 @@ var (
 	Reaction = &T{7}
 	// BadgeAward is an event type
 	BadgeAward = &T{8}
+	// ChatMessage is a short chat message, as sent to NIP-29 groups.
+	ChatMessage = &T{9}
 	// ReadReceipt is a type of event that marks a list of tagged events (e
 	// tags) as being seen by the client, its distinctive feature is the
 	// "expiration" tag which indicates a time after which the marking expires
@@ -162,7 +169,19 @@ var (
 	JobResultStart        = &T{6000}
 	JobResultEnd          = &T{6999}
 	JobFeedback           = &T{7000}
-	ZapGoal               = &T{9041}
+	// GroupPutUser and the kinds up to GroupCreateInvite are NIP-29 group
+	// moderation events.
+	GroupPutUser      = &T{9000}
+	GroupRemoveUser   = &T{9001}
+	GroupEditMetadata = &T{9002}
+	GroupDeleteEvent  = &T{9005}
+	GroupCreate       = &T{9007}
+	GroupDelete       = &T{9008}
+	GroupCreateInvite = &T{9009}
+	// GroupJoinRequest and GroupLeaveRequest are sent by users to NIP-29 groups.
+	GroupJoinRequest  = &T{9021}
+	GroupLeaveRequest = &T{9022}
+	ZapGoal           = &T{9041}
 	// ZapRequest is an event type that...
 	ZapRequest = &T{9734}
 	// Zap is an event type that...
@@ -249,7 +268,13 @@ var (
 	// WaveLakeTrack which has no spec and uses malformed tags
 	WaveLakeTrack       = &T{32123}
 	CommunityDefinition = &T{34550}
-	ACLEvent            = &T{39998}
+	// GroupMetadata and the kinds up to GroupRoles are the state of a NIP-29
+	// group, signed by its relay.
+	GroupMetadata = &T{39000}
+	GroupAdmins   = &T{39001}
+	GroupMembers  = &T{39002}
+	GroupRoles    = &T{39003}
+	ACLEvent      = &T{39998}
 	// ParameterizedReplaceableEnd is an event type that...
 	ParameterizedReplaceableEnd = &T{40000}
 )
@@ -265,6 +290,7 @@ var Map = map[*T]string{
 	Repost:                      "Repost",
 	Reaction:                    "Reaction",
 	BadgeAward:                  "BadgeAward",
+	ChatMessage:                 "ChatMessage",
 	ReadReceipt:                 "ReadReceipt",
 	GenericRepost:               "GenericRepost",
 	ChannelCreation:             "ChannelCreation",
@@ -286,6 +312,15 @@ var Map = map[*T]string{
 	JobResultStart:              "JobResultStart",
 	JobResultEnd:                "JobResultEnd",
 	JobFeedback:                 "JobFeedback",
+	GroupPutUser:                "GroupPutUser",
+	GroupRemoveUser:             "GroupRemoveUser",
+	GroupEditMetadata:           "GroupEditMetadata",
+	GroupDeleteEvent:            "GroupDeleteEvent",
+	GroupCreate:                 "GroupCreate",
+	GroupDelete:                 "GroupDelete",
+	GroupCreateInvite:           "GroupCreateInvite",
+	GroupJoinRequest:            "GroupJoinRequest",
+	GroupLeaveRequest:           "GroupLeaveRequest",
 	ZapGoal:                     "ZapGoal",
 	ZapRequest:                  "ZapRequest",
 	Zap:                         "Zap",
@@ -336,4 +371,8 @@ var Map = map[*T]string{
 	HandlerRecommendation:       "HandlerRecommendation",
 	HandlerInformation:          "HandlerInformation",
 	CommunityDefinition:         "CommunityDefinition",
+	GroupMetadata:               "GroupMetadata",
+	GroupAdmins:                 "GroupAdmins",
+	GroupMembers:                "GroupMembers",
+	GroupRoles:                  "GroupRoles",
 }
@@ -1,6 +1,8 @@
 package kinds
 
 import (
+	"io"
+
 	. "nostr.mleku.dev"
 	"nostr.mleku.dev/codec/kind"
 	"util.mleku.dev/ints"
@@ -25,9 +27,9 @@ func (k *T) Len() (l int) { return len(k.K) }
 
 func (k *T) Less(i, j int) bool { return k.K[i].K < k.K[j].K }
 
-func (k *T) Swap(i, j int) {
-	k.K[i].K, k.K[j].K = k.K[j].K, k.K[i].K
-}
+// Swap swaps the kinds and not their values, which are often the shared kinds of
+// package kind.
+func (k *T) Swap(i, j int) { k.K[i], k.K[j] = k.K[j], k.K[i] }
 
 func (k *T) ToUint16() (o []uint16) {
 	for i := range k.K {
@@ -107,6 +109,10 @@ func (k *T) UnmarshalJSON(b B) (r B, err error) {
 				return
 			}
 			k.K = append(k.K, kind.New(kk.Uint16()))
+			if len(r) == 0 {
+				err = io.EOF
+				return
+			}
 			if r[0] == ']' {
 				r = r[1:]
 				return
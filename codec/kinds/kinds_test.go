@@ -2,6 +2,7 @@ package kinds
 
 import (
 	. "nostr.mleku.dev"
+	"sort"
 	"testing"
 
 	"lukechampine.com/frand"
@@ -33,3 +34,12 @@ func TestUnmarshalKindsArray(t *testing.T) {
 		}
 	}
 }
+
+func TestSortKeepsKinds(t *testing.T) {
+	k := New(kind.JobFeedback, kind.TextNote)
+	sort.Sort(k)
+	if k.K[0] != kind.TextNote || kind.JobFeedback.K != 7000 || kind.TextNote.K != 1 {
+		t.Fatalf("sorting changed the shared kinds: %d %d", kind.TextNote.K,
+			kind.JobFeedback.K)
+	}
+}
@@ -0,0 +1,206 @@
+// Package list is a model of NIP-51 lists: standard lists, which are replaceable
+// events of kinds such as 10000 (mutes) and 10003 (bookmarks), and sets, which
+// are addressable events of kinds in the 30000 range told apart by a d tag.
+//
+// The items of a list are tags. Public items are the tags of the event, and
+// private items are a JSON array of tags in the content, encrypted by the author
+// to themselves with NIP-44, or NIP-04 by older clients.
+package list
+
+import (
+	"strings"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/crypto/encryption"
+	"util.mleku.dev/hex"
+)
+
+// T is a list.
+type T struct {
+	Kind *kind.T
+	// D is the identifier of a set.
+	D S
+	// Title, Image and Description describe a set.
+	Title, Image, Description S
+	// Public are the items anyone can see.
+	Public []*tag.T
+	// Private are the items only the author can see.
+	Private []*tag.T
+}
+
+// New creates an empty list of kind k, with the identifier d if it is a set.
+func New(k *kind.T, d S) (l *T, err E) {
+	if !k.IsReplaceable() && !k.IsParameterizedReplaceable() {
+		return nil, Errorf.E("kind %d is not a list kind", k.K)
+	}
+	return &T{Kind: k, D: d}, nil
+}
+
+// IsSet returns true if the list is a set, with an identifier.
+func (l *T) IsSet() bool { return l.Kind.IsParameterizedReplaceable() }
+
+// metadata are the tags of a set that are not items.
+var metadata = map[S]bool{"d": true, "title": true, "image": true, "description": true}
+
+// FromEvent reads a list. The private items are decrypted if signer is the
+// author; otherwise they are left out.
+func FromEvent(ev *event.T, signer crypto.Signer) (l *T, err E) {
+	if l, err = New(ev.Kind, ""); err != nil {
+		return
+	}
+	if ev.Tags != nil {
+		for _, t := range ev.Tags.T {
+			if t == nil || t.Len() < 1 {
+				continue
+			}
+			key := S(t.Key())
+			if l.IsSet() && metadata[key] {
+				if t.Len() > 1 {
+					v := S(t.Value())
+					switch key {
+					case "d":
+						l.D = v
+					case "title":
+						l.Title = v
+					case "image":
+						l.Image = v
+					case "description":
+						l.Description = v
+					}
+				}
+				continue
+			}
+			l.Public = append(l.Public, t)
+		}
+	}
+	if len(ev.Content) == 0 || signer == nil || !Equals(signer.Pub(), ev.PubKey) {
+		return
+	}
+	var plain B
+	if plain, err = decrypt(signer, S(ev.Content)); err != nil {
+		return nil, err
+	}
+	private := tags.New()
+	if _, err = private.UnmarshalJSON(plain); err != nil {
+		return nil, Errorf.E("invalid private items: %w", err)
+	}
+	l.Private = private.T
+	return
+}
+
+// decrypt decrypts content encrypted by signer to themselves, with NIP-44 or,
+// if it has an iv, NIP-04.
+func decrypt(signer crypto.Signer, content S) (plain B, err E) {
+	if strings.Contains(content, "?iv=") {
+		var key B
+		if key, err = signer.ECDH(signer.Pub()); Chk.E(err) {
+			return
+		}
+		if plain, err = encryption.DecryptNip4(content, key); err != nil {
+			return nil, Errorf.E("could not decrypt private items: %w", err)
+		}
+		return
+	}
+	var ck B
+	if ck, err = encryption.GenerateConversationKey(hex.Enc(signer.Pub()),
+		hex.Enc(signer.Sec())); Chk.E(err) {
+		return
+	}
+	var s S
+	if s, err = encryption.Decrypt(content, ck); err != nil {
+		return nil, Errorf.E("could not decrypt private items: %w", err)
+	}
+	return B(s), nil
+}
+
+// same returns true if two items have the same key and value.
+func same(a, b *tag.T) bool {
+	return a.Len() > 1 && b.Len() > 1 && Equals(a.Key(), b.Key()) &&
+		Equals(a.Value(), b.Value())
+}
+
+func index(items []*tag.T, item *tag.T) N {
+	for i, t := range items {
+		if same(t, item) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Contains returns true if the list has an item with the key and value of item,
+// publicly or privately.
+func (l *T) Contains(item *tag.T) bool {
+	return index(l.Public, item) >= 0 || index(l.Private, item) >= 0
+}
+
+// Add adds an item to the public or private items, unless the list has it
+// already. It returns true if the item was added.
+func (l *T) Add(item *tag.T, private bool) bool {
+	if item.Len() < 2 || l.Contains(item) {
+		return false
+	}
+	if private {
+		l.Private = append(l.Private, item)
+	} else {
+		l.Public = append(l.Public, item)
+	}
+	return true
+}
+
+// Remove removes the items with the key and value of item. It returns true if
+// there were any.
+func (l *T) Remove(item *tag.T) (removed bool) {
+	for _, items := range []*[]*tag.T{&l.Public, &l.Private} {
+		for i := index(*items, item); i >= 0; i = index(*items, item) {
+			*items = append((*items)[:i], (*items)[i+1:]...)
+			removed = true
+		}
+	}
+	return
+}
+
+// Event creates the list event and signs it, encrypting the private items to
+// the signer with NIP-44.
+func (l *T) Event(signer crypto.Signer) (ev *event.T, err E) {
+	t := tags.New()
+	if l.IsSet() {
+		t.T = append(t.T, tag.New("d", l.D))
+		for _, m := range [][2]S{{"title", l.Title}, {"image", l.Image},
+			{"description", l.Description}} {
+			if m[1] != "" {
+				t.T = append(t.T, tag.New(m[0], m[1]))
+			}
+		}
+	}
+	t.T = append(t.T, l.Public...)
+	var content B
+	if len(l.Private) > 0 {
+		var plain B
+		if plain, err = tags.New(l.Private...).MarshalJSON(nil); Chk.E(err) {
+			return
+		}
+		var ck B
+		if ck, err = encryption.GenerateConversationKey(hex.Enc(signer.Pub()),
+			hex.Enc(signer.Sec())); Chk.E(err) {
+			return
+		}
+		var s S
+		if s, err = encryption.Encrypt(S(plain), ck); Chk.E(err) {
+			return
+		}
+		content = B(s)
+	}
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: l.Kind, Tags: t, Content: content}
+	if err = ev.Sign(signer); Chk.E(err) {
+		return
+	}
+	return
+}
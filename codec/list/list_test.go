@@ -0,0 +1,113 @@
+package list
+
+import (
+	"strings"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/tests"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto/encryption"
+)
+
+func TestList(t *testing.T) {
+	s := tests.Signers(t, 2)
+	signer, other := s[0], s[1]
+	l, err := New(kind.MuteList, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := tag.New("p", strings.Repeat("ab", 32))
+	word := tag.New("word", "spam")
+	if !l.Add(pub, false) || !l.Add(word, true) ||
+		l.Add(tag.New("p", strings.Repeat("ab", 32)), true) {
+		t.Fatal("unexpected result of add")
+	}
+	l.Add(tag.New("t", "nsfw"), false)
+	var ev *event.T
+	if ev, err = l.Event(signer); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(S(ev.Content), "spam") || ev.Tags.Len() != 2 {
+		t.Fatalf("private items are not private: %s", ev.Serialize())
+	}
+	var got *T
+	if got, err = FromEvent(ev, signer); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Public) != 2 || len(got.Private) != 1 || !got.Contains(word) ||
+		!got.Contains(pub) {
+		t.Fatalf("got %+v", got)
+	}
+	// anyone else sees only the public items.
+	var anon, others *T
+	if anon, err = FromEvent(ev, nil); err != nil {
+		t.Fatal(err)
+	}
+	if others, err = FromEvent(ev, other); err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []*T{anon, others} {
+		if len(g.Public) != 2 || len(g.Private) != 0 {
+			t.Fatalf("got %+v", g)
+		}
+	}
+	if !got.Remove(tag.New("word", "spam")) || got.Contains(word) || got.Remove(word) {
+		t.Fatal("unexpected result of remove")
+	}
+	if _, err = New(kind.TextNote, ""); err == nil {
+		t.Fatal("a text note is not a list")
+	}
+}
+
+func TestSet(t *testing.T) {
+	signer := tests.Signers(t, 1)[0]
+	l, err := New(kind.BookmarkSets, "reading")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Title = "Reading"
+	l.Add(tag.New("e", strings.Repeat("cd", 32)), false)
+	l.Add(tag.New("a", "30023:"+strings.Repeat("ef", 32)+":article"), true)
+	var ev *event.T
+	if ev, err = l.Event(signer); err != nil {
+		t.Fatal(err)
+	}
+	var got *T
+	if got, err = FromEvent(ev, signer); err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsSet() || got.D != "reading" || got.Title != "Reading" ||
+		len(got.Public) != 1 || len(got.Private) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestNip04Fallback(t *testing.T) {
+	signer := tests.Signers(t, 1)[0]
+	key, err := signer.ECDH(signer.Pub())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content B
+	if content, err = encryption.EncryptNip4(`[["word","spam"]]`, key); err != nil {
+		t.Fatal(err)
+	}
+	ev := &event.T{CreatedAt: timestamp.Now(), Kind: kind.MuteList, Tags: tags.New(),
+		Content: content}
+	if err = ev.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	var got *T
+	if got, err = FromEvent(ev, signer); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Private) != 1 || !got.Contains(tag.New("word", "spam")) {
+		t.Fatalf("got %+v", got)
+	}
+}
@@ -0,0 +1,79 @@
+package ots
+
+import (
+	"encoding/base64"
+	"strconv"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto"
+	"util.mleku.dev/hex"
+)
+
+// check returns an error if a proof is not one NIP-03 allows for the event with
+// id: it must be of the id, and have a Bitcoin attestation.
+func (p *Proof) check(id B) (err E) {
+	if p.HashOp != SHA256 || !Equals(p.Digest, id) {
+		return Errorf.E("proof is not of event %0x", id)
+	}
+	for _, a := range p.Attestations() {
+		if a.IsBitcoin() {
+			return
+		}
+	}
+	return Errorf.E("proof has no Bitcoin attestation")
+}
+
+// NewEvent creates the kind 1040 event that attests target with a proof of its
+// id, naming the relay it can be found on, and signs it.
+func NewEvent(signer crypto.Signer, target *event.T, relay S, p *Proof) (ev *event.T,
+	err E) {
+	if err = p.check(target.ID); err != nil {
+		return
+	}
+	e := tag.New("e", target.IDString())
+	if relay != "" {
+		e.Append(B(relay))
+	}
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: kind.OpenTimestamps,
+		Tags:    tags.New(e, tag.New("k", strconv.Itoa(target.Kind.ToInt()))),
+		Content: B(base64.StdEncoding.EncodeToString(p.Bytes()))}
+	if err = ev.Sign(signer); Chk.E(err) {
+		return
+	}
+	return
+}
+
+// FromEvent reads the proof of a kind 1040 event and the id of the event it
+// attests.
+func FromEvent(ev *event.T) (id B, p *Proof, err E) {
+	if !ev.Kind.Equal(kind.OpenTimestamps) {
+		return nil, nil, Errorf.E("kind %d is not an OpenTimestamps attestation", ev.Kind.K)
+	}
+	var e *tag.T
+	if ev.Tags != nil {
+		e = ev.Tags.GetFirst(tag.New("e"))
+	}
+	if e == nil || e.Len() < 2 {
+		return nil, nil, Errorf.E("attestation has no e tag")
+	}
+	if id, err = hex.Dec(S(e.Value())); err != nil || len(id) != 32 {
+		return nil, nil, Errorf.E("invalid e tag %q", e.Value())
+	}
+	var b B
+	if b, err = base64.StdEncoding.DecodeString(S(ev.Content)); err != nil {
+		return nil, nil, Errorf.E("attestation content is not base64: %w", err)
+	}
+	if p, err = Parse(b); err != nil {
+		return nil, nil, err
+	}
+	if err = p.check(id); err != nil {
+		return nil, nil, err
+	}
+	return
+}
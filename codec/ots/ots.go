@@ -0,0 +1,378 @@
+// Package ots reads and writes OpenTimestamps proofs, and the NIP-03 events
+// that carry them.
+//
+// A proof commits a digest to attestations through a tree of operations: each
+// node is a message, the attestations of it, and the operations that lead from
+// it to further nodes. An attestation says that the message at its node was in
+// a Bitcoin block, or is pending at a calendar server.
+package ots
+
+import (
+	"bytes"
+	"crypto/sha1"
+
+	"github.com/minio/sha256-simd"
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
+	. "nostr.mleku.dev"
+
+	"util.mleku.dev/hex"
+)
+
+// Magic is the header of a proof file.
+var Magic = B("\x00OpenTimestamps\x00\x00Proof\x00\xbf\x89\xe2\xe8\x84\xe8\x92\x94")
+
+// Version is the version of the proof format.
+const Version = 1
+
+// The codes of the operations.
+const (
+	SHA1      = 0x02
+	RIPEMD160 = 0x03
+	SHA256    = 0x08
+	KECCAK256 = 0x67
+	Append    = 0xf0
+	Prepend   = 0xf1
+	Reverse   = 0xf2
+	Hexlify   = 0xf3
+)
+
+// Limits on the sizes of the parts of a proof.
+const (
+	MaxMsg     = 4096
+	MaxPayload = 8192
+	MaxDepth   = 256
+)
+
+// The tags of the kinds of attestation.
+var (
+	BitcoinTag  = B{0x05, 0x88, 0x96, 0x0d, 0x73, 0xd7, 0x19, 0x01}
+	LitecoinTag = B{0x06, 0x86, 0x9a, 0x0d, 0x73, 0xd7, 0x1b, 0x45}
+	PendingTag  = B{0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e}
+)
+
+// Op is an operation on a message.
+type Op struct {
+	Code byte
+	// Arg is what Append and Prepend add to the message.
+	Arg B
+}
+
+// Apply returns the result of the operation on msg.
+func (o *Op) Apply(msg B) (r B, err E) {
+	switch o.Code {
+	case SHA1:
+		h := sha1.Sum(msg)
+		r = h[:]
+	case RIPEMD160:
+		h := ripemd160.New()
+		h.Write(msg)
+		r = h.Sum(nil)
+	case SHA256:
+		h := sha256.Sum256(msg)
+		r = h[:]
+	case KECCAK256:
+		h := sha3.NewLegacyKeccak256()
+		h.Write(msg)
+		r = h.Sum(nil)
+	case Append:
+		r = append(append(B{}, msg...), o.Arg...)
+	case Prepend:
+		r = append(append(B{}, o.Arg...), msg...)
+	case Reverse:
+		r = make(B, len(msg))
+		for i := range msg {
+			r[i] = msg[len(msg)-1-i]
+		}
+	case Hexlify:
+		r = B(hex.Enc(msg))
+	default:
+		return nil, Errorf.E("unknown operation 0x%02x", o.Code)
+	}
+	if len(r) > MaxMsg {
+		return nil, Errorf.E("message of %d bytes is too long", len(r))
+	}
+	return
+}
+
+// unary returns true if the operation has no argument.
+func unary(code byte) bool { return code != Append && code != Prepend }
+
+// digestLen returns the length of the digest of a hash operation, or 0 if it is
+// not one.
+func digestLen(code byte) N {
+	switch code {
+	case SHA1, RIPEMD160:
+		return 20
+	case SHA256, KECCAK256:
+		return 32
+	}
+	return 0
+}
+
+// Attestation says that the message at its node is timestamped.
+type Attestation struct {
+	// Tag is the kind of attestation.
+	Tag B
+	// Height is the block height of a Bitcoin or Litecoin attestation.
+	Height uint64
+	// URI is the calendar of a pending attestation.
+	URI S
+	// Payload is the payload of an attestation of an unknown kind.
+	Payload B
+	// Msg is the message that is attested, which Proof.Attestations sets.
+	Msg B
+}
+
+// IsBitcoin returns true if the attestation is of a Bitcoin block header.
+func (a *Attestation) IsBitcoin() bool { return Equals(a.Tag, BitcoinTag) }
+
+// IsPending returns true if the attestation is of a calendar that has not yet
+// put the message in a block.
+func (a *Attestation) IsPending() bool { return Equals(a.Tag, PendingTag) }
+
+// Branch is an operation from a node and the node it leads to.
+type Branch struct {
+	Op   *Op
+	Node *Timestamp
+}
+
+// Timestamp is a node of the tree of a proof.
+type Timestamp struct {
+	Msg          B
+	Attestations []*Attestation
+	Branches     []*Branch
+}
+
+// Proof is a detached timestamp, as in a .ots file: the digest of a file, the
+// hash operation that made it, and the tree that commits it.
+type Proof struct {
+	HashOp    byte
+	Digest    B
+	Timestamp *Timestamp
+}
+
+// Attestations returns the attestations of a proof, each with the message it
+// attests.
+func (p *Proof) Attestations() (atts []*Attestation) {
+	var walk func(t *Timestamp)
+	walk = func(t *Timestamp) {
+		for _, a := range t.Attestations {
+			a.Msg = t.Msg
+			atts = append(atts, a)
+		}
+		for _, b := range t.Branches {
+			walk(b.Node)
+		}
+	}
+	walk(p.Timestamp)
+	return
+}
+
+// reader reads the fields of a proof.
+type reader struct{ b B }
+
+func (r *reader) bytes(n uint64) (b B, err E) {
+	if uint64(len(r.b)) < n {
+		return nil, Errorf.E("proof ends %d bytes short", n-uint64(len(r.b)))
+	}
+	b, r.b = r.b[:n], r.b[n:]
+	return
+}
+
+func (r *reader) byte() (c byte, err E) {
+	var b B
+	if b, err = r.bytes(1); err != nil {
+		return
+	}
+	return b[0], nil
+}
+
+// varuint reads an unsigned LEB128 integer.
+func (r *reader) varuint() (v uint64, err E) {
+	for shift := 0; ; shift += 7 {
+		if shift > 63 {
+			return 0, Errorf.E("varuint too long")
+		}
+		var c byte
+		if c, err = r.byte(); err != nil {
+			return
+		}
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return
+		}
+	}
+}
+
+func (r *reader) varbytes(max N) (b B, err E) {
+	var n uint64
+	if n, err = r.varuint(); err != nil {
+		return
+	}
+	if n > uint64(max) {
+		return nil, Errorf.E("%d bytes is more than %d", n, max)
+	}
+	return r.bytes(n)
+}
+
+// Parse reads a proof in the format of a .ots file.
+func Parse(b B) (p *Proof, err E) {
+	r := &reader{b}
+	var magic B
+	if magic, err = r.bytes(uint64(len(Magic))); err != nil || !Equals(magic, Magic) {
+		return nil, Errorf.E("not an OpenTimestamps proof")
+	}
+	var v uint64
+	if v, err = r.varuint(); err != nil {
+		return
+	}
+	if v != Version {
+		return nil, Errorf.E("unsupported proof version %d", v)
+	}
+	p = &Proof{}
+	if p.HashOp, err = r.byte(); err != nil {
+		return nil, err
+	}
+	n := digestLen(p.HashOp)
+	if n == 0 {
+		return nil, Errorf.E("0x%02x is not a hash operation", p.HashOp)
+	}
+	if p.Digest, err = r.bytes(uint64(n)); err != nil {
+		return nil, err
+	}
+	p.Digest = bytes.Clone(p.Digest)
+	if p.Timestamp, err = r.timestamp(p.Digest, 0); err != nil {
+		return nil, err
+	}
+	if len(r.b) > 0 {
+		return nil, Errorf.E("%d bytes after the proof", len(r.b))
+	}
+	return
+}
+
+// timestamp reads a node of the tree, whose items but the last are marked with
+// 0xff.
+func (r *reader) timestamp(msg B, depth N) (t *Timestamp, err E) {
+	if depth > MaxDepth {
+		return nil, Errorf.E("proof is deeper than %d", MaxDepth)
+	}
+	t = &Timestamp{Msg: msg}
+	for {
+		var c byte
+		if c, err = r.byte(); err != nil {
+			return
+		}
+		more := c == 0xff
+		if more {
+			if c, err = r.byte(); err != nil {
+				return
+			}
+		}
+		if c == 0x00 {
+			var a *Attestation
+			if a, err = r.attestation(); err != nil {
+				return
+			}
+			t.Attestations = append(t.Attestations, a)
+		} else {
+			o := &Op{Code: c}
+			if !unary(c) {
+				if o.Arg, err = r.varbytes(MaxMsg); err != nil {
+					return
+				}
+				o.Arg = bytes.Clone(o.Arg)
+			}
+			var next B
+			if next, err = o.Apply(msg); err != nil {
+				return
+			}
+			var node *Timestamp
+			if node, err = r.timestamp(next, depth+1); err != nil {
+				return
+			}
+			t.Branches = append(t.Branches, &Branch{Op: o, Node: node})
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+func (r *reader) attestation() (a *Attestation, err E) {
+	a = &Attestation{}
+	if a.Tag, err = r.bytes(8); err != nil {
+		return
+	}
+	a.Tag = bytes.Clone(a.Tag)
+	var payload B
+	if payload, err = r.varbytes(MaxPayload); err != nil {
+		return
+	}
+	pr := &reader{payload}
+	switch {
+	case Equals(a.Tag, BitcoinTag) || Equals(a.Tag, LitecoinTag):
+		a.Height, err = pr.varuint()
+	case Equals(a.Tag, PendingTag):
+		var uri B
+		if uri, err = pr.varbytes(1000); err == nil {
+			a.URI = S(uri)
+		}
+	default:
+		a.Payload = bytes.Clone(payload)
+		return
+	}
+	if err == nil && len(pr.b) > 0 {
+		err = Errorf.E("%d bytes after the attestation payload", len(pr.b))
+	}
+	return
+}
+
+func appendVaruint(dst B, v uint64) B {
+	for v >= 0x80 {
+		dst = append(dst, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(dst, byte(v))
+}
+
+func appendVarbytes(dst, b B) B { return append(appendVaruint(dst, uint64(len(b))), b...) }
+
+// Bytes returns the proof in the format of a .ots file.
+func (p *Proof) Bytes() (b B) {
+	b = append(append(B{}, Magic...), Version)
+	b = append(append(b, p.HashOp), p.Digest...)
+	return p.Timestamp.append(b)
+}
+
+func (t *Timestamp) append(dst B) B {
+	n := len(t.Attestations) + len(t.Branches)
+	i := 0
+	for _, a := range t.Attestations {
+		if i++; i < n {
+			dst = append(dst, 0xff)
+		}
+		dst = append(append(dst, 0x00), a.Tag...)
+		var payload B
+		switch {
+		case a.IsBitcoin() || Equals(a.Tag, LitecoinTag):
+			payload = appendVaruint(nil, a.Height)
+		case a.IsPending():
+			payload = appendVarbytes(nil, B(a.URI))
+		default:
+			payload = a.Payload
+		}
+		dst = appendVarbytes(dst, payload)
+	}
+	for _, br := range t.Branches {
+		if i++; i < n {
+			dst = append(dst, 0xff)
+		}
+		dst = append(dst, br.Op.Code)
+		if !unary(br.Op.Code) {
+			dst = appendVarbytes(dst, br.Op.Arg)
+		}
+		dst = br.Node.append(dst)
+	}
+	return dst
+}
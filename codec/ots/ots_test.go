@@ -0,0 +1,140 @@
+package ots
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/crypto/p256k"
+	"util.mleku.dev/hex"
+)
+
+// testdata/genesis.ots is built by hand, not by a calendar. It forks from its
+// digest to a pending attestation at a calendar, and to a Bitcoin attestation
+// of the genesis block: the digest is 32 bytes of the public key in the
+// coinbase transaction of the block, and the operations rebuild the transaction
+// around it and hash it to the merkle root in header, the real genesis header.
+//
+// TODO: add a proof stamped by a calendar and upgraded to a Bitcoin attestation
+// to testdata, so the parser is checked against the operations a calendar
+// really writes and not only against those this file was built from.
+const (
+	digest = "678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb6"
+	msg    = "3ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a"
+	header = "0100000000000000000000000000000000000000000000000000000000000000" +
+		"000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa" +
+		"4b1e5e4a29ab5f49ffff001d1dac2b7c"
+)
+
+func genesis(t *testing.T) (b B, p *Proof) {
+	var err E
+	if b, err = os.ReadFile("testdata/genesis.ots"); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = Parse(b); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func headers(h S) Headers {
+	return HeaderFunc(func(c Ctx, height uint64) (b B, err E) {
+		if height != 0 {
+			return nil, Errorf.E("no block %d", height)
+		}
+		return hex.Dec(h)
+	})
+}
+
+func TestParse(t *testing.T) {
+	b, p := genesis(t)
+	if p.HashOp != SHA256 || hex.Enc(p.Digest) != digest {
+		t.Fatalf("got digest %0x", p.Digest)
+	}
+	if !Equals(p.Bytes(), b) {
+		t.Fatalf("proof does not round trip")
+	}
+	if br := p.Timestamp.Branches; len(br) != 2 || br[0].Op.Code != Append ||
+		br[1].Op.Code != Prepend || br[1].Node.Branches[0].Op.Code != Append {
+		t.Fatalf("got %+v", br)
+	}
+	atts := p.Attestations()
+	if len(atts) != 2 || !atts[0].IsPending() ||
+		atts[0].URI != "https://alice.btc.calendar.opentimestamps.org" ||
+		!atts[1].IsBitcoin() || atts[1].Height != 0 || hex.Enc(atts[1].Msg) != msg {
+		t.Fatalf("got %+v %+v", atts[0], atts[1])
+	}
+	for i := range b {
+		if _, err := Parse(b[:i]); err == nil {
+			t.Fatalf("parsed proof cut to %d bytes", i)
+		}
+	}
+	if _, err := Parse(append(b, 0)); err == nil {
+		t.Fatal("parsed proof with trailing bytes")
+	}
+	bad := append(B{}, b...)
+	bad[len(Magic)+1] = Reverse
+	if _, err := Parse(bad); err == nil {
+		t.Fatal("parsed proof with a bad hash operation")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	_, p := genesis(t)
+	c := context.Background()
+	v, err := p.Verify(c, headers(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Height != 0 || v.Time.I64() != 1231006505 {
+		t.Fatalf("got %d %d", v.Height, v.Time.I64())
+	}
+	wrong := header[:100] + "00" + header[102:]
+	if _, err = p.Verify(c, headers(wrong)); err == nil {
+		t.Fatal("verified against the wrong header")
+	}
+	if _, err = p.Verify(c, headers(header[:158])); err == nil {
+		t.Fatal("verified against a short header")
+	}
+}
+
+func TestEvent(t *testing.T) {
+	_, p := genesis(t)
+	s := new(p256k.Signer)
+	if err := s.Generate(); Chk.E(err) {
+		t.Fatal(err)
+	}
+	id, _ := hex.Dec(digest)
+	target := &event.T{ID: id, Kind: kind.TextNote}
+	ev, err := NewEvent(s, target, "wss://relay.example.com", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ev.Verify(); err != nil || !ok {
+		t.Fatalf("bad signature: %v", err)
+	}
+	var got B
+	var q *Proof
+	if got, q, err = FromEvent(ev); err != nil {
+		t.Fatal(err)
+	}
+	if !Equals(got, id) || !Equals(q.Bytes(), p.Bytes()) {
+		t.Fatalf("got %0x", got)
+	}
+	if _, err = NewEvent(s, &event.T{ID: make(B, 32), Kind: kind.TextNote}, "", p); err == nil {
+		t.Fatal("attested an event the proof is not of")
+	}
+	p.Timestamp.Branches = p.Timestamp.Branches[:1]
+	if _, err = NewEvent(s, target, "", p); err == nil {
+		t.Fatal("attested with no Bitcoin attestation")
+	}
+	ev.Content = B(base64.StdEncoding.EncodeToString(p.Bytes()))
+	if _, _, err = FromEvent(ev); err == nil {
+		t.Fatal("read a proof with no Bitcoin attestation")
+	}
+}
@@ -0,0 +1,71 @@
+package ots
+
+import (
+	"encoding/binary"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/timestamp"
+)
+
+// Headers gives the headers of Bitcoin blocks, from a node or a service the
+// caller trusts.
+type Headers interface {
+	// Header returns the 80 byte header of the block at a height.
+	Header(c Ctx, height uint64) (header B, err E)
+}
+
+// HeaderFunc is a function that gives Headers.
+type HeaderFunc func(c Ctx, height uint64) (header B, err E)
+
+func (f HeaderFunc) Header(c Ctx, height uint64) (header B, err E) { return f(c, height) }
+
+// Verified is a Bitcoin attestation that holds.
+type Verified struct {
+	Height uint64
+	// Time is the time in the header of the block.
+	Time *timestamp.T
+}
+
+// VerifyHeader checks a Bitcoin attestation against the header of its block,
+// whose merkle root must be the attested message, and returns the time of the
+// block.
+func (a *Attestation) VerifyHeader(header B) (t *timestamp.T, err E) {
+	if !a.IsBitcoin() {
+		return nil, Errorf.E("not a Bitcoin attestation")
+	}
+	if len(header) != 80 {
+		return nil, Errorf.E("block header must be 80 bytes, got %d", len(header))
+	}
+	if !Equals(header[36:68], a.Msg) {
+		return nil, Errorf.E("message is not the merkle root of block %d", a.Height)
+	}
+	return timestamp.FromUnix(int64(binary.LittleEndian.Uint32(header[68:72]))), nil
+}
+
+// Verify checks the Bitcoin attestations of a proof against the headers of
+// their blocks, and returns the earliest that holds, or an error if none do.
+func (p *Proof) Verify(c Ctx, h Headers) (v *Verified, err E) {
+	var last E
+	for _, a := range p.Attestations() {
+		if !a.IsBitcoin() || (v != nil && a.Height >= v.Height) {
+			continue
+		}
+		var header B
+		if header, last = h.Header(c, a.Height); last != nil {
+			continue
+		}
+		var t *timestamp.T
+		if t, last = a.VerifyHeader(header); last != nil {
+			continue
+		}
+		v = &Verified{Height: a.Height, Time: t}
+	}
+	if v == nil {
+		if last == nil {
+			last = Errorf.E("proof has no Bitcoin attestation")
+		}
+		return nil, last
+	}
+	return
+}
@@ -0,0 +1,218 @@
+// Package profile is the content of kind 0 profile metadata events. Parsing is
+// lenient about the variants found in real profiles, and fields it does not know
+// are kept so that a profile can be edited and published again without losing
+// them.
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto"
+)
+
+// T is the metadata of a profile.
+type T struct {
+	Name        S
+	DisplayName S
+	About       S
+	Picture     S
+	Banner      S
+	Website     S
+	NIP05       S
+	LUD06       S
+	LUD16       S
+	Bot         bool
+	// Extra holds the fields that are not known, as their raw JSON values.
+	Extra map[S]json.RawMessage
+}
+
+// New creates an empty profile.
+func New() *T { return &T{} }
+
+// the keys of the known string fields in the order they are written.
+var fields = []struct {
+	key S
+	get func(p *T) *S
+}{
+	{"name", func(p *T) *S { return &p.Name }},
+	{"display_name", func(p *T) *S { return &p.DisplayName }},
+	{"about", func(p *T) *S { return &p.About }},
+	{"picture", func(p *T) *S { return &p.Picture }},
+	{"banner", func(p *T) *S { return &p.Banner }},
+	{"website", func(p *T) *S { return &p.Website }},
+	{"nip05", func(p *T) *S { return &p.NIP05 }},
+	{"lud06", func(p *T) *S { return &p.LUD06 }},
+	{"lud16", func(p *T) *S { return &p.LUD16 }},
+}
+
+// aliases are keys that clients have used for the known fields. They are used
+// only when the proper key is missing or empty.
+var aliases = map[S]S{
+	"displayName": "display_name",
+	"username":    "name",
+}
+
+// Parse decodes the content of a profile event.
+func Parse(content B) (p *T, err E) {
+	p = New()
+	if _, err = p.UnmarshalJSON(content); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// FromEvent decodes the profile of a kind 0 event.
+func FromEvent(ev *event.T) (p *T, err E) {
+	if ev.Kind == nil || !ev.Kind.Equal(kind.ProfileMetadata) {
+		err = Errorf.E("event is kind %v, not a profile", ev.Kind)
+		return
+	}
+	return Parse(ev.Content)
+}
+
+// UnmarshalJSON decodes a profile object and returns what follows it. Strings
+// may also be given as numbers or booleans, and bot as a string or number.
+func (p *T) UnmarshalJSON(b B) (r B, err E) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	var m map[S]json.RawMessage
+	if err = dec.Decode(&m); err != nil {
+		err = Errorf.E("invalid profile: %w", err)
+		return
+	}
+	if m == nil {
+		err = Errorf.E("profile is null")
+		return
+	}
+	r = b[dec.InputOffset():]
+	*p = T{}
+	for _, f := range fields {
+		if v, ok := m[f.key]; ok {
+			*f.get(p) = lenientString(v)
+			delete(m, f.key)
+		}
+	}
+	for alias, key := range aliases {
+		v, ok := m[alias]
+		if !ok {
+			continue
+		}
+		for _, f := range fields {
+			if f.key == key && *f.get(p) == "" {
+				*f.get(p) = lenientString(v)
+				delete(m, alias)
+			}
+		}
+	}
+	if v, ok := m["bot"]; ok {
+		p.Bot = lenientBool(v)
+		delete(m, "bot")
+	}
+	if len(m) > 0 {
+		p.Extra = m
+	}
+	return
+}
+
+// lenientString gets the text of a JSON value, which is the string itself for a
+// string, the literal for numbers and booleans, and empty for anything else.
+func lenientString(v json.RawMessage) (s S) {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return
+	}
+	switch v[0] {
+	case '"':
+		if err := json.Unmarshal(v, &s); err != nil {
+			return ""
+		}
+		return
+	case '{', '[', 'n':
+		return
+	default:
+		return S(v)
+	}
+}
+
+// lenientBool gets a boolean from a JSON boolean, string or number.
+func lenientBool(v json.RawMessage) bool {
+	b, err := strconv.ParseBool(strings.ToLower(lenientString(v)))
+	return err == nil && b
+}
+
+// MarshalJSON appends the profile as a JSON object with the known fields first,
+// leaving out empty ones, and then the extra fields in order of their keys.
+func (p *T) MarshalJSON(dst B) (b B, err E) {
+	b = append(dst, '{')
+	first := true
+	add := func(key S, v B) {
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = appendString(b, key)
+		b = append(b, ':')
+		b = append(b, v...)
+	}
+	for _, f := range fields {
+		if v := *f.get(p); v != "" {
+			add(f.key, appendString(nil, v))
+		}
+	}
+	if p.Bot {
+		add("bot", B("true"))
+	}
+	keys := make([]S, 0, len(p.Extra))
+	for k := range p.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var v B
+		if v, err = compact(p.Extra[k]); err != nil {
+			err = Errorf.E("invalid value of extra field '%s': %w", k, err)
+			return
+		}
+		add(k, v)
+	}
+	b = append(b, '}')
+	return
+}
+
+// appendString appends s as a JSON string without escaping HTML characters.
+func appendString(dst B, s S) (b B) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return append(dst, bytes.TrimRight(buf.Bytes(), "\n")...)
+}
+
+func compact(v json.RawMessage) (b B, err E) {
+	buf := &bytes.Buffer{}
+	if err = json.Compact(buf, v); err != nil {
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+// Event creates a kind 0 event with the profile as its content and signs it.
+func (p *T) Event(signer crypto.Signer) (ev *event.T, err E) {
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: kind.ProfileMetadata, Tags: tags.New()}
+	if ev.Content, err = p.MarshalJSON(nil); err != nil {
+		return
+	}
+	if err = ev.Sign(signer); Chk.E(err) {
+		return
+	}
+	return
+}
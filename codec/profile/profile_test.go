@@ -0,0 +1,88 @@
+package profile
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/crypto/p256k"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse(B(`{"name":"alice","displayName":"Alice <3","about":"hi\nthere",
+		"nip05":"alice@example.com","lud16":1234,"bot":"true","pronouns":"she/her",
+		"custom":{"a":[1, 2]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "alice" || p.DisplayName != "Alice <3" || p.About != "hi\nthere" ||
+		p.NIP05 != "alice@example.com" || p.LUD16 != "1234" || !p.Bot {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+	if len(p.Extra) != 2 {
+		t.Fatalf("expected two extra fields, got %v", p.Extra)
+	}
+	var b B
+	if b, err = p.MarshalJSON(nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"name":"alice","display_name":"Alice <3","about":"hi\nthere",` +
+		`"nip05":"alice@example.com","lud16":"1234","bot":true,"custom":{"a":[1,2]},` +
+		`"pronouns":"she/her"}`
+	if S(b) != expected {
+		t.Fatalf("got\n%s\nexpected\n%s", b, expected)
+	}
+	var p2 *T
+	if p2, err = Parse(b); err != nil {
+		t.Fatal(err)
+	}
+	var b2 B
+	if b2, err = p2.MarshalJSON(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !Equals(b, b2) {
+		t.Fatalf("round trip changed the profile\n%s\n%s", b, b2)
+	}
+	// the proper key wins over an alias, which is then kept as it is.
+	if p, err = Parse(B(`{"display_name":"a","displayName":"b","username":"c",` +
+		`"bot":0,"website":null}`)); err != nil {
+		t.Fatal(err)
+	}
+	if p.DisplayName != "a" || p.Name != "c" || p.Bot || p.Website != "" ||
+		len(p.Extra) != 1 {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+	for _, s := range []S{``, `null`, `[]`, `{"name":}`, `"name"`} {
+		if _, err = Parse(B(s)); err == nil {
+			t.Fatalf("expected an error for '%s'", s)
+		}
+	}
+}
+
+func TestEvent(t *testing.T) {
+	signer := &p256k.Signer{}
+	if err := signer.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	p := New()
+	p.Name, p.Picture, p.LUD06 = "bob", "https://example.com/bob.png", "lnurl1xyz"
+	ev, err := p.Event(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ev.Kind.Equal(kind.ProfileMetadata) {
+		t.Fatalf("got kind %d", ev.Kind.K)
+	}
+	var valid bool
+	if valid, err = ev.Verify(); err != nil || !valid {
+		t.Fatalf("event does not verify: %v", err)
+	}
+	var p2 *T
+	if p2, err = FromEvent(ev); err != nil {
+		t.Fatal(err)
+	}
+	if p2.Name != p.Name || p2.Picture != p.Picture || p2.LUD06 != p.LUD06 {
+		t.Fatalf("got %+v expected %+v", p2, p)
+	}
+}
@@ -0,0 +1,162 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+)
+
+// Index is an in-memory inverted index of the text of events, which ranks the
+// events that match a query with BM25.
+type Index struct {
+	// K1 and B are the BM25 parameters: how soon more of a term stops counting,
+	// and how much long texts are penalised.
+	K1, B    float64
+	mx       sync.RWMutex
+	docs     map[S]*doc
+	postings map[S]map[S]N
+	length   N
+}
+
+// doc is an indexed event and the number of terms in its text.
+type doc struct {
+	ev     *event.T
+	length N
+}
+
+// Result is an event found by a search, and how well it matches.
+type Result struct {
+	Event *event.T
+	Score float64
+}
+
+// NewIndex creates an empty index with the usual BM25 parameters.
+func NewIndex() *Index {
+	return &Index{K1: 1.2, B: 0.75, docs: make(map[S]*doc),
+		postings: make(map[S]map[S]N)}
+}
+
+// Len returns the number of events in the index.
+func (x *Index) Len() N {
+	x.mx.RLock()
+	defer x.mx.RUnlock()
+	return len(x.docs)
+}
+
+// Add indexes an event. An event that is indexed already is left as it is.
+func (x *Index) Add(ev *event.T) {
+	x.mx.Lock()
+	defer x.mx.Unlock()
+	id := S(ev.ID)
+	if _, ok := x.docs[id]; ok {
+		return
+	}
+	terms := Tokenize(Text(ev))
+	x.docs[id] = &doc{ev: ev, length: len(terms)}
+	x.length += len(terms)
+	for _, t := range terms {
+		p := x.postings[t]
+		if p == nil {
+			p = make(map[S]N)
+			x.postings[t] = p
+		}
+		p[id]++
+	}
+}
+
+// Remove removes the event with an id from the index, as when it is deleted or
+// replaced.
+func (x *Index) Remove(id B) {
+	x.mx.Lock()
+	defer x.mx.Unlock()
+	d, ok := x.docs[S(id)]
+	if !ok {
+		return
+	}
+	for _, t := range Tokenize(Text(d.ev)) {
+		if p := x.postings[t]; p != nil {
+			delete(p, S(id))
+			if len(p) == 0 {
+				delete(x.postings, t)
+			}
+		}
+	}
+	x.length -= d.length
+	delete(x.docs, S(id))
+}
+
+// Search returns the events that have every term of the query and for which
+// match, if it is not nil, returns true, best first. A filter answers its
+// search with
+//
+//	x.Search(f.Query(), f.Matches, f.Limit)
+//
+// A query without terms matches every event, newest first. A limit of zero or
+// less returns every result.
+func (x *Index) Search(q *Query, match func(*event.T) bool, limit N) (res []Result) {
+	x.mx.RLock()
+	defer x.mx.RUnlock()
+	var candidates map[S]N
+	if len(q.Terms) == 0 {
+		candidates = make(map[S]N, len(x.docs))
+		for id := range x.docs {
+			candidates[id] = 0
+		}
+	} else {
+		// start from the rarest term, which has the fewest events.
+		terms := append([]S{}, q.Terms...)
+		sort.Slice(terms, func(i, j N) bool {
+			return len(x.postings[terms[i]]) < len(x.postings[terms[j]])
+		})
+		candidates = x.postings[terms[0]]
+		for _, t := range terms[1:] {
+			if len(candidates) == 0 {
+				break
+			}
+			next := make(map[S]N)
+			for id := range candidates {
+				if _, ok := x.postings[t][id]; ok {
+					next[id] = 0
+				}
+			}
+			candidates = next
+		}
+	}
+	for id := range candidates {
+		d := x.docs[id]
+		if match != nil && !match(d.ev) {
+			continue
+		}
+		res = append(res, Result{Event: d.ev, Score: x.score(q, id, d)})
+	}
+	sort.Slice(res, func(i, j N) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Event.CreatedAt.I64() > res[j].Event.CreatedAt.I64()
+	})
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return
+}
+
+// score is the BM25 score of a document for a query.
+func (x *Index) score(q *Query, id S, d *doc) (s float64) {
+	n := float64(len(x.docs))
+	avg := float64(x.length) / n
+	for _, t := range q.Terms {
+		tf := float64(x.postings[t][id])
+		if tf == 0 {
+			continue
+		}
+		df := float64(len(x.postings[t]))
+		idf := math.Log((n-df+0.5)/(df+0.5) + 1)
+		s += idf * tf * (x.K1 + 1) / (tf + x.K1*(1-x.B+x.B*float64(d.length)/avg))
+	}
+	return
+}
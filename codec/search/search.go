@@ -0,0 +1,160 @@
+// Package search implements NIP-50 search: a parser for the search strings of
+// filters, matching of events against them, and an in-memory full-text index
+// that ranks events with BM25.
+package search
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+)
+
+// Sentiments are the values of the sentiment extension.
+const (
+	Negative = "negative"
+	Neutral  = "neutral"
+	Positive = "positive"
+)
+
+// Query is a parsed search string.
+type Query struct {
+	// Terms are the words of the query, as Tokenize makes them.
+	Terms []S
+	// IncludeSpam is set by include:spam, which asks not to filter out spam.
+	IncludeSpam bool
+	// Domain is set by domain:, which asks for events by authors with a NIP-05
+	// address at the domain.
+	Domain S
+	// Language is set by language:, a two letter ISO 639-1 code.
+	Language S
+	// Sentiment is set by sentiment:, one of the Sentiments.
+	Sentiment S
+	// NSFW is set by nsfw:, and is nil if the query does not say.
+	NSFW *bool
+	// Extensions are all the key:value pairs of the query, including ones it
+	// gives no meaning to, which relays ignore.
+	Extensions map[S]S
+}
+
+// Parse reads a search string. Words of the form key:value are extensions;
+// everything else is terms.
+func Parse(s S) (q *Query) {
+	q = &Query{Extensions: make(map[S]S)}
+	for _, w := range strings.Fields(s) {
+		if k, v, ok := extension(w); ok {
+			q.Extensions[k] = v
+			switch k {
+			case "include":
+				if v == "spam" {
+					q.IncludeSpam = true
+				}
+			case "domain":
+				q.Domain = v
+			case "language":
+				q.Language = v
+			case "sentiment":
+				q.Sentiment = v
+			case "nsfw":
+				b := v == "true"
+				q.NSFW = &b
+			}
+			continue
+		}
+		for _, t := range Tokenize(w) {
+			if !slices.Contains(q.Terms, t) {
+				q.Terms = append(q.Terms, t)
+			}
+		}
+	}
+	return
+}
+
+// extension splits a word of the form key:value, where the key is lower case
+// letters. A URL is not an extension.
+func extension(w S) (k, v S, ok bool) {
+	if k, v, ok = strings.Cut(w, ":"); !ok || k == "" || v == "" ||
+		strings.HasPrefix(v, "//") {
+		return "", "", false
+	}
+	for _, r := range k {
+		if r < 'a' || r > 'z' {
+			return "", "", false
+		}
+	}
+	return k, strings.ToLower(v), true
+}
+
+func (q *Query) String() S {
+	w := append([]S{}, q.Terms...)
+	keys := make([]S, 0, len(q.Extensions))
+	for k := range q.Extensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		w = append(w, k+":"+q.Extensions[k])
+	}
+	return strings.Join(w, " ")
+}
+
+// Tokenize splits text into lower case words of letters and digits, so that
+// "#Nostr," and "nostr" are the same term.
+func Tokenize(s S) (terms []S) {
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		terms = append(terms, strings.ToLower(f))
+	}
+	return
+}
+
+// Tags are the keys of the tags whose values are searched as well as the
+// content.
+var Tags = []S{"t", "title", "subject", "summary", "alt", "name", "d"}
+
+// Text returns the searchable text of an event: its content and the values of
+// its Tags.
+func Text(ev *event.T) S {
+	var b strings.Builder
+	b.Write(ev.Content)
+	if ev.Tags == nil {
+		return b.String()
+	}
+	for _, t := range ev.Tags.T {
+		if t == nil || t.Len() < 2 {
+			continue
+		}
+		for _, k := range Tags {
+			if S(t.Key()) == k {
+				b.WriteByte(' ')
+				b.Write(t.Value())
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+// Match returns true if the text of an event has every term of the query. The
+// extensions are left to relays that have what they need to apply them, such
+// as spam scores or NIP-05 addresses.
+func (q *Query) Match(ev *event.T) bool {
+	if len(q.Terms) == 0 {
+		return true
+	}
+	have := make(map[S]bool)
+	for _, t := range Tokenize(Text(ev)) {
+		have[t] = true
+	}
+	for _, t := range q.Terms {
+		if !have[t] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"slices"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+)
+
+func TestParse(t *testing.T) {
+	q := Parse(`Best #Nostr apps, nostr! include:spam domain:Example.com language:en ` +
+		`sentiment:positive nsfw:false wot:high https://nostr.com`)
+	if !slices.Equal(q.Terms, []S{"best", "nostr", "apps", "https", "com"}) {
+		t.Fatalf("got terms %v", q.Terms)
+	}
+	if !q.IncludeSpam || q.Domain != "example.com" || q.Language != "en" ||
+		q.Sentiment != Positive || q.NSFW == nil || *q.NSFW || q.Extensions["wot"] != "high" {
+		t.Fatalf("got %+v", q)
+	}
+	if s := q.String(); s != "best nostr apps https com domain:example.com include:spam "+
+		"language:en nsfw:false sentiment:positive wot:high" {
+		t.Fatalf("got %q", s)
+	}
+	if q = Parse("include:"); len(q.Extensions) != 0 || q.Terms[0] != "include" {
+		t.Fatalf("got %+v", q)
+	}
+}
+
+func note(id byte, content S, age int64, t ...*tag.T) *event.T {
+	return &event.T{ID: B{id}, CreatedAt: timestamp.FromUnix(1700000000 - age),
+		Kind: kind.TextNote, Tags: tags.New(t...), Content: B(content)}
+}
+
+func TestIndex(t *testing.T) {
+	x := NewIndex()
+	evs := []*event.T{
+		note(1, "nostr is a protocol", 0),
+		note(2, "nostr nostr nostr, the best protocol for notes", 10),
+		note(3, "bitcoin and lightning", 20, tag.New("t", "nostr")),
+		note(4, "a very long note that mentions nostr once among a great many other "+
+			"words that are not about the protocol at all", 30),
+		note(5, "cooking pasta", 40, tag.New("title", "Protocol for pasta"), nil),
+	}
+	for _, ev := range evs {
+		x.Add(ev)
+	}
+	x.Add(evs[0])
+	if x.Len() != 5 {
+		t.Fatalf("got %d events", x.Len())
+	}
+	ids := func(res []Result) (b B) {
+		for _, r := range res {
+			b = append(b, r.Event.ID[0])
+		}
+		return
+	}
+	// more of a term in a shorter text ranks higher.
+	if got := ids(x.Search(Parse("nostr"), nil, 0)); !Equals(got, B{2, 1, 3, 4}) {
+		t.Fatalf("got %v", got)
+	}
+	if got := ids(x.Search(Parse("protocol nostr"), nil, 2)); !Equals(got, B{2, 1}) {
+		t.Fatalf("got %v", got)
+	}
+	if got := ids(x.Search(Parse("protocol"), func(ev *event.T) bool {
+		return ev.CreatedAt.I64() < 1700000000-5
+	}, 0)); len(got) != 3 || got[len(got)-1] == 1 {
+		t.Fatalf("got %v", got)
+	}
+	if got := ids(x.Search(Parse("protocol unicorns"), nil, 0)); len(got) != 0 {
+		t.Fatalf("got %v", got)
+	}
+	// no terms is everything, newest first.
+	if got := ids(x.Search(Parse("include:spam"), nil, 3)); !Equals(got, B{1, 2, 3}) {
+		t.Fatalf("got %v", got)
+	}
+	x.Remove(B{2})
+	x.Remove(B{9})
+	if got := ids(x.Search(Parse("nostr"), nil, 0)); !Equals(got, B{1, 3, 4}) {
+		t.Fatalf("got %v", got)
+	}
+	for _, ev := range evs {
+		x.Remove(ev.ID)
+	}
+	if x.Len() != 0 || len(x.postings) != 0 || x.length != 0 {
+		t.Fatalf("index not empty: %d %d %d", x.Len(), len(x.postings), x.length)
+	}
+}
@@ -2,6 +2,7 @@ package subscriptionid
 
 import (
 	"crypto/rand"
+	"io"
 
 	. "nostr.mleku.dev"
 
@@ -102,5 +103,6 @@ func (si *T) UnmarshalJSON(b B) (r B, err error) {
 			}
 		}
 	}
+	err = io.EOF
 	return
 }
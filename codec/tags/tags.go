@@ -9,6 +9,7 @@ import (
 	. "nostr.mleku.dev"
 
 	"nostr.mleku.dev/codec/tag"
+	"util.mleku.dev/hex"
 )
 
 // T is a list of T - which are lists of string elements with ordering and no
@@ -166,30 +167,42 @@ func (t *T) Scan(src any) (err error) {
 	return
 }
 
-// Intersects returns true if a filter tags.T has a match. This means the second character of
-// the filter tag key matches, (ignoring the stupid # prefix in the filter) and one of the
-// following values in the tag matches the first tag of this tag.
+// Intersects returns true if a filter tags.T has a match. This means that for
+// every tag of the filter, this has a tag with the key of the filter tag (ignoring
+// the stupid # prefix in the filter) whose first value is one of the following
+// values in the filter tag.
 func (t *T) Intersects(f *T) (has bool) {
 	if t == nil || f == nil {
 		// if either are empty there can't be a match (if caller wants to know if both are empty
 		// that's not the same as an intersection).
 		return
 	}
-	matches := len(f.T)
 	for _, v := range f.T {
-		for _, w := range t.T {
-			if Equals(v.FilterKey(), w.Key()) {
-				// we have a matching tag key, and both have a first field, check if tag has any
-				// of the subsequent values in the filter tag.
-				for _, val := range v.Field[1:] {
-					if Equals(val, w.Value()) {
-						matches--
-					}
-				}
+		if !t.hasAny(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAny returns true if one of the tags has the key of the filter tag v and one
+// of its values. The values of e and p filter tags are binary when they are
+// decoded from JSON, so these are also compared hex encoded.
+func (t *T) hasAny(v *tag.T) bool {
+	key := v.FilterKey()
+	binary := Equals(key, B("e")) || Equals(key, B("p"))
+	for _, w := range t.T {
+		if !Equals(key, w.Key()) {
+			continue
+		}
+		for _, val := range v.Field[1:] {
+			if Equals(val, w.Value()) ||
+				(binary && len(val) == 32 && S(w.Value()) == hex.Enc(val)) {
+				return true
 			}
 		}
 	}
-	return matches == 0
+	return false
 }
 
 // // ContainsAny returns true if any of the strings given in `values` matches any of the tag
@@ -6,6 +6,7 @@ import (
 
 	"lukechampine.com/frand"
 	"nostr.mleku.dev/codec/tag"
+	"util.mleku.dev/hex"
 )
 
 func TestMarshalUnmarshal(t *testing.T) {
@@ -158,3 +159,35 @@ func TestT_Clone_Equal(t *testing.T) {
 		}
 	}
 }
+
+func TestIntersects(t *testing.T) {
+	id := frand.Bytes(32)
+	pk := frand.Bytes(32)
+	ev := New(tag.New("e", hex.Enc(id)), tag.New("p", hex.Enc(pk)), tag.New("t", "nostr"),
+		tag.New("t", "go"))
+	for i, c := range []struct {
+		f    *T
+		want bool
+	}{
+		// a filter tag matches any of its values.
+		{New(tag.New("#t", "rust", "go")), true},
+		{New(tag.New("#t", "rust")), false},
+		// every filter tag must match.
+		{New(tag.New("#t", "go"), tag.New("#t", "nostr")), true},
+		{New(tag.New("#t", "go"), tag.New("#d", "go")), false},
+		// e and p filter values are binary, event tag values are hex.
+		{New(tag.New(B("#e"), id), tag.New(B("#p"), pk)), true},
+		{New(tag.New("#e", hex.Enc(id))), true},
+		{New(tag.New(B("#e"), pk)), false},
+		// only e and p values are compared hex encoded.
+		{New(tag.New(B("#t"), B("go")), tag.New(B("#d"), id)), false},
+		{New(), true},
+	} {
+		if got := ev.Intersects(c.f); got != c.want {
+			t.Errorf("%d: got %v want %v", i, got, c.want)
+		}
+	}
+	if New().Intersects(New(tag.New("#t", "go"))) || ev.Intersects(nil) {
+		t.Fatal("empty tags intersect")
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/event/examples"
+)
+
+func generateCorpus(t testing.TB, n int) (evs []*event.T) {
+	for range n {
+		ev, _, err := GenerateEvent(nil, 280)
+		if Chk.E(err) {
+			t.Fatal(err)
+		}
+		evs = append(evs, ev)
+	}
+	return
+}
+
+func TestDictCompression(t *testing.T) {
+	var err error
+	var v1, v2 int
+	for _, ev := range generateCorpus(t, 1000) {
+		var b1, b2 B
+		if b1, err = ev.MarshalBinaryVersion(nil, event.BinaryV1); Chk.E(err) {
+			t.Fatal(err)
+		}
+		if b2, err = ev.MarshalBinaryVersion(nil, event.BinaryV2); Chk.E(err) {
+			t.Fatal(err)
+		}
+		v1, v2 = v1+len(b1), v2+len(b2)
+		ev2 := event.New()
+		if _, err = ev2.UnmarshalBinary(b2); Chk.E(err) {
+			t.Fatal(err)
+		}
+		if !Equals(ev.Serialize(), ev2.Serialize()) {
+			t.Fatalf("got\n%s\nexpected\n%s", ev2.Serialize(), ev.Serialize())
+		}
+	}
+	if v2 >= v1 {
+		t.Fatalf("compressed corpus %d bytes is not smaller than %d", v2, v1)
+	}
+	Log.I.F("v1 %d bytes v2 %d bytes, %.1f%% smaller", v1, v2,
+		100*float64(v1-v2)/float64(v1))
+}
+
+func TestDictExamples(t *testing.T) {
+	scanner := bufio.NewScanner(bytes.NewBuffer(examples.Cache))
+	buf := make(B, 1_000_000)
+	scanner.Buffer(buf, len(buf))
+	var err error
+	for scanner.Scan() {
+		ev := event.New()
+		if _, err = ev.UnmarshalJSON(append(B{}, scanner.Bytes()...)); Chk.E(err) {
+			t.Fatal(err)
+		}
+		var b B
+		if b, err = ev.MarshalBinaryVersion(nil, event.BinaryV2); Chk.E(err) {
+			t.Fatal(err)
+		}
+		ev2 := event.New()
+		if _, err = ev2.UnmarshalBinary(b); Chk.E(err) {
+			t.Fatal(err)
+		}
+		if !Equals(ev.Serialize(), ev2.Serialize()) {
+			t.Fatalf("got\n%s\nexpected\n%s", ev2.Serialize(), ev.Serialize())
+		}
+		// decoded fields must not share memory with the dictionary
+		for _, tt := range ev2.Tags.T {
+			for _, f := range tt.Field {
+				clear(f)
+			}
+		}
+	}
+	for i, e := range event.DefaultDict.Entries {
+		if e[0] == 0 {
+			t.Fatalf("decoding exposed dictionary entry %d", i)
+		}
+	}
+}
+
+func benchmarkMarshal(bb *testing.B, version byte) {
+	evs := generateCorpus(bb, 1000)
+	var out B
+	var size int
+	for _, ev := range evs {
+		out, _ = ev.MarshalBinaryVersion(out[:0], version)
+		size += len(out)
+	}
+	bb.ReportAllocs()
+	bb.ResetTimer()
+	for i := 0; i < bb.N; i++ {
+		out, _ = evs[i%len(evs)].MarshalBinaryVersion(out[:0], version)
+	}
+	bb.ReportMetric(float64(size)/float64(len(evs)), "bytes/event")
+}
+
+func benchmarkUnmarshal(bb *testing.B, version byte) {
+	evs := generateCorpus(bb, 1000)
+	bins := make([]B, len(evs))
+	for i, ev := range evs {
+		bins[i], _ = ev.MarshalBinaryVersion(nil, version)
+	}
+	bb.ReportAllocs()
+	bb.ResetTimer()
+	ev := event.New()
+	for i := 0; i < bb.N; i++ {
+		if _, err := ev.UnmarshalBinary(bins[i%len(bins)]); Chk.E(err) {
+			bb.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalBinaryV1(bb *testing.B)   { benchmarkMarshal(bb, event.BinaryV1) }
+func BenchmarkMarshalBinaryV2(bb *testing.B)   { benchmarkMarshal(bb, event.BinaryV2) }
+func BenchmarkUnmarshalBinaryV1(bb *testing.B) { benchmarkUnmarshal(bb, event.BinaryV1) }
+func BenchmarkUnmarshalBinaryV2(bb *testing.B) { benchmarkUnmarshal(bb, event.BinaryV2) }
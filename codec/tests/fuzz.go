@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec"
+	"nostr.mleku.dev/codec/envelopes"
+	"nostr.mleku.dev/codec/envelopes/enveloper"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/event/examples"
+)
+
+// ExampleEvents returns up to max of the events in the examples cache.
+func ExampleEvents(max int) (evs []*event.T) {
+	scanner := bufio.NewScanner(bytes.NewBuffer(examples.Cache))
+	buf := make(B, 1_000_000)
+	scanner.Buffer(buf, len(buf))
+	for scanner.Scan() && len(evs) < max {
+		ev := event.New()
+		if _, err := ev.UnmarshalJSON(append(B{}, scanner.Bytes()...)); err != nil {
+			continue
+		}
+		evs = append(evs, ev)
+	}
+	return
+}
+
+// CheckJSON decodes b into a value from mk. Hostile input must never panic, and
+// if it decodes, the encoding of the value must decode again and encode to the
+// same bytes.
+func CheckJSON(t *testing.T, mk func() codec.JSON, b B) {
+	v := mk()
+	// decoders can unescape in place, so don't let them modify the corpus
+	if _, err := v.UnmarshalJSON(append(B{}, b...)); err != nil {
+		return
+	}
+	m1, err := v.MarshalJSON(nil)
+	if err != nil {
+		return
+	}
+	v2 := mk()
+	if _, err = v2.UnmarshalJSON(append(B{}, m1...)); err != nil {
+		t.Fatalf("failed to decode own encoding: %v\ninput %q\nencoded %q",
+			err, b, m1)
+	}
+	var m2 B
+	if m2, err = v2.MarshalJSON(nil); err != nil {
+		t.Fatalf("failed to encode decoded encoding: %v\n%q", err, m1)
+	}
+	if !Equals(m1, m2) {
+		t.Fatalf("encoding not stable\ninput %q\nfirst %q\nsecond %q", b, m1, m2)
+	}
+}
+
+// CheckEnvelope is CheckJSON for a whole envelope, which is identified by its
+// label before the envelope decoder is applied to the remainder.
+func CheckEnvelope(t *testing.T, label S, mk func() enveloper.I, b B) {
+	l, rem, err := envelopes.Identify(append(B{}, b...))
+	if err != nil || l != label {
+		return
+	}
+	v := mk()
+	if _, err = v.UnmarshalJSON(rem); err != nil {
+		return
+	}
+	m1, err := v.MarshalJSON(nil)
+	if err != nil {
+		return
+	}
+	if l, rem, err = envelopes.Identify(append(B{}, m1...)); err != nil ||
+		l != label {
+		t.Fatalf("failed to identify own encoding %q: %v", m1, err)
+	}
+	v2 := mk()
+	if _, err = v2.UnmarshalJSON(rem); err != nil {
+		t.Fatalf("failed to decode own encoding: %v\ninput %q\nencoded %q",
+			err, b, m1)
+	}
+	var m2 B
+	if m2, err = v2.MarshalJSON(nil); err != nil {
+		t.Fatalf("failed to encode decoded encoding: %v\n%q", err, m1)
+	}
+	if !Equals(m1, m2) {
+		t.Fatalf("encoding not stable\ninput %q\nfirst %q\nsecond %q", b, m1, m2)
+	}
+}
+
+// CheckBinary is CheckJSON for binary codecs.
+func CheckBinary(t *testing.T, mk func() codec.Binary, b B) {
+	v := mk()
+	if _, err := v.UnmarshalBinary(append(B{}, b...)); err != nil {
+		return
+	}
+	m1, err := v.MarshalBinary(nil)
+	if err != nil {
+		return
+	}
+	v2 := mk()
+	if _, err = v2.UnmarshalBinary(append(B{}, m1...)); err != nil {
+		t.Fatalf("failed to decode own encoding: %v\ninput %x\nencoded %x",
+			err, b, m1)
+	}
+	var m2 B
+	if m2, err = v2.MarshalBinary(nil); err != nil {
+		t.Fatalf("failed to encode decoded encoding: %v\n%x", err, m1)
+	}
+	if !Equals(m1, m2) {
+		t.Fatalf("encoding not stable\ninput %x\nfirst %x\nsecond %x", b, m1, m2)
+	}
+}
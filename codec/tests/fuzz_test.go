@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec"
+	"nostr.mleku.dev/codec/envelopes/authenvelope"
+	"nostr.mleku.dev/codec/envelopes/closedenvelope"
+	"nostr.mleku.dev/codec/envelopes/closeenvelope"
+	"nostr.mleku.dev/codec/envelopes/countenvelope"
+	"nostr.mleku.dev/codec/envelopes/enveloper"
+	"nostr.mleku.dev/codec/envelopes/eoseenvelope"
+	"nostr.mleku.dev/codec/envelopes/eventenvelope"
+	"nostr.mleku.dev/codec/envelopes/noticeenvelope"
+	"nostr.mleku.dev/codec/envelopes/okenvelope"
+	"nostr.mleku.dev/codec/envelopes/reqenvelope"
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/filters"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/subscriptionid"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/text"
+	"nostr.mleku.dev/codec/timestamp"
+)
+
+var filterSeeds = []S{
+	`{}`,
+	`{"ids":["5c83da77af1dec6d7289834998ad7aafbd9e2191396d75ec3cc27f5a77226f36"],"kinds":[0,1,30023],"limit":10}`,
+	`{"authors":["0000000000000000000000000000000000000000000000000000000000000000"],"#e":["a","b"],"since":1,"until":1700000000,"search":"x\"y"}`,
+	`{"#p":[],"kinds":[],"limit":0}`,
+}
+
+// envelopeSeeds returns encoded envelopes of every type made from the examples.
+func envelopeSeeds() (seeds []B) {
+	var b B
+	for _, ev := range ExampleEvents(10) {
+		b, _ = eventenvelope.NewSubmissionWith(ev).MarshalJSON(nil)
+		seeds = append(seeds, b)
+		b, _ = eventenvelope.NewResultWith("sub", ev).MarshalJSON(nil)
+		seeds = append(seeds, b)
+		b, _ = authenvelope.NewResponseWith(ev).MarshalJSON(nil)
+		seeds = append(seeds, b)
+		b, _ = okenvelope.NewFrom(ev.ID, true, B("duplicate: \"x\"")).MarshalJSON(nil)
+		seeds = append(seeds, b)
+	}
+	for _, s := range []S{
+		`["AUTH","challenge\\\"\n"]`,
+		`["CLOSED","sub","error: \"reason\""]`,
+		`["CLOSE","sub"]`,
+		`["COUNT","sub",{"count":10,"approximate":true}]`,
+		`["EOSE","sub"]`,
+		`["NOTICE","notice\\u0000"]`,
+	} {
+		seeds = append(seeds, B(s))
+	}
+	for _, s := range filterSeeds {
+		seeds = append(seeds, B(`["REQ","sub",`+s+`]`), B(`["COUNT","sub",`+s+`]`))
+	}
+	return
+}
+
+func fuzzJSON(f *testing.F, seeds []B, mk func() codec.JSON) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) { CheckJSON(t, mk, b) })
+}
+
+func fuzzEnvelope(f *testing.F, label S, mk func() enveloper.I) {
+	for _, s := range envelopeSeeds() {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) { CheckEnvelope(t, label, mk, b) })
+}
+
+func FuzzKind(f *testing.F) {
+	fuzzJSON(f, []B{B("0"), B("65535"), B("-1"), B("1e3")},
+		func() codec.JSON { return kind.New(0) })
+}
+
+func FuzzKinds(f *testing.F) {
+	fuzzJSON(f, []B{B("[]"), B("[0,1,2]"), B("[1,"), B("[,]")},
+		func() codec.JSON { return kinds.New() })
+}
+
+func FuzzTimestamp(f *testing.F) {
+	fuzzJSON(f, []B{B("0"), B("1700000000"), B("-1"), B("18446744073709551615")},
+		func() codec.JSON { return timestamp.New() })
+}
+
+func FuzzSubscriptionID(f *testing.F) {
+	fuzzJSON(f, []B{B(`"sub"`), B(`""`), B(`"\"\\"`)},
+		func() codec.JSON { return subscriptionid.NewStd() })
+}
+
+func FuzzTag(f *testing.F) {
+	var seeds []B
+	for _, ev := range ExampleEvents(50) {
+		for _, t := range ev.Tags.T {
+			b, _ := t.MarshalJSON(nil)
+			seeds = append(seeds, b)
+		}
+	}
+	fuzzJSON(f, seeds, func() codec.JSON { return tag.NewWithCap(0) })
+}
+
+func FuzzTags(f *testing.F) {
+	var seeds []B
+	for _, ev := range ExampleEvents(50) {
+		b, _ := ev.Tags.MarshalJSON(nil)
+		seeds = append(seeds, b)
+	}
+	fuzzJSON(f, seeds, func() codec.JSON { return tags.New() })
+}
+
+func FuzzFilter(f *testing.F) {
+	var seeds []B
+	for _, s := range filterSeeds {
+		seeds = append(seeds, B(s))
+	}
+	fuzzJSON(f, seeds, func() codec.JSON { return filter.New() })
+}
+
+func FuzzFilters(f *testing.F) {
+	var seeds []B
+	for _, s := range filterSeeds {
+		seeds = append(seeds, B(`[`+s+`,`+s+`]`))
+	}
+	fuzzJSON(f, seeds, func() codec.JSON { return filters.New() })
+}
+
+func FuzzAuthChallengeEnvelope(f *testing.F) {
+	fuzzEnvelope(f, authenvelope.L,
+		func() enveloper.I { return authenvelope.NewChallenge() })
+}
+
+func FuzzAuthResponseEnvelope(f *testing.F) {
+	fuzzEnvelope(f, authenvelope.L,
+		func() enveloper.I { return authenvelope.NewResponse() })
+}
+
+func FuzzClosedEnvelope(f *testing.F) {
+	fuzzEnvelope(f, closedenvelope.L, func() enveloper.I { return closedenvelope.New() })
+}
+
+func FuzzCloseEnvelope(f *testing.F) {
+	fuzzEnvelope(f, closeenvelope.L, func() enveloper.I { return closeenvelope.New() })
+}
+
+func FuzzCountRequestEnvelope(f *testing.F) {
+	fuzzEnvelope(f, countenvelope.L, func() enveloper.I { return countenvelope.New() })
+}
+
+func FuzzCountResponseEnvelope(f *testing.F) {
+	fuzzEnvelope(f, countenvelope.L,
+		func() enveloper.I { return countenvelope.NewResponse() })
+}
+
+func FuzzEOSEEnvelope(f *testing.F) {
+	fuzzEnvelope(f, eoseenvelope.L, func() enveloper.I { return eoseenvelope.New() })
+}
+
+func FuzzEventSubmissionEnvelope(f *testing.F) {
+	fuzzEnvelope(f, eventenvelope.L,
+		func() enveloper.I { return eventenvelope.NewSubmission() })
+}
+
+func FuzzEventResultEnvelope(f *testing.F) {
+	fuzzEnvelope(f, eventenvelope.L,
+		func() enveloper.I { return eventenvelope.NewResult() })
+}
+
+func FuzzNoticeEnvelope(f *testing.F) {
+	fuzzEnvelope(f, noticeenvelope.L, func() enveloper.I { return noticeenvelope.New() })
+}
+
+func FuzzOKEnvelope(f *testing.F) {
+	fuzzEnvelope(f, okenvelope.L, func() enveloper.I { return okenvelope.New() })
+}
+
+func FuzzReqEnvelope(f *testing.F) {
+	fuzzEnvelope(f, reqenvelope.L, func() enveloper.I { return reqenvelope.New() })
+}
+
+// FuzzText covers the helpers the JSON decoders are built from, which must not
+// panic on any input.
+func FuzzText(f *testing.F) {
+	for _, s := range []S{`"abc"`, `"\\\"\n"`, `["a","b"]`, `[1,2]`, `true`,
+		`"0011"`, `["0011","2233"]`, `\`, `"`, `[`} {
+		f.Add(B(s))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		cp := func() B { return append(B{}, b...) }
+		_ = text.NostrUnescape(cp())
+		_, _, _ = text.UnmarshalQuoted(cp())
+		_, _, _ = text.UnmarshalHex(cp())
+		_, _, _ = text.UnmarshalStringArray(cp())
+		_, _, _ = text.UnmarshalHexArray(cp(), 2)
+		_, _, _ = text.UnmarshalKindsArray(cp())
+		_, _, _ = text.UnmarshalBool(cp())
+		// escaping and unescaping must restore the original
+		if un := text.NostrUnescape(text.NostrEscape(nil, b)); !Equals(un, b) &&
+			!containsEscapePreserved(b) {
+			t.Fatalf("escape round trip got %q expected %q", un, b)
+		}
+	})
+}
+
+// containsEscapePreserved reports whether b has a reverse solidus that
+// NostrEscape deliberately does not escape, which is not restored exactly.
+func containsEscapePreserved(b B) bool {
+	for i := 0; i+1 < len(b); i++ {
+		if b[i] == '\\' && b[i+1] == 'u' {
+			return true
+		}
+	}
+	return false
+}
@@ -2,33 +2,85 @@ package tests
 
 import (
 	"encoding/base64"
+	"fmt"
+	"testing"
+
 	. "nostr.mleku.dev"
 
 	"lukechampine.com/frand"
 	"nostr.mleku.dev/codec/event"
 	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
 	"nostr.mleku.dev/codec/timestamp"
 	"nostr.mleku.dev/crypto/p256k"
 	"util.mleku.dev/hex"
 )
 
+// Relays is a small set of relay URLs used in generated tags.
+var Relays = []S{
+	"wss://relay.damus.io", "wss://nos.lol", "wss://relay.nostr.band",
+	"wss://relay.example.com", "wss://nostr.wine",
+}
+
+// pubkeys is a pool of pubkeys for generated p and a tags, so they repeat the
+// way they do in real events.
+var pubkeys = func() (pks []B) {
+	for range 64 {
+		pks = append(pks, frand.Bytes(32))
+	}
+	return
+}()
+
+// GenerateTags creates up to n random e, p, a, t and r tags of the kind that
+// typically appear in text notes and reactions.
+func GenerateTags(n int) (t *tags.T) {
+	t = tags.New()
+	for range frand.Intn(n + 1) {
+		pk := hex.Enc(pubkeys[frand.Intn(len(pubkeys))])
+		relay := Relays[frand.Intn(len(Relays))]
+		switch frand.Intn(5) {
+		case 0:
+			t.T = append(t.T, tag.New("e", hex.Enc(frand.Bytes(32)), relay,
+				[]S{tag.MarkerRoot, tag.MarkerReply, tag.MarkerMention}[frand.Intn(3)]))
+		case 1:
+			t.T = append(t.T, tag.New("p", pk, relay))
+		case 2:
+			t.T = append(t.T, tag.New("a",
+				fmt.Sprintf("30023:%s:article-%d", pk, frand.Intn(100))))
+		case 3:
+			t.T = append(t.T, tag.New("t", fmt.Sprintf("topic%d", frand.Intn(100))))
+		case 4:
+			t.T = append(t.T, tag.New("r", relay))
+		}
+	}
+	return
+}
+
+// GenerateEvent creates a signed text note with random content of up to
+// maxSize bytes and some random tags. If nsec is empty a new key is generated,
+// otherwise it is the hex encoded secret key to sign with.
 func GenerateEvent(nsec B, maxSize int) (ev *event.T, binSize int, err E) {
 	l := frand.Intn(maxSize * 6 / 8) // account for base64 expansion
 	ev = &event.T{
 		Kind:      kind.TextNote,
 		CreatedAt: timestamp.Now(),
+		Tags:      GenerateTags(8),
 		Content:   B(base64.StdEncoding.EncodeToString(frand.Bytes(l))),
 	}
-	var sec B
-	if _, err = hex.DecBytes(sec, nsec); Chk.E(err) {
-		return
-	}
 	signer := new(p256k.Signer)
-	if err = signer.Generate(); Chk.E(err) {
-		return
-	}
-	if err = signer.InitSec(sec); Chk.E(err) {
-		return
+	if len(nsec) == 0 {
+		if err = signer.Generate(); Chk.E(err) {
+			return
+		}
+	} else {
+		sec := make(B, 32)
+		if _, err = hex.DecBytes(sec, nsec); Chk.E(err) {
+			return
+		}
+		if err = signer.InitSec(sec); Chk.E(err) {
+			return
+		}
 	}
 	if err = ev.Sign(signer); Chk.E(err) {
 		return
@@ -38,3 +90,17 @@ func GenerateEvent(nsec B, maxSize int) (ev *event.T, binSize int, err E) {
 	binSize = len(bin)
 	return
 }
+
+// Signers creates n signers with new keys, failing the test if one can't be
+// generated.
+func Signers(t testing.TB, n int) (signers []*p256k.Signer) {
+	t.Helper()
+	for range n {
+		s := new(p256k.Signer)
+		if err := s.Generate(); Chk.E(err) {
+			t.Fatal(err)
+		}
+		signers = append(signers, s)
+	}
+	return
+}
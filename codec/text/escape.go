@@ -64,6 +64,12 @@ func NostrUnescape(dst B) (b B) {
 	for ; r < len(dst); r++ {
 		if dst[r] == '\\' {
 			r++
+			if r == len(dst) {
+				// a trailing reverse solidus has nothing to escape, keep it.
+				dst[w] = '\\'
+				w++
+				break
+			}
 			c := dst[r]
 			switch {
 
@@ -28,7 +28,7 @@ func JSONKey(dst, k B) (b B) {
 // is required).
 func UnmarshalHex(b B) (h B, rem B, err error) {
 	rem = b[:]
-	var inQuote bool
+	var inQuote, closed bool
 	var start int
 	for i := 0; i < len(b); i++ {
 		if !inQuote {
@@ -39,10 +39,11 @@ func UnmarshalHex(b B) (h B, rem B, err error) {
 		} else if b[i] == '"' {
 			h = b[start:i]
 			rem = b[i+1:]
+			closed = true
 			break
 		}
 	}
-	if !inQuote {
+	if !closed {
 		err = io.EOF
 		return
 	}
@@ -61,15 +62,17 @@ func UnmarshalHex(b B) (h B, rem B, err error) {
 // UnmarshalQuoted performs an in-place unquoting of NIP-01 quoted byte string.
 func UnmarshalQuoted(b B) (content, rem B, err error) {
 	rem = b[:]
-	for ; len(rem) >= 0; rem = rem[1:] {
+	var opened bool
+	for ; len(rem) > 0; rem = rem[1:] {
 		// advance to open quotes
 		if rem[0] == '"' {
 			rem = rem[1:]
 			content = rem
+			opened = true
 			break
 		}
 	}
-	if len(rem) == 0 {
+	if !opened || len(rem) == 0 {
 		err = io.EOF
 		return
 	}
@@ -77,7 +80,8 @@ func UnmarshalQuoted(b B) (content, rem B, err error) {
 	var contentLen int
 	for len(rem) > 0 {
 		if rem[0] == '\\' {
-			escaping = true
+			// an escaped reverse solidus does not escape the next character.
+			escaping = !escaping
 			contentLen++
 			rem = rem[1:]
 		} else if rem[0] == '"' {
@@ -105,6 +109,9 @@ func UnmarshalQuoted(b B) (content, rem B, err error) {
 			rem = rem[1:]
 		}
 	}
+	// the closing quote was not found.
+	content = nil
+	err = io.EOF
 	return
 }
 
@@ -146,6 +153,10 @@ func UnmarshalHexArray(b B, size int) (t []B, rem B, err error) {
 					return
 				}
 				t = append(t, h)
+				if len(rem) == 0 {
+					err = io.EOF
+					return
+				}
 				if rem[0] == ']' {
 					rem = rem[1:]
 					// done
@@ -176,6 +187,10 @@ func UnmarshalStringArray(b B) (t []B, rem B, err error) {
 					return
 				}
 				t = append(t, h)
+				if len(rem) == 0 {
+					err = io.EOF
+					return
+				}
 				if rem[0] == ']' {
 					rem = rem[1:]
 					// done
@@ -220,6 +235,10 @@ func UnmarshalKindsArray(b B) (k *kinds.T, rem B, err error) {
 				return
 			}
 			k.K = append(k.K, kind.New(kk.Uint16()))
+			if len(rem) == 0 {
+				err = io.EOF
+				return
+			}
 			if rem[0] == ']' {
 				rem = rem[1:]
 				return
@@ -0,0 +1,325 @@
+// Package thread reconstructs NIP-10 reply threads of text notes from the e tags
+// of the events, and composes the tags of replies.
+package thread
+
+import (
+	"sort"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"util.mleku.dev/hex"
+)
+
+// The markers of e tags.
+var (
+	Root    = B("root")
+	Reply   = B("reply")
+	Mention = B("mention")
+)
+
+var etag, ptag = B("e"), B("p")
+
+// Ref is an event referred to by an e tag.
+type Ref struct {
+	// ID is the 32 byte id of the event.
+	ID B
+	// Relay is where the event can be found, if the tag has one.
+	Relay B
+	// PubKey is the 32 byte public key of the author, if the tag has one.
+	PubKey B
+}
+
+// Refs are the events a note refers to.
+type Refs struct {
+	// Root is the first event of the thread, nil if the note is not a reply.
+	Root *Ref
+	// Reply is the event the note replies to, which is Root for a direct reply.
+	Reply *Ref
+	// Mentions are the other events the note refers to.
+	Mentions []*Ref
+}
+
+// ParseRefs classifies the e tags of an event. Marked tags are used if there are
+// any, and otherwise the deprecated positional scheme, where the first e tag is
+// the root, the last is the reply, and those in between are mentions.
+func ParseRefs(ev *event.T) (r *Refs) {
+	r = &Refs{}
+	if ev.Tags == nil {
+		return
+	}
+	var refs []*Ref
+	var markers []B
+	marked := false
+	for _, t := range ev.Tags.T {
+		if t == nil || t.Len() < 2 || !Equals(t.Key(), etag) {
+			continue
+		}
+		id, err := hex.Dec(S(t.Value()))
+		if err != nil || len(id) != 32 {
+			continue
+		}
+		ref := &Ref{ID: id}
+		var marker B
+		if t.Len() > 2 {
+			ref.Relay = t.Field[2]
+		}
+		if t.Len() > 3 {
+			marker = t.Field[3]
+			if Equals(marker, Root) || Equals(marker, Reply) {
+				marked = true
+			}
+		}
+		if t.Len() > 4 {
+			if pk, err := hex.Dec(S(t.Field[4])); err == nil && len(pk) == 32 {
+				ref.PubKey = pk
+			}
+		}
+		refs = append(refs, ref)
+		markers = append(markers, marker)
+	}
+	if len(refs) == 0 {
+		return
+	}
+	if marked {
+		for i, ref := range refs {
+			switch {
+			case Equals(markers[i], Root) && r.Root == nil:
+				r.Root = ref
+			case Equals(markers[i], Reply) && r.Reply == nil:
+				r.Reply = ref
+			default:
+				r.Mentions = append(r.Mentions, ref)
+			}
+		}
+		// a reply to the root has only the root marker, and some clients only
+		// mark the reply.
+		if r.Reply == nil {
+			r.Reply = r.Root
+		}
+		if r.Root == nil {
+			r.Root = r.Reply
+		}
+		return
+	}
+	r.Root, r.Reply = refs[0], refs[len(refs)-1]
+	if len(refs) > 2 {
+		r.Mentions = refs[1 : len(refs)-1]
+	}
+	return
+}
+
+// Node is an event in a thread.
+type Node struct {
+	Event    *event.T
+	Refs     *Refs
+	Parent   *Node
+	Children []*Node
+}
+
+// Walk calls fn for the node and then depth first for its replies, in the order
+// they were created, until fn returns false.
+func (n *Node) Walk(fn func(n *Node, depth int) bool) { n.walk(fn, 0) }
+
+func (n *Node) walk(fn func(n *Node, depth int) bool, depth int) bool {
+	if !fn(n, depth) {
+		return false
+	}
+	for _, c := range n.Children {
+		if !c.walk(fn, depth+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// T is a set of events linked into reply trees.
+type T struct {
+	nodes  map[S]*Node
+	roots  []*Node
+	linked bool
+}
+
+// New creates a thread from a set of events.
+func New(evs ...*event.T) (t *T) {
+	t = &T{nodes: make(map[S]*Node)}
+	t.Add(evs...)
+	return
+}
+
+// Add adds events to the thread. Events already in it are ignored.
+func (t *T) Add(evs ...*event.T) {
+	for _, ev := range evs {
+		id := S(ev.ID)
+		if _, ok := t.nodes[id]; ok {
+			continue
+		}
+		t.nodes[id] = &Node{Event: ev, Refs: ParseRefs(ev)}
+		t.linked = false
+	}
+}
+
+// Get returns the node of an event by its 32 byte id, or nil if it is not in the
+// thread.
+func (t *T) Get(id B) *Node {
+	t.link()
+	return t.nodes[S(id)]
+}
+
+// Len is the number of events in the thread.
+func (t *T) Len() int { return len(t.nodes) }
+
+// Roots returns the nodes without a parent in the thread, oldest first. An event
+// whose parent is missing is placed under the root of its thread if that is
+// present, so it stays in the thread until its parent is found.
+func (t *T) Roots() []*Node {
+	t.link()
+	return t.roots
+}
+
+func (t *T) link() {
+	if t.linked {
+		return
+	}
+	t.roots = t.roots[:0]
+	for _, n := range t.nodes {
+		n.Parent, n.Children = nil, nil
+	}
+	for _, n := range t.nodes {
+		if n.Refs.Reply != nil {
+			if n.Parent = t.nodes[S(n.Refs.Reply.ID)]; n.Parent == nil {
+				n.Parent = t.nodes[S(n.Refs.Root.ID)]
+			}
+		}
+	}
+	// break the loops of events that claim to reply to each other.
+	for _, n := range t.nodes {
+		for p, i := n.Parent, 0; p != nil && i < len(t.nodes); p, i = p.Parent, i+1 {
+			if p == n {
+				n.Parent = nil
+				break
+			}
+		}
+	}
+	for _, n := range t.nodes {
+		if n.Parent == nil {
+			t.roots = append(t.roots, n)
+		} else {
+			n.Parent.Children = append(n.Parent.Children, n)
+		}
+	}
+	byTime(t.roots)
+	for _, n := range t.nodes {
+		byTime(n.Children)
+	}
+	t.linked = true
+}
+
+// byTime sorts nodes oldest first, by id where they were created at once.
+func byTime(nodes []*Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i].Event, nodes[j].Event
+		if a.CreatedAt.I64() != b.CreatedAt.I64() {
+			return a.CreatedAt.I64() < b.CreatedAt.I64()
+		}
+		return S(a.ID) < S(b.ID)
+	})
+}
+
+// Missing returns the ids of the roots and parents the events refer to that are
+// not in the thread.
+func (t *T) Missing() (ids []B) {
+	seen := make(map[S]bool)
+	for _, n := range t.nodes {
+		for _, ref := range []*Ref{n.Refs.Root, n.Refs.Reply} {
+			if ref == nil || seen[S(ref.ID)] {
+				continue
+			}
+			seen[S(ref.ID)] = true
+			if _, ok := t.nodes[S(ref.ID)]; !ok {
+				ids = append(ids, ref.ID)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return S(ids[i]) < S(ids[j]) })
+	return
+}
+
+// AncestorsFilter returns a filter for the missing roots and parents of the
+// events, or nil if none are missing.
+func (t *T) AncestorsFilter() (f *filter.T) {
+	ids := t.Missing()
+	if len(ids) == 0 {
+		return
+	}
+	f = filter.New()
+	f.IDs = tag.New(ids...)
+	return
+}
+
+// RepliesFilter returns a filter for the text notes that refer to any event of
+// the thread, which covers replies whose clients did not tag the root.
+func (t *T) RepliesFilter() (f *filter.T) {
+	ids := make([]B, 0, len(t.nodes))
+	for id := range t.nodes {
+		ids = append(ids, B(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return S(ids[i]) < S(ids[j]) })
+	f = filter.New()
+	f.Kinds = kinds.New(kind.TextNote)
+	// filters hold the values of e and p tags as binary, like the ids of events.
+	f.Tags = tags.New(tag.New(append([]B{B("#e")}, ids...)...))
+	return
+}
+
+// ReplyTags returns the tags of a reply to parent: a root and a reply e tag, or
+// just a root e tag if parent starts the thread, and p tags for the author of
+// parent and everyone it tags. Relay is the relay hint for parent, and may be
+// empty.
+func ReplyTags(parent *event.T, relay B) (t *tags.T) {
+	t = tags.New()
+	refs := ParseRefs(parent)
+	if refs.Root == nil {
+		t.T = append(t.T, eTag(parent.ID, relay, Root, parent.PubKey))
+	} else {
+		t.T = append(t.T, eTag(refs.Root.ID, refs.Root.Relay, Root, refs.Root.PubKey),
+			eTag(parent.ID, relay, Reply, parent.PubKey))
+	}
+	seen := make(map[S]bool)
+	addP := func(pk S) {
+		if pk == "" || seen[pk] {
+			return
+		}
+		seen[pk] = true
+		t.T = append(t.T, tag.New(ptag, B(pk)))
+	}
+	addP(hex.Enc(parent.PubKey))
+	if parent.Tags != nil {
+		for _, pt := range parent.Tags.T {
+			if pt != nil && pt.Len() >= 2 && Equals(pt.Key(), ptag) {
+				addP(S(pt.Value()))
+			}
+		}
+	}
+	return
+}
+
+func eTag(id, relay, marker, pubkey B) *tag.T {
+	t := tag.New(etag, hex.EncAppend(nil, id), relay, marker)
+	if len(pubkey) == 32 {
+		t.Append(hex.EncAppend(nil, pubkey))
+	}
+	return t
+}
+
+// NewReply creates an unsigned text note replying to parent.
+func NewReply(parent *event.T, content, relay B) (ev *event.T) {
+	return &event.T{CreatedAt: timestamp.Now(), Kind: kind.TextNote,
+		Tags: ReplyTags(parent, relay), Content: content}
+}
@@ -0,0 +1,140 @@
+package thread
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto/p256k"
+	"util.mleku.dev/hex"
+)
+
+func sign(t *testing.T, ev *event.T, at int64) *event.T {
+	signer := &p256k.Signer{}
+	if err := signer.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	ev.CreatedAt = timestamp.FromUnix(at)
+	if err := ev.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func id(b byte) S { return hex.Enc(append(make(B, 31), b)) }
+
+func TestParseRefs(t *testing.T) {
+	for i, v := range []struct {
+		tags        [][]S
+		root, reply S
+		mentions    int
+	}{
+		{nil, "", "", 0},
+		{[][]S{{"e", id(1)}}, id(1), id(1), 0},
+		{[][]S{{"e", id(1)}, {"e", id(2)}}, id(1), id(2), 0},
+		{[][]S{{"e", id(1)}, {"e", id(3)}, {"e", id(2)}}, id(1), id(2), 1},
+		{[][]S{{"e", id(2), "", "reply"}, {"e", id(3)}, {"e", id(1), "", "root"}},
+			id(1), id(2), 1},
+		{[][]S{{"e", id(3), "", "mention"}, {"e", id(1), "wss://r", "root"}}, id(1), id(1), 1},
+		{[][]S{{"e", id(2), "", "reply"}}, id(2), id(2), 0},
+		{[][]S{{"e", "xyz"}, {"p", id(4)}}, "", "", 0},
+	} {
+		ev := &event.T{Tags: tags.New()}
+		for _, tt := range v.tags {
+			ev.Tags.T = append(ev.Tags.T, tag.New(tt...))
+		}
+		r := ParseRefs(ev)
+		var root, reply S
+		if r.Root != nil {
+			root, reply = hex.Enc(r.Root.ID), hex.Enc(r.Reply.ID)
+		}
+		if root != v.root || reply != v.reply || len(r.Mentions) != v.mentions {
+			t.Fatalf("%d: got root %s reply %s and %d mentions", i, root, reply,
+				len(r.Mentions))
+		}
+	}
+}
+
+func TestThread(t *testing.T) {
+	note := func(content S) *event.T {
+		return &event.T{Kind: kind.TextNote, Tags: tags.New(), Content: B(content)}
+	}
+	root := sign(t, note("root"), 100)
+	a := sign(t, NewReply(root, B("a"), B("wss://relay.example.com")), 200)
+	b := sign(t, NewReply(root, B("b"), nil), 150)
+	aa := sign(t, NewReply(a, B("aa"), nil), 300)
+	aaa := sign(t, NewReply(aa, B("aaa"), nil), 400)
+	// the reply tags of a nested reply point at the root and the parent and tag
+	// everyone in the thread so far.
+	refs := ParseRefs(aa)
+	if !Equals(refs.Root.ID, root.ID) || !Equals(refs.Reply.ID, a.ID) ||
+		!Equals(refs.Root.PubKey, root.PubKey) || S(refs.Root.Relay) != "wss://relay.example.com" {
+		t.Fatalf("unexpected refs of a nested reply %v", aa.Tags.ToStringSlice())
+	}
+	if n := aa.Tags.GetAll(tag.New("p")).Len(); n != 2 {
+		t.Fatalf("expected 2 p tags, got %d", n)
+	}
+	th := New(aaa, b, a)
+	// aaa would hang under the root while its parent is missing, but the root is
+	// missing too, so every event is a root.
+	if len(th.Roots()) != 3 {
+		t.Fatalf("expected 3 roots, got %d", len(th.Roots()))
+	}
+	f := th.AncestorsFilter()
+	if f == nil || f.IDs.Len() != 2 || !f.IDs.Contains(root.ID) || !f.IDs.Contains(aa.ID) {
+		t.Fatalf("unexpected ancestors filter %s", f.Serialize())
+	}
+	if !th.RepliesFilter().Matches(aa) || th.RepliesFilter().Matches(root) {
+		t.Fatalf("unexpected replies filter %s", th.RepliesFilter().Serialize())
+	}
+	// the filter matches the same after it is sent to a relay.
+	f = filter.New()
+	if _, err := f.UnmarshalJSON(th.RepliesFilter().Serialize()); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Matches(aa) || f.Matches(root) {
+		t.Fatalf("unexpected decoded replies filter %s", f.Serialize())
+	}
+	th.Add(root, aa, aa)
+	if th.Len() != 5 || th.AncestorsFilter() != nil {
+		t.Fatalf("expected the thread to be complete")
+	}
+	roots := th.Roots()
+	if len(roots) != 1 || roots[0].Event != root {
+		t.Fatalf("expected one root, got %d", len(roots))
+	}
+	var order []S
+	roots[0].Walk(func(n *Node, depth int) bool {
+		order = append(order, S(n.Event.Content)+":"+S(rune('0'+depth)))
+		return true
+	})
+	expected := []S{"root:0", "b:1", "a:1", "aa:2", "aaa:3"}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("got order %v expected %v", order, expected)
+		}
+	}
+	if th.Get(aaa.ID).Parent.Event != aa {
+		t.Fatal("expected aaa to reply to aa")
+	}
+}
+
+func TestLoop(t *testing.T) {
+	// real ids can't refer to each other, but events can claim anything.
+	x, y := &event.T{Kind: kind.TextNote, CreatedAt: timestamp.FromUnix(1)},
+		&event.T{Kind: kind.TextNote, CreatedAt: timestamp.FromUnix(2)}
+	x.ID, _ = hex.Dec(id(1))
+	y.ID, _ = hex.Dec(id(2))
+	x.Tags = tags.New(tag.New("e", id(2), "", "root"))
+	y.Tags = tags.New(tag.New("e", id(1), "", "root"))
+	th := New(x, y)
+	if len(th.Roots()) != 1 || len(th.Roots()[0].Children) != 1 {
+		t.Fatal("expected the loop to be broken")
+	}
+}
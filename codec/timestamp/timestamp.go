@@ -91,6 +91,9 @@ func (t *T) String() (s S) {
 }
 
 func (t *T) MarshalJSON(dst B) (b B, err error) {
+	if t == nil {
+		return append(dst, '0'), nil
+	}
 	tt := ints.New(t.U64())
 	return tt.MarshalJSON(dst)
 }
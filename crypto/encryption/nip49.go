@@ -0,0 +1,135 @@
+package encryption
+
+import (
+	"crypto/rand"
+
+	. "nostr.mleku.dev"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+	"nostr.mleku.dev/codec/bech32encoding"
+	"nostr.mleku.dev/crypto/p256k"
+)
+
+// KeySecurity is the NIP-49 key security byte, it records whether the secret key
+// was ever handled insecurely before it was encrypted. It is authenticated along
+// with the key so it can't be changed without the password.
+type KeySecurity byte
+
+const (
+	// KeyInsecure means the key is known to have been handled insecurely, such
+	// as being stored unencrypted or pasted into a web page.
+	KeyInsecure KeySecurity = iota
+	// KeySecure means the key is not known to have been handled insecurely.
+	KeySecure
+	// KeyUnknown means the client does not track this.
+	KeyUnknown
+)
+
+const (
+	// NIP49Version is the version byte of the encrypted key payload.
+	NIP49Version byte = 2
+	// DefaultLogN is the scrypt cost used when none is given, 2^16 rounds use
+	// 64MiB of memory and take around 100ms on a fast machine. Each increment
+	// doubles both.
+	DefaultLogN byte = 16
+	// NIP49PayloadLen is the length of the encrypted key payload: version, log_n,
+	// 16 byte salt, 24 byte nonce, key security byte and the 48 byte ciphertext.
+	NIP49PayloadLen = 1 + 1 + 16 + chacha20poly1305.NonceSizeX + 1 + 32 +
+		chacha20poly1305.Overhead
+)
+
+// nip49Key derives the symmetric key from the password with scrypt, the
+// password is normalized to unicode NFKC first so it can be typed on any device.
+func nip49Key(password S, salt B, logN byte) (key B, err E) {
+	if logN > 30 {
+		return nil, Errorf.E("log_n %d is too large", logN)
+	}
+	return scrypt.Key(norm.NFKC.Bytes(B(password)), salt, 1<<logN, 8, 1,
+		chacha20poly1305.KeySize)
+}
+
+// EncryptSecretKey encrypts a 32 byte secret key with a password as specified
+// in NIP-49 and returns it as an ncryptsec string. logN is the scrypt cost, use
+// DefaultLogN if unsure.
+func EncryptSecretKey(sec B, password S, logN byte, ks KeySecurity) (ncryptsec B,
+	err E) {
+
+	if len(sec) != 32 {
+		return nil, Errorf.E("secret key must be 32 bytes, got %d", len(sec))
+	}
+	payload := make(B, 0, NIP49PayloadLen)
+	payload = append(payload, NIP49Version, logN)
+	salt := make(B, 16)
+	nonce := make(B, chacha20poly1305.NonceSizeX)
+	if _, err = rand.Read(salt); Chk.E(err) {
+		return
+	}
+	if _, err = rand.Read(nonce); Chk.E(err) {
+		return
+	}
+	var key B
+	if key, err = nip49Key(password, salt, logN); Chk.E(err) {
+		return
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if Chk.E(err) {
+		return
+	}
+	payload = append(payload, salt...)
+	payload = append(payload, nonce...)
+	payload = append(payload, byte(ks))
+	payload = aead.Seal(payload, nonce, sec, B{byte(ks)})
+	return bech32encoding.EncodeNcryptsec(payload)
+}
+
+// DecryptSecretKey decrypts an ncryptsec string with a password, returning the
+// secret key and its key security byte.
+func DecryptSecretKey(ncryptsec B, password S) (sec B, ks KeySecurity, err E) {
+	var payload B
+	if payload, err = bech32encoding.DecodeNcryptsec(ncryptsec); Chk.E(err) {
+		return
+	}
+	if len(payload) != NIP49PayloadLen {
+		err = Errorf.E("encrypted key must be %d bytes, got %d", NIP49PayloadLen,
+			len(payload))
+		return
+	}
+	if payload[0] != NIP49Version {
+		err = Errorf.E("unknown encrypted key version %d", payload[0])
+		return
+	}
+	logN, salt := payload[1], payload[2:18]
+	nonce := payload[18 : 18+chacha20poly1305.NonceSizeX]
+	ad := payload[18+chacha20poly1305.NonceSizeX : 19+chacha20poly1305.NonceSizeX]
+	ciphertext := payload[19+chacha20poly1305.NonceSizeX:]
+	var key B
+	if key, err = nip49Key(password, salt, logN); Chk.E(err) {
+		return
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if Chk.E(err) {
+		return
+	}
+	if sec, err = aead.Open(nil, nonce, ciphertext, ad); err != nil {
+		err = Errorf.E("failed to decrypt secret key, wrong password?")
+		return
+	}
+	ks = KeySecurity(ad[0])
+	return
+}
+
+// SignerFromNcryptsec decrypts an ncryptsec string and initializes a signer with
+// the secret key.
+func SignerFromNcryptsec(ncryptsec B, password S) (signer *p256k.Signer, err E) {
+	var sec B
+	if sec, _, err = DecryptSecretKey(ncryptsec, password); err != nil {
+		return
+	}
+	signer = &p256k.Signer{}
+	if err = signer.InitSec(sec); Chk.E(err) {
+		return
+	}
+	return
+}
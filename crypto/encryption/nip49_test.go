@@ -0,0 +1,52 @@
+package encryption
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/unicode/norm"
+	"nostr.mleku.dev/crypto/keys"
+	"util.mleku.dev/hex"
+)
+
+func TestDecryptSecretKeyVector(t *testing.T) {
+	// test vector from NIP-49
+	ncryptsec := B("ncryptsec1qgg9947rlpvqu76pj5ecreduf9jxhselq2nae2kghhvd5g7dgjtcxfqtd67p9m0w57lspw8gsq6yphnm8623nsl8xn9j4jdzz84zm3frztj3z7s35vpzmqf6ksu8r89qk5z2zxfmu5gv8th8wclt0h4p")
+	sec, _, err := DecryptSecretKey(ncryptsec, "nostr")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "3501454135014541350145413501453fefb02227e449e57cf4d3a3ce05378683",
+		hex.Enc(sec))
+	_, _, err = DecryptSecretKey(ncryptsec, "nostr!")
+	assert.Error(t, err, "wrong password must fail")
+}
+
+func TestEncryptSecretKey(t *testing.T) {
+	sec, err := hex.Dec(S(keys.GenerateSecretKeyHex()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the password is normalized, so either form of the same text decrypts.
+	password := "ÅΩẛ̣"
+	var ncryptsec B
+	ncryptsec, err = EncryptSecretKey(sec, password, 8, KeySecure)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var dec B
+	var ks KeySecurity
+	dec, ks, err = DecryptSecretKey(ncryptsec, norm.NFD.String(password))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, sec, dec)
+	assert.Equal(t, KeySecure, ks)
+	signer, err := SignerFromNcryptsec(ncryptsec, password)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, sec, signer.Sec())
+}
@@ -0,0 +1,123 @@
+package frost
+
+import (
+	"sort"
+	"sync"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+)
+
+// Participant is a signer as the coordinator sees it, either in the same
+// process or at the other end of a connection.
+type Participant interface {
+	ID() uint16
+	// Commit makes fresh nonces and returns the commitment to them.
+	Commit() (c *Commitment, err E)
+	// Sign signs the package with the nonces of the participant's commitment in
+	// it.
+	Sign(p *SigningPackage) (s *SignatureShare, err E)
+}
+
+// Local is a Participant that holds its key share in this process.
+type Local struct {
+	Key *KeyShare
+	mx  sync.Mutex
+	// nonces are the unused nonces by hiding commitment.
+	nonces map[S]*Nonces
+}
+
+var _ Participant = &Local{}
+
+// NewLocal creates a Participant for a key share.
+func NewLocal(k *KeyShare) *Local { return &Local{Key: k, nonces: make(map[S]*Nonces)} }
+
+func (l *Local) ID() uint16 { return l.Key.ID }
+
+func (l *Local) Commit() (c *Commitment, err E) {
+	var n *Nonces
+	if n, c, err = l.Key.Commit(); err != nil {
+		return
+	}
+	l.mx.Lock()
+	l.nonces[S(c.Hiding)] = n
+	l.mx.Unlock()
+	return
+}
+
+func (l *Local) Sign(p *SigningPackage) (s *SignatureShare, err E) {
+	var n *Nonces
+	l.mx.Lock()
+	for _, c := range p.Commitments {
+		if c.ID == l.Key.ID {
+			n = l.nonces[S(c.Hiding)]
+			// whatever happens the nonces are never used again.
+			delete(l.nonces, S(c.Hiding))
+		}
+	}
+	l.mx.Unlock()
+	if n == nil {
+		err = Errorf.E("participant %d has no nonces for the package", l.Key.ID)
+		return
+	}
+	return l.Key.Sign(n, p)
+}
+
+// Coordinator runs the signing rounds with the participants of a group.
+type Coordinator struct {
+	Keys *PublicKeys
+}
+
+// NewCoordinator creates a coordinator for the group with the given public keys.
+func NewCoordinator(pk *PublicKeys) *Coordinator { return &Coordinator{Keys: pk} }
+
+// Sign collects commitments from the participants, sends them the signing
+// package and aggregates their shares into a signature of msg. At least the
+// threshold of participants are needed, and all of them sign.
+func (c *Coordinator) Sign(msg B, participants []Participant) (sig B, err E) {
+	if len(participants) < int(c.Keys.Threshold) {
+		err = Errorf.E("need %d participants, got %d", c.Keys.Threshold,
+			len(participants))
+		return
+	}
+	p := &SigningPackage{Message: msg}
+	for _, pt := range participants {
+		var cm *Commitment
+		if cm, err = pt.Commit(); err != nil {
+			err = Errorf.E("participant %d failed to commit: %v", pt.ID(), err)
+			return
+		}
+		if cm.ID != pt.ID() {
+			err = Errorf.E("participant %d sent a commitment for %d", pt.ID(), cm.ID)
+			return
+		}
+		p.Commitments = append(p.Commitments, cm)
+	}
+	sort.Slice(p.Commitments, func(i, j int) bool {
+		return p.Commitments[i].ID < p.Commitments[j].ID
+	})
+	shares := make([]*SignatureShare, 0, len(participants))
+	for _, pt := range participants {
+		var s *SignatureShare
+		if s, err = pt.Sign(p); err != nil {
+			err = Errorf.E("participant %d failed to sign: %v", pt.ID(), err)
+			return
+		}
+		shares = append(shares, s)
+	}
+	return c.Keys.Aggregate(p, shares)
+}
+
+// SignEvent sets the pubkey of the event to the group key, computes its ID and
+// signs it with the participants.
+func (c *Coordinator) SignEvent(ev *event.T, participants []Participant) (err E) {
+	ev.PubKey = c.Keys.GroupKey
+	ev.ID = ev.GetIDBytes()
+	var sig B
+	if sig, err = c.Sign(ev.ID, participants); err != nil {
+		return
+	}
+	ev.Sig = sig
+	return
+}
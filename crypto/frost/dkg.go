@@ -0,0 +1,274 @@
+package frost
+
+import (
+	. "nostr.mleku.dev"
+
+	"ec.mleku.dev/v2/secp256k1"
+	"nostr.mleku.dev/crypto/internal/schnorr"
+)
+
+// Round1Package is broadcast to every other participant in the first round of
+// the DKG. It commits to the participant's secret polynomial and proves they
+// know its constant term.
+type Round1Package struct {
+	ID uint16
+	// Commitment is the 33 byte compressed commitments to each coefficient.
+	Commitment []B
+	// ProofR and ProofZ are a Schnorr proof of knowledge of the constant term.
+	ProofR, ProofZ B
+}
+
+// Round2Package is sent privately from one participant to another in the second
+// round of the DKG, it must be encrypted in transit.
+type Round2Package struct {
+	From, To uint16
+	Share    B
+}
+
+// DKG is the state of a participant in a distributed key generation, where n
+// participants make key shares with a threshold of t without any of them
+// knowing the group secret. It is the Pedersen DKG with proofs of knowledge from
+// the FROST paper.
+type DKG struct {
+	ID, Threshold, N uint16
+	ids              []uint16
+	coeffs           []secp256k1.ModNScalar
+	commitments      map[uint16][]secp256k1.JacobianPoint
+}
+
+func proofChallenge(id uint16, c0, r *secp256k1.JacobianPoint) secp256k1.ModNScalar {
+	return hashToScalar("dkg", encodeID(id), schnorr.EncodePoint(nil, c0), schnorr.EncodePoint(nil, r))
+}
+
+// NewDKG starts a distributed key generation as participant id, returning the
+// package to broadcast to the others.
+func NewDKG(id, t, n uint16) (d *DKG, p *Round1Package, err E) {
+	if err = validID(id); err != nil {
+		return
+	}
+	var ids []uint16
+	if ids, err = participants(int(n)); err != nil {
+		return
+	}
+	if t < 1 || t > n || id > n {
+		err = Errorf.E("need 1 <= threshold <= participants and 1 <= id <= "+
+			"participants, got threshold %d, participants %d, id %d", t, n, id)
+		return
+	}
+	d = &DKG{ID: id, Threshold: t, N: n, ids: ids,
+		coeffs:      make([]secp256k1.ModNScalar, t),
+		commitments: make(map[uint16][]secp256k1.JacobianPoint, n)}
+	commitment := make([]secp256k1.JacobianPoint, t)
+	p = &Round1Package{ID: id}
+	for i := range d.coeffs {
+		if d.coeffs[i], err = randomScalar(); err != nil {
+			return
+		}
+		commitment[i] = schnorr.BaseMul(&d.coeffs[i])
+		p.Commitment = append(p.Commitment, schnorr.EncodePoint(nil, &commitment[i]))
+	}
+	d.commitments[id] = commitment
+	var k secp256k1.ModNScalar
+	if k, err = randomScalar(); err != nil {
+		return
+	}
+	r := schnorr.BaseMul(&k)
+	c := proofChallenge(id, &commitment[0], &r)
+	var z secp256k1.ModNScalar
+	z.Mul2(&d.coeffs[0], &c).Add(&k)
+	p.ProofR, p.ProofZ = schnorr.EncodePoint(nil, &r), schnorr.EncodeScalar(nil, &z)
+	return
+}
+
+// verify checks the proof of knowledge of the package and decodes the
+// commitment.
+func (p *Round1Package) verify(t uint16) (commitment []secp256k1.JacobianPoint,
+	err E) {
+
+	if len(p.Commitment) != int(t) {
+		err = Errorf.E("participant %d committed to %d coefficients, expected %d",
+			p.ID, len(p.Commitment), t)
+		return
+	}
+	commitment = make([]secp256k1.JacobianPoint, t)
+	for i := range p.Commitment {
+		if commitment[i], err = schnorr.DecodePoint(p.Commitment[i]); err != nil {
+			return
+		}
+	}
+	var r secp256k1.JacobianPoint
+	var z secp256k1.ModNScalar
+	if r, err = schnorr.DecodePoint(p.ProofR); err != nil {
+		return
+	}
+	if z, err = schnorr.DecodeScalar(p.ProofZ); err != nil {
+		return
+	}
+	c := proofChallenge(p.ID, &commitment[0], &r)
+	// z*G - c*C0 must be R
+	c.Negate()
+	zg, cc := schnorr.BaseMul(&z), schnorr.Mul(&c, &commitment[0])
+	sum := schnorr.Add(&zg, &cc)
+	if schnorr.IsInfinity(&sum) || !Equals(schnorr.EncodePoint(nil, &sum), p.ProofR) {
+		err = Errorf.E("invalid proof of knowledge from participant %d", p.ID)
+	}
+	return
+}
+
+// Round2 checks the packages of every other participant from the first round
+// and returns the share to send privately to each of them.
+func (d *DKG) Round2(packages []*Round1Package) (shares []*Round2Package, err E) {
+	for _, p := range packages {
+		if p.ID == d.ID {
+			continue
+		}
+		if p.ID == 0 || p.ID > d.N {
+			err = Errorf.E("unknown participant %d", p.ID)
+			return
+		}
+		if _, ok := d.commitments[p.ID]; ok {
+			err = Errorf.E("more than one package from participant %d", p.ID)
+			return
+		}
+		var commitment []secp256k1.JacobianPoint
+		if commitment, err = p.verify(d.Threshold); err != nil {
+			return
+		}
+		d.commitments[p.ID] = commitment
+	}
+	if len(d.commitments) != int(d.N) {
+		err = Errorf.E("have packages from %d of %d participants",
+			len(d.commitments), d.N)
+		return
+	}
+	for _, id := range d.ids {
+		if id == d.ID {
+			continue
+		}
+		s := evaluate(d.coeffs, id)
+		shares = append(shares, &Round2Package{From: d.ID, To: id,
+			Share: schnorr.EncodeScalar(nil, &s)})
+	}
+	return
+}
+
+// Finish checks the shares sent to this participant in the second round against
+// the commitments of the first, and returns the key share.
+func (d *DKG) Finish(shares []*Round2Package) (k *KeyShare, err E) {
+	if len(d.commitments) != int(d.N) {
+		err = Errorf.E("round 2 is not complete")
+		return
+	}
+	secret := evaluate(d.coeffs, d.ID)
+	seen := map[uint16]bool{d.ID: true}
+	for _, p := range shares {
+		if p.To != d.ID {
+			err = Errorf.E("share from %d is for participant %d", p.From, p.To)
+			return
+		}
+		commitment, ok := d.commitments[p.From]
+		if !ok || seen[p.From] {
+			err = Errorf.E("unexpected share from participant %d", p.From)
+			return
+		}
+		seen[p.From] = true
+		var s secp256k1.ModNScalar
+		if s, err = schnorr.DecodeScalar(p.Share); err != nil {
+			return
+		}
+		sg, expected := schnorr.BaseMul(&s), evaluateCommitment(commitment, d.ID)
+		if !Equals(schnorr.EncodePoint(nil, &sg), schnorr.EncodePoint(nil, &expected)) {
+			err = Errorf.E("share from participant %d does not match its commitment",
+				p.From)
+			return
+		}
+		secret.Add(&s)
+	}
+	if len(seen) != int(d.N) {
+		err = Errorf.E("have shares from %d of %d participants", len(seen), d.N)
+		return
+	}
+	// the group commitment is the sum of the commitments of every participant.
+	group := make([]secp256k1.JacobianPoint, d.Threshold)
+	for _, commitment := range d.commitments {
+		for i := range group {
+			group[i] = schnorr.Add(&group[i], &commitment[i])
+		}
+	}
+	if schnorr.IsInfinity(&group[0]) {
+		err = Errorf.E("group key is the identity")
+		return
+	}
+	pk := newKeys(d.Threshold, map[uint16]*secp256k1.ModNScalar{d.ID: &secret},
+		group, d.ids)
+	k = &KeyShare{ID: d.ID, Secret: secret, PublicKeys: pk}
+	for i := range d.coeffs {
+		d.coeffs[i].Zero()
+	}
+	return
+}
+
+// MarshalBinary appends the identifier, the number of commitments, the
+// commitments and the proof.
+func (p *Round1Package) MarshalBinary(dst B) (b B, err E) {
+	b = appendUint16(dst, p.ID)
+	b = appendUint16(b, uint16(len(p.Commitment)))
+	for _, c := range p.Commitment {
+		if len(c) != PointLen {
+			err = Errorf.E("commitment must be %d bytes, got %d", PointLen, len(c))
+			return
+		}
+		b = append(b, c...)
+	}
+	if len(p.ProofR) != PointLen || len(p.ProofZ) != ScalarLen {
+		err = Errorf.E("invalid proof length")
+		return
+	}
+	b = append(b, p.ProofR...)
+	b = append(b, p.ProofZ...)
+	return
+}
+
+func (p *Round1Package) UnmarshalBinary(b B) (r B, err E) {
+	var n uint16
+	if p.ID, r, err = readUint16(b); err != nil {
+		return
+	}
+	if n, r, err = readUint16(r); err != nil {
+		return
+	}
+	p.Commitment = make([]B, n)
+	for i := range p.Commitment {
+		if p.Commitment[i], r, err = readBytes(r, PointLen); err != nil {
+			return
+		}
+	}
+	if p.ProofR, r, err = readBytes(r, PointLen); err != nil {
+		return
+	}
+	p.ProofZ, r, err = readBytes(r, ScalarLen)
+	return
+}
+
+// MarshalBinary appends the sender and recipient identifiers and the share.
+func (p *Round2Package) MarshalBinary(dst B) (b B, err E) {
+	if len(p.Share) != ScalarLen {
+		err = Errorf.E("share must be %d bytes, got %d", ScalarLen, len(p.Share))
+		return
+	}
+	b = appendUint16(dst, p.From)
+	b = appendUint16(b, p.To)
+	b = append(b, p.Share...)
+	return
+}
+
+func (p *Round2Package) UnmarshalBinary(b B) (r B, err E) {
+	if p.From, r, err = readUint16(b); err != nil {
+		return
+	}
+	if p.To, r, err = readUint16(r); err != nil {
+		return
+	}
+	p.Share, r, err = readBytes(r, ScalarLen)
+	return
+}
@@ -0,0 +1,191 @@
+// Package frost implements FROST threshold Schnorr signatures over secp256k1,
+// where any t of n participants can sign for a shared key without it ever
+// existing in one place. The signatures are x-only BIP-340 signatures, so the
+// group key is an ordinary nostr pubkey and the events it signs pass
+// event.T.Verify.
+//
+// Keys are made by a trusted dealer with Deal, or without one with the DKG
+// rounds. Signing is two rounds: each signer commits to a pair of nonces, then
+// signs a SigningPackage of the message and the commitments, and the
+// coordinator checks and aggregates the signature shares. Every message
+// implements codec.Binary so the rounds can run over any transport.
+//
+// Hashing follows RFC 9591 with BIP-340 tagged hashes, and the group key and
+// group commitment are negated where needed so they have an even Y coordinate,
+// as BIP-340 requires.
+package frost
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"math"
+
+	. "nostr.mleku.dev"
+
+	"ec.mleku.dev/v2/secp256k1"
+	"nostr.mleku.dev/crypto/internal/schnorr"
+)
+
+// contextString separates the hashes of this protocol from any other.
+const contextString = "FROST-secp256k1-SHA256-TR-v1"
+
+const (
+	// ScalarLen is the length of an encoded scalar.
+	ScalarLen = schnorr.ScalarLen
+	// PointLen is the length of an encoded compressed point.
+	PointLen = schnorr.PointLen
+	// MaxParticipants is the largest group, participant identifiers are 1 to
+	// MaxParticipants.
+	MaxParticipants = math.MaxUint16
+)
+
+// hashToScalar hashes data with the protocol tag name and reduces it to a
+// scalar.
+func hashToScalar(name S, data ...B) (k secp256k1.ModNScalar) {
+	h := schnorr.TaggedHash(contextString+name, data...)
+	k.SetByteSlice(h[:])
+	return
+}
+
+// challenge is the BIP-340 challenge of a signature with nonce point r for the
+// x-only key pub.
+func challenge(r *secp256k1.JacobianPoint, pub, msg B) (c secp256k1.ModNScalar) {
+	h := schnorr.TaggedHash("BIP0340/challenge", schnorr.XOnly(r), pub, msg)
+	c.SetByteSlice(h[:])
+	return
+}
+
+func randomScalar() (k secp256k1.ModNScalar, err E) {
+	b := make(B, 32)
+	for {
+		if _, err = rand.Read(b); Chk.E(err) {
+			return
+		}
+		if overflow := k.SetByteSlice(b); !overflow && !k.IsZero() {
+			return
+		}
+	}
+}
+
+// nonce makes a nonce from fresh randomness hashed with the secret, so a weak
+// random source alone does not reveal the secret.
+func nonce(secret *secp256k1.ModNScalar) (k secp256k1.ModNScalar, err E) {
+	b := make(B, 32)
+	if _, err = rand.Read(b); Chk.E(err) {
+		return
+	}
+	sb := secret.Bytes()
+	return hashToScalar("nonce", b, sb[:]), nil
+}
+
+func scalarInt(i uint16) (k secp256k1.ModNScalar) {
+	k.SetInt(uint32(i))
+	return
+}
+
+// encodeID is the scalar form of an identifier used in hashes.
+func encodeID(id uint16) B {
+	k := scalarInt(id)
+	return schnorr.EncodeScalar(nil, &k)
+}
+
+func negate(p *secp256k1.JacobianPoint) (r secp256k1.JacobianPoint) {
+	r.Set(p)
+	r.ToAffine()
+	r.Y.Negate(1).Normalize()
+	return
+}
+
+// lagrange is the Lagrange coefficient of id at zero over the set of
+// identifiers ids, which must contain id.
+func lagrange(id uint16, ids []uint16) (l secp256k1.ModNScalar, err E) {
+	var num, den secp256k1.ModNScalar
+	num.SetInt(1)
+	den.SetInt(1)
+	xi := scalarInt(id)
+	var found bool
+	for _, j := range ids {
+		if j == id {
+			found = true
+			continue
+		}
+		xj := scalarInt(j)
+		num.Mul(&xj)
+		var d secp256k1.ModNScalar
+		d.NegateVal(&xi).Add(&xj)
+		den.Mul(&d)
+	}
+	if !found {
+		err = Errorf.E("participant %d is not one of the signers", id)
+		return
+	}
+	l.Mul2(&num, den.InverseNonConst())
+	return
+}
+
+// evaluate evaluates the polynomial with coefficients coeffs at x.
+func evaluate(coeffs []secp256k1.ModNScalar, x uint16) (y secp256k1.ModNScalar) {
+	xs := scalarInt(x)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y.Mul(&xs).Add(&coeffs[i])
+	}
+	return
+}
+
+// evaluateCommitment evaluates the polynomial committed to by commitment at x,
+// giving the public key of the share of participant x.
+func evaluateCommitment(commitment []secp256k1.JacobianPoint,
+	x uint16) (y secp256k1.JacobianPoint) {
+
+	xs := scalarInt(x)
+	var pow secp256k1.ModNScalar
+	pow.SetInt(1)
+	for i := range commitment {
+		t := schnorr.Mul(&pow, &commitment[i])
+		y = schnorr.Add(&y, &t)
+		pow.Mul(&xs)
+	}
+	return
+}
+
+func appendUint16(dst B, v uint16) B { return binary.BigEndian.AppendUint16(dst, v) }
+
+func readUint16(b B) (v uint16, r B, err E) {
+	if len(b) < 2 {
+		err = Errorf.E("unexpected end of data")
+		return
+	}
+	return binary.BigEndian.Uint16(b), b[2:], nil
+}
+
+// readBytes returns a copy of the next n bytes.
+func readBytes(b B, n int) (v, r B, err E) {
+	if len(b) < n {
+		err = Errorf.E("unexpected end of data, need %d bytes, have %d", n, len(b))
+		return
+	}
+	return append(B{}, b[:n]...), b[n:], nil
+}
+
+// validID checks that an identifier is usable, zero is the group secret itself.
+func validID(id uint16) (err E) {
+	if id == 0 {
+		err = Errorf.E("participant identifiers start at 1")
+	}
+	return
+}
+
+// participants returns the identifiers 1 to n of a group of n participants. n
+// is an int so a count over MaxParticipants is an error instead of wrapping.
+func participants(n int) (ids []uint16, err E) {
+	if n < 1 || n > MaxParticipants {
+		err = Errorf.E("participants must be from 1 to %d, got %d",
+			MaxParticipants, n)
+		return
+	}
+	ids = make([]uint16, n)
+	for i := range ids {
+		ids[i] = uint16(i + 1)
+	}
+	return
+}
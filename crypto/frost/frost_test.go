@@ -0,0 +1,214 @@
+package frost
+
+import (
+	"strings"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto/keys"
+	"util.mleku.dev/hex"
+)
+
+func signEvent(t *testing.T, pk *PublicKeys, participants []Participant) {
+	ev := &event.T{
+		CreatedAt: timestamp.Now(),
+		Kind:      kind.TextNote,
+		Tags:      tags.New(),
+		Content:   B("signed by " + strings.Repeat("us ", len(participants))),
+	}
+	if err := NewCoordinator(pk).SignEvent(ev, participants); err != nil {
+		t.Fatal(err)
+	}
+	if valid, err := ev.Verify(); err != nil || !valid {
+		t.Fatalf("event does not verify: %v", err)
+	}
+}
+
+func locals(shares []*KeyShare, ids ...uint16) (p []Participant) {
+	for _, id := range ids {
+		p = append(p, NewLocal(shares[id-1]))
+	}
+	return
+}
+
+func TestDeal(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		sec := B(keys.GenerateSecretKeyHex())
+		secret, _ := hex.Dec(S(sec))
+		shares, pk, err := Deal(3, 5, secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pub S
+		if pub, err = keys.GetPublicKeyHex(S(sec)); err != nil {
+			t.Fatal(err)
+		}
+		if hex.Enc(pk.GroupKey) != pub {
+			t.Fatalf("got group key %0x expected %s", pk.GroupKey, pub)
+		}
+		for _, s := range shares {
+			if err = s.Verify(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, ids := range [][]uint16{{1, 2, 3}, {5, 3, 1}, {2, 4, 5}, {1, 2, 3, 4, 5}} {
+			signEvent(t, pk, locals(shares, ids...))
+		}
+		if _, err = NewCoordinator(pk).Sign(make(B, 32), locals(shares, 1, 2)); err == nil {
+			t.Fatal("expected an error signing with fewer than the threshold")
+		}
+	}
+}
+
+func TestParticipants(t *testing.T) {
+	ids, err := participants(MaxParticipants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := ids[len(ids)-1]
+	if len(ids) != MaxParticipants || ids[0] != 1 || last != MaxParticipants {
+		t.Fatalf("got %d identifiers from %d to %d", len(ids), ids[0], last)
+	}
+	for _, n := range []int{0, MaxParticipants + 1} {
+		if _, err = participants(n); err == nil {
+			t.Fatalf("accepted %d participants", n)
+		}
+	}
+}
+
+func TestDealMaxParticipants(t *testing.T) {
+	if testing.Short() {
+		t.Skip("deals a share to every one of the largest group")
+	}
+	shares, _, err := Deal(1, MaxParticipants, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != MaxParticipants || shares[len(shares)-1].ID != MaxParticipants {
+		t.Fatalf("got %d shares", len(shares))
+	}
+}
+
+// roundTrip encodes and decodes a message as if it were sent over a network.
+func roundTrip[V codec.Binary](t *testing.T, v V, dec V) V {
+	b, err := v.MarshalBinary(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r B
+	if r, err = dec.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 0 {
+		t.Fatalf("%d bytes left over", len(r))
+	}
+	return dec
+}
+
+func TestDKG(t *testing.T) {
+	const threshold, n = 3, 5
+	for i := 0; i < 5; i++ {
+		dkgs := make([]*DKG, n)
+		var round1 []*Round1Package
+		for id := uint16(1); id <= n; id++ {
+			d, p, err := NewDKG(id, threshold, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dkgs[id-1] = d
+			round1 = append(round1, roundTrip(t, p, &Round1Package{}))
+		}
+		inbox := make(map[uint16][]*Round2Package)
+		for _, d := range dkgs {
+			out, err := d.Round2(round1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range out {
+				inbox[p.To] = append(inbox[p.To], roundTrip(t, p, &Round2Package{}))
+			}
+		}
+		shares := make([]*KeyShare, n)
+		for j, d := range dkgs {
+			k, err := d.Finish(inbox[d.ID])
+			if err != nil {
+				t.Fatal(err)
+			}
+			shares[j] = roundTrip(t, k, &KeyShare{})
+			if !Equals(shares[j].GroupKey, shares[0].GroupKey) {
+				t.Fatal("participants disagree on the group key")
+			}
+		}
+		pk := roundTrip(t, shares[0].PublicKeys, &PublicKeys{})
+		signEvent(t, pk, locals(shares, 1, 3, 5))
+		signEvent(t, pk, locals(shares, 2, 3, 4, 5))
+	}
+}
+
+func TestDKGBadShare(t *testing.T) {
+	d1, p1, _ := NewDKG(1, 2, 2)
+	d2, p2, _ := NewDKG(2, 2, 2)
+	if _, err := d1.Round2([]*Round1Package{p1, p2}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := d2.Round2([]*Round1Package{p1, p2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out[0].Share[31] ^= 1
+	if _, err = d1.Finish(out); err == nil {
+		t.Fatal("expected an error for a tampered share")
+	}
+	p2.ProofZ[31] ^= 1
+	d3, _, _ := NewDKG(1, 2, 2)
+	if _, err = d3.Round2([]*Round1Package{p2}); err == nil {
+		t.Fatal("expected an error for an invalid proof of knowledge")
+	}
+}
+
+func TestSigning(t *testing.T) {
+	shares, pk, err := Deal(2, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := make(B, 32)
+	n1, c1, _ := shares[0].Commit()
+	n2, c2, _ := shares[1].Commit()
+	p := roundTrip(t, &SigningPackage{Message: msg, Commitments: []*Commitment{c1, c2}},
+		&SigningPackage{})
+	s1, err := shares[0].Sign(n1, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = shares[0].Sign(n1, p); err == nil {
+		t.Fatal("expected an error reusing nonces")
+	}
+	var s2 *SignatureShare
+	if s2, err = shares[1].Sign(n2, p); err != nil {
+		t.Fatal(err)
+	}
+	s2 = roundTrip(t, s2, &SignatureShare{})
+	if err = pk.VerifyShare(p, s2); err != nil {
+		t.Fatal(err)
+	}
+	bad := &SignatureShare{ID: s2.ID, Z: append(B{}, s2.Z...)}
+	bad.Z[31] ^= 1
+	if _, err = pk.Aggregate(p, []*SignatureShare{s1, bad}); err == nil ||
+		!strings.Contains(err.Error(), "participant 2") {
+		t.Fatalf("expected an error naming participant 2, got %v", err)
+	}
+	if _, err = pk.Aggregate(p, []*SignatureShare{s1, s2}); err != nil {
+		t.Fatal(err)
+	}
+	// the package must have the signer's own commitment
+	n3, _, _ := shares[2].Commit()
+	if _, err = shares[2].Sign(n3, p); err == nil {
+		t.Fatal("expected an error signing a package without the commitment")
+	}
+}
@@ -0,0 +1,204 @@
+package frost
+
+import (
+	"sort"
+
+	. "nostr.mleku.dev"
+
+	"ec.mleku.dev/v2/secp256k1"
+	"nostr.mleku.dev/crypto/internal/schnorr"
+)
+
+// PublicKeys are the public keys of a group: the group key and the public key
+// of each participant's share, used to check signature shares.
+type PublicKeys struct {
+	// Threshold is the number of participants needed to sign.
+	Threshold uint16
+	// GroupKey is the 32 byte x-only group public key, the nostr pubkey of the
+	// group.
+	GroupKey B
+	// Shares are the 33 byte compressed public keys of the shares by
+	// participant identifier.
+	Shares map[uint16]B
+}
+
+// KeyShare is the secret share of one participant.
+type KeyShare struct {
+	ID     uint16
+	Secret secp256k1.ModNScalar
+	*PublicKeys
+}
+
+// newKeys makes the key shares and public keys of a group from the secret
+// shares and the commitment to the polynomial they are on. If the group key has
+// an odd Y coordinate every share is negated, which negates the group key, so
+// the shares sign for the x-only key.
+func newKeys(threshold uint16, secrets map[uint16]*secp256k1.ModNScalar,
+	commitment []secp256k1.JacobianPoint, ids []uint16) (pk *PublicKeys) {
+
+	odd := !schnorr.HasEvenY(&commitment[0])
+	pk = &PublicKeys{
+		Threshold: threshold,
+		GroupKey:  schnorr.XOnly(&commitment[0]),
+		Shares:    make(map[uint16]B, len(ids)),
+	}
+	for _, id := range ids {
+		p := evaluateCommitment(commitment, id)
+		if odd {
+			p = negate(&p)
+		}
+		pk.Shares[id] = schnorr.EncodePoint(nil, &p)
+	}
+	if odd {
+		for _, s := range secrets {
+			s.Negate()
+		}
+	}
+	return
+}
+
+// Deal splits secret into n shares with a threshold of t as a trusted dealer. A
+// random secret is generated if it is nil. The dealer knows the whole secret so
+// it must be discarded after the shares are given out, use the DKG if there is
+// no party that everyone trusts.
+func Deal(t, n uint16, secret B) (shares []*KeyShare, pk *PublicKeys, err E) {
+	var ids []uint16
+	if ids, err = participants(int(n)); err != nil {
+		return
+	}
+	if t < 1 || t > n {
+		err = Errorf.E("threshold must be from 1 to %d, got %d", n, t)
+		return
+	}
+	coeffs := make([]secp256k1.ModNScalar, t)
+	if secret == nil {
+		if coeffs[0], err = randomScalar(); err != nil {
+			return
+		}
+	} else {
+		if coeffs[0], err = schnorr.DecodeScalar(secret); err != nil {
+			return
+		}
+		if coeffs[0].IsZero() {
+			err = Errorf.E("secret can't be zero")
+			return
+		}
+	}
+	for i := 1; i < len(coeffs); i++ {
+		if coeffs[i], err = randomScalar(); err != nil {
+			return
+		}
+	}
+	commitment := make([]secp256k1.JacobianPoint, t)
+	for i := range coeffs {
+		commitment[i] = schnorr.BaseMul(&coeffs[i])
+	}
+	secrets := make(map[uint16]*secp256k1.ModNScalar, n)
+	for _, id := range ids {
+		s := evaluate(coeffs, id)
+		secrets[id] = &s
+	}
+	pk = newKeys(t, secrets, commitment, ids)
+	for _, id := range ids {
+		shares = append(shares, &KeyShare{ID: id, Secret: *secrets[id], PublicKeys: pk})
+	}
+	for i := range coeffs {
+		coeffs[i].Zero()
+	}
+	return
+}
+
+// Verify checks that the secret of the key share matches its public key.
+func (k *KeyShare) Verify() (err E) {
+	if err = validID(k.ID); err != nil {
+		return
+	}
+	p := schnorr.BaseMul(&k.Secret)
+	if !Equals(schnorr.EncodePoint(nil, &p), k.Shares[k.ID]) {
+		err = Errorf.E("secret share of participant %d does not match its public key",
+			k.ID)
+	}
+	return
+}
+
+// ids returns the participant identifiers in order.
+func (pk *PublicKeys) ids() (ids []uint16) {
+	for id := range pk.Shares {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return
+}
+
+// MarshalBinary appends the threshold, the group key and the count and shares
+// of the participants, in order.
+func (pk *PublicKeys) MarshalBinary(dst B) (b B, err E) {
+	if len(pk.GroupKey) != 32 {
+		err = Errorf.E("group key must be 32 bytes, got %d", len(pk.GroupKey))
+		return
+	}
+	b = appendUint16(dst, pk.Threshold)
+	b = append(b, pk.GroupKey...)
+	b = appendUint16(b, uint16(len(pk.Shares)))
+	for _, id := range pk.ids() {
+		b = appendUint16(b, id)
+		b = append(b, pk.Shares[id]...)
+	}
+	return
+}
+
+func (pk *PublicKeys) UnmarshalBinary(b B) (r B, err E) {
+	var n uint16
+	if pk.Threshold, r, err = readUint16(b); err != nil {
+		return
+	}
+	if pk.GroupKey, r, err = readBytes(r, 32); err != nil {
+		return
+	}
+	if n, r, err = readUint16(r); err != nil {
+		return
+	}
+	pk.Shares = make(map[uint16]B, n)
+	for i := uint16(0); i < n; i++ {
+		var id uint16
+		var share B
+		if id, r, err = readUint16(r); err != nil {
+			return
+		}
+		if share, r, err = readBytes(r, PointLen); err != nil {
+			return
+		}
+		if _, err = schnorr.DecodePoint(share); err != nil {
+			return
+		}
+		pk.Shares[id] = share
+	}
+	return
+}
+
+// MarshalBinary appends the identifier and secret of the share and then the
+// public keys of the group.
+func (k *KeyShare) MarshalBinary(dst B) (b B, err E) {
+	b = appendUint16(dst, k.ID)
+	b = schnorr.EncodeScalar(b, &k.Secret)
+	return k.PublicKeys.MarshalBinary(b)
+}
+
+func (k *KeyShare) UnmarshalBinary(b B) (r B, err E) {
+	var sec B
+	if k.ID, r, err = readUint16(b); err != nil {
+		return
+	}
+	if sec, r, err = readBytes(r, ScalarLen); err != nil {
+		return
+	}
+	if k.Secret, err = schnorr.DecodeScalar(sec); err != nil {
+		return
+	}
+	k.PublicKeys = &PublicKeys{}
+	if r, err = k.PublicKeys.UnmarshalBinary(r); err != nil {
+		return
+	}
+	err = k.Verify()
+	return
+}
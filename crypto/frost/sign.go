@@ -0,0 +1,333 @@
+package frost
+
+import (
+	. "nostr.mleku.dev"
+
+	"ec.mleku.dev/v2/secp256k1"
+	"nostr.mleku.dev/crypto/internal/schnorr"
+)
+
+// Nonces are the secret nonces of a participant for one signature. They must
+// never be used for more than one, Sign zeroes them.
+type Nonces struct {
+	hiding, binding secp256k1.ModNScalar
+	Commitment      *Commitment
+	used            bool
+}
+
+// Commitment is a participant's commitment to their nonces, sent to the
+// coordinator in the first round of signing.
+type Commitment struct {
+	ID uint16
+	// Hiding and Binding are the 33 byte compressed nonce commitments.
+	Hiding, Binding B
+}
+
+// SigningPackage is sent by the coordinator to each signer in the second round,
+// the message and the commitments of all the signers in order of identifier.
+type SigningPackage struct {
+	Message     B
+	Commitments []*Commitment
+}
+
+// SignatureShare is a participant's share of a signature, sent to the
+// coordinator at the end of the second round.
+type SignatureShare struct {
+	ID uint16
+	Z  B
+}
+
+// Commit makes the nonces for one signature and the commitment to send to the
+// coordinator.
+func (k *KeyShare) Commit() (n *Nonces, c *Commitment, err E) {
+	n = &Nonces{}
+	if n.hiding, err = nonce(&k.Secret); err != nil {
+		return
+	}
+	if n.binding, err = nonce(&k.Secret); err != nil {
+		return
+	}
+	h, b := schnorr.BaseMul(&n.hiding), schnorr.BaseMul(&n.binding)
+	c = &Commitment{ID: k.ID, Hiding: schnorr.EncodePoint(nil, &h),
+		Binding: schnorr.EncodePoint(nil, &b)}
+	n.Commitment = c
+	return
+}
+
+// session is what the signers and the coordinator derive from a SigningPackage.
+type session struct {
+	ids []uint16
+	// r is the group commitment, negated if needed to have an even Y.
+	r secp256k1.JacobianPoint
+	// negated is true if r was negated, and so the nonces must be.
+	negated bool
+	// commitments are the commitments of each signer with their binding
+	// factors applied, before any negation.
+	commitments map[uint16]secp256k1.JacobianPoint
+	rho         map[uint16]secp256k1.ModNScalar
+	c           secp256k1.ModNScalar
+}
+
+// session checks the package and derives the binding factors, the group
+// commitment and the challenge.
+func (p *SigningPackage) session(groupKey B) (s *session, err E) {
+	if len(p.Commitments) == 0 {
+		err = Errorf.E("no commitments")
+		return
+	}
+	s = &session{commitments: make(map[uint16]secp256k1.JacobianPoint),
+		rho: make(map[uint16]secp256k1.ModNScalar)}
+	var list B
+	hiding := make([]secp256k1.JacobianPoint, len(p.Commitments))
+	binding := make([]secp256k1.JacobianPoint, len(p.Commitments))
+	for i, c := range p.Commitments {
+		if err = validID(c.ID); err != nil {
+			return
+		}
+		if i > 0 && c.ID <= p.Commitments[i-1].ID {
+			err = Errorf.E("commitments must be in order of identifier without repeats")
+			return
+		}
+		if hiding[i], err = schnorr.DecodePoint(c.Hiding); err != nil {
+			return
+		}
+		if binding[i], err = schnorr.DecodePoint(c.Binding); err != nil {
+			return
+		}
+		s.ids = append(s.ids, c.ID)
+		list = append(list, encodeID(c.ID)...)
+		list = append(list, c.Hiding...)
+		list = append(list, c.Binding...)
+	}
+	msgHash := schnorr.TaggedHash(contextString+"msg", p.Message)
+	listHash := schnorr.TaggedHash(contextString+"com", list)
+	for i, id := range s.ids {
+		rho := hashToScalar("rho", groupKey, msgHash[:], listHash[:], encodeID(id))
+		s.rho[id] = rho
+		e := schnorr.Mul(&rho, &binding[i])
+		c := schnorr.Add(&hiding[i], &e)
+		s.commitments[id] = c
+		s.r = schnorr.Add(&s.r, &c)
+	}
+	if schnorr.IsInfinity(&s.r) {
+		err = Errorf.E("group commitment is the identity")
+		return
+	}
+	if !schnorr.HasEvenY(&s.r) {
+		s.r, s.negated = negate(&s.r), true
+	}
+	s.c = challenge(&s.r, groupKey, p.Message)
+	return
+}
+
+// Sign makes the participant's signature share of the package with the nonces
+// from Commit, whose commitment must be in the package.
+func (k *KeyShare) Sign(n *Nonces, p *SigningPackage) (share *SignatureShare, err E) {
+	if n.used {
+		err = Errorf.E("nonces have already been used")
+		return
+	}
+	var own *Commitment
+	for _, c := range p.Commitments {
+		if c.ID == k.ID {
+			own = c
+		}
+	}
+	if own == nil || !Equals(own.Hiding, n.Commitment.Hiding) ||
+		!Equals(own.Binding, n.Commitment.Binding) {
+		err = Errorf.E("the package does not have the commitment of participant %d",
+			k.ID)
+		return
+	}
+	if len(p.Commitments) < int(k.Threshold) {
+		err = Errorf.E("need %d signers, the package has %d", k.Threshold,
+			len(p.Commitments))
+		return
+	}
+	var s *session
+	if s, err = p.session(k.GroupKey); err != nil {
+		return
+	}
+	var l secp256k1.ModNScalar
+	if l, err = lagrange(k.ID, s.ids); err != nil {
+		return
+	}
+	// z = d + e*rho, negated with R, + lambda*s*c
+	rho := s.rho[k.ID]
+	var z, t secp256k1.ModNScalar
+	z.Mul2(&n.binding, &rho).Add(&n.hiding)
+	if s.negated {
+		z.Negate()
+	}
+	t.Mul2(&l, &k.Secret).Mul(&s.c)
+	z.Add(&t)
+	n.hiding.Zero()
+	n.binding.Zero()
+	n.used = true
+	share = &SignatureShare{ID: k.ID, Z: schnorr.EncodeScalar(nil, &z)}
+	return
+}
+
+func (pk *PublicKeys) verifyShare(s *session, share *SignatureShare) (err E) {
+	c, ok := s.commitments[share.ID]
+	if !ok {
+		err = Errorf.E("participant %d is not one of the signers", share.ID)
+		return
+	}
+	var y secp256k1.JacobianPoint
+	if y, err = schnorr.DecodePoint(pk.Shares[share.ID]); err != nil {
+		err = Errorf.E("no public key for participant %d", share.ID)
+		return
+	}
+	var z, l secp256k1.ModNScalar
+	if z, err = schnorr.DecodeScalar(share.Z); err != nil {
+		return
+	}
+	if l, err = lagrange(share.ID, s.ids); err != nil {
+		return
+	}
+	// z*G must be the commitment, negated with R, + c*lambda*Y
+	if s.negated {
+		c = negate(&c)
+	}
+	l.Mul(&s.c)
+	zg, ly := schnorr.BaseMul(&z), schnorr.Mul(&l, &y)
+	expected := schnorr.Add(&c, &ly)
+	if schnorr.IsInfinity(&zg) || schnorr.IsInfinity(&expected) ||
+		!Equals(schnorr.EncodePoint(nil, &zg), schnorr.EncodePoint(nil, &expected)) {
+		err = Errorf.E("invalid signature share from participant %d", share.ID)
+	}
+	return
+}
+
+// VerifyShare checks a signature share against the package and the public key
+// of the participant's share.
+func (pk *PublicKeys) VerifyShare(p *SigningPackage, share *SignatureShare) (err E) {
+	var s *session
+	if s, err = p.session(pk.GroupKey); err != nil {
+		return
+	}
+	return pk.verifyShare(s, share)
+}
+
+// Aggregate checks the signature shares of every signer in the package and
+// combines them into a BIP-340 signature of the message by the group key. The
+// error names the participant if a share is invalid.
+func (pk *PublicKeys) Aggregate(p *SigningPackage, shares []*SignatureShare) (sig B,
+	err E) {
+
+	if len(p.Commitments) < int(pk.Threshold) {
+		err = Errorf.E("need %d signers, the package has %d", pk.Threshold,
+			len(p.Commitments))
+		return
+	}
+	var s *session
+	if s, err = p.session(pk.GroupKey); err != nil {
+		return
+	}
+	if len(shares) != len(s.ids) {
+		err = Errorf.E("have %d signature shares for %d signers", len(shares),
+			len(s.ids))
+		return
+	}
+	seen := make(map[uint16]bool, len(shares))
+	var z secp256k1.ModNScalar
+	for _, share := range shares {
+		if seen[share.ID] {
+			err = Errorf.E("more than one share from participant %d", share.ID)
+			return
+		}
+		seen[share.ID] = true
+		if err = pk.verifyShare(s, share); err != nil {
+			return
+		}
+		zi, _ := schnorr.DecodeScalar(share.Z)
+		z.Add(&zi)
+	}
+	sig = schnorr.EncodeScalar(schnorr.XOnly(&s.r), &z)
+	if err = schnorr.Verify(sig, pk.GroupKey, p.Message); err != nil {
+		err = Errorf.E("aggregated signature does not verify: %v", err)
+	}
+	return
+}
+
+// MarshalBinary appends the identifier and the hiding and binding commitments.
+func (c *Commitment) MarshalBinary(dst B) (b B, err E) {
+	if len(c.Hiding) != PointLen || len(c.Binding) != PointLen {
+		err = Errorf.E("commitments must be %d bytes", PointLen)
+		return
+	}
+	b = appendUint16(dst, c.ID)
+	b = append(b, c.Hiding...)
+	b = append(b, c.Binding...)
+	return
+}
+
+func (c *Commitment) UnmarshalBinary(b B) (r B, err E) {
+	if c.ID, r, err = readUint16(b); err != nil {
+		return
+	}
+	if c.Hiding, r, err = readBytes(r, PointLen); err != nil {
+		return
+	}
+	c.Binding, r, err = readBytes(r, PointLen)
+	return
+}
+
+// MarshalBinary appends the length and content of the message and then the
+// count and the commitments.
+func (p *SigningPackage) MarshalBinary(dst B) (b B, err E) {
+	if len(p.Message) > 0xffff || len(p.Commitments) > 0xffff {
+		err = Errorf.E("signing package is too large")
+		return
+	}
+	b = appendUint16(dst, uint16(len(p.Message)))
+	b = append(b, p.Message...)
+	b = appendUint16(b, uint16(len(p.Commitments)))
+	for _, c := range p.Commitments {
+		if b, err = c.MarshalBinary(b); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (p *SigningPackage) UnmarshalBinary(b B) (r B, err E) {
+	var n uint16
+	if n, r, err = readUint16(b); err != nil {
+		return
+	}
+	if p.Message, r, err = readBytes(r, int(n)); err != nil {
+		return
+	}
+	if n, r, err = readUint16(r); err != nil {
+		return
+	}
+	p.Commitments = make([]*Commitment, n)
+	for i := range p.Commitments {
+		p.Commitments[i] = &Commitment{}
+		if r, err = p.Commitments[i].UnmarshalBinary(r); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MarshalBinary appends the identifier and the share.
+func (s *SignatureShare) MarshalBinary(dst B) (b B, err E) {
+	if len(s.Z) != ScalarLen {
+		err = Errorf.E("signature share must be %d bytes, got %d", ScalarLen, len(s.Z))
+		return
+	}
+	b = appendUint16(dst, s.ID)
+	b = append(b, s.Z...)
+	return
+}
+
+func (s *SignatureShare) UnmarshalBinary(b B) (r B, err E) {
+	if s.ID, r, err = readUint16(b); err != nil {
+		return
+	}
+	s.Z, r, err = readBytes(r, ScalarLen)
+	return
+}
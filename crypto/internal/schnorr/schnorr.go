@@ -0,0 +1,128 @@
+// Package schnorr has the BIP-340 hashing, scalar and point helpers shared by
+// the threshold and aggregate signature schemes in crypto/frost and
+// crypto/musig2.
+package schnorr
+
+import (
+	. "nostr.mleku.dev"
+
+	"ec.mleku.dev/v2/schnorr"
+	"ec.mleku.dev/v2/secp256k1"
+	"github.com/minio/sha256-simd"
+)
+
+const (
+	// ScalarLen is the length of an encoded scalar.
+	ScalarLen = 32
+	// PointLen is the length of an encoded compressed point.
+	PointLen = secp256k1.PubKeyBytesLenCompressed
+)
+
+// TaggedHash is the BIP-340 tagged hash of the concatenated data.
+func TaggedHash(tag S, data ...B) (h [32]byte) {
+	t := sha256.Sum256(B(tag))
+	s := sha256.New()
+	s.Write(t[:])
+	s.Write(t[:])
+	for _, d := range data {
+		s.Write(d)
+	}
+	copy(h[:], s.Sum(nil))
+	return
+}
+
+// EncodeScalar appends the 32 byte big endian encoding of k to dst.
+func EncodeScalar(dst B, k *secp256k1.ModNScalar) B {
+	b := k.Bytes()
+	return append(dst, b[:]...)
+}
+
+// DecodeScalar decodes a 32 byte scalar, which must be less than the group
+// order.
+func DecodeScalar(b B) (k secp256k1.ModNScalar, err E) {
+	if len(b) != ScalarLen {
+		err = Errorf.E("scalar must be %d bytes, got %d", ScalarLen, len(b))
+		return
+	}
+	if k.SetByteSlice(b) {
+		err = Errorf.E("scalar %0x is not less than the group order", b)
+	}
+	return
+}
+
+// EncodePoint appends the compressed encoding of p to dst, p must not be the
+// point at infinity.
+func EncodePoint(dst B, p *secp256k1.JacobianPoint) B {
+	a := *p
+	a.ToAffine()
+	return append(dst, secp256k1.NewPublicKey(&a.X, &a.Y).SerializeCompressed()...)
+}
+
+// DecodePoint decodes a compressed point.
+func DecodePoint(b B) (p secp256k1.JacobianPoint, err E) {
+	if len(b) != PointLen {
+		err = Errorf.E("point must be %d bytes, got %d", PointLen, len(b))
+		return
+	}
+	var pk *secp256k1.PublicKey
+	if pk, err = secp256k1.ParsePubKey(b); err != nil {
+		err = Errorf.E("invalid point %0x: %v", b, err)
+		return
+	}
+	pk.AsJacobian(&p)
+	return
+}
+
+// XOnly is the 32 byte X coordinate of p.
+func XOnly(p *secp256k1.JacobianPoint) B {
+	a := *p
+	a.ToAffine()
+	return a.X.Bytes()[:]
+}
+
+// HasEvenY reports whether p has an even Y coordinate, p must not be the point
+// at infinity.
+func HasEvenY(p *secp256k1.JacobianPoint) bool {
+	a := *p
+	a.ToAffine()
+	return !a.Y.IsOdd()
+}
+
+// IsInfinity reports whether p is the point at infinity.
+func IsInfinity(p *secp256k1.JacobianPoint) bool {
+	return (p.X.IsZero() && p.Y.IsZero()) || p.Z.IsZero()
+}
+
+// BaseMul is k times the generator.
+func BaseMul(k *secp256k1.ModNScalar) (p secp256k1.JacobianPoint) {
+	secp256k1.ScalarBaseMultNonConst(k, &p)
+	return
+}
+
+// Mul is k times p.
+func Mul(k *secp256k1.ModNScalar, p *secp256k1.JacobianPoint) (r secp256k1.JacobianPoint) {
+	secp256k1.ScalarMultNonConst(k, p, &r)
+	return
+}
+
+// Add is a plus b.
+func Add(a, b *secp256k1.JacobianPoint) (r secp256k1.JacobianPoint) {
+	secp256k1.AddNonConst(a, b, &r)
+	return
+}
+
+// Verify checks a BIP-340 signature of msg by the x-only key pub.
+func Verify(sig, pub, msg B) (err E) {
+	var s *schnorr.Signature
+	if s, err = schnorr.ParseSignature(sig); err != nil {
+		return
+	}
+	var key *secp256k1.PublicKey
+	if key, err = schnorr.ParsePubKey(pub); err != nil {
+		return
+	}
+	if !s.Verify(msg, key) {
+		err = Errorf.E("signature does not verify")
+	}
+	return
+}
@@ -0,0 +1,201 @@
+// Package mnemonic implements NIP-06 keys: BIP-39 seed phrases with the English
+// wordlist and BIP-32 derivation of the nostr secret key along the path
+// m/44'/1237'/<account>'/0/0.
+package mnemonic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	_ "embed"
+	"strings"
+
+	. "nostr.mleku.dev"
+
+	"ec.mleku.dev/v2/secp256k1"
+	"github.com/minio/sha256-simd"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+	"nostr.mleku.dev/crypto/p256k"
+)
+
+//go:embed english.txt
+var english S
+
+// Words is the BIP-39 English wordlist.
+var Words = strings.Fields(english)
+
+var wordIndex = func() (m map[S]int) {
+	m = make(map[S]int, len(Words))
+	for i, w := range Words {
+		m[w] = i
+	}
+	return
+}()
+
+const (
+	// Hardened is added to a path index to make it a hardened derivation.
+	Hardened uint32 = 0x80000000
+	// CoinType is the SLIP-44 coin type registered for nostr.
+	CoinType uint32 = 1237
+)
+
+// Path returns the NIP-06 derivation path of the key of an account.
+func Path(account uint32) []uint32 {
+	return []uint32{44 + Hardened, CoinType + Hardened, account + Hardened, 0, 0}
+}
+
+// Generate creates a new mnemonic from bits of system entropy, which must be a
+// multiple of 32 between 128 and 256. 128 bits gives 12 words and 256 gives 24.
+func Generate(bits int) (words S, err E) {
+	if bits%32 != 0 || bits < 128 || bits > 256 {
+		err = Errorf.E("entropy must be a multiple of 32 from 128 to 256 bits, got %d",
+			bits)
+		return
+	}
+	entropy := make(B, bits/8)
+	if _, err = rand.Read(entropy); Chk.E(err) {
+		return
+	}
+	return FromEntropy(entropy)
+}
+
+// FromEntropy encodes entropy as a mnemonic.
+func FromEntropy(entropy B) (words S, err E) {
+	n := len(entropy) * 8
+	if n%32 != 0 || n < 128 || n > 256 {
+		err = Errorf.E("entropy must be a multiple of 32 from 128 to 256 bits, got %d",
+			n)
+		return
+	}
+	// the checksum is the first n/32 bits of the hash, appended to the entropy,
+	// and every 11 bits of the result is a word.
+	h := sha256.Sum256(entropy)
+	data := append(append(B{}, entropy...), h[0])
+	w := make([]S, (n+n/32)/11)
+	for i := range w {
+		var idx int
+		for j := 0; j < 11; j++ {
+			bit := i*11 + j
+			idx = idx<<1 | int(data[bit/8]>>(7-bit%8)&1)
+		}
+		w[i] = Words[idx]
+	}
+	return strings.Join(w, " "), nil
+}
+
+// Entropy decodes a mnemonic back to its entropy, returning an error if a word is
+// not in the wordlist, the number of words is wrong or the checksum does not
+// match.
+func Entropy(words S) (entropy B, err E) {
+	w := strings.Fields(norm.NFKD.String(words))
+	if len(w)%3 != 0 || len(w) < 12 || len(w) > 24 {
+		err = Errorf.E("mnemonic must have 12, 15, 18, 21 or 24 words, got %d",
+			len(w))
+		return
+	}
+	data := make(B, (len(w)*11+7)/8)
+	for i, word := range w {
+		idx, ok := wordIndex[word]
+		if !ok {
+			err = Errorf.E("word %d '%s' is not in the wordlist", i+1, word)
+			return
+		}
+		for j := 0; j < 11; j++ {
+			if idx>>(10-j)&1 == 1 {
+				bit := i*11 + j
+				data[bit/8] |= 1 << (7 - bit%8)
+			}
+		}
+	}
+	cs := len(w) * 11 / 33
+	entropy = data[:cs*4]
+	h := sha256.Sum256(entropy)
+	if data[cs*4]>>(8-cs) != h[0]>>(8-cs) {
+		err = Errorf.E("invalid mnemonic checksum")
+		entropy = nil
+		return
+	}
+	return
+}
+
+// Validate checks that a mnemonic has valid words and checksum.
+func Validate(words S) (err E) {
+	_, err = Entropy(words)
+	return
+}
+
+// Seed derives the 64 byte BIP-39 seed from a mnemonic and an optional
+// passphrase. It does not check the mnemonic, use Validate for that.
+func Seed(words, passphrase S) B {
+	w := strings.Join(strings.Fields(norm.NFKD.String(words)), " ")
+	return pbkdf2.Key(B(w), B("mnemonic"+norm.NFKD.String(passphrase)), 2048, 64,
+		sha512.New)
+}
+
+// Derive derives the BIP-32 secret key at path from a seed. Indexes at or above
+// Hardened are hardened derivations.
+func Derive(seed B, path []uint32) (sec B, err E) {
+	mac := hmac.New(sha512.New, B("Bitcoin seed"))
+	mac.Write(seed)
+	I := mac.Sum(nil)
+	var k secp256k1.ModNScalar
+	if overflow := k.SetByteSlice(I[:32]); overflow || k.IsZero() {
+		err = Errorf.E("invalid master key, use another seed")
+		return
+	}
+	chain := I[32:]
+	for _, index := range path {
+		kb := k.Bytes()
+		data := make(B, 0, 37)
+		if index >= Hardened {
+			data = append(append(data, 0), kb[:]...)
+		} else {
+			data = append(data,
+				secp256k1.SecKeyFromBytes(kb[:]).PubKey().SerializeCompressed()...)
+		}
+		data = append(data, byte(index>>24), byte(index>>16), byte(index>>8),
+			byte(index))
+		mac = hmac.New(sha512.New, chain)
+		mac.Write(data)
+		I = mac.Sum(nil)
+		var t secp256k1.ModNScalar
+		if overflow := t.SetByteSlice(I[:32]); overflow {
+			err = Errorf.E("invalid child key at index %d", index)
+			return
+		}
+		if k.Add(&t); k.IsZero() {
+			err = Errorf.E("invalid child key at index %d", index)
+			return
+		}
+		chain = I[32:]
+	}
+	kb := k.Bytes()
+	sec = kb[:]
+	return
+}
+
+// SecretKey validates a mnemonic and derives the nostr secret key of an account
+// from it, ready for crypto.Signer.InitSec.
+func SecretKey(words, passphrase S, account uint32) (sec B, err E) {
+	if err = Validate(words); err != nil {
+		return
+	}
+	return Derive(Seed(words, passphrase), Path(account))
+}
+
+// SignerFromMnemonic initializes a signer with the key of an account derived
+// from a mnemonic.
+func SignerFromMnemonic(words, passphrase S, account uint32) (signer *p256k.Signer,
+	err E) {
+
+	var sec B
+	if sec, err = SecretKey(words, passphrase, account); err != nil {
+		return
+	}
+	signer = &p256k.Signer{}
+	if err = signer.InitSec(sec); Chk.E(err) {
+		return
+	}
+	return
+}
@@ -0,0 +1,101 @@
+package mnemonic
+
+import (
+	"strings"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"util.mleku.dev/hex"
+)
+
+func TestNIP06Vectors(t *testing.T) {
+	for _, v := range []struct{ words, sec, pub S }{
+		{
+			"leader monkey parrot ring guide accident before fence cannon height naive bean",
+			"7f7ff03d123792d6ac594bfa67bf6d0c0ab55b6b1fdb6249303fe861f1ccba9a",
+			"17162c921dc4d2518f9a101db33695df1afb56ab82f5ff3e5da6eec3ca5cd917",
+		},
+		{
+			"what bleak badge arrange retreat wolf trade produce cricket blur garlic valid proud rude strong choose busy staff weather area salt hollow arm fade",
+			"c15d739894c81a2fcfd3a2df85a0d2c0dbc47a280d092799f144d73d7ae78add",
+			"d41b22899549e1f3d335a31002cfd382174006e166d3e658e3a5eecdb6463573",
+		},
+	} {
+		sec, err := SecretKey(v.words, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.Enc(sec) != v.sec {
+			t.Fatalf("got secret key %s expected %s", hex.Enc(sec), v.sec)
+		}
+		signer, err := SignerFromMnemonic(v.words, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.Enc(signer.Pub()) != v.pub {
+			t.Fatalf("got public key %s expected %s", hex.Enc(signer.Pub()), v.pub)
+		}
+	}
+}
+
+func TestBIP39Vector(t *testing.T) {
+	entropy := make(B, 16)
+	words, err := FromEntropy(entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Repeat("abandon ", 11) + "about"
+	if words != expected {
+		t.Fatalf("got %s expected %s", words, expected)
+	}
+	seed := Seed(words, "TREZOR")
+	if hex.Enc(seed) != "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e5349553"+
+		"1f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04" {
+		t.Fatalf("wrong seed %s", hex.Enc(seed))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		words, err := Generate(bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(strings.Fields(words)); n != bits/32*3 {
+			t.Fatalf("got %d words for %d bits", n, bits)
+		}
+		var entropy B
+		if entropy, err = Entropy(words); err != nil {
+			t.Fatal(err)
+		}
+		var again S
+		if again, err = FromEntropy(entropy); err != nil {
+			t.Fatal(err)
+		}
+		if again != words {
+			t.Fatalf("got %s expected %s", again, words)
+		}
+	}
+	if _, err := Generate(100); err == nil {
+		t.Fatal("expected an error for 100 bits")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, words := range []S{
+		// wrong checksum
+		strings.Repeat("abandon ", 12),
+		// not a word
+		strings.Repeat("abandon ", 11) + "nostr",
+		// wrong length
+		strings.Repeat("abandon ", 10) + "about",
+	} {
+		if err := Validate(words); err == nil {
+			t.Fatalf("expected '%s' to be invalid", words)
+		}
+	}
+	if err := Validate(strings.Repeat("abandon ", 11) + "about"); err != nil {
+		t.Fatal(err)
+	}
+}
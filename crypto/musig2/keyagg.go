@@ -0,0 +1,168 @@
+// Package musig2 implements BIP-327 MuSig2 n-of-n aggregate signatures, where a
+// group of signers make a single x-only key and sign with it together in two
+// rounds. The signatures are ordinary BIP-340 signatures of the aggregate key,
+// which verify like those of any other nostr key.
+//
+// Public keys here are the 33 byte compressed keys of BIP-327, as given by
+// crypto.Signer.ECPub, while the aggregate key used as a nostr pubkey is the 32
+// byte x-only key from KeyAgg.PubKey.
+package musig2
+
+import (
+	"bytes"
+	"sort"
+
+	. "nostr.mleku.dev"
+
+	"ec.mleku.dev/v2/secp256k1"
+	"nostr.mleku.dev/crypto/internal/schnorr"
+)
+
+const (
+	// PubKeyLen is the length of a compressed public key.
+	PubKeyLen = secp256k1.PubKeyBytesLenCompressed
+	// PubNonceLen is the length of a public nonce and of an aggregate nonce.
+	PubNonceLen = 2 * PubKeyLen
+	// PartialSigLen is the length of a partial signature.
+	PartialSigLen = 32
+)
+
+func hashToScalar(tag S, data ...B) (k secp256k1.ModNScalar) {
+	h := schnorr.TaggedHash(tag, data...)
+	k.SetByteSlice(h[:])
+	return
+}
+
+// decodePointExt is schnorr.DecodePoint that decodes 33 zero bytes as the point at
+// infinity.
+func decodePointExt(b B) (p secp256k1.JacobianPoint, err E) {
+	if Equals(b, make(B, PubKeyLen)) {
+		return
+	}
+	return schnorr.DecodePoint(b)
+}
+
+// encodePointExt is schnorr.EncodePoint that encodes the point at infinity as 33 zero
+// bytes.
+func encodePointExt(dst B, p *secp256k1.JacobianPoint) B {
+	if schnorr.IsInfinity(p) {
+		return append(dst, make(B, PubKeyLen)...)
+	}
+	return schnorr.EncodePoint(dst, p)
+}
+
+// parity is 1 if p has an even Y coordinate and -1 if it is odd.
+func parity(p *secp256k1.JacobianPoint) (g secp256k1.ModNScalar) {
+	g.SetInt(1)
+	if !schnorr.HasEvenY(p) {
+		g.Negate()
+	}
+	return
+}
+
+// SortKeys returns the public keys sorted in lexicographic order, which makes
+// the aggregate key independent of the order of the signers.
+func SortKeys(pubkeys []B) (sorted []B) {
+	sorted = append(sorted, pubkeys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return
+}
+
+// KeyAgg is the aggregate of a list of public keys and any tweaks applied to it.
+type KeyAgg struct {
+	pubkeys []B
+	// second is the first key that is not the same as the first, whose
+	// coefficient is 1.
+	second B
+	// list is the hash of all the keys.
+	list [32]byte
+	q    secp256k1.JacobianPoint
+	gacc secp256k1.ModNScalar
+	tacc secp256k1.ModNScalar
+}
+
+// AggregateKeys aggregates the public keys in the order given, use SortKeys first
+// if the signers don't agree on an order.
+func AggregateKeys(pubkeys []B) (k *KeyAgg, err E) {
+	if len(pubkeys) == 0 {
+		err = Errorf.E("no public keys to aggregate")
+		return
+	}
+	k = &KeyAgg{pubkeys: pubkeys, second: make(B, PubKeyLen)}
+	for _, pk := range pubkeys[1:] {
+		if !Equals(pk, pubkeys[0]) {
+			k.second = pk
+			break
+		}
+	}
+	k.list = schnorr.TaggedHash("KeyAgg list", pubkeys...)
+	for _, pk := range pubkeys {
+		var p secp256k1.JacobianPoint
+		if p, err = schnorr.DecodePoint(pk); err != nil {
+			return
+		}
+		a := k.coefficient(pk)
+		ap := schnorr.Mul(&a, &p)
+		k.q = schnorr.Add(&k.q, &ap)
+	}
+	if schnorr.IsInfinity(&k.q) {
+		err = Errorf.E("aggregate key is the point at infinity")
+		return
+	}
+	k.gacc.SetInt(1)
+	return
+}
+
+// coefficient is the key aggregation coefficient of a public key.
+func (k *KeyAgg) coefficient(pk B) (a secp256k1.ModNScalar) {
+	if Equals(pk, k.second) {
+		a.SetInt(1)
+		return
+	}
+	return hashToScalar("KeyAgg coefficient", k.list[:], pk)
+}
+
+func (k *KeyAgg) has(pk B) bool {
+	for _, p := range k.pubkeys {
+		if Equals(p, pk) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tweak adds tweak times the generator to the aggregate key. An x-only tweak is
+// applied to the x-only key, as a BIP-341 taproot tweak is, and a plain tweak to
+// the key with its Y coordinate as it is.
+func (k *KeyAgg) Tweak(tweak B, isXOnly bool) (err E) {
+	var t secp256k1.ModNScalar
+	if t, err = schnorr.DecodeScalar(tweak); err != nil {
+		return
+	}
+	var g secp256k1.ModNScalar
+	g.SetInt(1)
+	if isXOnly {
+		g = parity(&k.q)
+	}
+	gq, tg := schnorr.Mul(&g, &k.q), schnorr.BaseMul(&t)
+	q := schnorr.Add(&gq, &tg)
+	if schnorr.IsInfinity(&q) {
+		err = Errorf.E("tweaked key is the point at infinity")
+		return
+	}
+	k.q = q
+	k.gacc.Mul(&g)
+	k.tacc.Mul(&g).Add(&t)
+	return
+}
+
+// PubKey returns the 32 byte x-only aggregate key, the nostr pubkey of the group.
+func (k *KeyAgg) PubKey() B { return schnorr.XOnly(&k.q) }
+
+// PlainPubKey returns the 33 byte compressed aggregate key.
+func (k *KeyAgg) PlainPubKey() B { return schnorr.EncodePoint(nil, &k.q) }
+
+// PubKeys returns the public keys that were aggregated.
+func (k *KeyAgg) PubKeys() []B { return k.pubkeys }
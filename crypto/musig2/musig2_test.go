@@ -0,0 +1,206 @@
+package musig2
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto/internal/schnorr"
+	"nostr.mleku.dev/crypto/p256k"
+	"nostr.mleku.dev/crypto/p256k/btcec"
+	"util.mleku.dev/hex"
+)
+
+func dec(t *testing.T, s S) B {
+	b, err := hex.Dec(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestKeyAggVectors checks the key aggregation test vectors of BIP-327.
+func TestKeyAggVectors(t *testing.T) {
+	pubkeys := []B{
+		dec(t, "02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"),
+		dec(t, "03dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659"),
+		dec(t, "023590a94e768f8e1815c2f24b4d80a8e3149316c3518ce7b7ad338368d038ca66"),
+	}
+	for _, v := range []struct {
+		indices  []int
+		expected S
+	}{
+		{[]int{0, 1, 2}, "90539eede565f5d054f32cc0c220126889ed1e5d193baf15aef344fe59d4610c"},
+		{[]int{2, 1, 0}, "6204de8b083426dc6eaf9502d27024d53fc826bf7d2012148a0575435df54b2b"},
+		{[]int{0, 0, 0}, "b436e3bad62b8cd409969a224731c193d051162d8c5ae8b109306127da3aa935"},
+		{[]int{0, 0, 1, 1}, "69bc22bfa5d106306e48a20679de1d7389386124d07571d0d872686028c26a3e"},
+	} {
+		var keys []B
+		for _, i := range v.indices {
+			keys = append(keys, pubkeys[i])
+		}
+		k, err := AggregateKeys(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.Enc(k.PubKey()) != v.expected {
+			t.Fatalf("got %0x expected %s", k.PubKey(), v.expected)
+		}
+	}
+}
+
+type signer struct {
+	sec, pub B
+	nonce    *SecretNonce
+	pubNonce B
+}
+
+func newSigners(t *testing.T, n int) (signers []*signer, pubkeys []B) {
+	for i := 0; i < n; i++ {
+		s := &p256k.Signer{}
+		if err := s.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, &signer{sec: s.Sec(), pub: s.ECPub()})
+		pubkeys = append(pubkeys, s.ECPub())
+	}
+	return
+}
+
+// sign runs both rounds for msg and returns the aggregate signature.
+func sign(t *testing.T, signers []*signer, keys *KeyAgg, msg B) (sig B) {
+	var pubNonces []B
+	var err E
+	for _, s := range signers {
+		if s.nonce, s.pubNonce, err = GenerateNonce(s.sec, s.pub, keys.PubKey(), msg,
+			nil); err != nil {
+			t.Fatal(err)
+		}
+		pubNonces = append(pubNonces, s.pubNonce)
+	}
+	var aggNonce B
+	if aggNonce, err = AggregateNonces(pubNonces); err != nil {
+		t.Fatal(err)
+	}
+	var psigs []B
+	for _, s := range signers {
+		// each signer makes their own session from the shared values.
+		var session *Session
+		if session, err = NewSession(keys, aggNonce, msg); err != nil {
+			t.Fatal(err)
+		}
+		var psig B
+		if psig, err = session.Sign(s.nonce, s.sec); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = session.Sign(s.nonce, s.sec); err == nil {
+			t.Fatal("expected an error reusing a nonce")
+		}
+		psigs = append(psigs, psig)
+	}
+	session, err := NewSession(keys, aggNonce, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range signers {
+		if err = session.VerifyPartial(psigs[i], s.pubNonce, s.pub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bad := append(B{}, psigs[0]...)
+	bad[31] ^= 1
+	if err = session.VerifyPartial(bad, signers[0].pubNonce, signers[0].pub); err == nil {
+		t.Fatal("expected an error for a tampered partial signature")
+	}
+	if sig, err = session.Aggregate(psigs); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestSignEvent(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		signers, pubkeys := newSigners(t, 3)
+		keys, err := AggregateKeys(SortKeys(pubkeys))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev := &event.T{CreatedAt: timestamp.Now(), Kind: kind.TextNote,
+			Tags: tags.New(), Content: B("jointly signed")}
+		ev.Sig = sign(t, signers, keys, EventMessage(ev, keys))
+		var valid bool
+		if valid, err = ev.Verify(); err != nil || !valid {
+			t.Fatalf("event does not verify: %v", err)
+		}
+		// the pure Go verifier must accept it too, whichever the build uses.
+		v := &btcec.Signer{}
+		if err = v.InitPub(keys.PubKey()); err != nil {
+			t.Fatal(err)
+		}
+		if valid, err = v.Verify(ev.ID, ev.Sig); err != nil || !valid {
+			t.Fatalf("btcec does not verify the signature: %v", err)
+		}
+	}
+}
+
+func TestTweak(t *testing.T) {
+	signers, pubkeys := newSigners(t, 2)
+	for i := 0; i < 10; i++ {
+		keys, err := AggregateKeys(pubkeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweak := schnorr.TaggedHash("test", B{byte(i)})
+		if err = keys.Tweak(tweak[:], i%2 == 0); err != nil {
+			t.Fatal(err)
+		}
+		if err = keys.Tweak(tweak[:], i%3 == 0); err != nil {
+			t.Fatal(err)
+		}
+		msg := schnorr.TaggedHash("message", B{byte(i)})
+		sig := sign(t, signers, keys, msg[:])
+		v := &p256k.Signer{}
+		if err = v.InitPub(keys.PubKey()); err != nil {
+			t.Fatal(err)
+		}
+		var valid bool
+		if valid, err = v.Verify(msg[:], sig); err != nil || !valid {
+			t.Fatalf("tweaked signature does not verify: %v", err)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	signers, pubkeys := newSigners(t, 2)
+	keys, err := AggregateKeys(pubkeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := make(B, 32)
+	sn, pn, _ := GenerateNonce(nil, signers[0].pub, nil, nil, nil)
+	_, pn2, _ := GenerateNonce(nil, signers[1].pub, nil, nil, nil)
+	aggNonce, err := AggregateNonces([]B{pn, pn2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := NewSession(keys, aggNonce, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the nonce is for the first signer
+	if _, err = session.Sign(sn, signers[1].sec); err == nil {
+		t.Fatal("expected an error signing with another signer's nonce")
+	}
+	others, _ := newSigners(t, 1)
+	sn, _, _ = GenerateNonce(nil, others[0].pub, nil, nil, nil)
+	if _, err = session.Sign(sn, others[0].sec); err == nil {
+		t.Fatal("expected an error signing with a key that is not aggregated")
+	}
+	if _, err = AggregateKeys(nil); err == nil {
+		t.Fatal("expected an error aggregating no keys")
+	}
+}
@@ -0,0 +1,275 @@
+package musig2
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+
+	. "nostr.mleku.dev"
+
+	"ec.mleku.dev/v2/secp256k1"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/crypto/internal/schnorr"
+)
+
+// SecretNonce is the secret half of a signer's nonce. It must only ever be used
+// for one signature, Session.Sign zeroes it.
+type SecretNonce struct {
+	k1, k2 secp256k1.ModNScalar
+	// pub is the public key of the signer the nonce was made for.
+	pub  B
+	used bool
+}
+
+// GenerateNonce makes a nonce for the signer with the compressed public key pub.
+// The secret key, the aggregate x-only key, the message and extra can all be nil,
+// but giving them makes the nonce safe even if the random source is weak.
+func GenerateNonce(sec, pub, aggPub, msg, extra B) (sn *SecretNonce, pubNonce B,
+	err E) {
+
+	if len(pub) != PubKeyLen {
+		err = Errorf.E("public key must be %d bytes, got %d", PubKeyLen, len(pub))
+		return
+	}
+	r := make(B, 32)
+	if _, err = rand.Read(r); Chk.E(err) {
+		return
+	}
+	if sec != nil {
+		if len(sec) != 32 {
+			err = Errorf.E("secret key must be 32 bytes, got %d", len(sec))
+			return
+		}
+		aux := schnorr.TaggedHash("MuSig/aux", r)
+		for i := range r {
+			r[i] = sec[i] ^ aux[i]
+		}
+	}
+	msgPrefixed := B{0}
+	if msg != nil {
+		msgPrefixed = binary.BigEndian.AppendUint64(B{1}, uint64(len(msg)))
+		msgPrefixed = append(msgPrefixed, msg...)
+	}
+	sn = &SecretNonce{pub: pub}
+	for i, k := range []*secp256k1.ModNScalar{&sn.k1, &sn.k2} {
+		*k = hashToScalar("MuSig/nonce", r, B{byte(len(pub))}, pub,
+			B{byte(len(aggPub))}, aggPub, msgPrefixed,
+			binary.BigEndian.AppendUint32(nil, uint32(len(extra))), extra, B{byte(i)})
+		if k.IsZero() {
+			err = Errorf.E("generated a zero nonce")
+			return
+		}
+		p := schnorr.BaseMul(k)
+		pubNonce = schnorr.EncodePoint(pubNonce, &p)
+	}
+	return
+}
+
+// AggregateNonces sums the public nonces of all the signers.
+func AggregateNonces(pubNonces []B) (aggNonce B, err E) {
+	var r1, r2 secp256k1.JacobianPoint
+	for i, n := range pubNonces {
+		if len(n) != PubNonceLen {
+			err = Errorf.E("public nonce %d must be %d bytes, got %d", i, PubNonceLen,
+				len(n))
+			return
+		}
+		var p1, p2 secp256k1.JacobianPoint
+		if p1, err = schnorr.DecodePoint(n[:PubKeyLen]); err != nil {
+			err = Errorf.E("invalid public nonce %d: %v", i, err)
+			return
+		}
+		if p2, err = schnorr.DecodePoint(n[PubKeyLen:]); err != nil {
+			err = Errorf.E("invalid public nonce %d: %v", i, err)
+			return
+		}
+		r1, r2 = schnorr.Add(&r1, &p1), schnorr.Add(&r2, &p2)
+	}
+	aggNonce = encodePointExt(nil, &r1)
+	aggNonce = encodePointExt(aggNonce, &r2)
+	return
+}
+
+// Session is the signing of one message by the aggregate key with an aggregate
+// nonce, which all the signers and the aggregator compute the same.
+type Session struct {
+	keys *KeyAgg
+	msg  B
+	// b is the nonce coefficient and e the challenge.
+	b, e secp256k1.ModNScalar
+	r    secp256k1.JacobianPoint
+}
+
+// NewSession starts signing msg with the aggregate key and the aggregate of the
+// nonces of all the signers.
+func NewSession(keys *KeyAgg, aggNonce, msg B) (s *Session, err E) {
+	if len(aggNonce) != PubNonceLen {
+		err = Errorf.E("aggregate nonce must be %d bytes, got %d", PubNonceLen,
+			len(aggNonce))
+		return
+	}
+	s = &Session{keys: keys, msg: msg}
+	s.b = hashToScalar("MuSig/noncecoef", aggNonce, keys.PubKey(), msg)
+	var r1, r2 secp256k1.JacobianPoint
+	if r1, err = decodePointExt(aggNonce[:PubKeyLen]); err != nil {
+		return
+	}
+	if r2, err = decodePointExt(aggNonce[PubKeyLen:]); err != nil {
+		return
+	}
+	br2 := schnorr.Mul(&s.b, &r2)
+	if s.r = schnorr.Add(&r1, &br2); schnorr.IsInfinity(&s.r) {
+		// this can only happen if a signer is malicious, and BIP-327 continues
+		// with the generator so the malicious signer can be found.
+		var one secp256k1.ModNScalar
+		one.SetInt(1)
+		s.r = schnorr.BaseMul(&one)
+	}
+	s.e = hashToScalar("BIP0340/challenge", schnorr.XOnly(&s.r), keys.PubKey(), msg)
+	return
+}
+
+// Sign makes the partial signature of the signer with secret key sec using the
+// nonce generated for this session.
+func (s *Session) Sign(sn *SecretNonce, sec B) (psig B, err E) {
+	if sn.used {
+		err = Errorf.E("secret nonce has already been used")
+		return
+	}
+	k1, k2 := sn.k1, sn.k2
+	sn.k1.Zero()
+	sn.k2.Zero()
+	sn.used = true
+	if k1.IsZero() || k2.IsZero() {
+		err = Errorf.E("invalid secret nonce")
+		return
+	}
+	if !schnorr.HasEvenY(&s.r) {
+		k1.Negate()
+		k2.Negate()
+	}
+	var d secp256k1.ModNScalar
+	if d, err = schnorr.DecodeScalar(sec); err != nil {
+		return
+	}
+	if d.IsZero() {
+		err = Errorf.E("secret key is zero")
+		return
+	}
+	p := schnorr.BaseMul(&d)
+	pub := schnorr.EncodePoint(nil, &p)
+	if !Equals(pub, sn.pub) {
+		err = Errorf.E("the nonce was made for another public key")
+		return
+	}
+	if !s.keys.has(pub) {
+		err = Errorf.E("public key %0x is not one of the aggregated keys", pub)
+		return
+	}
+	a := s.keys.coefficient(pub)
+	g := parity(&s.keys.q)
+	d.Mul(&g).Mul(&s.keys.gacc)
+	// s = k1 + b*k2 + e*a*d
+	var z, t secp256k1.ModNScalar
+	z.Mul2(&s.b, &k2).Add(&k1)
+	t.Mul2(&s.e, &a).Mul(&d)
+	z.Add(&t)
+	b := z.Bytes()
+	psig = b[:]
+	if err = s.VerifyPartial(psig, s.pubNonce(k1, k2), pub); err != nil {
+		psig = nil
+		err = Errorf.E("partial signature does not verify: %v", err)
+	}
+	return
+}
+
+// pubNonce recomputes the public nonce from the secret nonce, undoing the
+// negation Sign applies.
+func (s *Session) pubNonce(k1, k2 secp256k1.ModNScalar) (n B) {
+	if !schnorr.HasEvenY(&s.r) {
+		k1.Negate()
+		k2.Negate()
+	}
+	p1, p2 := schnorr.BaseMul(&k1), schnorr.BaseMul(&k2)
+	return schnorr.EncodePoint(schnorr.EncodePoint(nil, &p1), &p2)
+}
+
+// VerifyPartial checks the partial signature of the signer with the compressed
+// public key pub and the public nonce pubNonce, so the aggregator can tell which
+// signer is at fault if the signature does not verify.
+func (s *Session) VerifyPartial(psig, pubNonce, pub B) (err E) {
+	var z secp256k1.ModNScalar
+	if z, err = schnorr.DecodeScalar(psig); err != nil {
+		return
+	}
+	if len(pubNonce) != PubNonceLen {
+		err = Errorf.E("public nonce must be %d bytes, got %d", PubNonceLen,
+			len(pubNonce))
+		return
+	}
+	var r1, r2, p secp256k1.JacobianPoint
+	if r1, err = schnorr.DecodePoint(pubNonce[:PubKeyLen]); err != nil {
+		return
+	}
+	if r2, err = schnorr.DecodePoint(pubNonce[PubKeyLen:]); err != nil {
+		return
+	}
+	if p, err = schnorr.DecodePoint(pub); err != nil {
+		return
+	}
+	if !s.keys.has(pub) {
+		err = Errorf.E("public key %0x is not one of the aggregated keys", pub)
+		return
+	}
+	br2 := schnorr.Mul(&s.b, &r2)
+	re := schnorr.Add(&r1, &br2)
+	if !schnorr.HasEvenY(&s.r) {
+		var m secp256k1.ModNScalar
+		m.SetInt(1).Negate()
+		re = schnorr.Mul(&m, &re)
+	}
+	// s*G must be Re + e*a*g*gacc*P
+	a := s.keys.coefficient(pub)
+	g := parity(&s.keys.q)
+	a.Mul(&s.e).Mul(&g).Mul(&s.keys.gacc)
+	ap := schnorr.Mul(&a, &p)
+	expected, sg := schnorr.Add(&re, &ap), schnorr.BaseMul(&z)
+	if schnorr.IsInfinity(&sg) != schnorr.IsInfinity(&expected) ||
+		!schnorr.IsInfinity(&sg) && !Equals(schnorr.EncodePoint(nil, &sg), schnorr.EncodePoint(nil, &expected)) {
+		err = Errorf.E("invalid partial signature from %0x", pub)
+	}
+	return
+}
+
+// Aggregate sums the partial signatures of all the signers into the BIP-340
+// signature of the message by the aggregate key.
+func (s *Session) Aggregate(psigs []B) (sig B, err E) {
+	var z secp256k1.ModNScalar
+	for i, psig := range psigs {
+		var zi secp256k1.ModNScalar
+		if zi, err = schnorr.DecodeScalar(psig); err != nil {
+			err = Errorf.E("invalid partial signature %d: %v", i, err)
+			return
+		}
+		z.Add(&zi)
+	}
+	// the tweaks are added by the aggregator, e*g*tacc
+	var t secp256k1.ModNScalar
+	g := parity(&s.keys.q)
+	t.Mul2(&s.e, &g).Mul(&s.keys.tacc)
+	z.Add(&t)
+	b := z.Bytes()
+	sig = append(schnorr.XOnly(&s.r), b[:]...)
+	if err = schnorr.Verify(sig, s.keys.PubKey(), s.msg); err != nil {
+		err = Errorf.E("aggregate signature does not verify: %v", err)
+	}
+	return
+}
+
+// EventMessage sets the pubkey of the event to the aggregate key and computes
+// its ID, which is the message the signers sign. Set the signature of the event
+// to the result of Aggregate.
+func EventMessage(ev *event.T, keys *KeyAgg) (msg B) {
+	ev.PubKey = keys.PubKey()
+	ev.ID = ev.GetIDBytes()
+	return ev.ID
+}
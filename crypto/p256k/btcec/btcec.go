@@ -42,12 +42,11 @@ func (s *Signer) InitSec(sec B) (err error) {
 		return
 	}
 	s.SecretKey = secp256k1.SecKeyFromBytes(sec)
+	s.skb = sec
 	s.PublicKey = s.SecretKey.PubKey()
+	// an odd public key is fine for BIP-340, which only uses the X coordinate,
+	// and keys derived elsewhere such as from a NIP-06 mnemonic can be odd.
 	s.pkb = s.SecretKey.PubKey().SerializeCompressed()
-	if s.pkb[0] != 2 {
-		err = Errorf.E("invalid odd pubkey from secret key %0x", s.pkb)
-		return
-	}
 	return
 }
 
@@ -131,5 +130,5 @@ func (k *Keygen) Negate() {
 }
 
 func (k *Keygen) KeyPairBytes() (secBytes, cmprPubBytes B) {
-	return k.Signer.SecretKey.Serialize(), k.Signer.PublicKey.SerializeCompressed()
+	return k.Signer.SecretKey.Serialize(), k.Signer.PublicKey.SerializeCompressed()[1:]
 }
@@ -0,0 +1,165 @@
+// Package vanity mines keys with a public key that matches a pattern, using a
+// crypto.Generator per core.
+package vanity
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strings"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/bech32encoding"
+	"util.mleku.dev/hex"
+)
+
+// Matcher tests a candidate public key. Match is called from many goroutines at
+// once with the 32 byte X-only key and must not keep it.
+type Matcher interface {
+	Match(pub B) bool
+	// Difficulty is the expected number of keys to try for one match, or 0 if it
+	// is not known.
+	Difficulty() float64
+	// String describes the pattern.
+	String() S
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+type hexPrefix struct {
+	prefix S
+	whole  B
+	nibble int
+}
+
+// HexPrefix matches public keys that start with prefix in hex.
+func HexPrefix(prefix S) (m Matcher, err E) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) == 0 || len(prefix) > 64 {
+		err = Errorf.E("hex prefix must be 1 to 64 characters, got %d", len(prefix))
+		return
+	}
+	h := &hexPrefix{prefix: prefix, nibble: -1}
+	if h.whole, err = hex.Dec(prefix[:len(prefix)/2*2]); err != nil {
+		err = Errorf.E("invalid hex prefix '%s'", prefix)
+		return
+	}
+	if len(prefix)%2 == 1 {
+		c := prefix[len(prefix)-1]
+		if h.nibble = strings.IndexByte("0123456789abcdef", c); h.nibble < 0 {
+			err = Errorf.E("invalid hex prefix '%s'", prefix)
+			return
+		}
+	}
+	return h, nil
+}
+
+func (h *hexPrefix) Match(pub B) bool {
+	if !bytes.HasPrefix(pub, h.whole) {
+		return false
+	}
+	return h.nibble < 0 || int(pub[len(h.whole)]>>4) == h.nibble
+}
+
+func (h *hexPrefix) Difficulty() float64 { return math.Pow(16, float64(len(h.prefix))) }
+
+func (h *hexPrefix) String() S { return "hex prefix " + h.prefix }
+
+// npubData strips the npub1 from a pattern and checks that the rest is bech32.
+func npubData(pattern S) (data S, err E) {
+	data = strings.TrimPrefix(strings.ToLower(pattern),
+		S(bech32encoding.NpubHRP)+"1")
+	if len(data) == 0 {
+		err = Errorf.E("empty npub pattern")
+		return
+	}
+	for i := range data {
+		if strings.IndexByte(bech32Charset, data[i]) < 0 {
+			err = Errorf.E("'%c' can't appear in an npub, bech32 does not use 1, b, i or o",
+				data[i])
+			return
+		}
+	}
+	return
+}
+
+type npubPrefix struct {
+	prefix S
+	// values are the 5 bit values of the characters.
+	values B
+}
+
+// NpubPrefix matches public keys whose npub starts with prefix, with or without
+// the npub1. The prefix is compared against the bits of the key so no encoding
+// is needed for each candidate.
+func NpubPrefix(prefix S) (m Matcher, err E) {
+	if prefix, err = npubData(prefix); err != nil {
+		return
+	}
+	// the 52nd character only has one bit of the key in it.
+	if len(prefix) > 51 {
+		err = Errorf.E("npub prefix must be at most 51 characters, got %d",
+			len(prefix))
+		return
+	}
+	n := &npubPrefix{prefix: prefix}
+	for i := range prefix {
+		n.values = append(n.values, byte(strings.IndexByte(bech32Charset, prefix[i])))
+	}
+	return n, nil
+}
+
+func (n *npubPrefix) Match(pub B) bool {
+	for i, v := range n.values {
+		bit := i * 5
+		w := uint16(pub[bit/8]) << 8
+		if bit/8+1 < len(pub) {
+			w |= uint16(pub[bit/8+1])
+		}
+		if byte(w>>(11-bit%8)&31) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *npubPrefix) Difficulty() float64 { return math.Pow(32, float64(len(n.prefix))) }
+
+func (n *npubPrefix) String() S { return "npub prefix npub1" + n.prefix }
+
+type npubSuffix struct{ suffix S }
+
+// NpubSuffix matches public keys whose npub ends with suffix. The last six
+// characters of an npub are the checksum, which is as random as the rest.
+func NpubSuffix(suffix S) (m Matcher, err E) {
+	if suffix, err = npubData(suffix); err != nil {
+		return
+	}
+	return &npubSuffix{suffix: suffix}, nil
+}
+
+func (n *npubSuffix) Match(pub B) bool {
+	npub, err := bech32encoding.BinToNpub(pub)
+	return err == nil && bytes.HasSuffix(npub, B(n.suffix))
+}
+
+func (n *npubSuffix) Difficulty() float64 { return math.Pow(32, float64(len(n.suffix))) }
+
+func (n *npubSuffix) String() S { return "npub suffix " + n.suffix }
+
+type npubRegexp struct{ re *regexp.Regexp }
+
+// NpubRegexp matches public keys whose whole npub, including the npub1, matches
+// re. The difficulty of a regular expression is not known so there is no time
+// estimate.
+func NpubRegexp(re *regexp.Regexp) Matcher { return &npubRegexp{re: re} }
+
+func (n *npubRegexp) Match(pub B) bool {
+	npub, err := bech32encoding.BinToNpub(pub)
+	return err == nil && n.re.Match(npub)
+}
+
+func (n *npubRegexp) Difficulty() float64 { return 0 }
+
+func (n *npubRegexp) String() S { return "npub regexp " + n.re.String() }
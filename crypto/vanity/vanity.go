@@ -0,0 +1,176 @@
+package vanity
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/crypto/p256k"
+	"util.mleku.dev/atomic"
+	"util.mleku.dev/context"
+)
+
+// Result is a key found by a miner.
+type Result struct {
+	// Sec is the secret key, adjusted if needed so the public key is even.
+	Sec B
+	// Pub is the 32 byte X-only public key.
+	Pub B
+	// Attempts is the number of keys tried by all workers.
+	Attempts uint64
+	Elapsed  time.Duration
+}
+
+// Progress is a report of how the search is going.
+type Progress struct {
+	Attempts uint64
+	Elapsed  time.Duration
+	// Rate is the number of keys tried per second.
+	Rate float64
+	// Probability is the chance that a match would have been found by now, or 0
+	// if the difficulty is not known.
+	Probability float64
+	// Estimate is the expected time until a match, or 0 if the difficulty is not
+	// known. Each key is an independent trial so this does not go down as the
+	// search goes on.
+	Estimate time.Duration
+}
+
+// T is a vanity key miner.
+type T struct {
+	Matcher Matcher
+	// Workers is the number of goroutines to mine with.
+	Workers int
+	// NewGenerator makes the Generator for each worker.
+	NewGenerator func() crypto.Generator
+	// Progress is called every Interval while mining if it is not nil.
+	Progress func(p Progress)
+	Interval time.Duration
+}
+
+// New creates a miner that uses every core and the p256k Keygen of the build.
+func New(m Matcher) *T {
+	return &T{
+		Matcher:      m,
+		Workers:      runtime.NumCPU(),
+		NewGenerator: func() crypto.Generator { return p256k.NewKeygen() },
+		Interval:     time.Second,
+	}
+}
+
+// batch is how many keys a worker tries between adding to the count and
+// checking if the search is over.
+const batch = 256
+
+// Mine searches for a key until one matches or the context is done, in which
+// case the context's error is returned.
+func (t *T) Mine(c context.T) (r *Result, err E) {
+	if t.Matcher == nil {
+		err = Errorf.E("no matcher")
+		return
+	}
+	workers := t.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	parent := c
+	c, cancel := context.Cancel(parent)
+	defer cancel()
+	var attempts atomic.Uint64
+	start := time.Now()
+	found := make(chan *Result, 1)
+	errs := make(chan E, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, e := t.work(c, &attempts); e != nil {
+				errs <- e
+			} else if res != nil {
+				select {
+				case found <- res:
+				default:
+				}
+			}
+			cancel()
+		}()
+	}
+	var tick <-chan time.Time
+	if t.Progress != nil && t.Interval > 0 {
+		ticker := time.NewTicker(t.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for done := false; !done; {
+		select {
+		case <-tick:
+			t.Progress(t.progress(attempts.Load(), time.Since(start)))
+		case <-c.Done():
+			done = true
+		}
+	}
+	wg.Wait()
+	select {
+	case r = <-found:
+		r.Attempts, r.Elapsed = attempts.Load(), time.Since(start)
+		return
+	default:
+	}
+	select {
+	case err = <-errs:
+	default:
+		err = parent.Err()
+	}
+	return
+}
+
+func (t *T) work(c context.T, attempts *atomic.Uint64) (r *Result, err E) {
+	g := t.NewGenerator()
+	done := c.Done()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		for i := 0; i < batch; i++ {
+			var pub B
+			if pub, err = g.Generate(); Chk.E(err) {
+				return
+			}
+			if !t.Matcher.Match(pub[1:]) {
+				continue
+			}
+			attempts.Add(uint64(i + 1))
+			if pub[0] != 2 {
+				g.Negate()
+			}
+			sec, xpub := g.KeyPairBytes()
+			r = &Result{Sec: append(B{}, sec...), Pub: append(B{}, xpub...)}
+			return
+		}
+		attempts.Add(batch)
+	}
+}
+
+func (t *T) progress(attempts uint64, elapsed time.Duration) (p Progress) {
+	p = Progress{Attempts: attempts, Elapsed: elapsed}
+	if elapsed > 0 {
+		p.Rate = float64(attempts) / elapsed.Seconds()
+	}
+	if d := t.Matcher.Difficulty(); d > 0 {
+		p.Probability = -math.Expm1(float64(attempts) * math.Log1p(-1/d))
+		if p.Rate > 0 {
+			p.Estimate = time.Duration(math.MaxInt64)
+			if s := d / p.Rate; s < float64(p.Estimate/time.Second) {
+				p.Estimate = time.Duration(s * float64(time.Second))
+			}
+		}
+	}
+	return
+}
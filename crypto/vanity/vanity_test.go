@@ -0,0 +1,174 @@
+package vanity
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/bech32encoding"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/crypto/p256k"
+	"nostr.mleku.dev/crypto/p256k/btcec"
+	"util.mleku.dev/context"
+	"util.mleku.dev/hex"
+)
+
+func mine(t *testing.T, m Matcher) (r *Result) {
+	var err E
+	v := New(m)
+	v.Interval = time.Millisecond
+	v.Progress = func(p Progress) {}
+	if r, err = v.Mine(context.Bg()); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Match(r.Pub) {
+		t.Fatalf("%v does not match %0x", m, r.Pub)
+	}
+	signer := &p256k.Signer{}
+	if err = signer.InitSec(r.Sec); err != nil {
+		t.Fatal(err)
+	}
+	if !Equals(signer.Pub(), r.Pub) {
+		t.Fatalf("secret key gives public key %0x, expected %0x", signer.Pub(), r.Pub)
+	}
+	if signer.ECPub()[0] != 2 {
+		t.Fatalf("public key %0x is odd", signer.ECPub())
+	}
+	return
+}
+
+func TestHexPrefix(t *testing.T) {
+	for _, prefix := range []S{"a", "be", "0f0"} {
+		m, err := HexPrefix(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := mine(t, m)
+		if h := hex.Enc(r.Pub); h[:len(prefix)] != prefix {
+			t.Fatalf("got %s expected prefix %s", h, prefix)
+		}
+	}
+	for _, prefix := range []S{"", "xy", "0g"} {
+		if _, err := HexPrefix(prefix); err == nil {
+			t.Fatalf("expected an error for '%s'", prefix)
+		}
+	}
+}
+
+func TestNpub(t *testing.T) {
+	for _, prefix := range []S{"q", "npub1ml", "x9"} {
+		m, err := NpubPrefix(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := mine(t, m)
+		npub, _ := bech32encoding.BinToNpub(r.Pub)
+		if !bytes.HasPrefix(npub, B("npub1"+strings.TrimPrefix(prefix, "npub1"))) {
+			t.Fatalf("got %s expected prefix %s", npub, prefix)
+		}
+	}
+	m, err := NpubSuffix("ml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mine(t, m)
+	if npub, _ := bech32encoding.BinToNpub(r.Pub); !bytes.HasSuffix(npub, B("ml")) {
+		t.Fatalf("got %s expected suffix ml", npub)
+	}
+	mine(t, NpubRegexp(regexp.MustCompile(`^npub1.+x[02-9]$`)))
+	for _, pattern := range []S{"", "npub1", "b", "1o"} {
+		if _, err = NpubPrefix(pattern); err == nil {
+			t.Fatalf("expected an error for '%s'", pattern)
+		}
+	}
+}
+
+// TestNpubPrefix checks the bitwise prefix against the encoded npub.
+func TestNpubPrefix(t *testing.T) {
+	g := p256k.NewKeygen()
+	for i := 0; i < 100; i++ {
+		pub, err := g.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		npub, _ := bech32encoding.BinToNpub(pub[1:])
+		for _, n := range []int{1, 7, 20, 51} {
+			var m Matcher
+			if m, err = NpubPrefix(S(npub[5 : 5+n])); err != nil {
+				t.Fatal(err)
+			}
+			if !m.Match(pub[1:]) {
+				t.Fatalf("%v does not match %s", m, npub)
+			}
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	m, err := HexPrefix(S(bytes.Repeat(B("0"), 64)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, cancel := context.Timeout(context.Bg(), 50*time.Millisecond)
+	defer cancel()
+	var last Progress
+	v := New(m)
+	v.Interval = 10 * time.Millisecond
+	v.Progress = func(p Progress) { last = p }
+	if _, err = v.Mine(c); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+	if last.Elapsed == 0 {
+		t.Fatal("expected progress to be reported")
+	}
+	// the count is only added to in batches so it can still be zero on a slow
+	// machine.
+	if last.Attempts > 0 && (last.Rate == 0 || last.Estimate == 0) {
+		t.Fatalf("expected a rate and estimate, got %+v", last)
+	}
+}
+
+func benchmarkGenerate(b *testing.B, g crypto.Generator) {
+	for i := 0; i < b.N; i++ {
+		if _, err := g.Generate(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGenerate measures the Keygen of the build, which is the CGO one
+// unless the btcec tag is set.
+func BenchmarkGenerate(b *testing.B) { benchmarkGenerate(b, p256k.NewKeygen()) }
+
+func BenchmarkGenerateBTCEC(b *testing.B) { benchmarkGenerate(b, &btcec.Keygen{}) }
+
+func benchmarkMine(b *testing.B, newGenerator func() crypto.Generator) {
+	m, err := HexPrefix("abc")
+	if err != nil {
+		b.Fatal(err)
+	}
+	v := New(m)
+	v.NewGenerator = newGenerator
+	var attempts uint64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var r *Result
+		if r, err = v.Mine(context.Bg()); err != nil {
+			b.Fatal(err)
+		}
+		attempts += r.Attempts
+	}
+	b.ReportMetric(float64(attempts)/b.Elapsed().Seconds(), "keys/s")
+}
+
+func BenchmarkMine(b *testing.B) {
+	benchmarkMine(b, func() crypto.Generator { return p256k.NewKeygen() })
+}
+
+func BenchmarkMineBTCEC(b *testing.B) {
+	benchmarkMine(b, func() crypto.Generator { return &btcec.Keygen{} })
+}
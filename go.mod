@@ -13,6 +13,7 @@ require (
 	github.com/templexxx/xhex v0.0.0-20200614015412-aed53437177b
 	golang.org/x/crypto v0.27.0
 	golang.org/x/net v0.29.0
+	golang.org/x/text v0.18.0
 	lukechampine.com/frand v1.4.2
 	util.mleku.dev v1.0.5
 )
@@ -3,13 +3,12 @@ package dns
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"regexp"
 	"strings"
 
 	. "nostr.mleku.dev"
 	"nostr.mleku.dev/codec/bech32encoding/pointers"
-	"nostr.mleku.dev/crypto/keys"
+	"nostr.mleku.dev/protocol/httpclient"
 )
 
 var Nip05Regex = regexp.MustCompile(`^(?:([\w.+-]+)@)?([\w_-]+(\.[\w_-]+)+)$`)
@@ -43,63 +42,50 @@ func ParseIdentifier(account S) (name, domain S, err error) {
 	return res[1], res[2], nil
 }
 
-func QueryIdentifier(c Ctx, account S) (prf *pointers.Profile, err E) {
+// QueryIdentifier resolves an identifier to a profile pointer. The options
+// change how the request is made, for example to go through a proxy.
+func QueryIdentifier(c Ctx, account S, opts ...httpclient.Option) (prf *pointers.Profile,
+	err E) {
+
 	var result *WellKnownResponse
 	var name S
-	if result, name, err = Fetch(c, account); Chk.E(err) {
-		return
-	}
-	pubkey, ok := result.Names[name]
-	if !ok {
-		err = Errorf.E("no entry for name '%s'", name)
-		return
-	}
-	if !keys.IsValidPublicKey(pubkey) {
-		return nil, Errorf.E("got an invalid public key '%s'", pubkey)
-	}
-	var pkb B
-	if pkb, err = keys.HexPubkeyToBytes(pubkey); Chk.E(err) {
+	if result, name, err = Fetch(c, account, opts...); Chk.E(err) {
 		return
 	}
-	relays, _ := result.Relays[pubkey]
-	return &pointers.Profile{
-		PublicKey: pkb,
-		Relays:    StringSliceToByteSlice(relays),
-	}, nil
+	return profileOf(result, name)
+}
+
+// Fetch gets the nostr.json of the domain of an identifier. Redirects are not
+// followed unless the options allow them, as NIP-05 forbids them.
+func Fetch(c Ctx, account S, opts ...httpclient.Option) (resp *WellKnownResponse, name S,
+	err error) {
+
+	return fetch(c, newClient(opts...), account)
+}
+
+// newClient creates the client for NIP-05 requests, which does not follow
+// redirects unless the options allow them.
+func newClient(opts ...httpclient.Option) *httpclient.T {
+	return httpclient.New(append([]httpclient.Option{httpclient.WithMaxRedirects(0)},
+		opts...)...)
 }
 
-func Fetch(c Ctx, account S) (resp *WellKnownResponse, name S, err error) {
+func fetch(c Ctx, client *httpclient.T, account S) (resp *WellKnownResponse, name S,
+	err error) {
+
 	var domain S
 	if name, domain, err = ParseIdentifier(account); Chk.E(err) {
 		err = Errorf.E("failed to parse '%s': %w", account, err)
 		return
 	}
-	var req *http.Request
-	if req, err = http.NewRequestWithContext(c, "GET",
+	var b B
+	if b, err = client.Get(c,
 		fmt.Sprintf("https://%s/.well-known/nostr.json?name=%s", domain, name),
 		nil); Chk.E(err) {
 
-		return resp, name, Errorf.E("failed to create a request: %w", err)
-	}
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request,
-			via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
-	var res *http.Response
-	if res, err = client.Do(req); Chk.E(err) {
-		err = Errorf.E("request failed: %w", err)
 		return
 	}
-	defer res.Body.Close()
 	resp = NewWellKnownResponse()
-	b := make(B, 65535)
-	var n N
-	if n, err = res.Body.Read(b); Chk.E(err) {
-		return
-	}
-	b = b[:n]
 	if err = json.Unmarshal(b, resp); Chk.E(err) {
 		err = Errorf.E("failed to decode json response: %w", err)
 	}
@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/bech32encoding/pointers"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/profile"
+	"nostr.mleku.dev/crypto/keys"
+	"nostr.mleku.dev/protocol/httpclient"
+)
+
+const (
+	// DefaultTTL is how long a Resolver keeps an identifier that resolved.
+	DefaultTTL = time.Hour
+	// DefaultNegativeTTL is how long a Resolver keeps an identifier that failed
+	// to resolve.
+	DefaultNegativeTTL = 5 * time.Minute
+)
+
+type cached struct {
+	profile *pointers.Profile
+	err     E
+	expires time.Time
+}
+
+// Resolver resolves NIP-05 identifiers and caches the results, including
+// failures so that a missing or broken server is not asked again on every
+// event.
+type Resolver struct {
+	TTL, NegativeTTL time.Duration
+	client           *httpclient.T
+	mx               sync.Mutex
+	cache            map[S]*cached
+}
+
+// NewResolver creates a Resolver with the default TTLs. The options change how
+// requests are made, for example to use a fake transport in tests.
+func NewResolver(opts ...httpclient.Option) *Resolver {
+	return &Resolver{TTL: DefaultTTL, NegativeTTL: DefaultNegativeTTL,
+		client: newClient(opts...), cache: make(map[S]*cached)}
+}
+
+// Resolve returns the profile pointer of an identifier from the cache or by
+// querying its server.
+func (r *Resolver) Resolve(c Ctx, identifier S) (prf *pointers.Profile, err E) {
+	key := strings.ToLower(NormalizeIdentifier(identifier))
+	now := time.Now()
+	r.mx.Lock()
+	if e, ok := r.cache[key]; ok && now.Before(e.expires) {
+		r.mx.Unlock()
+		return e.profile, e.err
+	}
+	r.mx.Unlock()
+	prf, err = r.query(c, key)
+	if c.Err() != nil {
+		// a cancelled query says nothing about the identifier.
+		return
+	}
+	e := &cached{profile: prf, err: err, expires: now.Add(r.TTL)}
+	if err != nil {
+		e.expires = now.Add(r.NegativeTTL)
+	}
+	r.mx.Lock()
+	if r.cache == nil {
+		r.cache = make(map[S]*cached)
+	}
+	r.cache[key] = e
+	// drop expired entries now and then so the cache does not grow forever.
+	if len(r.cache)%256 == 0 {
+		for k, v := range r.cache {
+			if now.After(v.expires) {
+				delete(r.cache, k)
+			}
+		}
+	}
+	r.mx.Unlock()
+	return
+}
+
+func (r *Resolver) query(c Ctx, identifier S) (prf *pointers.Profile, err E) {
+	var result *WellKnownResponse
+	var name S
+	if result, name, err = fetch(c, r.client, identifier); err != nil {
+		return
+	}
+	return profileOf(result, name)
+}
+
+// Forget removes an identifier from the cache.
+func (r *Resolver) Forget(identifier S) {
+	r.mx.Lock()
+	delete(r.cache, strings.ToLower(NormalizeIdentifier(identifier)))
+	r.mx.Unlock()
+}
+
+// Verify checks that the nip05 field of a kind 0 profile event resolves to the
+// pubkey of the event, and returns the identifier.
+func (r *Resolver) Verify(c Ctx, ev *event.T) (identifier S, err E) {
+	var p *profile.T
+	if p, err = profile.FromEvent(ev); err != nil {
+		return
+	}
+	if identifier = p.NIP05; identifier == "" {
+		err = Errorf.E("profile has no nip05")
+		return
+	}
+	var prf *pointers.Profile
+	if prf, err = r.Resolve(c, identifier); err != nil {
+		return
+	}
+	if !Equals(prf.PublicKey, ev.PubKey) {
+		err = Errorf.E("%s belongs to another pubkey", identifier)
+	}
+	return
+}
+
+// profileOf gets the profile pointer of a name from a response.
+func profileOf(result *WellKnownResponse, name S) (prf *pointers.Profile, err E) {
+	pubkey, ok := result.Names[name]
+	if !ok {
+		err = Errorf.E("no entry for name '%s'", name)
+		return
+	}
+	if !keys.IsValidPublicKey(pubkey) {
+		return nil, Errorf.E("got an invalid public key '%s'", pubkey)
+	}
+	var pkb B
+	if pkb, err = keys.HexPubkeyToBytes(pubkey); Chk.E(err) {
+		return
+	}
+	relays, _ := result.Relays[pubkey]
+	return &pointers.Profile{
+		PublicKey: pkb,
+		Relays:    StringSliceToByteSlice(relays),
+	}, nil
+}
@@ -0,0 +1,159 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto/p256k"
+	"nostr.mleku.dev/protocol/httpclient"
+	"util.mleku.dev/hex"
+)
+
+// transport serves every request from a handler without touching the network.
+type transport struct {
+	h        http.Handler
+	requests atomic.Int64
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	w := httptest.NewRecorder()
+	t.h.ServeHTTP(w, r)
+	return w.Result(), nil
+}
+
+const testPubKey = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+
+func testSource() Map {
+	return Map{
+		"_":   {PubKey: testPubKey, Relays: []S{"wss://relay.example.com"}},
+		"bob": {PubKey: "f9dd6a762506260b38a2d3e5b464213c2e47fa3877429fe9ee60e071a31a07d7"},
+	}
+}
+
+func serve(t *testing.T, h http.Handler, method, target S) (w *httptest.ResponseRecorder,
+	resp *WellKnownResponse) {
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("%s %s has no CORS header", method, target)
+	}
+	if w.Code == http.StatusOK && method == http.MethodGet {
+		resp = &WellKnownResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(testSource())
+	_, resp := serve(t, h, "GET", "/.well-known/nostr.json?name=BOB")
+	if len(resp.Names) != 1 || resp.Names["bob"] == "" || len(resp.Relays) != 0 {
+		t.Fatalf("unexpected response for bob: %v", resp)
+	}
+	_, resp = serve(t, h, "GET", "/.well-known/nostr.json?name=_")
+	if len(resp.Names) != 1 || len(resp.Relays[testPubKey]) != 1 {
+		t.Fatalf("unexpected response for _: %v", resp)
+	}
+	_, resp = serve(t, h, "GET", "/.well-known/nostr.json?name=carol")
+	if len(resp.Names) != 0 {
+		t.Fatalf("unexpected response for an unknown name: %v", resp)
+	}
+	_, resp = serve(t, h, "GET", "/.well-known/nostr.json")
+	if len(resp.Names) != 2 {
+		t.Fatalf("expected every name, got %v", resp)
+	}
+	w, _ := serve(t, h, "GET", "/.well-known/nostr.json?name=b%20b")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for an invalid name, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w, _ = serve(t, h, "OPTIONS", "/.well-known/nostr.json"); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d for a preflight, got %d", http.StatusNoContent, w.Code)
+	}
+	if w, _ = serve(t, h, "POST", "/.well-known/nostr.json"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d for POST, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	tr := &transport{h: NewHandler(testSource())}
+	r := NewResolver(httpclient.WithTransport(tr))
+	c := context.Background()
+	for i := 0; i < 3; i++ {
+		prf, err := r.Resolve(c, "_@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.Enc(prf.PublicKey) != testPubKey || len(prf.Relays) != 1 {
+			t.Fatalf("unexpected profile %0x %s", prf.PublicKey, prf.Relays)
+		}
+	}
+	if n := tr.requests.Load(); n != 1 {
+		t.Fatalf("expected one request, got %d", n)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := r.Resolve(c, "carol@example.com"); err == nil {
+			t.Fatal("expected an error for an unknown name")
+		}
+	}
+	if n := tr.requests.Load(); n != 2 {
+		t.Fatalf("expected the failure to be cached, got %d requests", n)
+	}
+	r.NegativeTTL = -time.Second
+	r.Forget("carol@example.com")
+	r.Resolve(c, "carol@example.com")
+	r.Resolve(c, "carol@example.com")
+	if n := tr.requests.Load(); n != 4 {
+		t.Fatalf("expected expired failures to be queried again, got %d requests", n)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	signer := &p256k.Signer{}
+	if err := signer.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	src := testSource()
+	src["alice"] = &Entry{PubKey: hex.Enc(signer.Pub())}
+	r := NewResolver(httpclient.WithTransport(&transport{h: NewHandler(src)}))
+	profile := func(nip05 S) *event.T {
+		ev := &event.T{Kind: kind.ProfileMetadata, CreatedAt: timestamp.Now(),
+			Tags: tags.New(), Content: B(`{"name":"alice","nip05":"` + nip05 + `"}`)}
+		if err := ev.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		return ev
+	}
+	c := context.Background()
+	id, err := r.Verify(c, profile("Alice@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "Alice@example.com" {
+		t.Fatalf("got identifier %s", id)
+	}
+	for _, nip05 := range []S{"bob@example.com", "carol@example.com", ""} {
+		if _, err = r.Verify(c, profile(nip05)); err == nil {
+			t.Fatalf("expected '%s' not to verify", nip05)
+		}
+	}
+	ev := profile("alice@example.com")
+	ev.Kind = kind.TextNote
+	if _, err = r.Verify(c, ev); err == nil {
+		t.Fatal("expected an error for an event that is not a profile")
+	}
+}
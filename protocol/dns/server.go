@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	. "nostr.mleku.dev"
+)
+
+// Entry is what a NIP-05 server has for a name.
+type Entry struct {
+	// PubKey is the hex public key of the name.
+	PubKey S
+	// Relays are the relays the pubkey can be found on.
+	Relays []S
+	// NIP46 are the NIP-46 bunker relays of the pubkey.
+	NIP46 []S
+}
+
+// Source is where a Handler looks up names.
+type Source interface {
+	// Lookup returns the entry for a lowercase name, or nil if there is none.
+	Lookup(c Ctx, name S) (e *Entry, err E)
+}
+
+// Lister is a Source that can list every name, for requests without a name.
+type Lister interface {
+	Source
+	List(c Ctx) (entries map[S]*Entry, err E)
+}
+
+// Map is a Source and Lister with a fixed set of names, which must be lowercase.
+type Map map[S]*Entry
+
+func (m Map) Lookup(c Ctx, name S) (e *Entry, err E) { return m[name], nil }
+
+func (m Map) List(c Ctx) (entries map[S]*Entry, err E) { return m, nil }
+
+// NameRegex matches the names NIP-05 allows.
+var NameRegex = regexp.MustCompile(`^[a-z0-9._-]+$`)
+
+// Handler serves /.well-known/nostr.json from a Source. A request with a name
+// query gets only that name, and one without gets every name if the Source is a
+// Lister and none if it isn't. Names are case insensitive.
+type Handler struct {
+	Source Source
+}
+
+// NewHandler creates a Handler for a Source.
+func NewHandler(src Source) *Handler { return &Handler{Source: src} }
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// NIP-05 requires that web clients on any origin can query the server.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "*")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodGet, http.MethodHead:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := NewWellKnownResponse()
+	add := func(name S, e *Entry) {
+		resp.Names[name] = e.PubKey
+		if len(e.Relays) > 0 {
+			resp.Relays[e.PubKey] = e.Relays
+		}
+		if len(e.NIP46) > 0 {
+			resp.NIP46[e.PubKey] = e.NIP46
+		}
+	}
+	c := r.Context()
+	if r.URL.Query().Has("name") {
+		name := strings.ToLower(r.URL.Query().Get("name"))
+		if !NameRegex.MatchString(name) {
+			http.Error(w, "invalid name", http.StatusBadRequest)
+			return
+		}
+		e, err := h.Source.Lookup(c, name)
+		if Chk.E(err) {
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+		if e != nil {
+			add(name, e)
+		}
+	} else if l, ok := h.Source.(Lister); ok {
+		entries, err := l.List(c)
+		if Chk.E(err) {
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+		for name, e := range entries {
+			add(name, e)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); Chk.E(err) {
+		return
+	}
+}
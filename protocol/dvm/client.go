@@ -0,0 +1,131 @@
+package dvm
+
+import (
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/filters"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/protocol/ws"
+	"util.mleku.dev/context"
+)
+
+// Client submits jobs for a customer and collects what service providers send
+// back.
+type Client struct {
+	// Relays are where jobs are published, and feedback and results looked for.
+	Relays []S
+	signer crypto.Signer
+	pool   *ws.SimplePool
+}
+
+// NewClient creates a client for the customer signer that reaches relays through
+// pool.
+func NewClient(signer crypto.Signer, pool *ws.SimplePool, relays ...S) *Client {
+	return &Client{Relays: relays, signer: signer, pool: pool}
+}
+
+// Update is a feedback or result event of a provider for a job.
+type Update struct {
+	// Provider is the pubkey of the service provider.
+	Provider B
+	// Feedback is set if the update is job feedback.
+	Feedback *Feedback
+	// Result is set if the update is a job result.
+	Result *Result
+}
+
+// Submit signs a job and publishes it to the relays of the client and the job.
+// The job asks for feedback and results on the relays of the client if it names
+// none.
+func (cl *Client) Submit(c Ctx, j *Job) (err E) {
+	if len(j.Relays) == 0 {
+		j.Relays = append(j.Relays, cl.Relays...)
+	}
+	if _, err = j.Sign(cl.signer); err != nil {
+		return
+	}
+	var published bool
+	for _, u := range j.Relays {
+		r, e := cl.pool.EnsureRelay(u)
+		if e != nil {
+			err = e
+			continue
+		}
+		if e = r.Publish(c, j.Event); e != nil {
+			err = e
+			continue
+		}
+		published = true
+	}
+	if !published {
+		return Errorf.E("could not publish job: %w", err)
+	}
+	return nil
+}
+
+// Watch returns the feedback and results for a submitted job as they arrive,
+// until the context is done.
+func (cl *Client) Watch(c Ctx, j *Job) (updates chan *Update) {
+	f := filter.New()
+	f.Kinds = kinds.New(kind.JobFeedback, ResultKind(j.Kind))
+	f.Tags = tags.New(tag.New(B("#e"), j.Event.ID))
+	if len(j.Providers) > 0 {
+		f.Authors = tag.New(j.Providers...)
+	}
+	updates = make(chan *Update)
+	events := cl.pool.SubMany(c, j.Relays, filters.New(f))
+	go func() {
+		defer close(updates)
+		for ie := range events {
+			u, err := cl.update(ie.Event)
+			if err != nil {
+				Log.D.F("job update %0x: %v", ie.Event.ID, err)
+				continue
+			}
+			select {
+			case updates <- u:
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+	return
+}
+
+func (cl *Client) update(ev *event.T) (u *Update, err E) {
+	u = &Update{Provider: ev.PubKey}
+	if ev.Kind.Equal(kind.JobFeedback) {
+		if u.Feedback, err = ParseFeedback(ev, cl.signer); err != nil {
+			return nil, err
+		}
+		return
+	}
+	if u.Result, err = ParseResult(ev, cl.signer); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Collect gathers the results of competing providers for a submitted job, one
+// per provider, until it has n of them or the context is done.
+func (cl *Client) Collect(c Ctx, j *Job, n N) (results []*Update) {
+	c, cancel := context.Cancel(c)
+	defer cancel()
+	seen := make(map[S]bool)
+	for u := range cl.Watch(c, j) {
+		if u.Result == nil || seen[S(u.Provider)] {
+			continue
+		}
+		seen[S(u.Provider)] = true
+		if results = append(results, u); len(results) >= n {
+			break
+		}
+	}
+	return
+}
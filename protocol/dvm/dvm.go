@@ -0,0 +1,448 @@
+// Package dvm implements NIP-90 data vending machines: customers publish job
+// requests of kinds 5000-5999, and service providers answer them with job
+// feedback (kind 7000) and results of the kind of the request plus 1000.
+package dvm
+
+import (
+	"encoding/json"
+	"strconv"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/crypto/encryption"
+	"util.mleku.dev/hex"
+)
+
+// The input types of i tags.
+const (
+	InputURL   = "url"
+	InputEvent = "event"
+	InputJob   = "job"
+	InputText  = "text"
+)
+
+// The statuses of job feedback.
+const (
+	PaymentRequired = "payment-required"
+	Processing      = "processing"
+	Error           = "error"
+	Success         = "success"
+	Partial         = "partial"
+)
+
+// IsJob returns true if k is a job request kind.
+func IsJob(k *kind.T) bool {
+	return k != nil && k.K >= kind.JobRequestStart.K && k.K <= kind.JobRequestEnd.K
+}
+
+// IsResult returns true if k is a job result kind.
+func IsResult(k *kind.T) bool {
+	return k != nil && k.K >= kind.JobResultStart.K && k.K <= kind.JobResultEnd.K
+}
+
+// ResultKind is the kind of the results of jobs of kind k.
+func ResultKind(k *kind.T) *kind.T { return &kind.T{K: k.K + 1000} }
+
+// Input is an i tag of a job request.
+type Input struct {
+	// Value is the data, or a reference to it.
+	Value S
+	// Type is one of url, event, job or text.
+	Type S
+	// Relay is where an event or job input can be found.
+	Relay S
+	// Marker is how the job should use the input.
+	Marker S
+}
+
+// Param is a param tag of a job request.
+type Param struct {
+	Name   S
+	Values []S
+}
+
+// Job is a job request.
+type Job struct {
+	// Event is the signed request, once it is signed or parsed.
+	Event *event.T
+	// Kind is the job kind, between 5000 and 5999.
+	Kind   *kind.T
+	Inputs []Input
+	Params []Param
+	// Output is the MIME type the result should have.
+	Output S
+	// Bid is the most the customer will pay in millisatoshis.
+	Bid int64
+	// Relays are where the provider should publish feedback and results.
+	Relays []S
+	// Providers are the pubkeys of the service providers the customer wants the
+	// job done by, or empty for any.
+	Providers []B
+	// Encrypted hides the inputs and params from everyone but the one provider.
+	Encrypted bool
+}
+
+// Param returns the first value of the param with a name, or "".
+func (j *Job) Param(name S) S {
+	for _, p := range j.Params {
+		if p.Name == name && len(p.Values) > 0 {
+			return p.Values[0]
+		}
+	}
+	return ""
+}
+
+// Customer is the pubkey of the customer of a signed or parsed job.
+func (j *Job) Customer() B { return j.Event.PubKey }
+
+// For returns true if the job is for the provider with a pubkey.
+func (j *Job) For(provider B) bool {
+	if len(j.Providers) == 0 {
+		return true
+	}
+	for _, p := range j.Providers {
+		if Equals(p, provider) {
+			return true
+		}
+	}
+	return false
+}
+
+// private returns the i and param tags of the job.
+func (j *Job) private() (t []*tag.T) {
+	for _, in := range j.Inputs {
+		f := []S{"i", in.Value, in.Type}
+		if in.Relay != "" || in.Marker != "" {
+			f = append(f, in.Relay)
+		}
+		if in.Marker != "" {
+			f = append(f, in.Marker)
+		}
+		t = append(t, tag.New(f...))
+	}
+	for _, p := range j.Params {
+		t = append(t, tag.New(append([]S{"param", p.Name}, p.Values...)...))
+	}
+	return
+}
+
+// encrypt encodes tags as the JSON of an array of tags encrypted by signer to
+// pub.
+func encrypt(signer crypto.Signer, pub B, t []*tag.T) (content B, err E) {
+	var key B
+	if key, err = signer.ECDH(pub); Chk.E(err) {
+		return
+	}
+	var plain B
+	if plain, err = tags.New(t...).MarshalJSON(nil); Chk.E(err) {
+		return
+	}
+	return encryption.EncryptNip4(S(plain), key)
+}
+
+// decrypt reverses encrypt with the other key of the pair.
+func decrypt(signer crypto.Signer, pub, content B) (t *tags.T, err E) {
+	var key, plain B
+	if key, err = signer.ECDH(pub); Chk.E(err) {
+		return
+	}
+	if plain, err = encryption.DecryptNip4(S(content), key); err != nil {
+		return nil, Errorf.E("could not decrypt job: %w", err)
+	}
+	// a wrong key mostly gives garbage rather than an error.
+	if !json.Valid(plain) {
+		return nil, Errorf.E("could not decrypt job")
+	}
+	t = tags.New()
+	if _, err = t.UnmarshalJSON(plain); err != nil {
+		return nil, Errorf.E("invalid encrypted tags: %w", err)
+	}
+	return
+}
+
+// Sign creates the job request event and signs it. An encrypted job must have
+// exactly one provider.
+func (j *Job) Sign(signer crypto.Signer) (ev *event.T, err E) {
+	if !IsJob(j.Kind) {
+		return nil, Errorf.E("kind %v is not a job request kind", j.Kind)
+	}
+	t := tags.New()
+	private := j.private()
+	var content B
+	if j.Encrypted {
+		if len(j.Providers) != 1 {
+			return nil, Errorf.E("an encrypted job needs exactly one provider")
+		}
+		if content, err = encrypt(signer, j.Providers[0], private); err != nil {
+			return
+		}
+		t.T = append(t.T, tag.New("encrypted"))
+	} else {
+		t.T = append(t.T, private...)
+	}
+	if j.Output != "" {
+		t.T = append(t.T, tag.New("output", j.Output))
+	}
+	if j.Bid > 0 {
+		t.T = append(t.T, tag.New("bid", strconv.FormatInt(j.Bid, 10)))
+	}
+	if len(j.Relays) > 0 {
+		t.T = append(t.T, tag.New(append([]S{"relays"}, j.Relays...)...))
+	}
+	for _, p := range j.Providers {
+		t.T = append(t.T, tag.New("p", hex.Enc(p)))
+	}
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: j.Kind, Tags: t, Content: content}
+	if err = ev.Sign(signer); Chk.E(err) {
+		return
+	}
+	j.Event = ev
+	return
+}
+
+// ParseJob reads a job request. The i and param tags of an encrypted job are
+// decrypted with signer, the key of the provider it is for; signer may be nil
+// for jobs that are not encrypted.
+func ParseJob(ev *event.T, signer crypto.Signer) (j *Job, err E) {
+	if !IsJob(ev.Kind) {
+		return nil, Errorf.E("kind %v is not a job request kind", ev.Kind)
+	}
+	j = &Job{Event: ev, Kind: ev.Kind}
+	all := ev.Tags
+	if all == nil {
+		all = tags.New()
+	}
+	for _, t := range all.T {
+		if t == nil || t.Len() < 1 {
+			continue
+		}
+		f := t.ToStringSlice()
+		switch f[0] {
+		case "encrypted":
+			j.Encrypted = true
+		case "output":
+			if len(f) > 1 {
+				j.Output = f[1]
+			}
+		case "bid":
+			if len(f) > 1 {
+				if j.Bid, err = strconv.ParseInt(f[1], 10, 64); err != nil {
+					return nil, Errorf.E("invalid bid '%s'", f[1])
+				}
+			}
+		case "relays":
+			j.Relays = append(j.Relays, f[1:]...)
+		case "p":
+			var p B
+			if len(f) > 1 {
+				if p, err = hex.Dec(f[1]); err != nil || len(p) != 32 {
+					return nil, Errorf.E("invalid p tag '%s'", f[1])
+				}
+				j.Providers = append(j.Providers, p)
+			}
+		}
+	}
+	private := all
+	if j.Encrypted {
+		if signer == nil {
+			return nil, Errorf.E("job is encrypted")
+		}
+		if private, err = decrypt(signer, ev.PubKey, ev.Content); err != nil {
+			return
+		}
+	}
+	for _, t := range private.T {
+		if t == nil || t.Len() < 2 {
+			continue
+		}
+		f := t.ToStringSlice()
+		switch f[0] {
+		case "i":
+			in := Input{Value: f[1], Type: InputText}
+			if len(f) > 2 {
+				in.Type = f[2]
+			}
+			if len(f) > 3 {
+				in.Relay = f[3]
+			}
+			if len(f) > 4 {
+				in.Marker = f[4]
+			}
+			j.Inputs = append(j.Inputs, in)
+		case "param":
+			j.Params = append(j.Params, Param{Name: f[1], Values: f[2:]})
+		}
+	}
+	return
+}
+
+// amountTag is an amount tag, with an invoice if there is one.
+func amountTag(msat int64, invoice S) *tag.T {
+	if invoice == "" {
+		return tag.New("amount", strconv.FormatInt(msat, 10))
+	}
+	return tag.New("amount", strconv.FormatInt(msat, 10), invoice)
+}
+
+// parseAmount reads the amount tag of an event.
+func parseAmount(ev *event.T) (msat int64, invoice S, err E) {
+	t := ev.Tags.GetFirst(tag.New("amount"))
+	if t == nil || t.Len() < 2 {
+		return
+	}
+	f := t.ToStringSlice()
+	if msat, err = strconv.ParseInt(f[1], 10, 64); err != nil {
+		return 0, "", Errorf.E("invalid amount '%s'", f[1])
+	}
+	if len(f) > 2 {
+		invoice = f[2]
+	}
+	return
+}
+
+// reply creates a result or feedback event for a job, tagging the job and the
+// customer, and encrypting content if the job is encrypted.
+func reply(signer crypto.Signer, j *Job, k *kind.T, content S, t ...*tag.T) (ev *event.T,
+	err E) {
+
+	relay := ""
+	if len(j.Relays) > 0 {
+		relay = j.Relays[0]
+	}
+	t = append(t, tag.New("e", j.Event.IDString(), relay),
+		tag.New("p", hex.Enc(j.Customer())))
+	c := B(content)
+	if j.Encrypted && content != "" {
+		var key B
+		if key, err = signer.ECDH(j.Customer()); Chk.E(err) {
+			return
+		}
+		if c, err = encryption.EncryptNip4(content, key); Chk.E(err) {
+			return
+		}
+		t = append(t, tag.New("encrypted"))
+	}
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: k, Tags: tags.New(t...), Content: c}
+	if err = ev.Sign(signer); Chk.E(err) {
+		return
+	}
+	return
+}
+
+// NewResult creates the result event of a job. If msat is not zero the customer
+// is asked to pay it, with the invoice if there is one.
+func NewResult(signer crypto.Signer, j *Job, content S, msat int64, invoice S) (ev *event.T,
+	err E) {
+
+	t := []*tag.T{tag.New("request", S(j.Event.Serialize()))}
+	if !j.Encrypted {
+		t = append(t, j.private()[:len(j.Inputs)]...)
+	}
+	if msat > 0 {
+		t = append(t, amountTag(msat, invoice))
+	}
+	return reply(signer, j, ResultKind(j.Kind), content, t...)
+}
+
+// Feedback is a job feedback event.
+type Feedback struct {
+	Event *event.T
+	// Status is one of payment-required, processing, error, success or partial.
+	Status S
+	// Info is more about the status, for humans.
+	Info S
+	// MSat is the amount the provider asks for, if it does.
+	MSat int64
+	// Invoice is the bolt11 invoice to pay it with, if there is one.
+	Invoice S
+	// Content is a partial result, if the status is partial.
+	Content S
+}
+
+// NewFeedback creates the feedback event of a job.
+func NewFeedback(signer crypto.Signer, j *Job, f *Feedback) (ev *event.T, err E) {
+	status := tag.New("status", f.Status)
+	if f.Info != "" {
+		status = tag.New("status", f.Status, f.Info)
+	}
+	t := []*tag.T{status}
+	if f.MSat > 0 {
+		t = append(t, amountTag(f.MSat, f.Invoice))
+	}
+	return reply(signer, j, kind.JobFeedback, f.Content, t...)
+}
+
+// Result is a job result event.
+type Result struct {
+	Event *event.T
+	// Content is the output of the job.
+	Content S
+	// MSat is the amount the provider asks for, if it does.
+	MSat int64
+	// Invoice is the bolt11 invoice to pay it with, if there is one.
+	Invoice S
+}
+
+// open decrypts the content of a result or feedback event if it is encrypted,
+// with signer, the key of the customer.
+func open(signer crypto.Signer, ev *event.T) (content S, err E) {
+	if ev.Tags.GetFirst(tag.New("encrypted")) == nil {
+		return S(ev.Content), nil
+	}
+	if signer == nil {
+		return "", Errorf.E("event is encrypted")
+	}
+	var key, plain B
+	if key, err = signer.ECDH(ev.PubKey); Chk.E(err) {
+		return
+	}
+	if plain, err = encryption.DecryptNip4(S(ev.Content), key); err != nil {
+		return "", Errorf.E("could not decrypt: %w", err)
+	}
+	return S(plain), nil
+}
+
+// ParseFeedback reads a job feedback event, decrypting it with signer if it is
+// encrypted.
+func ParseFeedback(ev *event.T, signer crypto.Signer) (f *Feedback, err E) {
+	if ev.Kind == nil || !ev.Kind.Equal(kind.JobFeedback) {
+		return nil, Errorf.E("event is not job feedback")
+	}
+	t := ev.Tags.GetFirst(tag.New("status"))
+	if t == nil || t.Len() < 2 {
+		return nil, Errorf.E("job feedback has no status")
+	}
+	f = &Feedback{Event: ev, Status: S(t.Value())}
+	if t.Len() > 2 {
+		f.Info = t.ToStringSlice()[2]
+	}
+	if f.MSat, f.Invoice, err = parseAmount(ev); err != nil {
+		return nil, err
+	}
+	if f.Content, err = open(signer, ev); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// ParseResult reads a job result event, decrypting it with signer if it is
+// encrypted.
+func ParseResult(ev *event.T, signer crypto.Signer) (r *Result, err E) {
+	if !IsResult(ev.Kind) {
+		return nil, Errorf.E("kind %v is not a job result kind", ev.Kind)
+	}
+	r = &Result{Event: ev}
+	if r.MSat, r.Invoice, err = parseAmount(ev); err != nil {
+		return nil, err
+	}
+	if r.Content, err = open(signer, ev); err != nil {
+		return nil, err
+	}
+	return
+}
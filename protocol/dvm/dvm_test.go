@@ -0,0 +1,158 @@
+package dvm
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tests"
+	"nostr.mleku.dev/protocol/relaytest"
+	"nostr.mleku.dev/protocol/ws"
+	"util.mleku.dev/context"
+)
+
+var translate = &kind.T{K: 5002}
+
+func TestJob(t *testing.T) {
+	keys := tests.Signers(t, 3)
+	customer, provider, other := keys[0], keys[1], keys[2]
+	for _, encrypted := range []bool{false, true} {
+		j := &Job{Kind: translate, Output: "text/plain", Bid: 5000,
+			Relays:    []S{"wss://relay.example.com"},
+			Providers: []B{provider.Pub()}, Encrypted: encrypted,
+			Inputs: []Input{{Value: "hola mundo", Type: InputText},
+				{Value: strings.Repeat("ab", 32), Type: InputEvent,
+					Relay: "wss://r.example.com", Marker: "source"}},
+			Params: []Param{{Name: "lang", Values: []S{"en"}}}}
+		ev, err := j.Sign(customer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got *Job
+		if got, err = ParseJob(ev, provider); err != nil {
+			t.Fatal(err)
+		}
+		if got.Encrypted != encrypted || got.Bid != 5000 || got.Output != "text/plain" ||
+			len(got.Inputs) != 2 || got.Inputs[1] != j.Inputs[1] || got.Param("lang") != "en" ||
+			!got.For(provider.Pub()) || got.For(other.Pub()) || len(got.Relays) != 1 {
+			t.Fatalf("got %+v", got)
+		}
+		if _, err = ParseJob(ev, other); encrypted && err == nil {
+			t.Fatal("another provider should not decrypt the job")
+		}
+		var res *event.T
+		if res, err = NewResult(provider, got, "hello world", 2000, "lnbc1"); err != nil {
+			t.Fatal(err)
+		}
+		if !res.Kind.Equal(&kind.T{K: 6002}) {
+			t.Fatalf("result kind %d", res.Kind.K)
+		}
+		if encrypted == strings.Contains(S(res.Content), "hello") {
+			t.Fatalf("result content %s", res.Content)
+		}
+		var r *Result
+		if r, err = ParseResult(res, customer); err != nil {
+			t.Fatal(err)
+		}
+		if r.Content != "hello world" || r.MSat != 2000 || r.Invoice != "lnbc1" {
+			t.Fatalf("got %+v", r)
+		}
+		req := res.Tags.GetFirst(tag.New("request"))
+		if req == nil || S(req.Value()) != S(ev.Serialize()) {
+			t.Fatal("result has no request tag")
+		}
+	}
+}
+
+// payments charges 1000 msat for every job, which is paid when paid is closed.
+type payments struct{ paid chan struct{} }
+
+func (p *payments) Invoice(c Ctx, j *Job) (msat int64, invoice S, err E) {
+	return 1000, "lnbc10n1fake", nil
+}
+
+func (p *payments) Wait(c Ctx, invoice S) (err E) {
+	select {
+	case <-p.paid:
+		return
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+func TestService(t *testing.T) {
+	c, cancel := context.Timeout(context.Bg(), 20*time.Second)
+	defer cancel()
+	relay := relaytest.New()
+	defer relay.Close()
+	pool := ws.NewSimplePool(c)
+	keys := tests.Signers(t, 3)
+	upperKey, reverseKey, clientKey := keys[0], keys[1], keys[2]
+	upper := NewService(upperKey, pool, relay.URL)
+	upper.Handle(translate, func(c Ctx, j *Job) (S, E) {
+		return strings.ToUpper(j.Inputs[0].Value), nil
+	})
+	reverse := NewService(reverseKey, pool, relay.URL)
+	reverse.Payments = &payments{paid: make(chan struct{})}
+	reverse.PayFirst = true
+	reverse.Handle(translate, func(c Ctx, j *Job) (S, E) {
+		r := []rune(j.Inputs[0].Value)
+		for i, k := 0, len(r)-1; i < k; i, k = i+1, k-1 {
+			r[i], r[k] = r[k], r[i]
+		}
+		return S(r), nil
+	})
+	go upper.Serve(c)
+	go reverse.Serve(c)
+	time.Sleep(100 * time.Millisecond)
+	cl := NewClient(clientKey, pool, relay.URL)
+	j := &Job{Kind: translate, Inputs: []Input{{Value: "abc", Type: InputText}}}
+	if err := cl.Submit(c, j); err != nil {
+		t.Fatal(err)
+	}
+	// the reverse provider asks to be paid first.
+	var paid bool
+	results := make(map[S]S)
+	for u := range cl.Watch(c, j) {
+		if f := u.Feedback; f != nil && f.Status == PaymentRequired && !paid {
+			if !Equals(u.Provider, reverse.PubKey()) || f.MSat != 1000 ||
+				f.Invoice != "lnbc10n1fake" {
+				t.Fatalf("unexpected feedback %+v", f)
+			}
+			paid = true
+			close(reverse.Payments.(*payments).paid)
+		}
+		if u.Result != nil {
+			results[S(u.Provider)] = u.Result.Content
+		}
+		if len(results) == 2 {
+			break
+		}
+	}
+	if !paid || results[S(upper.PubKey())] != "ABC" ||
+		results[S(reverse.PubKey())] != "cba" {
+		t.Fatalf("got results %v, paid %v", results, paid)
+	}
+	// an encrypted job goes to its one provider.
+	j = &Job{Kind: translate, Inputs: []Input{{Value: "secret", Type: InputText}},
+		Providers: []B{upper.PubKey()}, Encrypted: true}
+	if err := cl.Submit(c, j); err != nil {
+		t.Fatal(err)
+	}
+	got := cl.Collect(c, j, 1)
+	if len(got) != 1 || !Equals(got[0].Provider, upper.PubKey()) ||
+		got[0].Result.Content != "SECRET" {
+		t.Fatalf("got %+v", got)
+	}
+	for _, ev := range relay.Events() {
+		if strings.Contains(S(ev.Content), "secret") ||
+			strings.Contains(S(ev.Content), "SECRET") {
+			t.Fatalf("event %s is not encrypted", ev.Serialize())
+		}
+	}
+}
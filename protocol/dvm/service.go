@@ -0,0 +1,176 @@
+package dvm
+
+import (
+	"sync"
+	"time"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/filters"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/protocol/ws"
+	"util.mleku.dev/context"
+)
+
+// Handler does a job and returns its output.
+type Handler func(c Ctx, j *Job) (output S, err E)
+
+// Payments prices jobs and tells when they are paid.
+type Payments interface {
+	// Invoice returns the price of a job in millisatoshis and an invoice for it.
+	// A price of zero means the job is free.
+	Invoice(c Ctx, j *Job) (msat int64, invoice S, err E)
+	// Wait returns once the invoice is paid, or an error if the context is done
+	// first.
+	Wait(c Ctx, invoice S) (err E)
+}
+
+// Service is a data vending machine, which does the jobs of the kinds it has
+// handlers for.
+type Service struct {
+	// Relays are where the service listens for jobs, and publishes its feedback
+	// and results as well as to the relays the jobs ask for.
+	Relays []S
+	// Payments prices jobs, or nil if they are free.
+	Payments Payments
+	// PayFirst asks for payment before doing a job. Otherwise the result asks for
+	// it.
+	PayFirst bool
+	// PaymentTimeout is how long a job that must be paid first waits for it.
+	PaymentTimeout time.Duration
+	signer         crypto.Signer
+	pool           *ws.SimplePool
+	mx             sync.RWMutex
+	handlers       map[uint16]Handler
+}
+
+// NewService creates a data vending machine that signs with signer and reaches
+// relays through pool.
+func NewService(signer crypto.Signer, pool *ws.SimplePool, relays ...S) *Service {
+	return &Service{Relays: relays, PaymentTimeout: 10 * time.Minute, signer: signer,
+		pool: pool, handlers: make(map[uint16]Handler)}
+}
+
+// PubKey is the pubkey of the service provider.
+func (s *Service) PubKey() B { return s.signer.Pub() }
+
+// Handle registers the handler of jobs of kind k.
+func (s *Service) Handle(k *kind.T, h Handler) (err E) {
+	if !IsJob(k) {
+		return Errorf.E("kind %v is not a job request kind", k)
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.handlers[k.K] = h
+	return
+}
+
+func (s *Service) handler(k *kind.T) (h Handler) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return s.handlers[k.K]
+}
+
+// Serve subscribes to the jobs of the kinds with handlers, from now on, and does
+// each in its own goroutine until the context is done.
+func (s *Service) Serve(c Ctx) (err E) {
+	f := filter.New()
+	f.Kinds = kinds.NewWithCap(0)
+	s.mx.RLock()
+	for k := range s.handlers {
+		f.Kinds.K = append(f.Kinds.K, &kind.T{K: k})
+	}
+	s.mx.RUnlock()
+	if f.Kinds.Len() == 0 {
+		return Errorf.E("no job handlers")
+	}
+	f.Since = timestamp.Now()
+	for ie := range s.pool.SubMany(c, s.Relays, filters.New(f)) {
+		var j *Job
+		if j, err = ParseJob(ie.Event, s.signer); err != nil {
+			Log.D.F("job %0x: %v", ie.Event.ID, err)
+			continue
+		}
+		if !j.For(s.PubKey()) {
+			continue
+		}
+		go s.Do(c, j)
+	}
+	return c.Err()
+}
+
+// Do does a job, publishing its feedback and result.
+func (s *Service) Do(c Ctx, j *Job) {
+	h := s.handler(j.Kind)
+	if h == nil {
+		return
+	}
+	var err E
+	var msat int64
+	var invoice S
+	if s.Payments != nil {
+		if msat, invoice, err = s.Payments.Invoice(c, j); err != nil {
+			s.feedback(c, j, &Feedback{Status: Error, Info: err.Error()})
+			return
+		}
+		if j.Bid > 0 && msat > j.Bid {
+			// the customer won't pay this much.
+			return
+		}
+	}
+	if msat > 0 && s.PayFirst {
+		s.feedback(c, j, &Feedback{Status: PaymentRequired, MSat: msat, Invoice: invoice})
+		pc, cancel := context.Timeout(c, s.PaymentTimeout)
+		err = s.Payments.Wait(pc, invoice)
+		cancel()
+		if err != nil {
+			s.feedback(c, j, &Feedback{Status: Error, Info: "not paid"})
+			return
+		}
+		msat, invoice = 0, ""
+	}
+	s.feedback(c, j, &Feedback{Status: Processing})
+	var output S
+	if output, err = h(c, j); err != nil {
+		s.feedback(c, j, &Feedback{Status: Error, Info: err.Error()})
+		return
+	}
+	var ev *event.T
+	if ev, err = NewResult(s.signer, j, output, msat, invoice); Chk.E(err) {
+		return
+	}
+	s.publish(c, j, ev)
+	s.feedback(c, j, &Feedback{Status: Success})
+}
+
+func (s *Service) feedback(c Ctx, j *Job, f *Feedback) {
+	ev, err := NewFeedback(s.signer, j, f)
+	if Chk.E(err) {
+		return
+	}
+	s.publish(c, j, ev)
+}
+
+// publish sends an event to the relays of the service and of the job.
+func (s *Service) publish(c Ctx, j *Job, ev *event.T) {
+	seen := make(map[S]bool)
+	for _, u := range append(append([]S{}, s.Relays...), j.Relays...) {
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		r, err := s.pool.EnsureRelay(u)
+		if err != nil {
+			Log.D.F("could not connect to %s: %v", u, err)
+			continue
+		}
+		if err = r.Publish(c, ev); err != nil {
+			Log.D.F("could not publish %0x to %s: %v", ev.ID, u, err)
+		}
+	}
+}
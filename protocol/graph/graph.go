@@ -0,0 +1,303 @@
+// Package graph is a social graph of the follow lists (kind 3) and mute lists
+// (kind 10000) of pubkeys, with queries for follows, followers and distances,
+// and web of trust scores computed with personalized PageRank.
+package graph
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"util.mleku.dev/hex"
+)
+
+type key = [32]byte
+
+// list is the latest replaceable list event of a pubkey.
+type list struct {
+	at int64
+	id key
+}
+
+// newer returns true if the event with created_at and id replaces the list.
+func (l *list) newer(at int64, id key) bool {
+	if l.at == 0 {
+		return true
+	}
+	if at != l.at {
+		return at > l.at
+	}
+	// NIP-01 keeps the lowest id when they were created at once.
+	return bytes.Compare(id[:], l.id[:]) < 0
+}
+
+// edges are the sorted indexes of the pubkeys a pubkey has an edge to.
+type edges []uint32
+
+func (e edges) find(i uint32) (int, bool) {
+	n := sort.Search(len(e), func(j int) bool { return e[j] >= i })
+	return n, n < len(e) && e[n] == i
+}
+
+func (e edges) has(i uint32) bool { _, ok := e.find(i); return ok }
+
+func (e edges) add(i uint32) edges {
+	n, ok := e.find(i)
+	if ok {
+		return e
+	}
+	e = append(e, 0)
+	copy(e[n+1:], e[n:])
+	e[n] = i
+	return e
+}
+
+func (e edges) remove(i uint32) edges {
+	n, ok := e.find(i)
+	if !ok {
+		return e
+	}
+	return append(e[:n], e[n+1:]...)
+}
+
+// T is a social graph. Pubkeys are numbered as they are first seen, and edges
+// are kept as sorted slices of these numbers in both directions. It is safe for
+// concurrent use.
+type T struct {
+	mx        sync.RWMutex
+	index     map[key]uint32
+	keys      []key
+	follows   []edges
+	followers []edges
+	mutes     []edges
+	muters    []edges
+	followsAt []list
+	mutesAt   []list
+}
+
+// New creates an empty graph.
+func New() *T { return &T{index: make(map[key]uint32)} }
+
+// node returns the number of a pubkey, adding it if it is new and add is true.
+func (g *T) node(pub B, add bool) (i uint32, ok bool) {
+	if len(pub) != 32 {
+		return
+	}
+	k := key(pub)
+	if i, ok = g.index[k]; ok || !add {
+		return
+	}
+	i = uint32(len(g.keys))
+	g.index[k] = i
+	g.keys = append(g.keys, k)
+	g.follows, g.followers = append(g.follows, nil), append(g.followers, nil)
+	g.mutes, g.muters = append(g.mutes, nil), append(g.muters, nil)
+	g.followsAt, g.mutesAt = append(g.followsAt, list{}), append(g.mutesAt, list{})
+	return i, true
+}
+
+// Add ingests a follow or mute list event, which replaces the list of its author
+// if it is newer. Signatures are not checked, so events must be verified first.
+// It returns false if the event was older than the list in the graph.
+func (g *T) Add(ev *event.T) (updated bool, err E) {
+	if ev.Kind == nil {
+		return false, Errorf.E("event has no kind")
+	}
+	follow := ev.Kind.Equal(kind.FollowList)
+	if !follow && !ev.Kind.Equal(kind.MuteList) {
+		return false, Errorf.E("kind %d is not a follow or mute list", ev.Kind.K)
+	}
+	if len(ev.PubKey) != 32 || len(ev.ID) != 32 || ev.CreatedAt == nil {
+		return false, Errorf.E("event has no valid pubkey, id and created_at")
+	}
+	targets := listed(ev)
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	// a stale list must not add its pubkeys to the graph, so it is checked
+	// before they are.
+	if author, ok := g.node(ev.PubKey, false); ok {
+		at := g.mutesAt
+		if follow {
+			at = g.followsAt
+		}
+		if !at[author].newer(ev.CreatedAt.I64(), key(ev.ID)) {
+			return
+		}
+	}
+	author, _ := g.node(ev.PubKey, true)
+	var ts edges
+	for _, t := range targets {
+		if i, _ := g.node(t, true); i != author {
+			ts = ts.add(i)
+		}
+	}
+	// adding pubkeys grows the slices, so they are only taken after it.
+	out, in, at := g.mutes, g.muters, g.mutesAt
+	if follow {
+		out, in, at = g.follows, g.followers, g.followsAt
+	}
+	at[author] = list{ev.CreatedAt.I64(), key(ev.ID)}
+	for _, i := range out[author] {
+		in[i] = in[i].remove(author)
+	}
+	for _, i := range ts {
+		in[i] = in[i].add(author)
+	}
+	out[author] = ts
+	return true, nil
+}
+
+// listed returns the pubkeys of the p tags of an event.
+func listed(ev *event.T) (pubs []B) {
+	if ev.Tags == nil {
+		return
+	}
+	for _, t := range ev.Tags.T {
+		if t == nil || t.Len() < 2 || !Equals(t.Key(), B("p")) {
+			continue
+		}
+		if pub, err := hex.Dec(S(t.Value())); err == nil && len(pub) == 32 {
+			pubs = append(pubs, pub)
+		}
+	}
+	return
+}
+
+// Len is the number of pubkeys in the graph.
+func (g *T) Len() int {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	return len(g.keys)
+}
+
+// pub returns a copy of the pubkey with number i.
+func (g *T) pub(i uint32) B { return append(B{}, g.keys[i][:]...) }
+
+func (g *T) pubkeys(e edges) (pubs []B) {
+	pubs = make([]B, len(e))
+	for n, i := range e {
+		pubs[n] = g.pub(i)
+	}
+	return
+}
+
+func (g *T) get(pub B, adj func() []edges) (pubs []B) {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	if i, ok := g.node(pub, false); ok {
+		pubs = g.pubkeys(adj()[i])
+	}
+	return
+}
+
+// Follows returns the pubkeys that pub follows.
+func (g *T) Follows(pub B) []B { return g.get(pub, func() []edges { return g.follows }) }
+
+// Followers returns the pubkeys that follow pub.
+func (g *T) Followers(pub B) []B { return g.get(pub, func() []edges { return g.followers }) }
+
+// Mutes returns the pubkeys that pub mutes.
+func (g *T) Mutes(pub B) []B { return g.get(pub, func() []edges { return g.mutes }) }
+
+// Muters returns the pubkeys that mute pub.
+func (g *T) Muters(pub B) []B { return g.get(pub, func() []edges { return g.muters }) }
+
+// Mutual returns the pubkeys that pub follows and that follow pub.
+func (g *T) Mutual(pub B) (pubs []B) {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	i, ok := g.node(pub, false)
+	if !ok {
+		return
+	}
+	for _, j := range g.follows[i] {
+		if g.follows[j].has(i) {
+			pubs = append(pubs, g.pub(j))
+		}
+	}
+	return
+}
+
+// IsFollowing returns true if a follows b.
+func (g *T) IsFollowing(a, b B) bool {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	i, ok := g.node(a, false)
+	j, ok2 := g.node(b, false)
+	return ok && ok2 && g.follows[i].has(j)
+}
+
+// IsMuting returns true if a mutes b.
+func (g *T) IsMuting(a, b B) bool {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	i, ok := g.node(a, false)
+	j, ok2 := g.node(b, false)
+	return ok && ok2 && g.mutes[i].has(j)
+}
+
+// bfs calls fn with each pubkey reachable by follows from a start pubkey, nearest
+// first, down to max hops, until fn returns false.
+func (g *T) bfs(from uint32, max N, fn func(i uint32, d N) bool) {
+	seen := map[uint32]bool{from: true}
+	frontier := []uint32{from}
+	for d := 1; d <= max && len(frontier) > 0; d++ {
+		var next []uint32
+		for _, i := range frontier {
+			for _, j := range g.follows[i] {
+				if seen[j] {
+					continue
+				}
+				seen[j] = true
+				if !fn(j, d) {
+					return
+				}
+				next = append(next, j)
+			}
+		}
+		frontier = next
+	}
+}
+
+// Distance returns the number of follows from one pubkey to another, or -1 if it
+// is more than max.
+func (g *T) Distance(from, to B, max N) (d N) {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	i, ok := g.node(from, false)
+	j, ok2 := g.node(to, false)
+	if !ok || !ok2 {
+		return -1
+	}
+	if i == j {
+		return 0
+	}
+	d = -1
+	g.bfs(i, max, func(k uint32, dist N) bool {
+		if k == j {
+			d = dist
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// Within returns the pubkeys that are at most n follows from pub, nearest first.
+func (g *T) Within(pub B, n N) (pubs []B) {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	i, ok := g.node(pub, false)
+	if !ok {
+		return
+	}
+	g.bfs(i, n, func(k uint32, _ N) bool {
+		pubs = append(pubs, g.pub(k))
+		return true
+	})
+	return
+}
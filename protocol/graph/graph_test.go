@@ -0,0 +1,141 @@
+package graph
+
+import (
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"util.mleku.dev/hex"
+)
+
+func pk(b byte) B { return append(make(B, 31), b) }
+
+var idCounter byte
+
+func newList(k *kind.T, author byte, at int64, targets ...byte) *event.T {
+	idCounter++
+	ev := &event.T{ID: append(make(B, 31), idCounter), PubKey: pk(author), Kind: k,
+		CreatedAt: timestamp.FromUnix(at), Tags: tags.New()}
+	for _, t := range targets {
+		ev.Tags.T = append(ev.Tags.T, tag.New("p", hex.Enc(pk(t))))
+	}
+	return ev
+}
+
+func has(pubs []B, b byte) bool {
+	for _, p := range pubs {
+		if Equals(p, pk(b)) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGraph(t *testing.T) {
+	g := New()
+	for _, ev := range []*event.T{
+		newList(kind.FollowList, 1, 10, 2, 3),
+		newList(kind.FollowList, 2, 10, 1, 4),
+		newList(kind.FollowList, 4, 10, 5, 4),
+		newList(kind.MuteList, 1, 10, 5),
+	} {
+		if ok, err := g.Add(ev); err != nil || !ok {
+			t.Fatalf("failed to add: %v", err)
+		}
+	}
+	n := g.Len()
+	if ok, _ := g.Add(newList(kind.FollowList, 1, 9, 6)); ok {
+		t.Fatal("an older follow list replaced a newer one")
+	}
+	if g.Len() != n {
+		t.Fatal("an older follow list added its pubkeys to the graph")
+	}
+	if _, err := g.Add(newList(kind.TextNote, 1, 9)); err == nil {
+		t.Fatal("expected an error for a text note")
+	}
+	if f := g.Follows(pk(1)); len(f) != 2 || !has(f, 2) || !has(f, 3) {
+		t.Fatalf("unexpected follows %0x", f)
+	}
+	if f := g.Followers(pk(1)); len(f) != 1 || !has(f, 2) {
+		t.Fatalf("unexpected followers %0x", f)
+	}
+	// a self follow is ignored.
+	if f := g.Follows(pk(4)); len(f) != 1 || !has(f, 5) {
+		t.Fatalf("unexpected follows %0x", f)
+	}
+	if m := g.Mutual(pk(1)); len(m) != 1 || !has(m, 2) {
+		t.Fatalf("unexpected mutuals %0x", m)
+	}
+	if !g.IsMuting(pk(1), pk(5)) || !has(g.Muters(pk(5)), 1) {
+		t.Fatal("expected 1 to mute 5")
+	}
+	for _, v := range []struct {
+		from, to byte
+		max, d   N
+	}{{1, 1, 3, 0}, {1, 2, 3, 1}, {1, 4, 3, 2}, {1, 5, 3, 3}, {1, 5, 2, -1},
+		{3, 1, 3, -1}, {1, 9, 3, -1}} {
+		if d := g.Distance(pk(v.from), pk(v.to), v.max); d != v.d {
+			t.Fatalf("distance from %d to %d is %d, expected %d", v.from, v.to, d, v.d)
+		}
+	}
+	if w := g.Within(pk(1), 2); len(w) != 3 || !Equals(w[2], pk(4)) {
+		t.Fatalf("unexpected pubkeys within 2 %0x", w)
+	}
+	// a newer list replaces the edges in both directions.
+	if ok, _ := g.Add(newList(kind.FollowList, 1, 11, 4)); !ok {
+		t.Fatal("a newer follow list did not replace an older one")
+	}
+	if has(g.Followers(pk(2)), 1) || !has(g.Followers(pk(4)), 1) {
+		t.Fatal("the followers were not updated")
+	}
+}
+
+func TestRank(t *testing.T) {
+	g := New()
+	// 1 and 2 follow each other and 3, 3 follows 4, 5 follows 6 which nobody
+	// trusted knows, and 1 mutes 4.
+	for _, ev := range []*event.T{
+		newList(kind.FollowList, 1, 10, 2, 3),
+		newList(kind.FollowList, 2, 10, 1, 3),
+		newList(kind.FollowList, 3, 10, 4),
+		newList(kind.FollowList, 5, 10, 6),
+	} {
+		g.Add(ev)
+	}
+	o := DefaultRankOptions
+	o.MutePenalty = 0
+	s := g.Rank([]B{pk(1)}, &o)
+	var sum float64
+	for i := byte(1); i <= 6; i++ {
+		sum += s.Of(pk(i))
+	}
+	if sum < 0.999 || sum > 1.001 {
+		t.Fatalf("scores add up to %f", sum)
+	}
+	if s.Of(pk(5)) != 0 || s.Of(pk(6)) != 0 {
+		t.Fatal("pubkeys outside the web of trust have a score")
+	}
+	if !(s.Of(pk(1)) > s.Of(pk(3)) && s.Of(pk(3)) > s.Of(pk(4)) && s.Of(pk(4)) > 0) {
+		t.Fatalf("unexpected scores %v", s.Top(10))
+	}
+	if top := s.Top(2); len(top) != 2 || !Equals(top[0].PubKey, pk(1)) {
+		t.Fatalf("unexpected top %v", top)
+	}
+	if top := s.Top(-1); len(top) != 0 {
+		t.Fatalf("unexpected top %v", top)
+	}
+	g.Add(newList(kind.MuteList, 1, 10, 4))
+	muted := g.Rank([]B{pk(1)}, nil)
+	if muted.Of(pk(4)) >= s.Of(pk(4)) {
+		t.Fatal("muting did not lower the score")
+	}
+	policy := muted.Policy(0.01)
+	if !policy(&event.T{PubKey: pk(2)}) || policy(&event.T{PubKey: pk(5)}) {
+		t.Fatal("unexpected policy")
+	}
+}
@@ -0,0 +1,158 @@
+package graph
+
+import (
+	"bytes"
+	"math"
+	"sort"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+)
+
+// RankOptions are the parameters of Rank.
+type RankOptions struct {
+	// Damping is the chance of following a follow rather than going back to the
+	// seeds.
+	Damping float64
+	// Iterations is the most rounds of the computation.
+	Iterations N
+	// Tolerance stops the computation once the scores change by less than it.
+	Tolerance float64
+	// MutePenalty scales how much of the score of each muter, shared out among
+	// the pubkeys they mute, is taken from them.
+	MutePenalty float64
+}
+
+// DefaultRankOptions are the options used when Rank is given none.
+var DefaultRankOptions = RankOptions{Damping: 0.85, Iterations: 50, Tolerance: 1e-9,
+	MutePenalty: 1}
+
+// Scores are web of trust scores of the pubkeys of a graph, which add up to at
+// most 1.
+type Scores struct {
+	g     *T
+	score []float64
+}
+
+// Score is the score of a pubkey.
+type Score struct {
+	PubKey B
+	Value  float64
+}
+
+// Rank computes personalized PageRank scores from the point of view of the seed
+// pubkeys, which are trusted: each round, a pubkey passes the share of its score
+// that is damped on to the pubkeys it follows, and the rest goes back to the
+// seeds. Then each pubkey loses a share of the scores of those that mute it.
+// The scores are a snapshot, and don't change when the graph does.
+func (g *T) Rank(seeds []B, o *RankOptions) (s *Scores) {
+	if o == nil {
+		o = &DefaultRankOptions
+	}
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+	n := len(g.keys)
+	s = &Scores{g: g, score: make([]float64, n)}
+	var start []uint32
+	for _, pub := range seeds {
+		if i, ok := g.node(pub, false); ok {
+			start = append(start, i)
+		}
+	}
+	if len(start) == 0 {
+		return
+	}
+	teleport := 1 / float64(len(start))
+	for _, i := range start {
+		s.score[i] += teleport
+	}
+	next := make([]float64, n)
+	for round := 0; round < o.Iterations; round++ {
+		for i := range next {
+			next[i] = 0
+		}
+		// the score of pubkeys that follow nobody goes back to the seeds.
+		returned := 1 - o.Damping
+		for i, f := range g.follows {
+			if len(f) == 0 {
+				returned += o.Damping * s.score[i]
+				continue
+			}
+			share := o.Damping * s.score[i] / float64(len(f))
+			for _, j := range f {
+				next[j] += share
+			}
+		}
+		for _, i := range start {
+			next[i] += returned * teleport
+		}
+		var delta float64
+		for i := range next {
+			delta += math.Abs(next[i] - s.score[i])
+		}
+		s.score, next = next, s.score
+		if delta < o.Tolerance {
+			break
+		}
+	}
+	if o.MutePenalty > 0 {
+		penalty := make([]float64, n)
+		for i, m := range g.mutes {
+			if len(m) == 0 {
+				continue
+			}
+			share := o.MutePenalty * s.score[i] / float64(len(m))
+			for _, j := range m {
+				penalty[j] += share
+			}
+		}
+		for i := range s.score {
+			if s.score[i] -= penalty[i]; s.score[i] < 0 {
+				s.score[i] = 0
+			}
+		}
+	}
+	return
+}
+
+// Of returns the score of a pubkey, zero if it is not in the graph.
+func (s *Scores) Of(pub B) float64 {
+	s.g.mx.RLock()
+	defer s.g.mx.RUnlock()
+	if i, ok := s.g.node(pub, false); ok && int(i) < len(s.score) {
+		return s.score[i]
+	}
+	return 0
+}
+
+// Top returns the n pubkeys with the highest scores, highest first, leaving out
+// those with none.
+func (s *Scores) Top(n N) (top []Score) {
+	if n <= 0 {
+		return
+	}
+	s.g.mx.RLock()
+	defer s.g.mx.RUnlock()
+	for i, v := range s.score {
+		if v > 0 {
+			top = append(top, Score{s.g.pub(uint32(i)), v})
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Value != top[j].Value {
+			return top[i].Value > top[j].Value
+		}
+		return bytes.Compare(top[i].PubKey, top[j].PubKey) < 0
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return
+}
+
+// Policy returns a write policy for a relay that accepts events whose authors
+// have a score of at least min.
+func (s *Scores) Policy(min float64) func(ev *event.T) bool {
+	return func(ev *event.T) bool { return s.Of(ev.PubKey) >= min }
+}
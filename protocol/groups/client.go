@@ -0,0 +1,90 @@
+package groups
+
+import (
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/filters"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/protocol/ws"
+)
+
+// Client joins, leaves, reads and posts to the groups of one relay.
+type Client struct {
+	// RelayPubKey is the pubkey the relay signs the state of its groups with. If
+	// it is set, state signed by anyone else is ignored.
+	RelayPubKey B
+	signer      crypto.Signer
+	relay       *ws.Client
+}
+
+// NewClient creates a client for the user signer of the groups on relay.
+func NewClient(signer crypto.Signer, relay *ws.Client) *Client {
+	return &Client{signer: signer, relay: relay}
+}
+
+// Publish signs an event, such as one made by PutUser or EditMetadata, and
+// publishes it to the relay. The error says why if the relay rejects it.
+func (cl *Client) Publish(c Ctx, ev *event.T) (err E) {
+	if err = ev.Sign(cl.signer); Chk.E(err) {
+		return
+	}
+	return cl.relay.Publish(c, ev)
+}
+
+// Join asks to join a group, with the invite code of a closed group if it is
+// one.
+func (cl *Client) Join(c Ctx, group, reason, code S) (err E) {
+	ev := message(kind.GroupJoinRequest, group, reason)
+	if code != "" {
+		ev.Tags.T = append(ev.Tags.T, tag.New("code", code))
+	}
+	return cl.Publish(c, ev)
+}
+
+// Leave asks to leave a group.
+func (cl *Client) Leave(c Ctx, group, reason S) (err E) {
+	return cl.Publish(c, message(kind.GroupLeaveRequest, group, reason))
+}
+
+// Post posts an event of kind k to a group, such as a kind.ChatMessage.
+func (cl *Client) Post(c Ctx, group S, k *kind.T, content S, t ...*tag.T) (ev *event.T,
+	err E) {
+	ev = message(k, group, content, t...)
+	if err = cl.Publish(c, ev); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Group fetches the state of a group from the relay.
+func (cl *Client) Group(c Ctx, group S) (g *Group, err E) {
+	f := filter.New()
+	f.Kinds = kinds.New(kind.GroupMetadata, kind.GroupAdmins, kind.GroupMembers,
+		kind.GroupRoles)
+	f.Tags = tags.New(tag.New("#d", group))
+	if cl.RelayPubKey != nil {
+		f.Authors = tag.New(cl.RelayPubKey)
+	}
+	var evs []*event.T
+	if evs, err = cl.relay.QuerySync(c, f); err != nil {
+		return
+	}
+	return FromEvents(group, evs...)
+}
+
+// Subscribe subscribes to the events posted to a group, of kinds kk or of any
+// kind if none are given.
+func (cl *Client) Subscribe(c Ctx, group S, kk ...*kind.T) (sub *ws.Subscription, err E) {
+	f := filter.New()
+	if len(kk) > 0 {
+		f.Kinds = kinds.New(kk...)
+	}
+	f.Tags = tags.New(tag.New("#h", group))
+	return cl.relay.Subscribe(c, filters.New(f))
+}
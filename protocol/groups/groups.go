@@ -0,0 +1,402 @@
+// Package groups implements NIP-29 relay-based groups. A group lives on one
+// relay, which keeps its state and publishes it as kinds 39000 to 39003, signed
+// with its own key. Users post to a group with an h tag naming it, and admins
+// change it with moderation events of kinds 9000 to 9020, which the relay checks
+// against the permissions of their roles.
+package groups
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"util.mleku.dev/hex"
+)
+
+// ID is the identifier of a group, written as host'local. The local part is the
+// id the relay knows the group by, and what h tags name.
+type ID struct {
+	Host, Local S
+}
+
+// ParseID reads a group identifier. An identifier without a local part is the
+// top level group of the host, "_".
+func ParseID(s S) (id *ID, err E) {
+	host, local, found := strings.Cut(s, "'")
+	if !found {
+		local = "_"
+	}
+	if host == "" || local == "" {
+		return nil, Errorf.E("invalid group identifier %q", s)
+	}
+	return &ID{Host: host, Local: local}, nil
+}
+
+func (id *ID) String() S { return id.Host + "'" + id.Local }
+
+// IsModeration returns true if k is a group moderation kind.
+func IsModeration(k *kind.T) bool { return k.K >= 9000 && k.K <= 9020 }
+
+// IsState returns true if k is one of the kinds a relay publishes the state of
+// a group as.
+func IsState(k *kind.T) bool {
+	return k.K >= kind.GroupMetadata.K && k.K <= kind.GroupRoles.K
+}
+
+// Of returns the group an event is posted to, from its h tag, or "" if it has
+// none.
+func Of(ev *event.T) S {
+	if ev.Tags == nil {
+		return ""
+	}
+	if t := ev.Tags.GetFirst(tag.New("h")); t != nil && t.Len() > 1 {
+		return S(t.Value())
+	}
+	return ""
+}
+
+// Role is a role members of a group can be given. Permissions are the
+// moderation kinds it allows; they are relay policy and are not published.
+type Role struct {
+	Name, Description S
+	Permissions       []*kind.T
+}
+
+// Allows returns true if the role permits moderation events of kind k.
+func (r *Role) Allows(k *kind.T) bool {
+	for _, p := range r.Permissions {
+		if p.Equal(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRoles are an admin, who may do anything, and a moderator, who may
+// remove users and delete events.
+var DefaultRoles = []*Role{
+	{Name: "admin", Description: "manages the group",
+		Permissions: []*kind.T{kind.GroupPutUser, kind.GroupRemoveUser,
+			kind.GroupEditMetadata, kind.GroupDeleteEvent, kind.GroupDelete,
+			kind.GroupCreateInvite}},
+	{Name: "moderator", Description: "removes users and events",
+		Permissions: []*kind.T{kind.GroupRemoveUser, kind.GroupDeleteEvent}},
+}
+
+// Metadata describes a group.
+type Metadata struct {
+	Name, Picture, About S
+	// Private groups can only be read by members.
+	Private bool
+	// Closed groups ignore join requests without an invite code.
+	Closed bool
+}
+
+// Group is the state of a group.
+type Group struct {
+	// ID is the local identifier of the group.
+	ID S
+	Metadata
+	// Members are the pubkeys of the members, as strings of their bytes.
+	Members map[S]bool
+	// Admins are the roles of the members that have any, by pubkey.
+	Admins map[S][]S
+	// Roles are the roles of the group.
+	Roles []*Role
+	// invites are the invite codes that let users join a closed group.
+	invites map[S]bool
+	// updated are the timestamps of the newest state events, by kind.
+	updated map[uint16]int64
+}
+
+// New creates an empty group.
+func New(id S) *Group {
+	return &Group{ID: id, Members: make(map[S]bool), Admins: make(map[S][]S),
+		invites: make(map[S]bool), updated: make(map[uint16]int64)}
+}
+
+// Clone returns a copy of a group that shares nothing with it.
+func (g *Group) Clone() (c *Group) {
+	c = New(g.ID)
+	c.Metadata = g.Metadata
+	for k := range g.Members {
+		c.Members[k] = true
+	}
+	for k, v := range g.Admins {
+		c.Admins[k] = append([]S{}, v...)
+	}
+	c.Roles = append(c.Roles, g.Roles...)
+	for k := range g.invites {
+		c.invites[k] = true
+	}
+	for k, v := range g.updated {
+		c.updated[k] = v
+	}
+	return
+}
+
+// IsMember returns true if pub is a member of the group.
+func (g *Group) IsMember(pub B) bool { return g.Members[S(pub)] }
+
+// RolesOf returns the names of the roles of pub in the group.
+func (g *Group) RolesOf(pub B) []S { return g.Admins[S(pub)] }
+
+// Role returns the role of the group with a name, or nil if there is none.
+func (g *Group) Role(name S) *Role {
+	for _, r := range g.Roles {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Allows returns true if pub has a role in the group that permits moderation
+// events of kind k.
+func (g *Group) Allows(pub B, k *kind.T) bool {
+	for _, name := range g.RolesOf(pub) {
+		if r := g.Role(name); r != nil && r.Allows(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Update applies a group state event of kind 39000 to 39003 to the group. The
+// caller checks that the relay of the group signed it.
+func (g *Group) Update(ev *event.T) (err E) {
+	if !IsState(ev.Kind) {
+		return Errorf.E("kind %d is not a group state kind", ev.Kind.K)
+	}
+	var d *tag.T
+	if ev.Tags != nil {
+		d = ev.Tags.GetFirst(tag.New("d"))
+	}
+	if d == nil || d.Len() < 2 || S(d.Value()) != g.ID {
+		return Errorf.E("event is not the state of group %s", g.ID)
+	}
+	switch ev.Kind.K {
+	case kind.GroupMetadata.K:
+		g.Metadata = Metadata{}
+		g.Metadata.update(ev.Tags)
+	case kind.GroupAdmins.K:
+		g.Admins = make(map[S][]S)
+		for _, t := range ev.Tags.T {
+			if pub, ok := pubKey(t); ok && t.Len() > 2 {
+				g.Admins[S(pub)] = t.ToStringSlice()[2:]
+				g.Members[S(pub)] = true
+			}
+		}
+	case kind.GroupMembers.K:
+		g.Members = make(map[S]bool)
+		for _, t := range ev.Tags.T {
+			if pub, ok := pubKey(t); ok {
+				g.Members[S(pub)] = true
+			}
+		}
+	case kind.GroupRoles.K:
+		roles := g.Roles
+		g.Roles = nil
+		for _, t := range ev.Tags.T {
+			if t.Len() < 2 || S(t.Key()) != "role" {
+				continue
+			}
+			r := &Role{Name: S(t.Value())}
+			if t.Len() > 2 {
+				r.Description = S(t.Field[2])
+			}
+			// keep the permissions the relay gave a role if it is known.
+			for _, old := range roles {
+				if old.Name == r.Name {
+					r.Permissions = old.Permissions
+				}
+			}
+			g.Roles = append(g.Roles, r)
+		}
+	}
+	return
+}
+
+// update sets the metadata in the name, picture and about tags and the flag
+// tags of an event.
+func (m *Metadata) update(t *tags.T) {
+	for _, f := range t.T {
+		if f.Len() < 1 {
+			continue
+		}
+		var v S
+		if f.Len() > 1 {
+			v = S(f.Value())
+		}
+		switch S(f.Key()) {
+		case "name":
+			m.Name = v
+		case "picture":
+			m.Picture = v
+		case "about":
+			m.About = v
+		case "public":
+			m.Private = false
+		case "private":
+			m.Private = true
+		case "open":
+			m.Closed = false
+		case "closed":
+			m.Closed = true
+		}
+	}
+}
+
+// flags returns the tags of the flags of the metadata.
+func (m *Metadata) flags() (t []*tag.T) {
+	t = []*tag.T{tag.New("public"), tag.New("open")}
+	if m.Private {
+		t[0] = tag.New("private")
+	}
+	if m.Closed {
+		t[1] = tag.New("closed")
+	}
+	return
+}
+
+// pubKey returns the pubkey of a p tag.
+func pubKey(t *tag.T) (pub B, ok bool) {
+	if t.Len() < 2 || S(t.Key()) != "p" {
+		return
+	}
+	var err E
+	if pub, err = hex.Dec(S(t.Value())); err != nil || len(pub) != 32 {
+		return nil, false
+	}
+	return pub, true
+}
+
+// FromEvents reconstructs a group from its state events, using the newest of
+// each kind. The caller checks that the relay of the group signed them.
+func FromEvents(id S, evs ...*event.T) (g *Group, err E) {
+	g = New(id)
+	newest := make(map[uint16]*event.T)
+	for _, ev := range evs {
+		if !IsState(ev.Kind) {
+			continue
+		}
+		if n, ok := newest[ev.Kind.K]; !ok || newer(ev, n) {
+			newest[ev.Kind.K] = ev
+		}
+	}
+	if newest[kind.GroupMetadata.K] == nil {
+		return nil, Errorf.E("no metadata for group %s", id)
+	}
+	// members first, as admins are members too.
+	for _, k := range []*kind.T{kind.GroupMetadata, kind.GroupMembers, kind.GroupRoles,
+		kind.GroupAdmins} {
+		if ev := newest[k.K]; ev != nil {
+			if err = g.Update(ev); err != nil {
+				return nil, err
+			}
+			g.updated[k.K] = ev.CreatedAt.I64()
+		}
+	}
+	return
+}
+
+// newer returns true if a replaces b, being newer or, if they are as old, having
+// the lower id.
+func newer(a, b *event.T) bool {
+	if a.CreatedAt.I64() != b.CreatedAt.I64() {
+		return a.CreatedAt.I64() > b.CreatedAt.I64()
+	}
+	return bytes.Compare(a.ID, b.ID) < 0
+}
+
+// sorted returns the keys of a map in order, so events come out the same every
+// time.
+func sorted[V any](m map[S]V) (keys []S) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// State returns the unsigned state event of kind k for the group.
+func (g *Group) State(k *kind.T) (ev *event.T, err E) {
+	t := tags.New(tag.New("d", g.ID))
+	switch k.K {
+	case kind.GroupMetadata.K:
+		for _, f := range [][2]S{{"name", g.Name}, {"picture", g.Picture},
+			{"about", g.About}} {
+			if f[1] != "" {
+				t.T = append(t.T, tag.New(f[0], f[1]))
+			}
+		}
+		t.T = append(t.T, g.flags()...)
+	case kind.GroupAdmins.K:
+		for _, pub := range sorted(g.Admins) {
+			t.T = append(t.T, tag.New(append([]S{"p", hex.Enc(B(pub))}, g.Admins[pub]...)...))
+		}
+	case kind.GroupMembers.K:
+		for _, pub := range sorted(g.Members) {
+			t.T = append(t.T, tag.New("p", hex.Enc(B(pub))))
+		}
+	case kind.GroupRoles.K:
+		for _, r := range g.Roles {
+			t.T = append(t.T, tag.New("role", r.Name, r.Description))
+		}
+	default:
+		return nil, Errorf.E("kind %d is not a group state kind", k.K)
+	}
+	return &event.T{CreatedAt: timestamp.Now(), Kind: k, Tags: t}, nil
+}
+
+// message creates an unsigned event posted to a group.
+func message(k *kind.T, group S, content S, t ...*tag.T) *event.T {
+	return &event.T{CreatedAt: timestamp.Now(), Kind: k,
+		Tags: tags.New(append([]*tag.T{tag.New("h", group)}, t...)...), Content: B(content)}
+}
+
+// PutUser creates an unsigned event that adds a user to a group, with roles if
+// any are given.
+func PutUser(group S, pub B, roles ...S) *event.T {
+	return message(kind.GroupPutUser, group, "",
+		tag.New(append([]S{"p", hex.Enc(pub)}, roles...)...))
+}
+
+// RemoveUser creates an unsigned event that removes a user from a group.
+func RemoveUser(group S, pub B) *event.T {
+	return message(kind.GroupRemoveUser, group, "", tag.New("p", hex.Enc(pub)))
+}
+
+// EditMetadata creates an unsigned event that sets the metadata of a group.
+func EditMetadata(group S, m *Metadata) *event.T {
+	ev := message(kind.GroupEditMetadata, group, "")
+	for _, f := range [][2]S{{"name", m.Name}, {"picture", m.Picture}, {"about", m.About}} {
+		ev.Tags.T = append(ev.Tags.T, tag.New(f[0], f[1]))
+	}
+	ev.Tags.T = append(ev.Tags.T, m.flags()...)
+	return ev
+}
+
+// DeleteEvent creates an unsigned event that deletes an event from a group.
+func DeleteEvent(group S, id B) *event.T {
+	return message(kind.GroupDeleteEvent, group, "", tag.New("e", hex.Enc(id)))
+}
+
+// CreateGroup creates an unsigned event that creates a group.
+func CreateGroup(group S) *event.T { return message(kind.GroupCreate, group, "") }
+
+// DeleteGroup creates an unsigned event that deletes a group.
+func DeleteGroup(group S) *event.T { return message(kind.GroupDelete, group, "") }
+
+// CreateInvite creates an unsigned event that lets users with code join a closed
+// group.
+func CreateInvite(group, code S) *event.T {
+	return message(kind.GroupCreateInvite, group, "", tag.New("code", code))
+}
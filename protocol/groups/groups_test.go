@@ -0,0 +1,198 @@
+package groups
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tests"
+	"nostr.mleku.dev/crypto/p256k"
+	"nostr.mleku.dev/protocol/relaytest"
+	"nostr.mleku.dev/protocol/ws"
+	"util.mleku.dev/context"
+)
+
+func signed(t *testing.T, s *p256k.Signer, ev *event.T) *event.T {
+	if err := ev.Sign(s); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestID(t *testing.T) {
+	id, err := ParseID("groups.example.com'pizza")
+	if err != nil || id.Host != "groups.example.com" || id.Local != "pizza" ||
+		id.String() != "groups.example.com'pizza" {
+		t.Fatalf("got %+v, %v", id, err)
+	}
+	if id, err = ParseID("groups.example.com"); err != nil || id.Local != "_" {
+		t.Fatalf("got %+v, %v", id, err)
+	}
+	if _, err = ParseID("'pizza"); err == nil {
+		t.Fatal("an identifier needs a host")
+	}
+}
+
+func TestRelay(t *testing.T) {
+	keys := tests.Signers(t, 5)
+	rs, alice, bob, carol, dave := keys[0], keys[1], keys[2], keys[3], keys[4]
+	r := NewRelay(rs)
+	var state []*event.T
+	apply := func(s *p256k.Signer, ev *event.T, prefix S) (remove []B) {
+		t.Helper()
+		pub, rm, err := r.Apply(signed(t, s, ev))
+		if prefix != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), prefix) {
+				t.Fatalf("kind %d: expected %s error, got %v", ev.Kind.K, prefix, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("kind %d: %v", ev.Kind.K, err)
+		}
+		for _, p := range pub {
+			if !Equals(p.PubKey, r.PubKey()) {
+				t.Fatal("state not signed by the relay")
+			}
+		}
+		state = append(state, pub...)
+		return rm
+	}
+	apply(alice, CreateGroup("pizza"), "")
+	apply(bob, CreateGroup("pizza"), "duplicate:")
+	apply(alice, EditMetadata("pizza", &Metadata{Name: "Pizza", About: "lovers"}), "")
+	if g := r.Group("pizza"); g.Name != "Pizza" || !g.IsMember(alice.Pub()) ||
+		!g.Allows(alice.Pub(), kind.GroupPutUser) {
+		t.Fatalf("got %+v", g)
+	}
+	// only members post, and anyone can join an open group.
+	apply(bob, message(kind.ChatMessage, "pizza", "hi"), "restricted:")
+	apply(bob, message(kind.GroupJoinRequest, "pizza", ""), "")
+	apply(bob, message(kind.GroupJoinRequest, "pizza", ""), "duplicate:")
+	post := signed(t, bob, message(kind.ChatMessage, "pizza", "hi"))
+	apply(bob, post, "")
+	apply(bob, message(kind.ChatMessage, "pasta", "hi"), "invalid:")
+	// moderation needs a role that allows it.
+	apply(bob, PutUser("pizza", carol.Pub()), "blocked:")
+	apply(alice, PutUser("pizza", carol.Pub(), "chef"), "invalid:")
+	apply(alice, PutUser("pizza", carol.Pub(), "moderator"), "")
+	apply(carol, EditMetadata("pizza", &Metadata{Name: "Pasta"}), "blocked:")
+	if rm := apply(carol, DeleteEvent("pizza", post.ID), ""); len(rm) != 1 ||
+		!Equals(rm[0], post.ID) {
+		t.Fatalf("got %v", rm)
+	}
+	ev := DeleteEvent("pizza", post.ID)
+	ev.Tags = nil
+	apply(carol, ev, "invalid:")
+	ev, _ = (&Group{ID: "pizza"}).State(kind.GroupMetadata)
+	apply(alice, ev, "blocked:")
+	// a closed group needs an invite.
+	apply(alice, EditMetadata("pizza", &Metadata{Name: "Pizza", Closed: true}), "")
+	apply(dave, message(kind.GroupJoinRequest, "pizza", ""), "")
+	if r.Group("pizza").IsMember(dave.Pub()) {
+		t.Fatal("joined a closed group without an invite")
+	}
+	invite := signed(t, alice, CreateInvite("pizza", "secret"))
+	apply(alice, invite, "")
+	join := message(kind.GroupJoinRequest, "pizza", "")
+	join.Tags.T = append(join.Tags.T, tag.New("code", "secret"))
+	apply(dave, join, "")
+	apply(bob, message(kind.GroupLeaveRequest, "pizza", ""), "")
+	g := r.Group("pizza")
+	if !g.IsMember(dave.Pub()) || g.IsMember(bob.Pub()) || !g.Closed ||
+		len(g.RolesOf(carol.Pub())) != 1 {
+		t.Fatalf("got %+v", g)
+	}
+	// the state the relay published tells the same.
+	got, err := FromEvents("pizza", state...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Metadata != g.Metadata || len(got.Members) != 3 || len(got.Admins) != 2 ||
+		got.RolesOf(carol.Pub())[0] != "moderator" || len(got.Roles) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	// and a restarted relay picks up where it left off.
+	r = NewRelay(rs)
+	if err = r.Load(append(state, invite)...); err != nil {
+		t.Fatal(err)
+	}
+	apply(carol, DeleteEvent("pizza", post.ID), "")
+	join = message(kind.GroupJoinRequest, "pizza", "")
+	join.Tags.T = append(join.Tags.T, tag.New("code", "secret"))
+	apply(bob, join, "")
+	apply(alice, DeleteGroup("pizza"), "")
+	if r.Group("pizza") != nil {
+		t.Fatal("group not deleted")
+	}
+}
+
+func TestClient(t *testing.T) {
+	c, cancel := context.Timeout(context.Bg(), 10*time.Second)
+	defer cancel()
+	rs := tests.Signers(t, 1)[0]
+	r := NewRelay(rs)
+	relay := relaytest.New()
+	defer relay.Close()
+	relay.Accept = func(ev *event.T) (more []*event.T, err E) {
+		more, _, err = r.Apply(ev)
+		return
+	}
+	connect := func() *Client {
+		conn, err := ws.RelayConnect(c, relay.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cl := NewClient(tests.Signers(t, 1)[0], conn)
+		cl.RelayPubKey = r.PubKey()
+		return cl
+	}
+	alice, bob, carol := connect(), connect(), connect()
+	if err := alice.Publish(c, CreateGroup("pizza")); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Publish(c, EditMetadata("pizza", &Metadata{Name: "Pizza"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Join(c, "pizza", "I like pizza", ""); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := bob.Subscribe(c, "pizza", kind.ChatMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = alice.Post(c, "pizza", kind.ChatMessage, "margherita?"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = carol.Post(c, "pizza", kind.ChatMessage, "pineapple!"); err == nil ||
+		!strings.Contains(err.Error(), "restricted") {
+		t.Fatalf("expected a non-member to be refused, got %v", err)
+	}
+	select {
+	case ev := <-sub.Events:
+		if S(ev.Content) != "margherita?" {
+			t.Fatalf("got %s", ev.Content)
+		}
+	case <-c.Done():
+		t.Fatal("no post")
+	}
+	var g *Group
+	if g, err = bob.Group(c, "pizza"); err != nil {
+		t.Fatal(err)
+	}
+	if g.Name != "Pizza" || !g.IsMember(bob.signer.Pub()) ||
+		g.RolesOf(alice.signer.Pub())[0] != "admin" {
+		t.Fatalf("got %+v", g)
+	}
+	if err = bob.Leave(c, "pizza", ""); err != nil {
+		t.Fatal(err)
+	}
+	if g, err = bob.Group(c, "pizza"); err != nil || g.IsMember(bob.signer.Pub()) {
+		t.Fatalf("got %+v, %v", g, err)
+	}
+}
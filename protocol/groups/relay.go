@@ -0,0 +1,276 @@
+package groups
+
+import (
+	"sync"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto"
+	"util.mleku.dev/hex"
+)
+
+// Relay is the relay side of groups. It holds the state of the groups of a
+// relay, checks the events written to them, and turns the ones it accepts into
+// changes of state, which it publishes signed with the key of the relay.
+//
+// The errors of Check and Apply start with the machine readable prefixes of
+// NIP-01 OK messages.
+type Relay struct {
+	// Roles are the roles of new groups. The creator of a group gets the first.
+	Roles []*Role
+	// CanCreate decides who may create groups. Anyone may if it is nil.
+	CanCreate func(pub B) bool
+	signer    crypto.Signer
+	mx        sync.RWMutex
+	groups    map[S]*Group
+}
+
+// NewRelay creates the group state of a relay that signs with signer.
+func NewRelay(signer crypto.Signer) *Relay {
+	return &Relay{Roles: DefaultRoles, signer: signer, groups: make(map[S]*Group)}
+}
+
+// PubKey is the pubkey of the relay, which signs the state of its groups.
+func (r *Relay) PubKey() B { return r.signer.Pub() }
+
+// Group returns a copy of a group, or nil if there is no such group.
+func (r *Relay) Group(id S) *Group {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	if g := r.groups[id]; g != nil {
+		return g.Clone()
+	}
+	return nil
+}
+
+// Load restores the groups from the state events the relay has published, and
+// the invite events it has accepted, as when it restarts.
+func (r *Relay) Load(evs ...*event.T) (err E) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	states := make(map[S][]*event.T)
+	for _, ev := range evs {
+		if IsState(ev.Kind) && Equals(ev.PubKey, r.PubKey()) {
+			if d := ev.Tags.GetFirst(tag.New("d")); d != nil && d.Len() > 1 {
+				states[S(d.Value())] = append(states[S(d.Value())], ev)
+			}
+		}
+	}
+	for id, sevs := range states {
+		var g *Group
+		if g, err = FromEvents(id, sevs...); err != nil {
+			return
+		}
+		// the permissions of roles are policy of the relay.
+		for i, role := range g.Roles {
+			for _, known := range r.Roles {
+				if known.Name == role.Name {
+					g.Roles[i] = known
+				}
+			}
+		}
+		r.groups[id] = g
+	}
+	for _, ev := range evs {
+		if g := r.groups[Of(ev)]; g != nil && ev.Kind.Equal(kind.GroupCreateInvite) {
+			g.addInvites(ev)
+		}
+	}
+	return
+}
+
+// Check returns an error if the relay should not accept an event. Events that
+// are not posted to a group are accepted, except for group state events signed
+// by anyone else than the relay.
+func (r *Relay) Check(ev *event.T) (err E) {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	_, err = r.check(ev)
+	return
+}
+
+func (r *Relay) check(ev *event.T) (g *Group, err E) {
+	if IsState(ev.Kind) {
+		if !Equals(ev.PubKey, r.PubKey()) {
+			return nil, Errorf.E("blocked: group state is only published by the relay")
+		}
+		return
+	}
+	id := Of(ev)
+	if id == "" {
+		if IsModeration(ev.Kind) || ev.Kind.Equal(kind.GroupJoinRequest) ||
+			ev.Kind.Equal(kind.GroupLeaveRequest) {
+			return nil, Errorf.E("invalid: missing h tag")
+		}
+		return
+	}
+	g = r.groups[id]
+	if ev.Kind.Equal(kind.GroupCreate) {
+		if g != nil {
+			return nil, Errorf.E("duplicate: group %s already exists", id)
+		}
+		if r.CanCreate != nil && !r.CanCreate(ev.PubKey) {
+			return nil, Errorf.E("restricted: not allowed to create groups")
+		}
+		return
+	}
+	if g == nil {
+		return nil, Errorf.E("invalid: no group %s", id)
+	}
+	if Equals(ev.PubKey, r.PubKey()) {
+		return
+	}
+	switch {
+	case IsModeration(ev.Kind):
+		if !g.Allows(ev.PubKey, ev.Kind) {
+			return nil, Errorf.E("blocked: no role in group %s that allows kind %d", id,
+				ev.Kind.K)
+		}
+		if ev.Kind.Equal(kind.GroupPutUser) {
+			for _, t := range ev.Tags.T {
+				if _, ok := pubKey(t); !ok {
+					continue
+				}
+				for _, name := range t.ToStringSlice()[2:] {
+					if g.Role(name) == nil {
+						return nil, Errorf.E("invalid: no role %q in group %s", name, id)
+					}
+				}
+			}
+		}
+	case ev.Kind.Equal(kind.GroupJoinRequest):
+		if g.IsMember(ev.PubKey) {
+			return nil, Errorf.E("duplicate: already a member of group %s", id)
+		}
+	case !g.IsMember(ev.PubKey):
+		return nil, Errorf.E("restricted: not a member of group %s", id)
+	}
+	return
+}
+
+// Apply checks an event and changes the groups by it if it is accepted. It
+// returns the events the relay publishes as a result, signed, and the ids of the
+// events that are deleted from the group. The events it returns are applied
+// already, and are stored without being applied again.
+func (r *Relay) Apply(ev *event.T) (publish []*event.T, remove []B, err E) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	var g *Group
+	if g, err = r.check(ev); err != nil {
+		return
+	}
+	if IsState(ev.Kind) || (g == nil && !ev.Kind.Equal(kind.GroupCreate)) {
+		return
+	}
+	var changed []*kind.T
+	switch ev.Kind.K {
+	case kind.GroupCreate.K:
+		g = New(Of(ev))
+		g.Roles = r.Roles
+		g.Members[S(ev.PubKey)] = true
+		if len(g.Roles) > 0 {
+			g.Admins[S(ev.PubKey)] = []S{g.Roles[0].Name}
+		}
+		r.groups[g.ID] = g
+		changed = []*kind.T{kind.GroupMetadata, kind.GroupAdmins, kind.GroupMembers,
+			kind.GroupRoles}
+	case kind.GroupDelete.K:
+		delete(r.groups, g.ID)
+	case kind.GroupPutUser.K:
+		changed = []*kind.T{kind.GroupMembers}
+		for _, t := range ev.Tags.T {
+			if pub, ok := pubKey(t); ok {
+				g.Members[S(pub)] = true
+				if t.Len() > 2 {
+					g.Admins[S(pub)] = t.ToStringSlice()[2:]
+					changed = []*kind.T{kind.GroupAdmins, kind.GroupMembers}
+				}
+			}
+		}
+	case kind.GroupRemoveUser.K:
+		var pubs []B
+		for _, t := range ev.Tags.T {
+			if pub, ok := pubKey(t); ok {
+				pubs = append(pubs, pub)
+			}
+		}
+		changed = g.remove(pubs...)
+	case kind.GroupEditMetadata.K:
+		g.Metadata.update(ev.Tags)
+		changed = []*kind.T{kind.GroupMetadata}
+	case kind.GroupDeleteEvent.K:
+		for _, t := range ev.Tags.T {
+			if t.Len() < 2 || S(t.Key()) != "e" {
+				continue
+			}
+			if id, e := hex.Dec(S(t.Value())); e == nil && len(id) == 32 {
+				remove = append(remove, id)
+			}
+		}
+	case kind.GroupCreateInvite.K:
+		g.addInvites(ev)
+	case kind.GroupJoinRequest.K:
+		var code S
+		if t := ev.Tags.GetFirst(tag.New("code")); t != nil && t.Len() > 1 {
+			code = S(t.Value())
+		}
+		if g.Closed && !g.invites[code] {
+			// the request waits for an admin to put the user in the group.
+			return
+		}
+		g.Members[S(ev.PubKey)] = true
+		publish = append(publish, PutUser(g.ID, ev.PubKey))
+		changed = []*kind.T{kind.GroupMembers}
+	case kind.GroupLeaveRequest.K:
+		changed = g.remove(ev.PubKey)
+		publish = append(publish, RemoveUser(g.ID, ev.PubKey))
+	}
+	for _, k := range changed {
+		var s *event.T
+		if s, err = g.State(k); Chk.E(err) {
+			return
+		}
+		// a newer state must not tie with the one it replaces.
+		if last := g.updated[k.K]; s.CreatedAt.I64() <= last {
+			s.CreatedAt = timestamp.FromUnix(last + 1)
+		}
+		g.updated[k.K] = s.CreatedAt.I64()
+		publish = append(publish, s)
+	}
+	for _, p := range publish {
+		if err = p.Sign(r.signer); Chk.E(err) {
+			return
+		}
+	}
+	return
+}
+
+// remove removes users from a group and returns the kinds of state it changed.
+func (g *Group) remove(pubs ...B) (changed []*kind.T) {
+	changed = []*kind.T{kind.GroupMembers}
+	var admin bool
+	for _, pub := range pubs {
+		delete(g.Members, S(pub))
+		if _, ok := g.Admins[S(pub)]; ok {
+			delete(g.Admins, S(pub))
+			admin = true
+		}
+	}
+	if admin {
+		changed = append([]*kind.T{kind.GroupAdmins}, changed...)
+	}
+	return
+}
+
+// addInvites adds the codes of an invite event to the invites of a group.
+func (g *Group) addInvites(ev *event.T) {
+	for _, t := range ev.Tags.T {
+		if t.Len() > 1 && S(t.Key()) == "code" {
+			g.invites[S(t.Value())] = true
+		}
+	}
+}
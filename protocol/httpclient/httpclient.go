@@ -0,0 +1,182 @@
+// Package httpclient holds the settings for the HTTP requests made to relays
+// and NIP-05 servers, so that every package can be routed through a proxy, use
+// a custom TLS setup or be given a fake transport in tests in the same way.
+package httpclient
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	. "nostr.mleku.dev"
+)
+
+const (
+	// DefaultUserAgent is sent with requests unless another is set.
+	DefaultUserAgent = "nostr.mleku.dev"
+	// DefaultMaxSize is the default limit on the size of a response body.
+	DefaultMaxSize = 1 << 20
+	// DefaultMaxRedirects is the default number of redirects followed.
+	DefaultMaxRedirects = 10
+	// DefaultRetryDelay is the default wait before the first retry, which doubles
+	// with each retry after it.
+	DefaultRetryDelay = 500 * time.Millisecond
+)
+
+// DialFunc opens a network connection, such as through a SOCKS5 proxy.
+type DialFunc func(c Ctx, network, addr S) (conn net.Conn, err E)
+
+// T is a set of HTTP client settings.
+type T struct {
+	// Client is the base client, http.DefaultClient if nil. Its CheckRedirect is
+	// replaced by the redirect policy of T.
+	Client *http.Client
+	// Transport replaces the transport of Client if it is not nil.
+	Transport http.RoundTripper
+	// Dial opens connections, if it is not nil and neither Client nor Transport
+	// have a transport. It is also used to dial websockets.
+	Dial DialFunc
+	// UserAgent is sent with every request if it is not empty.
+	UserAgent S
+	// MaxSize is the largest response body that is read, if it is greater than
+	// zero.
+	MaxSize int64
+	// MaxRedirects is the number of redirects followed, zero for none.
+	MaxRedirects N
+	// Retries is how many times a request is repeated after a network error or a
+	// 429 or 5xx status.
+	Retries N
+	// RetryDelay is the wait before the first retry.
+	RetryDelay time.Duration
+	once       sync.Once
+	client     *http.Client
+}
+
+// Option changes a setting of T.
+type Option func(t *T)
+
+// New creates T with the defaults and then the options applied.
+func New(opts ...Option) (t *T) {
+	t = &T{UserAgent: DefaultUserAgent, MaxSize: DefaultMaxSize,
+		MaxRedirects: DefaultMaxRedirects, RetryDelay: DefaultRetryDelay}
+	for _, o := range opts {
+		o(t)
+	}
+	return
+}
+
+// WithClient makes requests with a shared client.
+func WithClient(c *http.Client) Option { return func(t *T) { t.Client = c } }
+
+// WithTransport makes requests with a transport, such as a fake one in tests.
+func WithTransport(rt http.RoundTripper) Option { return func(t *T) { t.Transport = rt } }
+
+// WithDialer opens connections with a custom dialer.
+func WithDialer(d DialFunc) Option { return func(t *T) { t.Dial = d } }
+
+// WithUserAgent sets the User-Agent header, or leaves it out if it is empty.
+func WithUserAgent(ua S) Option { return func(t *T) { t.UserAgent = ua } }
+
+// WithMaxSize limits the size of response bodies, or removes the limit if it
+// is not greater than zero.
+func WithMaxSize(n int64) Option { return func(t *T) { t.MaxSize = n } }
+
+// WithMaxRedirects sets how many redirects are followed, zero for none.
+func WithMaxRedirects(n N) Option { return func(t *T) { t.MaxRedirects = n } }
+
+// WithRetries repeats failed requests up to n times, waiting delay before the
+// first retry and twice as long before each one after it.
+func WithRetries(n N, delay time.Duration) Option {
+	return func(t *T) { t.Retries, t.RetryDelay = n, delay }
+}
+
+// HTTPClient returns the client that T makes requests with.
+func (t *T) HTTPClient() *http.Client {
+	t.once.Do(func() {
+		t.client = &http.Client{}
+		if t.Client != nil {
+			*t.client = *t.Client
+		}
+		if t.Transport != nil {
+			t.client.Transport = t.Transport
+		} else if t.client.Transport == nil && t.Dial != nil {
+			tr := http.DefaultTransport.(*http.Transport).Clone()
+			tr.DialContext = t.Dial
+			t.client.Transport = tr
+		}
+		t.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > t.MaxRedirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		}
+	})
+	return t.client
+}
+
+// Get requests a URL with the given headers and returns the body of the
+// response, which must have status 200.
+func (t *T) Get(c Ctx, url S, header http.Header) (b B, err E) {
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(c, http.MethodGet, url, nil); Chk.E(err) {
+		err = Errorf.E("failed to create a request: %w", err)
+		return
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if t.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.UserAgent)
+	}
+	var res *http.Response
+	if res, err = t.do(c, req); err != nil {
+		err = Errorf.E("request failed: %w", err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		err = Errorf.E("%s responded with status %d", req.URL.Host, res.StatusCode)
+		return
+	}
+	var r io.Reader = res.Body
+	if t.MaxSize > 0 {
+		r = io.LimitReader(r, t.MaxSize+1)
+	}
+	if b, err = io.ReadAll(r); Chk.E(err) {
+		return
+	}
+	if t.MaxSize > 0 && int64(len(b)) > t.MaxSize {
+		err = Errorf.E("response from %s is larger than %d bytes", req.URL.Host, t.MaxSize)
+	}
+	return
+}
+
+// do sends a request, retrying it as many times as T allows.
+func (t *T) do(c Ctx, req *http.Request) (res *http.Response, err E) {
+	client := t.HTTPClient()
+	delay := t.RetryDelay
+	for i := 0; ; i++ {
+		res, err = client.Do(req)
+		if i >= t.Retries || !retryable(res, err) {
+			return
+		}
+		if err == nil {
+			res.Body.Close()
+		}
+		select {
+		case <-c.Done():
+			return nil, c.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func retryable(res *http.Response, err E) bool {
+	if err != nil {
+		return true
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
@@ -0,0 +1,93 @@
+package httpclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "nostr.mleku.dev"
+)
+
+func TestGet(t *testing.T) {
+	var failures atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ua", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(B(r.UserAgent()))
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(B(strings.Repeat("x", 100)))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ua", http.StatusFound)
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if failures.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(B("ok"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	c := context.Background()
+	b, err := New().Get(c, srv.URL+"/ua", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if S(b) != DefaultUserAgent {
+		t.Fatalf("got user agent '%s'", b)
+	}
+	if b, err = New(WithUserAgent("test")).Get(c, srv.URL+"/ua", nil); err != nil {
+		t.Fatal(err)
+	}
+	if S(b) != "test" {
+		t.Fatalf("got user agent '%s'", b)
+	}
+	if b, err = New().Get(c, srv.URL+"/ua", http.Header{"User-Agent": {"header"}}); err != nil {
+		t.Fatal(err)
+	}
+	if S(b) != "header" {
+		t.Fatalf("got user agent '%s'", b)
+	}
+	if _, err = New(WithMaxSize(99)).Get(c, srv.URL+"/big", nil); err == nil {
+		t.Fatal("expected an error for a response over the size limit")
+	}
+	if _, err = New(WithMaxSize(100)).Get(c, srv.URL+"/big", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New().Get(c, srv.URL+"/redirect", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(WithMaxRedirects(0)).Get(c, srv.URL+"/redirect", nil); err == nil {
+		t.Fatal("expected an error for a redirect that is not followed")
+	}
+	if _, err = New(WithRetries(1, time.Millisecond)).Get(c, srv.URL+"/flaky",
+		nil); err == nil {
+		t.Fatal("expected an error after one retry")
+	}
+	failures.Store(0)
+	if b, err = New(WithRetries(2, time.Millisecond)).Get(c, srv.URL+"/flaky",
+		nil); err != nil {
+		t.Fatal(err)
+	}
+	if S(b) != "ok" {
+		t.Fatalf("got '%s' after retries", b)
+	}
+	var dials atomic.Int64
+	d := &net.Dialer{}
+	dial := func(c Ctx, network, addr S) (net.Conn, E) {
+		dials.Add(1)
+		return d.DialContext(c, network, addr)
+	}
+	if _, err = New(WithDialer(dial)).Get(c, srv.URL+"/ua", nil); err != nil {
+		t.Fatal(err)
+	}
+	if dials.Load() != 1 {
+		t.Fatalf("expected the dialer to be used once, got %d", dials.Load())
+	}
+}
@@ -0,0 +1,220 @@
+package nwc
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/filters"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/crypto/p256k"
+	"nostr.mleku.dev/protocol/ws"
+	"util.mleku.dev/context"
+	"util.mleku.dev/hex"
+)
+
+// DefaultTimeout is how long a Client waits for a response when the context of
+// a call has no deadline.
+var DefaultTimeout = time.Minute
+
+// Client sends requests to a wallet service over the relay of a URI.
+type Client struct {
+	uri     *URI
+	signer  crypto.Signer
+	relay   *ws.Client
+	sub     *ws.Subscription
+	mx      sync.Mutex
+	pending map[S]chan *Response
+}
+
+// NewClient connects to the first relay of the URI that it can, and subscribes
+// to the responses of the wallet service.
+func NewClient(c Ctx, uri *URI, opts ...ws.RelayOption) (cl *Client, err E) {
+	cl = &Client{uri: uri, signer: &p256k.Signer{}, pending: make(map[S]chan *Response)}
+	if err = cl.signer.InitSec(uri.Secret); Chk.E(err) {
+		return nil, err
+	}
+	for _, u := range uri.Relays {
+		if cl.relay, err = ws.RelayConnect(c, u, opts...); err == nil {
+			break
+		}
+		Log.D.F("could not connect to wallet relay %s: %v", u, err)
+	}
+	if err != nil {
+		return nil, Errorf.E("could not connect to any wallet relay: %w", err)
+	}
+	f := filter.New()
+	f.Kinds = kinds.New(kind.NWCWalletResponse)
+	f.Authors = tag.New(uri.WalletPubKey)
+	f.Tags = tags.New(tag.New(B("#p"), cl.signer.Pub()))
+	if cl.sub, err = cl.relay.Subscribe(cl.relay.Context(), filters.New(f)); err != nil {
+		cl.relay.Close()
+		return nil, err
+	}
+	go cl.receive()
+	return
+}
+
+// PubKey is the pubkey of the client, which the wallet service knows it by.
+func (cl *Client) PubKey() B { return cl.signer.Pub() }
+
+// receive hands responses to the calls waiting for them, by the e tag of the
+// request they answer.
+func (cl *Client) receive() {
+	for ev := range cl.sub.Events {
+		t := ev.Tags.GetFirst(tag.New("e"))
+		if t == nil || t.Len() < 2 {
+			continue
+		}
+		cl.mx.Lock()
+		ch, ok := cl.pending[S(t.Value())]
+		delete(cl.pending, S(t.Value()))
+		cl.mx.Unlock()
+		if !ok {
+			continue
+		}
+		resp := &Response{}
+		if err := open(cl.signer, ev, resp); Chk.E(err) {
+			resp = &Response{Error: &Error{Code: Other, Message: err.Error()}}
+		}
+		ch <- resp
+	}
+}
+
+// Call sends a request to the wallet service and waits for its response,
+// decoding its result into result if it is not nil. An error response is
+// returned as an *Error.
+func (cl *Client) Call(c Ctx, method S, params, result any) (err E) {
+	req := &Request{Method: method, Params: json.RawMessage("{}")}
+	if params != nil {
+		if req.Params, err = json.Marshal(params); Chk.E(err) {
+			return
+		}
+	}
+	var ev *event.T
+	if ev, err = seal(cl.signer, cl.uri.WalletPubKey, kind.NWCWalletRequest, req); err != nil {
+		return
+	}
+	if _, ok := c.Deadline(); !ok {
+		var cancel context.F
+		c, cancel = context.Timeout(c, DefaultTimeout)
+		defer cancel()
+	}
+	id := hex.Enc(ev.ID)
+	ch := make(chan *Response, 1)
+	cl.mx.Lock()
+	cl.pending[id] = ch
+	cl.mx.Unlock()
+	defer func() {
+		cl.mx.Lock()
+		delete(cl.pending, id)
+		cl.mx.Unlock()
+	}()
+	if err = cl.relay.Publish(c, ev); err != nil {
+		return
+	}
+	var resp *Response
+	select {
+	case resp = <-ch:
+	case <-c.Done():
+		return Errorf.E("no response to %s: %w", method, c.Err())
+	case <-cl.relay.Context().Done():
+		return Errorf.E("wallet relay connection closed")
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.ResultType != method {
+		return Errorf.E("response to %s has result type '%s'", method, resp.ResultType)
+	}
+	if result != nil {
+		if err = json.Unmarshal(resp.Result, result); err != nil {
+			return Errorf.E("invalid %s result: %w", method, err)
+		}
+	}
+	return
+}
+
+// PayInvoice pays a bolt11 invoice. The amount in millisatoshis is only given
+// for invoices without one.
+func (cl *Client) PayInvoice(c Ctx, invoice S, msat int64) (r *PayInvoiceResult, err E) {
+	r = &PayInvoiceResult{}
+	if err = cl.Call(c, PayInvoice, &PayInvoiceParams{invoice, msat}, r); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// MakeInvoice creates an invoice.
+func (cl *Client) MakeInvoice(c Ctx, p *MakeInvoiceParams) (tx *Transaction, err E) {
+	tx = &Transaction{}
+	if err = cl.Call(c, MakeInvoice, p, tx); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// GetBalance returns the balance of the wallet in millisatoshis.
+func (cl *Client) GetBalance(c Ctx) (msat int64, err E) {
+	var r GetBalanceResult
+	if err = cl.Call(c, GetBalance, nil, &r); err != nil {
+		return
+	}
+	return r.Balance, nil
+}
+
+// ListTransactions lists the invoices and payments of the wallet.
+func (cl *Client) ListTransactions(c Ctx, p *ListTransactionsParams) (txs []Transaction,
+	err E) {
+
+	var r ListTransactionsResult
+	if err = cl.Call(c, ListTransactions, p, &r); err != nil {
+		return
+	}
+	return r.Transactions, nil
+}
+
+// LookupInvoice finds an invoice by its payment hash or bolt11 string.
+func (cl *Client) LookupInvoice(c Ctx, p *LookupInvoiceParams) (tx *Transaction, err E) {
+	tx = &Transaction{}
+	if err = cl.Call(c, LookupInvoice, p, tx); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Info returns the methods the wallet service supports, from its info event.
+func (cl *Client) Info(c Ctx) (methods []S, err E) {
+	f := filter.New()
+	f.Kinds = kinds.New(kind.NWCWalletInfo)
+	f.Authors = tag.New(cl.uri.WalletPubKey)
+	var evs []*event.T
+	if evs, err = cl.relay.QuerySync(c, f); err != nil {
+		return
+	}
+	var latest *event.T
+	for _, ev := range evs {
+		if latest == nil || ev.CreatedAt.I64() > latest.CreatedAt.I64() {
+			latest = ev
+		}
+	}
+	if latest == nil {
+		return nil, Errorf.E("wallet service has no info event")
+	}
+	return strings.Fields(S(latest.Content)), nil
+}
+
+// Close closes the connection to the relay.
+func (cl *Client) Close() (err E) {
+	cl.sub.Unsub()
+	return cl.relay.Close()
+}
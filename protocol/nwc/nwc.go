@@ -0,0 +1,184 @@
+// Package nwc implements Nostr Wallet Connect (NIP-47): a client that sends
+// encrypted requests to a lightning wallet service over a relay, and the wallet
+// service side, which answers them with a Wallet.
+package nwc
+
+import (
+	"encoding/json"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/crypto/encryption"
+	"util.mleku.dev/hex"
+)
+
+// The methods of NIP-47.
+const (
+	PayInvoice       = "pay_invoice"
+	MakeInvoice      = "make_invoice"
+	GetBalance       = "get_balance"
+	ListTransactions = "list_transactions"
+	LookupInvoice    = "lookup_invoice"
+)
+
+// Methods are the methods a Service supports, as listed in its info event.
+var Methods = []S{PayInvoice, MakeInvoice, GetBalance, ListTransactions, LookupInvoice}
+
+// The error codes of NIP-47.
+const (
+	RateLimited         = "RATE_LIMITED"
+	NotImplemented      = "NOT_IMPLEMENTED"
+	InsufficientBalance = "INSUFFICIENT_BALANCE"
+	QuotaExceeded       = "QUOTA_EXCEEDED"
+	Restricted          = "RESTRICTED"
+	Unauthorized        = "UNAUTHORIZED"
+	Internal            = "INTERNAL"
+	Other               = "OTHER"
+	PaymentFailed       = "PAYMENT_FAILED"
+	NotFound            = "NOT_FOUND"
+)
+
+// Error is an error response of a wallet service. A Wallet returns one to give
+// a client a specific error code.
+type Error struct {
+	Code    S `json:"code"`
+	Message S `json:"message"`
+}
+
+func (e *Error) Error() S { return e.Code + ": " + e.Message }
+
+// Request is the decrypted content of a request event.
+type Request struct {
+	Method S               `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// Response is the decrypted content of a response event.
+type Response struct {
+	ResultType S               `json:"result_type"`
+	Error      *Error          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+}
+
+// PayInvoiceParams are the parameters of pay_invoice.
+type PayInvoiceParams struct {
+	Invoice S `json:"invoice"`
+	// Amount in millisatoshis, for invoices without one.
+	Amount int64 `json:"amount,omitempty"`
+}
+
+// PayInvoiceResult is the result of pay_invoice.
+type PayInvoiceResult struct {
+	Preimage S     `json:"preimage"`
+	FeesPaid int64 `json:"fees_paid,omitempty"`
+}
+
+// MakeInvoiceParams are the parameters of make_invoice.
+type MakeInvoiceParams struct {
+	// Amount in millisatoshis.
+	Amount          int64 `json:"amount"`
+	Description     S     `json:"description,omitempty"`
+	DescriptionHash S     `json:"description_hash,omitempty"`
+	// Expiry in seconds from now.
+	Expiry int64 `json:"expiry,omitempty"`
+}
+
+// LookupInvoiceParams are the parameters of lookup_invoice, which needs one of
+// them.
+type LookupInvoiceParams struct {
+	PaymentHash S `json:"payment_hash,omitempty"`
+	Invoice     S `json:"invoice,omitempty"`
+}
+
+// ListTransactionsParams are the parameters of list_transactions.
+type ListTransactionsParams struct {
+	From   int64 `json:"from,omitempty"`
+	Until  int64 `json:"until,omitempty"`
+	Limit  int64 `json:"limit,omitempty"`
+	Offset int64 `json:"offset,omitempty"`
+	// Unpaid includes invoices that were not paid.
+	Unpaid bool `json:"unpaid,omitempty"`
+	// Type is "incoming" or "outgoing", or empty for both.
+	Type S `json:"type,omitempty"`
+}
+
+// Transaction is an invoice or payment of a wallet.
+type Transaction struct {
+	// Type is "incoming" or "outgoing".
+	Type            S     `json:"type"`
+	Invoice         S     `json:"invoice,omitempty"`
+	Description     S     `json:"description,omitempty"`
+	DescriptionHash S     `json:"description_hash,omitempty"`
+	Preimage        S     `json:"preimage,omitempty"`
+	PaymentHash     S     `json:"payment_hash"`
+	Amount          int64 `json:"amount"`
+	FeesPaid        int64 `json:"fees_paid"`
+	CreatedAt       int64 `json:"created_at"`
+	ExpiresAt       int64 `json:"expires_at,omitempty"`
+	SettledAt       int64 `json:"settled_at,omitempty"`
+}
+
+// GetBalanceResult is the result of get_balance.
+type GetBalanceResult struct {
+	// Balance in millisatoshis.
+	Balance int64 `json:"balance"`
+}
+
+// ListTransactionsResult is the result of list_transactions.
+type ListTransactionsResult struct {
+	Transactions []Transaction `json:"transactions"`
+}
+
+// Wallet is the lightning wallet behind a Service. Errors that are not an *Error
+// are returned to clients as INTERNAL errors.
+type Wallet interface {
+	PayInvoice(c Ctx, p *PayInvoiceParams) (r *PayInvoiceResult, err E)
+	MakeInvoice(c Ctx, p *MakeInvoiceParams) (tx *Transaction, err E)
+	GetBalance(c Ctx) (msat int64, err E)
+	ListTransactions(c Ctx, p *ListTransactionsParams) (txs []Transaction, err E)
+	LookupInvoice(c Ctx, p *LookupInvoiceParams) (tx *Transaction, err E)
+}
+
+// seal encrypts v as JSON to the shared key of the signer and the pubkey to, and
+// signs it as an event of kind k with tags for to and any more tags.
+func seal(signer crypto.Signer, to B, k *kind.T, v any, more ...*tag.T) (ev *event.T,
+	err E) {
+
+	var key, plain, content B
+	if key, err = signer.ECDH(to); Chk.E(err) {
+		return
+	}
+	if plain, err = json.Marshal(v); Chk.E(err) {
+		return
+	}
+	if content, err = encryption.EncryptNip4(S(plain), key); Chk.E(err) {
+		return
+	}
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: k, Content: content,
+		Tags: tags.New(append([]*tag.T{tag.New("p", hex.Enc(to))}, more...)...)}
+	if err = ev.Sign(signer); Chk.E(err) {
+		return
+	}
+	return
+}
+
+// open decrypts the JSON content of an event from its author into v.
+func open(signer crypto.Signer, ev *event.T, v any) (err E) {
+	var key, plain B
+	if key, err = signer.ECDH(ev.PubKey); Chk.E(err) {
+		return
+	}
+	if plain, err = encryption.DecryptNip4(S(ev.Content), key); err != nil {
+		return Errorf.E("could not decrypt event %0x: %w", ev.ID, err)
+	}
+	if err = json.Unmarshal(plain, v); err != nil {
+		return Errorf.E("invalid content of event %0x: %w", ev.ID, err)
+	}
+	return
+}
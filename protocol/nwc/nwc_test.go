@@ -0,0 +1,288 @@
+package nwc
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/sha256-simd"
+	"lukechampine.com/frand"
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/bolt11"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/crypto/p256k"
+	"nostr.mleku.dev/protocol/relaytest"
+	"nostr.mleku.dev/protocol/ws"
+	"util.mleku.dev/context"
+	"util.mleku.dev/hex"
+)
+
+// wallet is a mock wallet that pays its own invoices.
+type wallet struct {
+	mx        sync.Mutex
+	node      B
+	balance   int64
+	preimages map[S]B
+	txs       []Transaction
+}
+
+func (w *wallet) PayInvoice(c Ctx, p *PayInvoiceParams) (r *PayInvoiceResult, err E) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	var inv *bolt11.T
+	if inv, err = bolt11.Decode(p.Invoice); err != nil {
+		return
+	}
+	if inv.MSat > w.balance {
+		return nil, &Error{InsufficientBalance, "not enough funds"}
+	}
+	hash := hex.Enc(inv.PaymentHash)
+	preimage, ok := w.preimages[hash]
+	if !ok {
+		return nil, &Error{PaymentFailed, "no route"}
+	}
+	w.balance -= inv.MSat
+	for i := range w.txs {
+		if w.txs[i].PaymentHash == hash {
+			w.txs[i].SettledAt = inv.Timestamp + 1
+			w.txs[i].Preimage = hex.Enc(preimage)
+		}
+	}
+	w.txs = append(w.txs, Transaction{Type: "outgoing", Invoice: p.Invoice,
+		PaymentHash: hash, Preimage: hex.Enc(preimage), Amount: inv.MSat,
+		CreatedAt: inv.Timestamp, SettledAt: inv.Timestamp + 1})
+	return &PayInvoiceResult{Preimage: hex.Enc(preimage)}, nil
+}
+
+func (w *wallet) MakeInvoice(c Ctx, p *MakeInvoiceParams) (tx *Transaction, err E) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	preimage := frand.Bytes(32)
+	h := sha256.Sum256(preimage)
+	inv := &bolt11.T{Network: "bc", MSat: p.Amount, Timestamp: time.Now().Unix(),
+		PaymentHash: h[:], PaymentSecret: frand.Bytes(32), Description: p.Description,
+		Expiry: p.Expiry, MinFinalCLTV: bolt11.DefaultMinFinalCLTV}
+	var s S
+	if s, err = inv.Encode(w.node); err != nil {
+		return
+	}
+	w.preimages[hex.Enc(h[:])] = preimage
+	w.txs = append(w.txs, Transaction{Type: "incoming", Invoice: s,
+		Description: p.Description, PaymentHash: hex.Enc(h[:]), Amount: p.Amount,
+		CreatedAt: inv.Timestamp, ExpiresAt: inv.ExpiresAt()})
+	tx = &w.txs[len(w.txs)-1]
+	return
+}
+
+func (w *wallet) GetBalance(c Ctx) (msat int64, err E) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return w.balance, nil
+}
+
+func (w *wallet) ListTransactions(c Ctx, p *ListTransactionsParams) (txs []Transaction,
+	err E) {
+
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	for _, tx := range w.txs {
+		if (p.Type == "" || tx.Type == p.Type) && (p.Unpaid || tx.SettledAt != 0) {
+			txs = append(txs, tx)
+		}
+	}
+	return
+}
+
+func (w *wallet) LookupInvoice(c Ctx, p *LookupInvoiceParams) (tx *Transaction, err E) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	for i := range w.txs {
+		if w.txs[i].Type == "incoming" && (w.txs[i].PaymentHash == p.PaymentHash ||
+			w.txs[i].Invoice == p.Invoice) {
+			t := w.txs[i]
+			return &t, nil
+		}
+	}
+	return nil, &Error{NotFound, "no such invoice"}
+}
+
+func TestURI(t *testing.T) {
+	pub := strings.Repeat("b8", 32)
+	sec := strings.Repeat("71", 32)
+	s := Scheme + "://" + pub + "?relay=wss%3A%2F%2Frelay.example.com&relay=wss://r2.example.com" +
+		"&secret=" + sec + "&lud16=alice%40example.com"
+	u, err := ParseURI(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.Enc(u.WalletPubKey) != pub || hex.Enc(u.Secret) != sec || len(u.Relays) != 2 ||
+		u.Relays[0] != "wss://relay.example.com" || u.LUD16 != "alice@example.com" {
+		t.Fatalf("got %+v", u)
+	}
+	var u2 *URI
+	if u2, err = ParseURI(u.String()); err != nil {
+		t.Fatal(err)
+	}
+	if u2.String() != u.String() {
+		t.Fatalf("got %s expected %s", u2, u)
+	}
+	for _, bad := range []S{
+		"nostrwalletconnect://" + pub + "?relay=wss://r&secret=" + sec,
+		Scheme + "://" + pub[:62] + "?relay=wss://r&secret=" + sec,
+		Scheme + "://" + pub + "?secret=" + sec,
+		Scheme + "://" + pub + "?relay=wss://r&secret=abc",
+	} {
+		if _, err = ParseURI(bad); err == nil {
+			t.Errorf("%s should not parse", bad)
+		}
+	}
+}
+
+func TestService(t *testing.T) {
+	c, cancel := context.Timeout(context.Bg(), 20*time.Second)
+	defer cancel()
+	relay := relaytest.New()
+	defer relay.Close()
+	walletSigner := &p256k.Signer{}
+	if err := walletSigner.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	w := &wallet{node: frand.Bytes(32), balance: 100_000, preimages: make(map[S]B)}
+	svc := NewService(walletSigner, w)
+	sr, err := ws.RelayConnect(c, relay.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sr.Close()
+	go svc.Serve(c, sr)
+	var u *URI
+	if u, err = svc.NewConnection([]S{relay.URL}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if u, err = ParseURI(u.String()); err != nil {
+		t.Fatal(err)
+	}
+	var cl *Client
+	if cl, err = NewClient(c, u); err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	var methods []S
+	for i := 0; i < 50 && len(methods) == 0; i++ {
+		methods, err = cl.Info(c)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if strings.Join(methods, " ") != strings.Join(Methods, " ") {
+		t.Fatalf("got methods %v, %v", methods, err)
+	}
+	var msat int64
+	if msat, err = cl.GetBalance(c); err != nil || msat != 100_000 {
+		t.Fatalf("got balance %d, %v", msat, err)
+	}
+	var tx *Transaction
+	if tx, err = cl.MakeInvoice(c, &MakeInvoiceParams{Amount: 21_000, Description: "coffee",
+		Expiry: 600}); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Amount != 21_000 || tx.Description != "coffee" || tx.SettledAt != 0 {
+		t.Fatalf("got invoice %+v", tx)
+	}
+	var paid *PayInvoiceResult
+	if paid, err = cl.PayInvoice(c, tx.Invoice, 0); err != nil {
+		t.Fatal(err)
+	}
+	preimage, _ := hex.Dec(paid.Preimage)
+	if h := sha256.Sum256(preimage); hex.Enc(h[:]) != tx.PaymentHash {
+		t.Fatalf("preimage %s does not match payment hash %s", paid.Preimage, tx.PaymentHash)
+	}
+	var found *Transaction
+	if found, err = cl.LookupInvoice(c, &LookupInvoiceParams{PaymentHash: tx.PaymentHash}); err != nil {
+		t.Fatal(err)
+	}
+	if found.SettledAt == 0 || found.Preimage != paid.Preimage {
+		t.Fatalf("invoice not settled: %+v", found)
+	}
+	var txs []Transaction
+	if txs, err = cl.ListTransactions(c, &ListTransactionsParams{Type: "outgoing"}); err != nil ||
+		len(txs) != 1 || txs[0].Amount != 21_000 {
+		t.Fatalf("got transactions %+v, %v", txs, err)
+	}
+	if msat, err = cl.GetBalance(c); err != nil || msat != 79_000 {
+		t.Fatalf("got balance %d, %v", msat, err)
+	}
+	// errors of the wallet reach the client with their codes.
+	if tx, err = cl.MakeInvoice(c, &MakeInvoiceParams{Amount: 1_000_000}); err != nil {
+		t.Fatal(err)
+	}
+	var e *Error
+	if _, err = cl.PayInvoice(c, tx.Invoice, 0); !errors.As(err, &e) ||
+		e.Code != InsufficientBalance {
+		t.Fatalf("expected %s, got %v", InsufficientBalance, err)
+	}
+	if _, err = cl.LookupInvoice(c, &LookupInvoiceParams{PaymentHash: "00"}); !errors.As(err, &e) ||
+		e.Code != NotFound {
+		t.Fatalf("expected %s, got %v", NotFound, err)
+	}
+	if err = cl.Call(c, "pay_keysend", nil, nil); !errors.As(err, &e) || e.Code != NotImplemented {
+		t.Fatalf("expected %s, got %v", NotImplemented, err)
+	}
+	// a revoked client is not served.
+	svc.Revoke(cl.PubKey())
+	if _, err = cl.GetBalance(c); !errors.As(err, &e) || e.Code != Unauthorized {
+		t.Fatalf("expected %s, got %v", Unauthorized, err)
+	}
+}
+
+func TestHandleExpired(t *testing.T) {
+	walletSigner, client := &p256k.Signer{}, &p256k.Signer{}
+	if err := walletSigner.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService(walletSigner, &wallet{preimages: make(map[S]B)})
+	svc.Authorize(client.Pub())
+	exp := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	ev, err := seal(client, walletSigner.Pub(), kind.NWCWalletRequest, &Request{Method: GetBalance},
+		tag.New("expiration", exp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = svc.Handle(context.Bg(), ev); err == nil {
+		t.Fatal("expired request should not be answered")
+	}
+}
+
+func TestHandleUnauthorized(t *testing.T) {
+	walletSigner, client := &p256k.Signer{}, &p256k.Signer{}
+	if err := walletSigner.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService(walletSigner, &wallet{preimages: make(map[S]B)})
+	ev, err := seal(client, walletSigner.Pub(), kind.NWCWalletRequest,
+		&Request{Method: GetBalance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp *event.T
+	if resp, err = svc.Handle(context.Bg(), ev); err != nil {
+		t.Fatal(err)
+	}
+	r := &Response{}
+	if err = open(client, resp, r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ResultType != GetBalance || r.Error == nil || r.Error.Code != Unauthorized {
+		t.Fatalf("got result type %q error %v", r.ResultType, r.Error)
+	}
+}
@@ -0,0 +1,213 @@
+package nwc
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/filters"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/crypto/p256k"
+	"nostr.mleku.dev/protocol/ws"
+	"util.mleku.dev/hex"
+)
+
+// Service is the wallet service side of NIP-47: it answers the requests of the
+// clients it has authorized with its Wallet.
+type Service struct {
+	Wallet  Wallet
+	signer  crypto.Signer
+	mx      sync.RWMutex
+	clients map[S]bool
+}
+
+// NewService creates a wallet service that signs with signer.
+func NewService(signer crypto.Signer, w Wallet) *Service {
+	return &Service{Wallet: w, signer: signer, clients: make(map[S]bool)}
+}
+
+// PubKey is the pubkey of the wallet service.
+func (s *Service) PubKey() B { return s.signer.Pub() }
+
+// Authorize lets the client with a pubkey make requests.
+func (s *Service) Authorize(pub B) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.clients[hex.Enc(pub)] = true
+}
+
+// Revoke stops the client with a pubkey from making requests.
+func (s *Service) Revoke(pub B) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.clients, hex.Enc(pub))
+}
+
+// Authorized returns true if the client with a pubkey may make requests.
+func (s *Service) Authorized(pub B) bool {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return s.clients[hex.Enc(pub)]
+}
+
+// NewConnection generates a secret for a new client, authorizes it, and returns
+// the URI to give to the client.
+func (s *Service) NewConnection(relays []S, lud16 S) (u *URI, err E) {
+	client := &p256k.Signer{}
+	if err = client.Generate(); Chk.E(err) {
+		return
+	}
+	s.Authorize(client.Pub())
+	return &URI{WalletPubKey: s.PubKey(), Relays: relays, Secret: client.Sec(),
+		LUD16: lud16}, nil
+}
+
+// Info creates the info event of the wallet service, which lists the methods it
+// supports.
+func (s *Service) Info() (ev *event.T, err E) {
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: kind.NWCWalletInfo,
+		Tags: tags.New(), Content: B(strings.Join(Methods, " "))}
+	if err = ev.Sign(s.signer); Chk.E(err) {
+		return
+	}
+	return
+}
+
+// Serve publishes the info event to the relay and answers requests from it until
+// the context is done or the relay connection closes.
+func (s *Service) Serve(c Ctx, relay *ws.Client) (err E) {
+	var info *event.T
+	if info, err = s.Info(); err != nil {
+		return
+	}
+	if err = relay.Publish(c, info); err != nil {
+		return
+	}
+	f := filter.New()
+	f.Kinds = kinds.New(kind.NWCWalletRequest)
+	f.Tags = tags.New(tag.New(B("#p"), s.PubKey()))
+	// requests from before the service started are not paid again.
+	f.Since = timestamp.Now()
+	var sub *ws.Subscription
+	if sub, err = relay.Subscribe(c, filters.New(f)); err != nil {
+		return
+	}
+	defer sub.Unsub()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return Errorf.E("wallet relay subscription closed")
+			}
+			resp, e := s.Handle(c, ev)
+			if e != nil {
+				Log.D.F("wallet request %0x: %v", ev.ID, e)
+				continue
+			}
+			if e = relay.Publish(c, resp); e != nil {
+				Log.E.F("could not publish wallet response %0x: %v", resp.ID, e)
+			}
+		}
+	}
+}
+
+// Handle answers a request event with a signed response event. Requests that
+// have expired or can't be decrypted are not answered, and return an error.
+func (s *Service) Handle(c Ctx, ev *event.T) (resp *event.T, err E) {
+	if ev.Kind == nil || !ev.Kind.Equal(kind.NWCWalletRequest) {
+		return nil, Errorf.E("event is not a wallet request")
+	}
+	if t := ev.Tags.GetFirst(tag.New("expiration")); t != nil && t.Len() > 1 {
+		if exp, e := strconv.ParseInt(S(t.Value()), 10, 64); e == nil &&
+			exp < timestamp.Now().I64() {
+			return nil, Errorf.E("request has expired")
+		}
+	}
+	// the request is decrypted even when it is not authorized, so the error
+	// response has the result type of the method it answers.
+	req := &Request{}
+	if err = open(s.signer, ev, req); err != nil {
+		return
+	}
+	var r *Response
+	if !s.Authorized(ev.PubKey) {
+		r = &Response{Error: &Error{Unauthorized, "no wallet connection for this pubkey"}}
+	} else {
+		r = s.dispatch(c, req)
+	}
+	r.ResultType = req.Method
+	return seal(s.signer, ev.PubKey, kind.NWCWalletResponse, r, tag.New("e", ev.IDString()))
+}
+
+// dispatch calls the method of the Wallet for a request.
+func (s *Service) dispatch(c Ctx, req *Request) (r *Response) {
+	var result any
+	var err E
+	params := func(p any) E {
+		if len(req.Params) == 0 {
+			return nil
+		}
+		if e := json.Unmarshal(req.Params, p); e != nil {
+			return &Error{Other, "invalid params: " + e.Error()}
+		}
+		return nil
+	}
+	switch req.Method {
+	case PayInvoice:
+		p := &PayInvoiceParams{}
+		if err = params(p); err == nil {
+			result, err = s.Wallet.PayInvoice(c, p)
+		}
+	case MakeInvoice:
+		p := &MakeInvoiceParams{}
+		if err = params(p); err == nil {
+			result, err = s.Wallet.MakeInvoice(c, p)
+		}
+	case GetBalance:
+		var msat int64
+		if msat, err = s.Wallet.GetBalance(c); err == nil {
+			result = &GetBalanceResult{msat}
+		}
+	case ListTransactions:
+		p := &ListTransactionsParams{}
+		if err = params(p); err == nil {
+			var txs []Transaction
+			if txs, err = s.Wallet.ListTransactions(c, p); err == nil {
+				result = &ListTransactionsResult{append([]Transaction{}, txs...)}
+			}
+		}
+	case LookupInvoice:
+		p := &LookupInvoiceParams{}
+		if err = params(p); err == nil {
+			result, err = s.Wallet.LookupInvoice(c, p)
+		}
+	default:
+		err = &Error{NotImplemented, "unknown method '" + req.Method + "'"}
+	}
+	r = &Response{}
+	if err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			e = &Error{Internal, err.Error()}
+		}
+		r.Error = e
+		return
+	}
+	if r.Result, err = json.Marshal(result); Chk.E(err) {
+		r.Error = &Error{Internal, err.Error()}
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package nwc
+
+import (
+	"net/url"
+	"strings"
+
+	. "nostr.mleku.dev"
+
+	"util.mleku.dev/hex"
+)
+
+// Scheme is the scheme of Nostr Wallet Connect URIs.
+const Scheme = "nostr+walletconnect"
+
+// URI is a connection to a wallet service, as given to a client by the wallet.
+type URI struct {
+	// WalletPubKey is the 32 byte pubkey of the wallet service.
+	WalletPubKey B
+	// Relays are the relays the wallet service listens on.
+	Relays []S
+	// Secret is the 32 byte secret key the client signs and encrypts requests
+	// with.
+	Secret B
+	// LUD16 is the lightning address of the wallet, if it has one.
+	LUD16 S
+}
+
+// ParseURI parses a nostr+walletconnect:// URI.
+func ParseURI(s S) (u *URI, err E) {
+	var p *url.URL
+	if p, err = url.Parse(strings.TrimSpace(s)); err != nil {
+		return nil, Errorf.E("invalid wallet connect uri: %w", err)
+	}
+	if p.Scheme != Scheme {
+		return nil, Errorf.E("invalid wallet connect uri scheme '%s'", p.Scheme)
+	}
+	// the pubkey is the host for nostr+walletconnect://pub and the opaque part
+	// for nostr+walletconnect:pub.
+	pub := p.Host
+	if pub == "" {
+		pub = p.Opaque
+	}
+	u = &URI{}
+	if u.WalletPubKey, err = hex.Dec(pub); err != nil || len(u.WalletPubKey) != 32 {
+		return nil, Errorf.E("invalid wallet pubkey '%s'", pub)
+	}
+	q := p.Query()
+	for _, r := range q["relay"] {
+		if r != "" {
+			u.Relays = append(u.Relays, r)
+		}
+	}
+	if len(u.Relays) == 0 {
+		return nil, Errorf.E("wallet connect uri has no relay")
+	}
+	if u.Secret, err = hex.Dec(q.Get("secret")); err != nil || len(u.Secret) != 32 {
+		return nil, Errorf.E("wallet connect uri has no valid secret")
+	}
+	u.LUD16 = q.Get("lud16")
+	return
+}
+
+// String encodes the URI.
+func (u *URI) String() S {
+	q := url.Values{"relay": u.Relays, "secret": {hex.Enc(u.Secret)}}
+	if u.LUD16 != "" {
+		q.Set("lud16", u.LUD16)
+	}
+	return Scheme + "://" + hex.Enc(u.WalletPubKey) + "?" + q.Encode()
+}
@@ -1,18 +1,20 @@
 package relayinfo
 
 import (
+	"bytes"
 	"encoding/json"
-	"io"
 	"net/http"
 	. "nostr.mleku.dev"
 	"time"
 
+	"nostr.mleku.dev/protocol/httpclient"
 	"util.mleku.dev/context"
 	"util.mleku.dev/normalize"
 )
 
-// Fetch fetches the NIP-11 Info.
-func Fetch(c Ctx, u B) (info *T, err E) {
+// Fetch fetches the NIP-11 Info. The options change how the request is made,
+// for example to go through a proxy.
+func Fetch(c Ctx, u B, opts ...httpclient.Option) (info *T, err E) {
 	if _, ok := c.Deadline(); !ok {
 		// if no timeout is set, force it to 7 seconds
 		var cancel context.F
@@ -20,21 +22,14 @@ func Fetch(c Ctx, u B) (info *T, err E) {
 		defer cancel()
 	}
 	u = normalize.URL(u)
-	var req *http.Request
-	if req, err = http.NewRequestWithContext(c, http.MethodGet, S(u), nil); Chk.E(err) {
-		return
+	// the info is served over http from the websocket address
+	if bytes.HasPrefix(u, B("ws")) {
+		u = append(B("http"), u[2:]...)
 	}
 	// add the NIP-11 header
-	req.Header.Add("Accept", "application/nostr+json")
-	// send the response
-	var resp *http.Response
-	if resp, err = http.DefaultClient.Do(req); Chk.E(err) {
-		err = Errorf.E("request failed: %w", err)
-		return
-	}
-	defer resp.Body.Close()
+	header := http.Header{"Accept": {"application/nostr+json"}}
 	var b B
-	if b, err = io.ReadAll(resp.Body); Chk.E(err) {
+	if b, err = httpclient.New(opts...).Get(c, S(u), header); Chk.E(err) {
 		return
 	}
 	info = &T{}
@@ -1,6 +1,13 @@
 package relayinfo
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nostr.mleku.dev/protocol/httpclient"
+)
 
 func TestAddSupportedNIP(t *testing.T) {
 	info := NewInfo(nil)
@@ -13,3 +20,27 @@ func TestAddSupportedNIP(t *testing.T) {
 		}
 	}
 }
+
+type transport func(r *http.Request) (*http.Response, error)
+
+func (t transport) RoundTrip(r *http.Request) (*http.Response, error) { return t(r) }
+
+func TestFetch(t *testing.T) {
+	tr := transport(func(r *http.Request) (*http.Response, error) {
+		if r.URL.String() != "https://relay.example.com" ||
+			r.Header.Get("Accept") != "application/nostr+json" {
+			t.Errorf("unexpected request %s %v", r.URL, r.Header)
+		}
+		w := httptest.NewRecorder()
+		w.WriteString(`{"name":"example","supported_nips":[1,11]}`)
+		return w.Result(), nil
+	})
+	info, err := Fetch(context.Background(), []byte("wss://relay.example.com/"),
+		httpclient.WithTransport(tr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "example" || !info.HasNIP(11) {
+		t.Fatalf("unexpected info %v", info)
+	}
+}
@@ -0,0 +1,171 @@
+// Package relaytest is a minimal in-process relay for testing clients. It keeps
+// every event it is sent, including ephemeral ones, answers REQ with the stored
+// events that match and an EOSE, and sends new events to the subscriptions they
+// match. It answers COUNT with a HyperLogLog sketch for the filters that can
+// have one. An Accept hook lets a test put relay policy in front of the store.
+package relaytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"golang.org/x/net/websocket"
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/envelopes"
+	"nostr.mleku.dev/codec/envelopes/closeenvelope"
+	"nostr.mleku.dev/codec/envelopes/countenvelope"
+	"nostr.mleku.dev/codec/envelopes/eoseenvelope"
+	"nostr.mleku.dev/codec/envelopes/eventenvelope"
+	"nostr.mleku.dev/codec/envelopes/okenvelope"
+	"nostr.mleku.dev/codec/envelopes/reqenvelope"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/filters"
+	"nostr.mleku.dev/codec/hll"
+)
+
+// T is an in-process relay.
+type T struct {
+	*httptest.Server
+	// URL is the websocket URL of the relay.
+	URL S
+	// Accept, if set, decides whether an event is stored, and returns any more
+	// events the relay stores and sends along with it. Set it before connecting.
+	Accept func(ev *event.T) (more []*event.T, err E)
+	mx     sync.Mutex
+	events []*event.T
+	subs   map[*websocket.Conn]map[S]*filters.T
+}
+
+// New starts a relay. Close it when done.
+func New() (r *T) {
+	r = &T{subs: make(map[*websocket.Conn]map[S]*filters.T)}
+	r.Server = httptest.NewServer(&websocket.Server{
+		// nostr clients send no origin.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   r.handle,
+	})
+	r.URL = "ws" + r.Server.URL[len("http"):]
+	return
+}
+
+// Add stores events as if they had been sent to the relay.
+func (r *T) Add(evs ...*event.T) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for _, ev := range evs {
+		r.store(ev)
+	}
+}
+
+// Events returns the events the relay has been sent.
+func (r *T) Events() (evs []*event.T) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return append(evs, r.events...)
+}
+
+func send(conn *websocket.Conn, m interface{ MarshalJSON(B) (B, E) }) {
+	if b, err := m.MarshalJSON(nil); !Chk.E(err) {
+		websocket.Message.Send(conn, S(b))
+	}
+}
+
+func (r *T) handle(conn *websocket.Conn) {
+	r.mx.Lock()
+	r.subs[conn] = make(map[S]*filters.T)
+	r.mx.Unlock()
+	defer func() {
+		r.mx.Lock()
+		delete(r.subs, conn)
+		r.mx.Unlock()
+	}()
+	for {
+		var msg S
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			return
+		}
+		l, rem, err := envelopes.Identify(B(msg))
+		if Chk.E(err) {
+			continue
+		}
+		r.mx.Lock()
+		switch l {
+		case eventenvelope.L:
+			env := eventenvelope.NewSubmission()
+			if _, err = env.UnmarshalJSON(rem); Chk.E(err) {
+				break
+			}
+			evs := []*event.T{env.T}
+			if r.Accept != nil {
+				var more []*event.T
+				if more, err = r.Accept(env.T); err != nil {
+					send(conn, okenvelope.NewFrom(env.T.ID, false, B(err.Error())))
+					break
+				}
+				evs = append(evs, more...)
+			}
+			send(conn, okenvelope.NewFrom(env.T.ID, true))
+			for _, ev := range evs {
+				r.store(ev)
+			}
+		case reqenvelope.L:
+			env := reqenvelope.New()
+			if _, err = env.UnmarshalJSON(rem); Chk.E(err) {
+				break
+			}
+			id := env.Subscription.String()
+			r.subs[conn][id] = env.Filters
+			for _, ev := range r.events {
+				if env.Filters.Match(ev) {
+					send(conn, eventenvelope.NewResultWith(id, ev))
+				}
+			}
+			send(conn, eoseenvelope.NewFrom(env.Subscription))
+		case countenvelope.L:
+			env := countenvelope.New()
+			if _, err = env.UnmarshalJSON(rem); Chk.E(err) {
+				break
+			}
+			res := &countenvelope.Response{ID: env.ID}
+			var sketch *hll.T
+			var offset N
+			if env.Filters.Len() == 1 {
+				if o, ok := hll.Offset(env.Filters.F[0]); ok {
+					sketch, offset = hll.New(), o
+				}
+			}
+			for _, ev := range r.events {
+				if env.Filters.Match(ev) {
+					res.Count++
+					if sketch != nil {
+						sketch.Add(offset, ev.PubKey)
+					}
+				}
+			}
+			if sketch != nil {
+				res.HLL = sketch.Bytes()
+			}
+			send(conn, res)
+		case closeenvelope.L:
+			env := closeenvelope.New()
+			if _, err = env.UnmarshalJSON(rem); !Chk.E(err) {
+				delete(r.subs[conn], env.ID.String())
+			}
+		}
+		r.mx.Unlock()
+	}
+}
+
+// store keeps an event and sends it to the subscriptions it matches.
+func (r *T) store(ev *event.T) {
+	r.events = append(r.events, ev)
+	for c, subs := range r.subs {
+		for id, ff := range subs {
+			if ff.Match(ev) {
+				send(c, eventenvelope.NewResultWith(id, ev))
+			}
+		}
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"nostr.mleku.dev/codec/filters"
 	"nostr.mleku.dev/codec/kind"
 	"nostr.mleku.dev/protocol/auth"
+	"nostr.mleku.dev/protocol/httpclient"
 	"util.mleku.dev/atomic"
 	"util.mleku.dev/context"
 	"util.mleku.dev/normalize"
@@ -51,6 +52,7 @@ type Client struct {
 	subscriptionChannelCloseQueue chan *Subscription
 	signatureChecker              func(*event.T) bool
 	AssumeValid                   bool // this will skip verifying signatures for events received from this relay
+	connectionOptions             []httpclient.Option
 }
 
 type writeRequest struct {
@@ -95,6 +97,7 @@ type RelayOption interface {
 var (
 	_ RelayOption = (WithNoticeHandler)(nil)
 	_ RelayOption = (WithSignatureChecker)(nil)
+	_ RelayOption = (WithDialer)(nil)
 )
 
 // WithNoticeHandler just takes notices and is expected to do something with them. when not
@@ -118,6 +121,15 @@ func (sc WithSignatureChecker) ApplyRelayOption(r *Client) {
 	r.signatureChecker = sc
 }
 
+// WithDialer opens the connection to the relay with a custom dialer, such as one
+// for a SOCKS5 proxy.
+type WithDialer httpclient.DialFunc
+
+func (d WithDialer) ApplyRelayOption(r *Client) {
+	r.connectionOptions = append(r.connectionOptions,
+		httpclient.WithDialer(httpclient.DialFunc(d)))
+}
+
 // String just returns the relay URL.
 func (r *Client) String() string {
 	return r.URL
@@ -152,7 +164,8 @@ func (r *Client) ConnectWithTLS(ctx Ctx, tlsConfig *tls.Config) error {
 		ctx, cancel = context.Timeout(ctx, 7*time.Second)
 		defer cancel()
 	}
-	conn, err := NewConnection(ctx, r.URL, r.RequestHeader, tlsConfig)
+	conn, err := NewConnection(ctx, r.URL, r.RequestHeader, tlsConfig,
+		r.connectionOptions...)
 	if err != nil {
 		return Errorf.E("error opening websocket to '%s': %w", r.URL, err)
 	}
@@ -209,7 +222,9 @@ func (r *Client) ConnectWithTLS(ctx Ctx, tlsConfig *tls.Config) error {
 				r.Close()
 				break
 			}
-			message := buf.Bytes()
+			// events are decoded in place and handed to subscriptions, so they
+			// must not share the buffer with the next message.
+			message := bytes.Clone(buf.Bytes())
 			Log.D.F("{%s} %v\n", r.URL, message)
 
 			var t S
@@ -287,7 +302,10 @@ func (r *Client) ConnectWithTLS(ctx Ctx, tlsConfig *tls.Config) error {
 					continue
 				}
 				if subscription, ok := r.Subscriptions.Load(env.ID.String()); ok && subscription.countResult != nil {
-					subscription.countResult <- env.Count
+					select {
+					case subscription.countResult <- env:
+					default:
+					}
 				}
 			case okenvelope.L:
 				env := okenvelope.New()
@@ -331,26 +349,25 @@ func (r *Client) Auth(c Ctx, signer crypto.Signer) error {
 
 // publish can be used both for EVENT and for AUTH
 func (r *Client) publish(ctx Ctx, ev *event.T) (err E) {
-	var cancel context.F
 	if _, ok := ctx.Deadline(); !ok {
 		// if no timeout is set, force it to 7 seconds
+		var cancel context.F
 		ctx, cancel = context.TimeoutCause(ctx, 7*time.Second,
 			Errorf.E("given up waiting for an OK"))
 		defer cancel()
-	} else {
-		// otherwise make the context cancellable so we can stop everything upon receiving an "OK"
-		ctx, cancel = context.Cancel(ctx)
-		defer cancel()
 	}
-	// listen for an OK callback
-	gotOk := false
+	// listen for an OK callback, which runs on the reader goroutine.
+	okc := make(chan E, 1)
 	id := ev.IDString()
 	r.okCallbacks.Store(id, func(ok bool, reason string) {
-		gotOk = true
+		var e E
 		if !ok {
-			err = Errorf.E("msg: %s", reason)
+			e = Errorf.E("msg: %s", reason)
+		}
+		select {
+		case okc <- e:
+		default:
 		}
-		cancel()
 	})
 	defer r.okCallbacks.Delete(id)
 	// publish event
@@ -366,20 +383,16 @@ func (r *Client) publish(ctx Ctx, ev *event.T) (err E) {
 	}
 	Log.T.F("{%s} sending %s\n", r.URL, b)
 	if err = <-r.Write(b); err != nil {
-		return err
+		return
 	}
-	for {
-		select {
-		case <-ctx.Done():
-			// this will be called when we get an OK or when the context has been canceled
-			if gotOk {
-				return err
-			}
-			return ctx.Err()
-		case <-r.connectionContext.Done():
-			// this is caused when we lose connectivity
-			return err
-		}
+	select {
+	case err = <-okc:
+		return
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.connectionContext.Done():
+		// this is caused when we lose connectivity
+		return
 	}
 }
 
@@ -465,12 +478,24 @@ func (r *Client) QuerySync(ctx Ctx, f *filter.T,
 	}
 }
 
+// Count sends a COUNT request to the relay and returns the count.
 func (r *Client) Count(c Ctx, ff *filters.T, opts ...SubscriptionOption) (int, error) {
+	res, err := r.CountResponse(c, ff, opts...)
+	if err != nil {
+		return 0, err
+	}
+	return res.Count, nil
+}
+
+// CountResponse sends a COUNT request to the relay and returns its response,
+// which has a HyperLogLog sketch if the relay supports them for the filter.
+func (r *Client) CountResponse(c Ctx, ff *filters.T,
+	opts ...SubscriptionOption) (*countenvelope.Response, error) {
 	sub := r.PrepareSubscription(c, ff, opts...)
-	sub.countResult = make(chan int)
+	sub.countResult = make(chan *countenvelope.Response, 1)
 
 	if err := sub.Fire(); err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	defer sub.Unsub()
@@ -484,10 +509,10 @@ func (r *Client) Count(c Ctx, ff *filters.T, opts ...SubscriptionOption) (int, e
 
 	for {
 		select {
-		case count := <-sub.countResult:
-			return count, nil
+		case res := <-sub.countResult:
+			return res, nil
 		case <-c.Done():
-			return 0, c.Err()
+			return nil, c.Err()
 		}
 	}
 }
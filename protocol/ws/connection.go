@@ -15,6 +15,7 @@ import (
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
+	"nostr.mleku.dev/protocol/httpclient"
 )
 
 type Connection struct {
@@ -29,14 +30,25 @@ type Connection struct {
 	msgStateW         *wsflate.MessageState
 }
 
+// NewConnection dials a websocket. The options set the dialer, for example to go
+// through a SOCKS5 proxy, and the User-Agent if requestHeader has none.
 func NewConnection(ctx context.Context, url string, requestHeader http.Header,
-	tlsConfig *tls.Config) (*Connection, error) {
+	tlsConfig *tls.Config, opts ...httpclient.Option) (*Connection, error) {
+	o := httpclient.New(opts...)
+	if o.UserAgent != "" && requestHeader.Get("User-Agent") == "" {
+		requestHeader = requestHeader.Clone()
+		if requestHeader == nil {
+			requestHeader = http.Header{}
+		}
+		requestHeader.Set("User-Agent", o.UserAgent)
+	}
 	dialer := ws.Dialer{
 		Header: ws.HandshakeHeaderHTTP(requestHeader),
 		Extensions: []httphead.Option{
 			wsflate.DefaultParameters.Option(),
 		},
 		TLSConfig: tlsConfig,
+		NetDial:   o.Dial,
 	}
 	conn, _, hs, err := dialer.Dial(ctx, url)
 	if err != nil {
@@ -3,9 +3,11 @@ package ws
 import (
 	"fmt"
 	. "nostr.mleku.dev"
+	"nostr.mleku.dev/codec/envelopes/countenvelope"
 	"nostr.mleku.dev/codec/event"
 	"nostr.mleku.dev/codec/filter"
 	"nostr.mleku.dev/codec/filters"
+	"nostr.mleku.dev/codec/hll"
 	"nostr.mleku.dev/codec/timestamp"
 	"nostr.mleku.dev/crypto"
 	"slices"
@@ -356,6 +358,69 @@ func (pool *SimplePool) QuerySingle(c Ctx, urls []S, f *filter.T) *IncomingEvent
 	return nil
 }
 
+// CountMany sends a COUNT request for a filter to several relays. If every
+// relay that answers sends a HyperLogLog sketch, the sketches are merged, so an
+// author counted by several relays is counted once, and the count is an
+// estimate. Otherwise it is the largest count of any relay.
+func (pool *SimplePool) CountMany(c Ctx, urls []S, f *filter.T) (count int,
+	approximate bool, err E) {
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+	var responses []*countenvelope.Response
+	seen := make(map[S]bool)
+	for _, url := range urls {
+		nm := S(normalize.URL(url))
+		if seen[nm] {
+			continue
+		}
+		seen[nm] = true
+		wg.Add(1)
+		go func(nm S) {
+			defer wg.Done()
+			relay, e := pool.EnsureRelay(nm)
+			var res *countenvelope.Response
+			if e == nil {
+				res, e = relay.CountResponse(c, filters.New(f))
+			}
+			mx.Lock()
+			defer mx.Unlock()
+			if e != nil {
+				Log.D.F("count on %s failed: %v", nm, e)
+				err = e
+				return
+			}
+			responses = append(responses, res)
+		}(nm)
+	}
+	wg.Wait()
+	if len(responses) == 0 {
+		if err == nil {
+			err = Errorf.E("no relays to count on")
+		}
+		return 0, false, err
+	}
+	err = nil
+	sketch := hll.New()
+	for _, res := range responses {
+		if res.Count > count {
+			count, approximate = res.Count, res.Approximate
+		}
+		if sketch != nil {
+			var h *hll.T
+			if h, err = hll.FromBytes(res.HLL); err != nil {
+				// this relay sent no sketch, so they can't be merged.
+				sketch, err = nil, nil
+				continue
+			}
+			sketch.Merge(h)
+		}
+	}
+	if sketch != nil {
+		return sketch.Estimate(), true, nil
+	}
+	return
+}
+
 func (pool *SimplePool) batchedSubMany(
 	c Ctx,
 	dfs []DirectedFilters,
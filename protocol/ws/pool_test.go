@@ -0,0 +1,68 @@
+package ws
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/minio/sha256-simd"
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/filter"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/kinds"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/protocol/relaytest"
+	"util.mleku.dev/context"
+)
+
+// reaction makes a reaction to id by a made up pubkey that is the same for the
+// same n.
+func reaction(id B, n N) *event.T {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(n))
+	pub := sha256.Sum256(b[:])
+	return &event.T{ID: make(B, 32), PubKey: pub[:], CreatedAt: timestamp.Now(),
+		Kind: kind.Reaction, Tags: tags.New(tag.New(B("e"), id)), Content: B("+"),
+		Sig: make(B, 64)}
+}
+
+func TestCountMany(t *testing.T) {
+	c, cancel := context.Timeout(context.Bg(), 10*time.Second)
+	defer cancel()
+	id := sha256.Sum256(B("note"))
+	a, b := relaytest.New(), relaytest.New()
+	defer a.Close()
+	defer b.Close()
+	// 3000 people react, and 1000 of them reach both relays.
+	for i := range 3000 {
+		if i < 2000 {
+			a.Add(reaction(id[:], i))
+		}
+		if i >= 1000 {
+			b.Add(reaction(id[:], i))
+		}
+	}
+	pool := NewSimplePool(c)
+	f := filter.New()
+	f.Kinds = kinds.New(kind.Reaction)
+	f.Tags = tags.New(tag.New(B("#e"), id[:]))
+	count, approximate, err := pool.CountMany(c, []S{a.URL, b.URL, a.URL}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approximate || count < 2700 || count > 3300 {
+		t.Fatalf("3000 counted as %d, approximate %v", count, approximate)
+	}
+	// without a sketch the best there is is the largest count.
+	f.Tags = tags.New()
+	if count, approximate, err = pool.CountMany(c, []S{a.URL, b.URL}, f); err != nil {
+		t.Fatal(err)
+	}
+	if approximate || count != 2000 {
+		t.Fatalf("got %d, approximate %v", count, approximate)
+	}
+}
@@ -24,7 +24,7 @@ type Subscription struct {
 	Filters *filters.T
 
 	// for this to be treated as a COUNT and not a REQ this must be set
-	countResult chan int
+	countResult chan *countenvelope.Response
 
 	// The Events channel emits all EVENTs that come in a Subscription will be closed when the
 	// subscription ends
@@ -0,0 +1,169 @@
+package zap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ec.mleku.dev/v2/bech32"
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/bolt11"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/protocol/httpclient"
+)
+
+// LNURLHRP is the prefix of bech32 encoded LNURLs.
+var LNURLHRP = B("lnurl")
+
+// EncodeLNURL encodes a URL as a bech32 LNURL, as used in lud06 fields.
+func EncodeLNURL(u S) (lnurl S, err E) {
+	var b5 B
+	if b5, err = bech32.ConvertBits(B(u), 8, 5, true); err != nil {
+		return
+	}
+	var b B
+	if b, err = bech32.Encode(LNURLHRP, b5); err != nil {
+		return
+	}
+	return S(b), nil
+}
+
+// URL returns the URL of an LNURL, which may be a bech32 LNURL, a lightning
+// address (lud16) or a URL.
+func URL(lnurl S) (u S, err E) {
+	lnurl = strings.TrimPrefix(strings.TrimPrefix(lnurl, "lightning:"), "LIGHTNING:")
+	switch {
+	case strings.HasPrefix(strings.ToLower(lnurl), "lnurl1"):
+		var hrp, b5, b B
+		if hrp, b5, err = bech32.DecodeNoLimit(B(strings.ToLower(lnurl))); err != nil {
+			err = Errorf.E("invalid lnurl: %w", err)
+			return
+		}
+		if !Equals(hrp, LNURLHRP) {
+			err = Errorf.E("invalid lnurl prefix '%s'", hrp)
+			return
+		}
+		if b, err = bech32.ConvertBits(b5, 5, 8, false); err != nil {
+			err = Errorf.E("invalid lnurl: %w", err)
+			return
+		}
+		return S(b), nil
+	case strings.Contains(lnurl, "@"):
+		name, domain, _ := strings.Cut(lnurl, "@")
+		if name == "" || domain == "" || strings.ContainsAny(domain, "/@") {
+			err = Errorf.E("invalid lightning address '%s'", lnurl)
+			return
+		}
+		return "https://" + domain + "/.well-known/lnurlp/" + name, nil
+	case strings.HasPrefix(lnurl, "https://") || strings.HasPrefix(lnurl, "http://"):
+		return lnurl, nil
+	}
+	return "", Errorf.E("not an lnurl: '%s'", lnurl)
+}
+
+// PayParams is the LNURL-pay response of a lightning address, with the NIP-57
+// fields.
+type PayParams struct {
+	Tag         S     `json:"tag"`
+	Callback    S     `json:"callback"`
+	MinSendable int64 `json:"minSendable"`
+	MaxSendable int64 `json:"maxSendable"`
+	Metadata    S     `json:"metadata"`
+	// AllowsNostr is true if the provider publishes zap receipts.
+	AllowsNostr bool `json:"allowsNostr"`
+	// NostrPubkey is the hex pubkey that signs the zap receipts.
+	NostrPubkey S `json:"nostrPubkey"`
+}
+
+// lnurlError is the error response of LNURL.
+type lnurlError struct {
+	Status S `json:"status"`
+	Reason S `json:"reason"`
+}
+
+// getJSON requests a URL and decodes its JSON response into v, returning any
+// LNURL error response as an error.
+func getJSON(c Ctx, u S, v any, opts ...httpclient.Option) (err E) {
+	var b B
+	if b, err = httpclient.New(opts...).Get(c, u,
+		http.Header{"Accept": {"application/json"}}); err != nil {
+		return
+	}
+	var le lnurlError
+	if json.Unmarshal(b, &le) == nil && strings.EqualFold(le.Status, "ERROR") {
+		return Errorf.E("lnurl error: %s", le.Reason)
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return Errorf.E("invalid lnurl response: %w", err)
+	}
+	return
+}
+
+// FetchPayParams gets the LNURL-pay parameters of an LNURL or lightning address.
+func FetchPayParams(c Ctx, lnurl S, opts ...httpclient.Option) (p *PayParams, err E) {
+	var u S
+	if u, err = URL(lnurl); err != nil {
+		return
+	}
+	p = &PayParams{}
+	if err = getJSON(c, u, p, opts...); err != nil {
+		return nil, err
+	}
+	if p.Tag != "payRequest" || p.Callback == "" {
+		return nil, Errorf.E("%s is not an lnurl-pay endpoint", u)
+	}
+	return
+}
+
+// FetchInvoice asks the LNURL-pay callback for an invoice for a zap request, and
+// checks that the invoice commits to the zap request and is for its amount.
+func FetchInvoice(c Ctx, p *PayParams, req *event.T, opts ...httpclient.Option) (invoice S,
+	err E) {
+
+	if !p.AllowsNostr {
+		err = Errorf.E("lnurl provider does not support zaps")
+		return
+	}
+	var r *Request
+	if r, err = ParseRequest(req); err != nil {
+		return
+	}
+	if r.MSat == 0 {
+		err = Errorf.E("zap request has no amount")
+		return
+	}
+	if r.MSat < p.MinSendable || (p.MaxSendable > 0 && r.MSat > p.MaxSendable) {
+		err = Errorf.E("amount of %d msat is not between %d and %d", r.MSat,
+			p.MinSendable, p.MaxSendable)
+		return
+	}
+	var u *url.URL
+	if u, err = url.Parse(p.Callback); err != nil {
+		err = Errorf.E("invalid callback: %w", err)
+		return
+	}
+	q := u.Query()
+	q.Set("amount", strconv.FormatInt(r.MSat, 10))
+	q.Set("nostr", S(req.Serialize()))
+	if r.LNURL != "" {
+		q.Set("lnurl", r.LNURL)
+	}
+	u.RawQuery = q.Encode()
+	var resp struct {
+		PR S `json:"pr"`
+	}
+	if err = getJSON(c, u.String(), &resp, opts...); err != nil {
+		return
+	}
+	var inv *bolt11.T
+	if inv, err = bolt11.Decode(resp.PR); err != nil {
+		return
+	}
+	if err = checkInvoice(inv, req.Serialize(), r.MSat); err != nil {
+		return
+	}
+	return resp.PR, nil
+}
@@ -0,0 +1,273 @@
+// Package zap implements NIP-57 lightning zaps: zap requests, which ask an
+// LNURL provider for an invoice, and the zap receipts the provider publishes
+// when the invoice is paid.
+package zap
+
+import (
+	"strconv"
+
+	"github.com/minio/sha256-simd"
+	. "nostr.mleku.dev"
+
+	"nostr.mleku.dev/codec/bolt11"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto"
+	"nostr.mleku.dev/protocol/httpclient"
+	"util.mleku.dev/hex"
+)
+
+// Request is a zap request.
+type Request struct {
+	// Recipient is the 32 byte pubkey that is zapped.
+	Recipient B
+	// Event is the 32 byte id of the zapped event, if an event is zapped.
+	Event B
+	// Address is the address of the zapped addressable event, if one is.
+	Address S
+	// MSat is the amount in millisatoshis.
+	MSat int64
+	// Relays are where the receipt should be published.
+	Relays []S
+	// LNURL is the lnurl of the recipient, bech32 encoded.
+	LNURL S
+	// Content is a message for the recipient.
+	Content S
+}
+
+// Sign creates the kind 9734 zap request event and signs it.
+func (r *Request) Sign(signer crypto.Signer) (ev *event.T, err E) {
+	if len(r.Recipient) != 32 {
+		err = Errorf.E("recipient must be 32 bytes, got %d", len(r.Recipient))
+		return
+	}
+	if len(r.Relays) == 0 {
+		err = Errorf.E("a zap request needs relays for the receipt")
+		return
+	}
+	t := tags.New(tag.New(append([]S{"relays"}, r.Relays...)...))
+	if r.MSat > 0 {
+		t.T = append(t.T, tag.New("amount", strconv.FormatInt(r.MSat, 10)))
+	}
+	if r.LNURL != "" {
+		t.T = append(t.T, tag.New("lnurl", r.LNURL))
+	}
+	t.T = append(t.T, tag.New("p", hex.Enc(r.Recipient)))
+	if r.Event != nil {
+		t.T = append(t.T, tag.New("e", hex.Enc(r.Event)))
+	}
+	if r.Address != "" {
+		t.T = append(t.T, tag.New("a", r.Address))
+	}
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: kind.ZapRequest, Tags: t,
+		Content: B(r.Content)}
+	if err = ev.Sign(signer); Chk.E(err) {
+		return
+	}
+	return
+}
+
+// first returns the values of the first tag with a key, or nil if there is none,
+// and an error if there are several.
+func first(ev *event.T, key S) (values []B, err E) {
+	if ev.Tags == nil {
+		return
+	}
+	for _, t := range ev.Tags.T {
+		if t == nil || t.Len() < 2 || S(t.Key()) != key {
+			continue
+		}
+		if values != nil {
+			return nil, Errorf.E("more than one %s tag", key)
+		}
+		values = t.ToByteSlice()[1:]
+	}
+	return
+}
+
+// ParseRequest checks a zap request as NIP-57 asks an LNURL provider to, and
+// returns its fields.
+func ParseRequest(ev *event.T) (r *Request, err E) {
+	if ev.Kind == nil || !ev.Kind.Equal(kind.ZapRequest) {
+		return nil, Errorf.E("event is not a zap request")
+	}
+	var valid bool
+	if valid, err = ev.Verify(); err != nil || !valid {
+		return nil, Errorf.E("zap request has an invalid signature")
+	}
+	r = &Request{Content: S(ev.Content)}
+	var v []B
+	if v, err = first(ev, "p"); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, Errorf.E("zap request has no p tag")
+	}
+	if r.Recipient, err = hex.Dec(S(v[0])); err != nil || len(r.Recipient) != 32 {
+		return nil, Errorf.E("zap request has an invalid p tag")
+	}
+	if v, err = first(ev, "e"); err != nil {
+		return nil, err
+	}
+	if v != nil {
+		if r.Event, err = hex.Dec(S(v[0])); err != nil || len(r.Event) != 32 {
+			return nil, Errorf.E("zap request has an invalid e tag")
+		}
+	}
+	if v, err = first(ev, "a"); err != nil {
+		return nil, err
+	}
+	if v != nil {
+		r.Address = S(v[0])
+	}
+	if v, err = first(ev, "relays"); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, Errorf.E("zap request has no relays tag")
+	}
+	for _, relay := range v {
+		r.Relays = append(r.Relays, S(relay))
+	}
+	if v, err = first(ev, "amount"); err != nil {
+		return nil, err
+	}
+	if v != nil {
+		if r.MSat, err = strconv.ParseInt(S(v[0]), 10, 64); err != nil || r.MSat <= 0 {
+			return nil, Errorf.E("zap request has an invalid amount '%s'", v[0])
+		}
+	}
+	if v, err = first(ev, "lnurl"); err != nil {
+		return nil, err
+	}
+	if v != nil {
+		r.LNURL = S(v[0])
+	}
+	return
+}
+
+// checkInvoice checks that an invoice commits to a description and is for the
+// amount, if it is not zero.
+func checkInvoice(inv *bolt11.T, description B, msat int64) (err E) {
+	h := sha256.Sum256(description)
+	if !Equals(inv.DescriptionHash, h[:]) {
+		return Errorf.E("invoice description hash does not match the zap request")
+	}
+	if msat != 0 && inv.MSat != msat {
+		return Errorf.E("invoice is for %d msat, the zap request for %d", inv.MSat, msat)
+	}
+	return
+}
+
+// Receipt is a validated zap receipt.
+type Receipt struct {
+	// Request is the zap request that was paid.
+	*Request
+	// Sender is the pubkey of the zap request, which may be anonymous.
+	Sender B
+	// Invoice is the paid invoice.
+	Invoice *bolt11.T
+	// Preimage is the preimage of the payment, if the receipt has one.
+	Preimage B
+}
+
+// ParseReceipt validates a kind 9735 zap receipt as NIP-57 asks clients to: it
+// must be signed by nostrPubkey, the nostrPubkey of the recipient's LNURL
+// provider, the bolt11 invoice must commit to the zap request in the description
+// tag and be for its amount, and the p and e tags must be those of the request.
+func ParseReceipt(ev *event.T, nostrPubkey B) (r *Receipt, err E) {
+	if ev.Kind == nil || !ev.Kind.Equal(kind.Zap) {
+		return nil, Errorf.E("event is not a zap receipt")
+	}
+	if !Equals(ev.PubKey, nostrPubkey) {
+		return nil, Errorf.E("zap receipt is not signed by the lnurl provider")
+	}
+	var valid bool
+	if valid, err = ev.Verify(); err != nil || !valid {
+		return nil, Errorf.E("zap receipt has an invalid signature")
+	}
+	var v []B
+	if v, err = first(ev, "description"); err != nil || v == nil {
+		return nil, Errorf.E("zap receipt needs one description tag")
+	}
+	description := v[0]
+	req := &event.T{}
+	if _, err = req.UnmarshalJSON(append(B{}, description...)); err != nil {
+		return nil, Errorf.E("invalid zap request in zap receipt: %w", err)
+	}
+	r = &Receipt{Sender: req.PubKey}
+	if r.Request, err = ParseRequest(req); err != nil {
+		return nil, err
+	}
+	if v, err = first(ev, "bolt11"); err != nil || v == nil {
+		return nil, Errorf.E("zap receipt needs one bolt11 tag")
+	}
+	if r.Invoice, err = bolt11.Decode(S(v[0])); err != nil {
+		return nil, err
+	}
+	if err = checkInvoice(r.Invoice, description, r.MSat); err != nil {
+		return nil, err
+	}
+	if r.MSat == 0 {
+		r.MSat = r.Invoice.MSat
+	}
+	if v, err = first(ev, "p"); err != nil || v == nil || S(v[0]) != hex.Enc(r.Recipient) {
+		return nil, Errorf.E("zap receipt p tag is not the recipient of the request")
+	}
+	if v, err = first(ev, "e"); err != nil {
+		return nil, err
+	}
+	if (v == nil) != (r.Event == nil) || (v != nil && S(v[0]) != hex.Enc(r.Event)) {
+		return nil, Errorf.E("zap receipt e tag is not the event of the request")
+	}
+	if v, err = first(ev, "preimage"); err != nil {
+		return nil, err
+	}
+	if v != nil {
+		if r.Preimage, err = hex.Dec(S(v[0])); err != nil {
+			return nil, Errorf.E("invalid preimage")
+		}
+		if h := sha256.Sum256(r.Preimage); !Equals(h[:], r.Invoice.PaymentHash) {
+			return nil, Errorf.E("preimage does not match the payment hash")
+		}
+	}
+	return
+}
+
+// Verify validates a zap receipt against the nostrPubkey of the LNURL provider of
+// the lnurl of its zap request. The lnurl tag is optional, so lud is the lud16
+// or lud06 of the profile of the recipient, used when the zap request has no
+// lnurl, and may be empty if it is not known.
+func Verify(c Ctx, ev *event.T, lud S, opts ...httpclient.Option) (r *Receipt,
+	err E) {
+	var v []B
+	if v, err = first(ev, "description"); err != nil || v == nil {
+		return nil, Errorf.E("zap receipt needs one description tag")
+	}
+	req := &event.T{}
+	if _, err = req.UnmarshalJSON(append(B{}, v[0]...)); err != nil {
+		return nil, Errorf.E("invalid zap request in zap receipt: %w", err)
+	}
+	if v, err = first(req, "lnurl"); err != nil {
+		return
+	}
+	if v != nil {
+		lud = S(v[0])
+	}
+	if lud == "" {
+		return nil, Errorf.E("zap request has no lnurl and the recipient has no " +
+			"lud16 or lud06 to find the provider")
+	}
+	var p *PayParams
+	if p, err = FetchPayParams(c, lud, opts...); err != nil {
+		return
+	}
+	var pub B
+	if pub, err = hex.Dec(p.NostrPubkey); err != nil || len(pub) != 32 {
+		return nil, Errorf.E("lnurl provider has no valid nostrPubkey")
+	}
+	return ParseReceipt(ev, pub)
+}
@@ -0,0 +1,218 @@
+package zap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	. "nostr.mleku.dev"
+
+	"github.com/minio/sha256-simd"
+	"lukechampine.com/frand"
+	"nostr.mleku.dev/codec/bolt11"
+	"nostr.mleku.dev/codec/event"
+	"nostr.mleku.dev/codec/kind"
+	"nostr.mleku.dev/codec/tag"
+	"nostr.mleku.dev/codec/tags"
+	"nostr.mleku.dev/codec/timestamp"
+	"nostr.mleku.dev/crypto/p256k"
+	"nostr.mleku.dev/protocol/httpclient"
+	"util.mleku.dev/hex"
+)
+
+// provider is a fake LNURL provider with zap support for alice@example.com.
+type provider struct {
+	t        *testing.T
+	signer   *p256k.Signer
+	node     B
+	mx       sync.Mutex
+	requests map[S]B // zap request by invoice
+	preimage map[S]B
+}
+
+func newProvider(t *testing.T) (p *provider) {
+	p = &provider{t: t, signer: &p256k.Signer{}, node: frand.Bytes(32),
+		requests: make(map[S]B), preimage: make(map[S]B)}
+	if err := p.signer.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func (p *provider) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	return w.Result(), nil
+}
+
+func (p *provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Host + r.URL.Path {
+	case "example.com/.well-known/lnurlp/alice":
+		json.NewEncoder(w).Encode(&PayParams{Tag: "payRequest",
+			Callback: "https://example.com/callback", MinSendable: 1000,
+			MaxSendable: 100_000_000, Metadata: `[["text/plain","alice"]]`,
+			AllowsNostr: true, NostrPubkey: hex.Enc(p.signer.Pub())})
+	case "example.com/callback":
+		msat, _ := strconv.ParseInt(r.URL.Query().Get("amount"), 10, 64)
+		nostr := B(r.URL.Query().Get("nostr"))
+		req := &event.T{}
+		if _, err := req.UnmarshalJSON(append(B{}, nostr...)); err != nil {
+			w.Write(B(`{"status":"ERROR","reason":"invalid zap request"}`))
+			return
+		}
+		if _, err := ParseRequest(req); err != nil {
+			w.Write(B(`{"status":"ERROR","reason":"` + err.Error() + `"}`))
+			return
+		}
+		preimage := frand.Bytes(32)
+		ph, dh := sha256.Sum256(preimage), sha256.Sum256(nostr)
+		inv := &bolt11.T{Network: "bc", MSat: msat, Timestamp: timestamp.Now().I64(),
+			PaymentHash: ph[:], DescriptionHash: dh[:], Expiry: bolt11.DefaultExpiry,
+			MinFinalCLTV: bolt11.DefaultMinFinalCLTV}
+		pr, err := inv.Encode(p.node)
+		if err != nil {
+			p.t.Error(err)
+		}
+		p.mx.Lock()
+		p.requests[pr], p.preimage[pr] = nostr, preimage
+		p.mx.Unlock()
+		json.NewEncoder(w).Encode(map[S]S{"pr": pr})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// pay pays an invoice and returns the zap receipt the provider publishes.
+func (p *provider) pay(pr S) (ev *event.T) {
+	p.mx.Lock()
+	description, preimage := p.requests[pr], p.preimage[pr]
+	p.mx.Unlock()
+	req := &event.T{}
+	if _, err := req.UnmarshalJSON(append(B{}, description...)); err != nil {
+		p.t.Fatal(err)
+	}
+	t := tags.New()
+	for _, k := range []S{"p", "e", "a"} {
+		if v, _ := first(req, k); v != nil {
+			t.T = append(t.T, tag.New(B(k), v[0]))
+		}
+	}
+	t.T = append(t.T, tag.New("P", hex.Enc(req.PubKey)), tag.New("bolt11", pr),
+		tag.New(B("description"), description), tag.New("preimage", hex.Enc(preimage)))
+	ev = &event.T{CreatedAt: timestamp.Now(), Kind: kind.Zap, Tags: t}
+	if err := ev.Sign(p.signer); err != nil {
+		p.t.Fatal(err)
+	}
+	return
+}
+
+func TestLNURL(t *testing.T) {
+	lnurl, err := EncodeLNURL("https://example.com/.well-known/lnurlp/alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []S{lnurl, "lightning:" + lnurl, "alice@example.com",
+		"https://example.com/.well-known/lnurlp/alice"} {
+		var u S
+		if u, err = URL(s); err != nil {
+			t.Fatal(err)
+		}
+		if u != "https://example.com/.well-known/lnurlp/alice" {
+			t.Fatalf("%s: got %s", s, u)
+		}
+	}
+	for _, s := range []S{"alice", "@example.com", "lnurl1xyz", "ftp://example.com"} {
+		if _, err = URL(s); err == nil {
+			t.Fatalf("expected an error for '%s'", s)
+		}
+	}
+}
+
+func TestZap(t *testing.T) {
+	p := newProvider(t)
+	opt := httpclient.WithTransport(p)
+	c := context.Background()
+	sender, recipient := &p256k.Signer{}, &p256k.Signer{}
+	sender.Generate()
+	recipient.Generate()
+	params, err := FetchPayParams(c, "alice@example.com", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnurl, _ := EncodeLNURL("https://example.com/.well-known/lnurlp/alice")
+	zapped := frand.Bytes(32)
+	r := &Request{Recipient: recipient.Pub(), Event: zapped, MSat: 21_000,
+		Relays: []S{"wss://relay.example.com"}, LNURL: lnurl, Content: "nice"}
+	req, err := r.Sign(sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pr S
+	if pr, err = FetchInvoice(c, params, req, opt); err != nil {
+		t.Fatal(err)
+	}
+	receipt := p.pay(pr)
+	var got *Receipt
+	if got, err = Verify(c, receipt, "", opt); err != nil {
+		t.Fatal(err)
+	}
+	if got.MSat != 21_000 || !Equals(got.Sender, sender.Pub()) ||
+		!Equals(got.Recipient, recipient.Pub()) || !Equals(got.Event, zapped) ||
+		got.Content != "nice" || got.Preimage == nil {
+		t.Fatalf("unexpected receipt %+v", got)
+	}
+	// without an lnurl tag the provider is found from the recipient's lud16.
+	bare := *r
+	bare.LNURL = ""
+	bareReq, _ := bare.Sign(sender)
+	var barePR S
+	if barePR, err = FetchInvoice(c, params, bareReq, opt); err != nil {
+		t.Fatal(err)
+	}
+	bareReceipt := p.pay(barePR)
+	if _, err = Verify(c, bareReceipt, "alice@example.com", opt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Verify(c, bareReceipt, "", opt); err == nil {
+		t.Fatal("expected an error with no lnurl and no lud16")
+	}
+	// a receipt signed by someone else is not valid.
+	if _, err = ParseReceipt(receipt, recipient.Pub()); err == nil {
+		t.Fatal("expected an error for the wrong provider")
+	}
+	// an invoice for another request does not match the description.
+	r.MSat = 42_000
+	req2, _ := r.Sign(sender)
+	pr2, err := FetchInvoice(c, params, req2, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := p.pay(pr)
+	forged.Tags = tags.New()
+	for _, tt := range receipt.Tags.T {
+		if S(tt.Key()) == "bolt11" {
+			tt = tag.New("bolt11", pr2)
+		}
+		forged.Tags.T = append(forged.Tags.T, tt)
+	}
+	forged.Sign(p.signer)
+	if _, err = ParseReceipt(forged, p.signer.Pub()); err == nil {
+		t.Fatal("expected an error for an invoice of another zap request")
+	}
+	// the provider refuses amounts out of range.
+	r.MSat = 1
+	req3, _ := r.Sign(sender)
+	if _, err = FetchInvoice(c, params, req3, opt); err == nil {
+		t.Fatal("expected an error for a too small amount")
+	}
+	// a request without relays is invalid.
+	req.Tags = tags.New(tag.New("p", hex.Enc(recipient.Pub())))
+	req.Sign(sender)
+	if _, err = ParseRequest(req); err == nil {
+		t.Fatal("expected an error for a request without relays")
+	}
+}